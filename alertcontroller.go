@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/level-5-pidgey/MarketMoogle/csv/readertype"
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	"github.com/level-5-pidgey/MarketMoogle/util"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+func (c Controller) getAlertIdFromRequest(r *http.Request) (int, error) {
+	param := chi.URLParam(r, "alertId")
+
+	alertId, err := strconv.Atoi(param)
+	if err != nil {
+		return 0, errors.New("alert id must be a number")
+	}
+
+	return alertId, nil
+}
+
+// readAlertFromRequest
+// Decodes and validates a price alert from the request body. Alerts are enabled and sent as JSON unless the body says
+// otherwise.
+func (c Controller) readAlertFromRequest(w http.ResponseWriter, r *http.Request) (*db.PriceAlert, error) {
+	alert := db.PriceAlert{Enabled: true, Format: db.AlertFormatJson}
+	err := util.ReadJSON(w, r, &alert)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := (*c.worlds)[alert.WorldId]; !ok {
+		return nil, errors.New("world does not exist")
+	}
+
+	// Currencies can be given the same way as in the currency routes, e.g. "purplecrafters"
+	if alert.Kind == db.AlertCurrencyValue {
+		if currency := readertype.FromApiParam(alert.Currency); currency != readertype.DefaultCurrency {
+			alert.Currency = currency.String()
+		}
+	} else {
+		alert.Currency = ""
+	}
+
+	err = c.profitCalc.ValidateAlert(&alert)
+	if err != nil {
+		return nil, err
+	}
+
+	return &alert, nil
+}
+
+func writeAlertError(w http.ResponseWriter, err error) {
+	if errors.Is(err, db.ErrAlertNotFound) {
+		util.ErrorJSON(w, err, http.StatusNotFound)
+		return
+	}
+
+	util.ErrorJSON(w, err, http.StatusInternalServerError)
+}
+
+// reloadAlerts
+// Picks up changed alerts straight away rather than waiting for the monitor's next reload
+func (c Controller) reloadAlerts() {
+	if c.alerts == nil {
+		return
+	}
+
+	if err := c.alerts.Reload(); err != nil {
+		log.Printf("failed to reload price alerts: %s\n", err)
+	}
+}
+
+func (c Controller) GetPriceAlerts(w http.ResponseWriter, r *http.Request) {
+	alerts, err := c.repository.GetPriceAlerts()
+	if err != nil {
+		writeAlertError(w, err)
+		return
+	}
+
+	err = util.WriteJSON(w, http.StatusOK, alerts)
+	if err != nil {
+		util.ErrorJSON(w, err, http.StatusInternalServerError)
+	}
+}
+
+func (c Controller) GetPriceAlert(w http.ResponseWriter, r *http.Request) {
+	alertId, err := c.getAlertIdFromRequest(r)
+	if err != nil {
+		util.ErrorJSON(w, err)
+		return
+	}
+
+	alert, err := c.repository.GetPriceAlert(alertId)
+	if err != nil {
+		writeAlertError(w, err)
+		return
+	}
+
+	err = util.WriteJSON(w, http.StatusOK, alert)
+	if err != nil {
+		util.ErrorJSON(w, err, http.StatusInternalServerError)
+	}
+}
+
+func (c Controller) CreatePriceAlert(w http.ResponseWriter, r *http.Request) {
+	alert, err := c.readAlertFromRequest(w, r)
+	if err != nil {
+		util.ErrorJSON(w, err)
+		return
+	}
+
+	created, err := c.repository.CreatePriceAlert(*alert)
+	if err != nil {
+		writeAlertError(w, err)
+		return
+	}
+
+	c.reloadAlerts()
+
+	err = util.WriteJSON(w, http.StatusCreated, created)
+	if err != nil {
+		util.ErrorJSON(w, err, http.StatusInternalServerError)
+	}
+}
+
+func (c Controller) UpdatePriceAlert(w http.ResponseWriter, r *http.Request) {
+	alertId, err := c.getAlertIdFromRequest(r)
+	if err != nil {
+		util.ErrorJSON(w, err)
+		return
+	}
+
+	alert, err := c.readAlertFromRequest(w, r)
+	if err != nil {
+		util.ErrorJSON(w, err)
+		return
+	}
+
+	// The id in the route is the one being updated, regardless of what was sent in the body
+	alert.Id = alertId
+
+	updated, err := c.repository.UpdatePriceAlert(*alert)
+	if err != nil {
+		writeAlertError(w, err)
+		return
+	}
+
+	c.reloadAlerts()
+
+	err = util.WriteJSON(w, http.StatusOK, updated)
+	if err != nil {
+		util.ErrorJSON(w, err, http.StatusInternalServerError)
+	}
+}
+
+func (c Controller) DeletePriceAlert(w http.ResponseWriter, r *http.Request) {
+	alertId, err := c.getAlertIdFromRequest(r)
+	if err != nil {
+		util.ErrorJSON(w, err)
+		return
+	}
+
+	err = c.repository.DeletePriceAlert(alertId)
+	if err != nil {
+		writeAlertError(w, err)
+		return
+	}
+
+	c.reloadAlerts()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetAlertDeliveries
+// The most recent webhooks sent for an alert, newest first
+func (c Controller) GetAlertDeliveries(w http.ResponseWriter, r *http.Request) {
+	alertId, err := c.getAlertIdFromRequest(r)
+	if err != nil {
+		util.ErrorJSON(w, err)
+		return
+	}
+
+	if _, err = c.repository.GetPriceAlert(alertId); err != nil {
+		writeAlertError(w, err)
+		return
+	}
+
+	deliveries, err := c.repository.GetAlertDeliveries(alertId)
+	if err != nil {
+		writeAlertError(w, err)
+		return
+	}
+
+	err = util.WriteJSON(w, http.StatusOK, deliveries)
+	if err != nil {
+		util.ErrorJSON(w, err, http.StatusInternalServerError)
+	}
+}
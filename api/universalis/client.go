@@ -0,0 +1,417 @@
+package universalis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBaseUrl = "https://universalis.app/api/v2"
+
+	// Universalis allows 25 requests a second and 8 open connections from each IP, so stay a little under
+	DefaultRequestsPerSecond = 20
+	DefaultBurst             = 20
+	DefaultMaxConnections    = 8
+
+	DefaultMaxAttempts = 5
+	DefaultRetryDelay  = time.Second
+	DefaultTimeout     = 30 * time.Second
+
+	maxRetryDelay = time.Minute
+
+	// The most item ids Universalis takes in a single request
+	maxItemsPerRequest = 100
+
+	// How much of an error response is kept in an ApiError
+	maxErrorBodyLength = 200
+)
+
+// ErrNotFound is matched by errors for items, worlds or data centers Universalis doesn't know about
+var ErrNotFound = errors.New("not found on universalis")
+
+// ApiError
+// Universalis responded to a request with an error status
+type ApiError struct {
+	StatusCode int
+	Url        string
+	// The start of the response body
+	Message string
+}
+
+func (e *ApiError) Error() string {
+	return fmt.Sprintf("universalis responded with %d to %s: %s", e.StatusCode, e.Url, e.Message)
+}
+
+func (e *ApiError) Is(target error) bool {
+	return target == ErrNotFound && e.StatusCode == http.StatusNotFound
+}
+
+// Retryable
+// Whether the same request could work later: Universalis is rate limiting us, or is down
+func (e *ApiError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// DecodeError
+// Universalis responded successfully, but not with what was asked for. Asking again would get the same response back.
+type DecodeError struct {
+	Url string
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("failed to decode response from %s: %s", e.Url, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// MarketOptions
+// What to include in market data. Zero values leave it up to Universalis, which includes every listing.
+type MarketOptions struct {
+	// How many listings to include for each item
+	Listings int
+	// How many recent sales to include for each item
+	Entries int
+}
+
+func (o MarketOptions) query() url.Values {
+	query := url.Values{}
+	if o.Listings > 0 {
+		query.Set("listings", strconv.Itoa(o.Listings))
+	}
+
+	if o.Entries > 0 {
+		query.Set("entries", strconv.Itoa(o.Entries))
+	}
+
+	return query
+}
+
+// multiItemResponse
+// What Universalis sends back when asked for more than one item at once
+type multiItemResponse struct {
+	Items           map[string]Entry `json:"items"`
+	UnresolvedItems []int            `json:"unresolvedItems"`
+}
+
+// Client
+// Makes requests to the Universalis REST API, keeping to its rate limits and retrying when it's busy or down
+type Client struct {
+	// Where the API lives, DefaultBaseUrl unless pointed somewhere else
+	BaseUrl string
+	// How many times a request is tried before giving up
+	MaxAttempts int
+	// How long to wait before the first retry, doubling for each one after
+	RetryDelay time.Duration
+	// How long a single attempt can take
+	Timeout time.Duration
+	// Every response is written to this, if it's set
+	Recorder *Recorder
+
+	httpClient  *http.Client
+	limiter     *tokenBucket
+	connections chan struct{}
+}
+
+// NewClient
+// A client for the API at the given base url, or DefaultBaseUrl if it's empty
+func NewClient(baseUrl string) *Client {
+	if baseUrl == "" {
+		baseUrl = DefaultBaseUrl
+	}
+
+	return &Client{
+		BaseUrl:     strings.TrimRight(baseUrl, "/"),
+		MaxAttempts: DefaultMaxAttempts,
+		RetryDelay:  DefaultRetryDelay,
+		Timeout:     DefaultTimeout,
+		httpClient:  &http.Client{},
+		limiter:     newTokenBucket(DefaultRequestsPerSecond, DefaultBurst),
+		connections: make(chan struct{}, DefaultMaxConnections),
+	}
+}
+
+// SetRateLimit
+// Changes how many requests can be made each second, and how many can be made at once after a quiet spell
+func (c *Client) SetRateLimit(requestsPerSecond float64, burst int) {
+	c.limiter = newTokenBucket(requestsPerSecond, burst)
+}
+
+// MarketData
+// Current listings and recent sales of items on a world, data center or region (by name or id), keyed by item id.
+// Items are requested as many at a time as Universalis allows. Items it doesn't know about are left out.
+func (c *Client) MarketData(
+	ctx context.Context,
+	scope string,
+	itemIds []int,
+	options MarketOptions,
+) (map[int]*Entry, error) {
+	entries := make(map[int]*Entry, len(itemIds))
+
+	for start := 0; start < len(itemIds); start += maxItemsPerRequest {
+		chunk := itemIds[start:min(start+maxItemsPerRequest, len(itemIds))]
+
+		ids := make([]string, 0, len(chunk))
+		for _, itemId := range chunk {
+			ids = append(ids, strconv.Itoa(itemId))
+		}
+
+		path := fmt.Sprintf("/%s/%s", url.PathEscape(scope), strings.Join(ids, ","))
+
+		// Asking for a single item gets it back on its own rather than in a map
+		if len(chunk) == 1 {
+			var entry Entry
+			err := c.get(ctx, path, options.query(), &entry)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			entry.Item = chunk[0]
+			entries[entry.Item] = &entry
+			continue
+		}
+
+		var response multiItemResponse
+		if err := c.get(ctx, path, options.query(), &response); err != nil {
+			return nil, err
+		}
+
+		for key, entry := range response.Items {
+			itemId, err := strconv.Atoi(key)
+			if err != nil {
+				continue
+			}
+
+			entry.Item = itemId
+			entries[itemId] = &entry
+		}
+	}
+
+	return entries, nil
+}
+
+// ItemMarketData
+// Current listings and recent sales of a single item, or ErrNotFound if Universalis doesn't know about it
+func (c *Client) ItemMarketData(ctx context.Context, scope string, itemId int, options MarketOptions) (*Entry, error) {
+	entries, err := c.MarketData(ctx, scope, []int{itemId}, options)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, ok := entries[itemId]
+	if !ok {
+		return nil, fmt.Errorf("item %d on %s: %w", itemId, scope, ErrNotFound)
+	}
+
+	return entry, nil
+}
+
+// RecentlyUpdated
+// The items most recently uploaded to a world, newest first
+func (c *Client) RecentlyUpdated(ctx context.Context, worldId, entries int) (*RecentlyUpdated, error) {
+	query := url.Values{}
+	query.Set("world", strconv.Itoa(worldId))
+	query.Set("entries", strconv.Itoa(entries))
+
+	var recent RecentlyUpdated
+	if err := c.get(ctx, "/extra/stats/most-recently-updated", query, &recent); err != nil {
+		return nil, err
+	}
+
+	return &recent, nil
+}
+
+// get
+// Fetches and decodes a JSON response, retrying with a growing delay while Universalis is busy or down, or the
+// connection to it fails. Anything else would fail the same way again, so it isn't retried.
+func (c *Client) get(ctx context.Context, path string, query url.Values, out any) error {
+	requestUrl := c.BaseUrl + path
+	if len(query) > 0 {
+		requestUrl += "?" + query.Encode()
+	}
+
+	maxAttempts := max(c.MaxAttempts, 1)
+	for attempt := 1; ; attempt++ {
+		retryAfter, retryable, err := c.attempt(ctx, requestUrl, out)
+		if err == nil {
+			return nil
+		}
+
+		// Our own context ending isn't something to retry
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if !retryable || attempt >= maxAttempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.retryDelay(attempt, retryAfter)):
+		}
+	}
+}
+
+// attempt
+// Makes a single request once the rate limit allows. If it fails, also returns how long Universalis asked us to wait
+// and whether trying again could work: the connection failed, or Universalis is rate limiting us or is down.
+func (c *Client) attempt(ctx context.Context, requestUrl string, out any) (time.Duration, bool, error) {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return 0, false, err
+	}
+
+	select {
+	case c.connections <- struct{}{}:
+	case <-ctx.Done():
+		return 0, false, ctx.Err()
+	}
+	defer func() {
+		<-c.connections
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestUrl, nil)
+	if err != nil {
+		return 0, false, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "MarketMoogle")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, true, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyLength))
+		c.record(requestUrl, resp.StatusCode, body)
+
+		apiErr := &ApiError{
+			StatusCode: resp.StatusCode,
+			Url:        requestUrl,
+			Message:    strings.TrimSpace(string(body)),
+		}
+
+		return parseRetryAfter(resp.Header.Get("Retry-After")), apiErr.Retryable(), apiErr
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, true, fmt.Errorf("failed to read response from %s: %w", requestUrl, err)
+	}
+
+	c.record(requestUrl, resp.StatusCode, body)
+
+	if err = json.Unmarshal(body, out); err != nil {
+		return 0, false, &DecodeError{Url: requestUrl, Err: err}
+	}
+
+	return 0, false, nil
+}
+
+// record
+// Writes a response to the recorder, if there is one, against its path and query so it can be replayed from anywhere
+func (c *Client) record(requestUrl string, statusCode int, body []byte) {
+	if c.Recorder != nil {
+		c.Recorder.RecordResponse(strings.TrimPrefix(requestUrl, c.BaseUrl), statusCode, body)
+	}
+}
+
+// retryDelay
+// Doubles the delay for each attempt with up to 50% jitter, or waits as long as Universalis asked if that's longer
+func (c *Client) retryDelay(attempt int, retryAfter time.Duration) time.Duration {
+	delay := c.RetryDelay << min(attempt-1, 30)
+	if delay <= 0 || delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+
+	delay += time.Duration(rand.Int63n(int64(delay)/2 + 1))
+
+	return max(delay, min(retryAfter, maxRetryDelay))
+}
+
+// parseRetryAfter
+// Reads a Retry-After header, which is either a number of seconds or a date
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+
+	if date, err := http.ParseTime(header); err == nil {
+		return max(time.Until(date), 0)
+	}
+
+	return 0
+}
+
+// tokenBucket
+// Lets through up to burst requests at once, refilling at rate requests a second
+type tokenBucket struct {
+	mutex  sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{
+		rate:   max(rate, 0.001),
+		burst:  float64(max(burst, 1)),
+		tokens: float64(max(burst, 1)),
+		last:   time.Now(),
+	}
+}
+
+// Wait
+// Blocks until a request is allowed or the context ends
+func (b *tokenBucket) Wait(ctx context.Context) error {
+	for {
+		b.mutex.Lock()
+		now := time.Now()
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mutex.Unlock()
+			return nil
+		}
+
+		wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package universalis
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient
+// A client for a local server that retries straight away
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client := NewClient(server.URL)
+	client.RetryDelay = time.Millisecond
+	client.MaxAttempts = 3
+
+	return client
+}
+
+func TestClient_MarketData(t *testing.T) {
+	var requests []string
+	client := newTestClient(
+		t, func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r.URL.RequestURI())
+
+			switch r.URL.Path {
+			case "/light/5057":
+				_, _ = w.Write([]byte(`{"itemID":5057,"listings":[{"listingID":"a","pricePerUnit":100,"quantity":2,"total":200,"worldID":63}]}`))
+			case "/light/5057,5058,5059":
+				_, _ = w.Write(
+					[]byte(`{"itemIDs":[5057,5058,5059],"items":{"5057":{"itemID":5057},"5058":{"itemID":5058}},"unresolvedItems":[5059]}`),
+				)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		},
+	)
+
+	entry, err := client.ItemMarketData(context.Background(), "light", 5057, MarketOptions{Listings: 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listings := entry.ConvertToDbListings()
+	if len(*listings) != 1 || (*listings)[0].ItemId != 5057 || (*listings)[0].WorldId != 63 {
+		t.Errorf("ItemMarketData() listings = %+v, want the listing on world 63", *listings)
+	}
+
+	if requests[0] != "/light/5057?listings=40" {
+		t.Errorf("ItemMarketData() requested %s, want the listings option in the query", requests[0])
+	}
+
+	entries, err := client.MarketData(context.Background(), "light", []int{5057, 5058, 5059}, MarketOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := entries[5059]; len(entries) != 2 || ok {
+		t.Errorf("MarketData() = %v, want the two items Universalis knows about", entries)
+	}
+
+	if _, err = client.ItemMarketData(context.Background(), "light", 1, MarketOptions{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ItemMarketData() error = %v, want ErrNotFound for an unknown item", err)
+	}
+}
+
+func TestClient_MarketDataInChunks(t *testing.T) {
+	var requests atomic.Int32
+	client := newTestClient(
+		t, func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+
+			if ids := strings.Split(strings.TrimPrefix(r.URL.Path, "/63/"), ","); len(ids) > maxItemsPerRequest {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			_, _ = w.Write([]byte(`{"items":{}}`))
+		},
+	)
+
+	itemIds := make([]int, 250)
+	for index := range itemIds {
+		itemIds[index] = index + 1
+	}
+
+	if _, err := client.MarketData(context.Background(), "63", itemIds, MarketOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := requests.Load(); got != 3 {
+		t.Errorf("MarketData() made %d requests for 250 items, want 3", got)
+	}
+}
+
+func TestClient_Retries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantErr      bool
+		wantStatus   int
+		wantRequests int32
+	}{
+		{
+			name:         "Rate limited then succeeds",
+			statuses:     []int{http.StatusTooManyRequests, http.StatusOK},
+			wantRequests: 2,
+		},
+		{
+			name:         "Down until out of attempts",
+			statuses:     []int{522, 522, 522, 522},
+			wantErr:      true,
+			wantStatus:   522,
+			wantRequests: 3,
+		},
+		{
+			name:         "Bad request isn't retried",
+			statuses:     []int{http.StatusBadRequest, http.StatusOK},
+			wantErr:      true,
+			wantStatus:   http.StatusBadRequest,
+			wantRequests: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				var requests atomic.Int32
+				client := newTestClient(
+					t, func(w http.ResponseWriter, r *http.Request) {
+						status := tt.statuses[requests.Add(1)-1]
+						if status == http.StatusTooManyRequests {
+							w.Header().Set("Retry-After", "0")
+						}
+
+						w.WriteHeader(status)
+						if status == http.StatusOK {
+							_, _ = w.Write([]byte(`{"items":[]}`))
+						}
+					},
+				)
+
+				_, err := client.RecentlyUpdated(context.Background(), 63, 10)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("RecentlyUpdated() error = %v, wantErr %v", err, tt.wantErr)
+				}
+
+				var apiErr *ApiError
+				if tt.wantErr && (!errors.As(err, &apiErr) || apiErr.StatusCode != tt.wantStatus) {
+					t.Errorf("RecentlyUpdated() error = %v, want an ApiError with status %d", err, tt.wantStatus)
+				}
+
+				if got := requests.Load(); got != tt.wantRequests {
+					t.Errorf("RecentlyUpdated() made %d requests, want %d", got, tt.wantRequests)
+				}
+			},
+		)
+	}
+}
+
+func TestClient_DecodeErrorsArentRetried(t *testing.T) {
+	var requests atomic.Int32
+	client := newTestClient(
+		t, func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			_, _ = w.Write([]byte(`<html>not json</html>`))
+		},
+	)
+
+	_, err := client.RecentlyUpdated(context.Background(), 63, 10)
+
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("RecentlyUpdated() error = %v, want a DecodeError", err)
+	}
+
+	if got := requests.Load(); got != 1 {
+		t.Errorf("RecentlyUpdated() made %d requests, want 1", got)
+	}
+}
+
+func TestClient_Timeout(t *testing.T) {
+	client := newTestClient(
+		t, func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+		},
+	)
+	client.MaxAttempts = 1
+	client.Timeout = 10 * time.Millisecond
+
+	if _, err := client.RecentlyUpdated(context.Background(), 63, 10); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("RecentlyUpdated() error = %v, want the attempt to time out", err)
+	}
+}
+
+func TestClient_TaxRates(t *testing.T) {
+	client := newTestClient(
+		t, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.RequestURI() != "/tax-rates?world=63" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			_, _ = w.Write([]byte(`{"Limsa Lominsa":3,"Gridania":5,"Ul'dah":0,"Unknown City":4}`))
+		},
+	)
+
+	rates, err := client.TaxRates(context.Background(), 63)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tax free cities keep their rate of 0, while cities without a retainer city id are left out
+	want := map[int]int{1: 3, 2: 5, 3: 0}
+	if !reflect.DeepEqual(rates, want) {
+		t.Errorf("TaxRates() = %v, want %v", rates, want)
+	}
+}
+
+func Test_parseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   time.Duration
+	}{
+		{name: "Missing", header: "", want: 0},
+		{name: "Seconds", header: "3", want: 3 * time.Second},
+		{name: "Date in the past", header: "Wed, 21 Oct 2015 07:28:00 GMT", want: 0},
+		{name: "Nonsense", header: "soon", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if got := parseRetryAfter(tt.header); got != tt.want {
+					t.Errorf("parseRetryAfter() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func Test_tokenBucket(t *testing.T) {
+	bucket := newTokenBucket(100, 2)
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := bucket.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The burst goes straight through, then each request waits for a token at 100 a second
+	if elapsed := time.Since(start); elapsed < 15*time.Millisecond {
+		t.Errorf("4 requests took %s, want the two after the burst to wait for tokens", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := newTokenBucket(0.001, 1).Wait(ctx); err != nil {
+		t.Errorf("Wait() error = %v, want the first request let through", err)
+	}
+}
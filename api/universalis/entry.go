@@ -9,8 +9,8 @@ var twoYearsAgo = time.Now().AddDate(-2, 0, 0)
 
 type Entry struct {
 	Event         string    `bson:"event"`
-	Item          int       `bson:"item"`
-	World         int       `bson:"world"`
+	Item          int       `bson:"item" json:"itemID"`
+	World         int       `bson:"world" json:"worldID"`
 	Listings      []Listing `bson:"listings"`
 	Sales         []Sale    `bson:"sales"`
 	RecentHistory []Sale    `bson:"recentHistory"` // Because for some godforsaken reason universalis uses a different term for the s
@@ -45,6 +45,7 @@ func (entry *Entry) ConvertToDbListings() *[]db.Listing {
 			RetainerName:  listing.RetainerName,
 			RetainerCity:  listing.RetainerCity,
 			LastReview:    now,
+			Tax:           listing.Tax,
 		}
 	}
 
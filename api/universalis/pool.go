@@ -0,0 +1,103 @@
+package universalis
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// WebsocketPool
+// Spreads the subscriptions for many worlds over a handful of websocket connections, rather than opening one for
+// every world. Events say which world they're for, so they can all be handled the same way.
+type WebsocketPool struct {
+	clients []*WebsocketClient
+	// The worlds subscribed to on each client, in the same order as clients
+	shardWorlds [][]int
+}
+
+// NewWebsocketPool
+// Shares the worlds out between at most the given number of connections, each getting every event for its worlds
+func NewWebsocketPool(worldIds []int, connections int, onEntry func(entry *Entry)) *WebsocketPool {
+	worldIds = slices.Clone(worldIds)
+	slices.Sort(worldIds)
+
+	shards := max(min(connections, len(worldIds)), 1)
+	pool := &WebsocketPool{
+		clients:     make([]*WebsocketClient, 0, shards),
+		shardWorlds: make([][]int, shards),
+	}
+
+	for index, worldId := range worldIds {
+		pool.shardWorlds[index%shards] = append(pool.shardWorlds[index%shards], worldId)
+	}
+
+	for index, shardWorlds := range pool.shardWorlds {
+		channels := make([]string, 0, len(shardWorlds)*len(SubscribedEvents))
+		for _, worldId := range shardWorlds {
+			channels = append(channels, WorldChannels(worldId)...)
+		}
+
+		pool.clients = append(
+			pool.clients,
+			NewWebsocketClient(fmt.Sprintf("shard %d/%d", index+1, shards), channels, onEntry),
+		)
+	}
+
+	return pool
+}
+
+// OnReconnect
+// Sets what's called when a connection comes back, with the worlds it carries and how long it was down for
+func (p *WebsocketPool) OnReconnect(handler func(ctx context.Context, worldIds []int, gap Gap)) {
+	for index, client := range p.clients {
+		worldIds := p.shardWorlds[index]
+		client.OnReconnect = func(ctx context.Context, gap Gap) {
+			handler(ctx, worldIds, gap)
+		}
+	}
+}
+
+// SetUrl
+// Points every connection at another websocket, e.g. a local fake of Universalis
+func (p *WebsocketPool) SetUrl(url string) {
+	for _, client := range p.clients {
+		client.Url = url
+	}
+}
+
+// SetRecorder
+// Records every message received on any connection
+func (p *WebsocketPool) SetRecorder(recorder *Recorder) {
+	for _, client := range p.clients {
+		client.Recorder = recorder
+	}
+}
+
+// Run
+// Keeps every connection open until the context is cancelled
+func (p *WebsocketPool) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, client := range p.clients {
+		wg.Add(1)
+
+		go func(client *WebsocketClient) {
+			defer wg.Done()
+
+			client.Run(ctx)
+		}(client)
+	}
+
+	wg.Wait()
+}
+
+// Status
+// The health of every connection in the pool
+func (p *WebsocketPool) Status() []ConnectionStatus {
+	statuses := make([]ConnectionStatus, 0, len(p.clients))
+	for _, client := range p.clients {
+		statuses = append(statuses, client.Status())
+	}
+
+	return statuses
+}
@@ -0,0 +1,51 @@
+package universalis
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNewWebsocketPool(t *testing.T) {
+	tests := []struct {
+		name        string
+		worldIds    []int
+		connections int
+		want        [][]int
+	}{
+		{
+			name:        "Worlds shared out in order",
+			worldIds:    []int{65, 63, 64, 66, 67},
+			connections: 2,
+			want:        [][]int{{63, 65, 67}, {64, 66}},
+		},
+		{
+			name:        "No more connections than worlds",
+			worldIds:    []int{63},
+			connections: 4,
+			want:        [][]int{{63}},
+		},
+		{
+			name:        "At least one connection",
+			worldIds:    []int{63, 64},
+			connections: 0,
+			want:        [][]int{{63, 64}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				pool := NewWebsocketPool(tt.worldIds, tt.connections, nil)
+
+				if !slices.EqualFunc(pool.shardWorlds, tt.want, slices.Equal[[]int]) {
+					t.Errorf("NewWebsocketPool() shards = %v, want %v", pool.shardWorlds, tt.want)
+				}
+
+				for index, status := range pool.Status() {
+					if len(status.Channels) != len(tt.want[index])*len(SubscribedEvents) {
+						t.Errorf("shard %d subscribes to %v, want every event for its worlds", index, status.Channels)
+					}
+				}
+			},
+		)
+	}
+}
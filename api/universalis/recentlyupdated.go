@@ -0,0 +1,20 @@
+package universalis
+
+import "time"
+
+// RecentlyUpdated
+// The response from /api/v2/extra/stats/most-recently-updated, newest upload first
+type RecentlyUpdated struct {
+	Items []RecentlyUpdatedItem `json:"items"`
+}
+
+type RecentlyUpdatedItem struct {
+	ItemId  int `json:"itemID"`
+	WorldId int `json:"worldID"`
+	// Unix milliseconds
+	LastUploadTime int64 `json:"lastUploadTime"`
+}
+
+func (item RecentlyUpdatedItem) UploadedAt() time.Time {
+	return time.UnixMilli(item.LastUploadTime).UTC()
+}
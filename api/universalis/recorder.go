@@ -0,0 +1,102 @@
+package universalis
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// RecordKind is what was received from Universalis
+type RecordKind string
+
+const (
+	// RecordMessage is a websocket message
+	RecordMessage RecordKind = "message"
+	// RecordResponse is a response from the REST API
+	RecordResponse RecordKind = "response"
+)
+
+// Record
+// Something received from Universalis, exactly as it was sent
+type Record struct {
+	Kind RecordKind `json:"kind"`
+	At   time.Time  `json:"at"`
+	// The connection a message came in on, or the path and query a response was for
+	Source     string `json:"source"`
+	StatusCode int    `json:"status_code,omitempty"`
+	// The raw BSON of a message, or the body of a response
+	Data []byte `json:"data"`
+}
+
+// Recorder
+// Writes everything received from Universalis to a file, one JSON record per line, so it can be replayed later
+type Recorder struct {
+	path string
+
+	mutex   sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+	failed  bool
+}
+
+// NewRecorder
+// Starts recording to a new file in the given directory, named after when recording started
+func NewRecorder(dir string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("universalis-%s.jsonl", time.Now().UTC().Format("20060102-150405")))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording: %w", err)
+	}
+
+	return &Recorder{
+		path:    path,
+		file:    file,
+		encoder: json.NewEncoder(file),
+	}, nil
+}
+
+// Path
+// The file being recorded to
+func (r *Recorder) Path() string {
+	return r.path
+}
+
+// RecordMessage
+// Records a raw websocket message received on the named connection
+func (r *Recorder) RecordMessage(source string, message []byte) {
+	r.write(Record{Kind: RecordMessage, At: time.Now().UTC(), Source: source, Data: message})
+}
+
+// RecordResponse
+// Records the status and body of a response from the REST API, against the path and query it was for
+func (r *Recorder) RecordResponse(request string, statusCode int, body []byte) {
+	r.write(Record{Kind: RecordResponse, At: time.Now().UTC(), Source: request, StatusCode: statusCode, Data: body})
+}
+
+// Close
+// Stops recording. Every record is written as it's made, so nothing is lost if this is never called.
+func (r *Recorder) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.file.Close()
+}
+
+func (r *Recorder) write(record Record) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// Only complain once, rather than for every message after the disk fills up
+	if err := r.encoder.Encode(record); err != nil && !r.failed {
+		r.failed = true
+		log.Printf("failed to write to recording %s: %s\n", r.path, err)
+	}
+}
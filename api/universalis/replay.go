@@ -0,0 +1,173 @@
+package universalis
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// The largest line a recording can have, big enough for a response with every listing of 100 items
+	maxRecordSize = 64 * 1024 * 1024
+
+	// Where a replay client sends its requests, which never leave the process
+	replayBaseUrl = "http://universalis.replay"
+)
+
+// Recording
+// Everything received from Universalis while recording, loaded back from a file
+type Recording struct {
+	messages []Record
+
+	mutex sync.Mutex
+	// Responses for each request, in the order they were received
+	responses map[string][]Record
+}
+
+// LoadRecording
+// Reads a file written by a Recorder
+func LoadRecording(path string) (*Recording, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %w", err)
+	}
+
+	defer file.Close()
+
+	return ReadRecording(file)
+}
+
+// ReadRecording
+// Reads records written by a Recorder, one per line
+func ReadRecording(reader io.Reader) (*Recording, error) {
+	recording := &Recording{
+		messages:  make([]Record, 0),
+		responses: make(map[string][]Record),
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRecordSize)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("failed to read record on line %d: %w", line, err)
+		}
+
+		switch record.Kind {
+		case RecordMessage:
+			recording.messages = append(recording.messages, record)
+		case RecordResponse:
+			recording.responses[record.Source] = append(recording.responses[record.Source], record)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read recording: %w", err)
+	}
+
+	return recording, nil
+}
+
+// MessageCount
+// How many websocket messages there are to replay
+func (r *Recording) MessageCount() int {
+	return len(r.messages)
+}
+
+// Replay
+// Sends every recorded websocket message to onEntry in order, waiting between them as long as Universalis did divided
+// by speed, so 1 is real time and 60 plays an hour back in a minute. Speeds of 0 or less don't wait at all. Returns how
+// many messages were replayed, stopping early if the context is cancelled.
+func (r *Recording) Replay(ctx context.Context, speed float64, onEntry func(entry *Entry)) (int, error) {
+	replayed := 0
+
+	for index, record := range r.messages {
+		if index > 0 && speed > 0 {
+			wait := time.Duration(float64(record.At.Sub(r.messages[index-1].At)) / speed)
+
+			if wait > 0 {
+				select {
+				case <-ctx.Done():
+					return replayed, ctx.Err()
+				case <-time.After(wait):
+				}
+			}
+		}
+
+		if ctx.Err() != nil {
+			return replayed, ctx.Err()
+		}
+
+		var entry Entry
+		if err := bson.Unmarshal(record.Data, &entry); err != nil {
+			log.Printf("failed to unmarshal recorded message from %s: %s\n", record.Source, err)
+			continue
+		}
+
+		onEntry(&entry)
+		replayed++
+	}
+
+	return replayed, nil
+}
+
+// NewReplayClient
+// A client that answers requests from the recording's responses instead of Universalis, so nothing goes over the
+// network. Requests made more than once get their recorded responses in order, then the last one again. Requests that
+// weren't recorded get a 404, as if Universalis didn't know about them.
+func NewReplayClient(recording *Recording) *Client {
+	client := NewClient(replayBaseUrl)
+	client.httpClient = &http.Client{Transport: recording}
+	client.SetRateLimit(math.MaxInt32, math.MaxInt32)
+
+	return client
+}
+
+// RoundTrip
+// Answers a request with its recorded response
+func (r *Recording) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := strings.TrimPrefix(req.URL.String(), replayBaseUrl)
+
+	r.mutex.Lock()
+	responses := r.responses[key]
+	var record *Record
+	if len(responses) > 0 {
+		record = &responses[0]
+		if len(responses) > 1 {
+			r.responses[key] = responses[1:]
+		}
+	}
+	r.mutex.Unlock()
+
+	response := &http.Response{
+		StatusCode: http.StatusNotFound,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader([]byte("not in the recording"))),
+		Request:    req,
+	}
+
+	if record != nil {
+		response.StatusCode = record.StatusCode
+		response.Body = io.NopCloser(bytes.NewReader(record.Data))
+	}
+
+	response.Status = fmt.Sprintf("%d %s", response.StatusCode, http.StatusText(response.StatusCode))
+
+	return response, nil
+}
@@ -0,0 +1,153 @@
+package universalis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRecorder(t *testing.T) {
+	client := newTestClient(
+		t, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/63/5057" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			_, _ = w.Write([]byte(`{"itemID":5057,"listings":[{"listingID":"a","pricePerUnit":100,"quantity":2,"total":200}]}`))
+		},
+	)
+
+	recorder, err := NewRecorder(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.Recorder = recorder
+	if _, err = client.ItemMarketData(context.Background(), "63", 5057, MarketOptions{Entries: 20}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = client.ItemMarketData(context.Background(), "63", 1, MarketOptions{}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("ItemMarketData() error = %v, want ErrNotFound for an unknown item", err)
+	}
+
+	message, _ := bson.Marshal(Entry{Event: "sales/add", Item: 5057, World: 63})
+	recorder.RecordMessage("shard 1/1", message)
+
+	if err = recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	recording, err := LoadRecording(recorder.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Responses are answered without Universalis, unknown items included
+	replayClient := NewReplayClient(recording)
+	entry, err := replayClient.ItemMarketData(context.Background(), "63", 5057, MarketOptions{Entries: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if listings := entry.ConvertToDbListings(); len(*listings) != 1 || (*listings)[0].UniversalisId != "a" {
+		t.Errorf("replayed ItemMarketData() listings = %+v, want the recorded listing", *listings)
+	}
+
+	if _, err = replayClient.ItemMarketData(context.Background(), "63", 1, MarketOptions{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("replayed ItemMarketData() error = %v, want the recorded 404", err)
+	}
+
+	if _, err = replayClient.ItemMarketData(context.Background(), "63", 5058, MarketOptions{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("replayed ItemMarketData() error = %v, want ErrNotFound for a request that wasn't recorded", err)
+	}
+
+	var entries []*Entry
+	replayed, err := recording.Replay(
+		context.Background(), 0, func(entry *Entry) {
+			entries = append(entries, entry)
+		},
+	)
+	if err != nil || replayed != 1 || entries[0].Item != 5057 || entries[0].World != 63 {
+		t.Errorf("Replay() = %d (%v), entries %+v, want the recorded sale", replayed, err, entries)
+	}
+}
+
+// recordingOf
+// A recording of one message for each time, offset from when it started
+func recordingOf(t *testing.T, offsets ...time.Duration) *Recording {
+	t.Helper()
+
+	start := time.Now().UTC()
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	for index, offset := range offsets {
+		message, _ := bson.Marshal(Entry{Event: "listings/add", Item: index + 1, World: 63})
+		_ = encoder.Encode(Record{Kind: RecordMessage, At: start.Add(offset), Source: "shard 1/1", Data: message})
+	}
+
+	// Messages that can't be read are skipped
+	_ = encoder.Encode(Record{Kind: RecordMessage, At: start.Add(offsets[len(offsets)-1]), Data: []byte("nonsense")})
+
+	recording, err := ReadRecording(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return recording
+}
+
+func TestRecording_Replay(t *testing.T) {
+	tests := []struct {
+		name        string
+		speed       float64
+		minDuration time.Duration
+		maxDuration time.Duration
+	}{
+		{name: "As fast as possible", speed: 0, minDuration: 0, maxDuration: 500 * time.Millisecond},
+		{name: "Accelerated", speed: 50, minDuration: 40 * time.Millisecond, maxDuration: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				recording := recordingOf(t, 0, time.Second, 2*time.Second)
+
+				var items []int
+				start := time.Now()
+				replayed, err := recording.Replay(
+					context.Background(), tt.speed, func(entry *Entry) {
+						items = append(items, entry.Item)
+					},
+				)
+				elapsed := time.Since(start)
+
+				if err != nil || replayed != 3 || len(items) != 3 || items[0] != 1 || items[2] != 3 {
+					t.Fatalf("Replay() = %d (%v), items %v, want the 3 messages in order", replayed, err, items)
+				}
+
+				if elapsed < tt.minDuration || elapsed > tt.maxDuration {
+					t.Errorf("Replay() took %s, want between %s and %s", elapsed, tt.minDuration, tt.maxDuration)
+				}
+			},
+		)
+	}
+}
+
+func TestRecording_ReplayCancelled(t *testing.T) {
+	recording := recordingOf(t, 0, time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	replayed, err := recording.Replay(ctx, 1, func(entry *Entry) {})
+	if !errors.Is(err, context.DeadlineExceeded) || replayed != 1 {
+		t.Errorf("Replay() = %d (%v), want to stop after the first message when cancelled", replayed, err)
+	}
+}
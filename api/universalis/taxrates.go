@@ -0,0 +1,45 @@
+package universalis
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+// taxRatesResponse
+// The response from /api/v2/tax-rates, the percentage buyers pay as tax in each city on a world, keyed by city name
+type taxRatesResponse map[string]int
+
+// taxRateCities are the ids Universalis gives retainer cities in listings, keyed by the names tax rates use
+var taxRateCities = map[string]int{
+	"Limsa Lominsa": 1,
+	"Gridania":      2,
+	"Ul'dah":        3,
+	"Ishgard":       4,
+	"Kugane":        7,
+	"Crystarium":    10,
+	"Old Sharlayan": 12,
+	"Tuliyollal":    14,
+}
+
+// TaxRates
+// This week's tax rate (as a percentage) in each city on a world, keyed by the retainer city ids listings use. Cities
+// Universalis doesn't return a rate for are left out rather than treated as tax free.
+func (c *Client) TaxRates(ctx context.Context, worldId int) (map[int]int, error) {
+	query := url.Values{}
+	query.Set("world", strconv.Itoa(worldId))
+
+	var response taxRatesResponse
+	if err := c.get(ctx, "/tax-rates", query, &response); err != nil {
+		return nil, err
+	}
+
+	rates := make(map[int]int, len(response))
+	for name, rate := range response {
+		if city, ok := taxRateCities[name]; ok {
+			rates[city] = rate
+		}
+	}
+
+	return rates, nil
+}
@@ -0,0 +1,340 @@
+package universalis
+
+import (
+	"context"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"gopkg.in/mgo.v2/bson"
+	"log"
+	"math/rand"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultWebsocketUrl = "wss://universalis.app/api/ws"
+
+	DefaultMinBackoff = time.Second
+	DefaultMaxBackoff = 2 * time.Minute
+
+	writeWait = 8 * time.Second
+
+	pongWait = 60 * time.Second
+
+	pingPeriod = (pongWait * 6) / 10
+
+	// How long to wait for Universalis to answer our close message before hanging up anyway
+	closeWait = time.Second
+
+	// A connection has to stay up this long before its failures are forgotten, so a connection that drops straight
+	// after subscribing still backs off
+	stableConnection = time.Minute
+)
+
+// SubscribedEvents are the websocket channels subscribed to for each world
+var SubscribedEvents = []string{"listings/add", "listings/remove", "sales/add", "sales/remove"}
+
+// WorldChannels
+// The channels to subscribe to for every market event on a world, e.g. "listings/add{world=63}"
+func WorldChannels(worldId int) []string {
+	channels := make([]string, 0, len(SubscribedEvents))
+	for _, event := range SubscribedEvents {
+		channels = append(channels, fmt.Sprintf("%s{world=%d}", event, worldId))
+	}
+
+	return channels
+}
+
+// ConnectionState is what a websocket client is currently doing
+type ConnectionState string
+
+const (
+	StateConnecting ConnectionState = "connecting"
+	StateConnected  ConnectionState = "connected"
+	StateBackingOff ConnectionState = "backing_off"
+	StateStopped    ConnectionState = "stopped"
+)
+
+// ConnectionStatus
+// The health of a websocket client's connection
+type ConnectionStatus struct {
+	Name     string          `json:"name"`
+	State    ConnectionState `json:"state"`
+	Channels []string        `json:"channels"`
+	// When the current connection was made, if connected
+	ConnectedSince   *time.Time `json:"connected_since,omitempty"`
+	LastMessageAt    *time.Time `json:"last_message_at,omitempty"`
+	MessagesReceived int64      `json:"messages_received"`
+	Reconnects       int        `json:"reconnects"`
+	// Failed connections since the last one that stayed up
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	LastError           string `json:"last_error,omitempty"`
+	// When the next connection will be tried, if backing off
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+}
+
+// Gap
+// A stretch of time the websocket was down, so events from it were missed
+type Gap struct {
+	From time.Time
+	To   time.Time
+}
+
+// WebsocketClient
+// Keeps a connection to the Universalis websocket subscribed to a set of channels, reconnecting with jittered
+// exponential backoff whenever it drops
+type WebsocketClient struct {
+	// The websocket to connect to, DefaultWebsocketUrl unless pointed somewhere else
+	Url string
+	// Shown in the client's status and logs
+	Name string
+	// Called with every event received. Events are handled one at a time, so this should return quickly.
+	OnEntry func(entry *Entry)
+	// Called in its own goroutine after reconnecting, with how long the connection was down for. The context is
+	// cancelled when the client is stopped.
+	OnReconnect func(ctx context.Context, gap Gap)
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+	// Every message is written to this as it was received, if it's set
+	Recorder *Recorder
+
+	channels []string
+	dialer   *websocket.Dialer
+
+	mutex  sync.Mutex
+	status ConnectionStatus
+}
+
+func NewWebsocketClient(name string, channels []string, onEntry func(entry *Entry)) *WebsocketClient {
+	return &WebsocketClient{
+		Url:        DefaultWebsocketUrl,
+		Name:       name,
+		OnEntry:    onEntry,
+		MinBackoff: DefaultMinBackoff,
+		MaxBackoff: DefaultMaxBackoff,
+		channels:   channels,
+		dialer:     websocket.DefaultDialer,
+		status: ConnectionStatus{
+			Name:     name,
+			State:    StateConnecting,
+			Channels: slices.Clone(channels),
+		},
+	}
+}
+
+// Status
+// A snapshot of the client's connection health
+func (c *WebsocketClient) Status() ConnectionStatus {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	status := c.status
+	status.Channels = slices.Clone(c.status.Channels)
+
+	return status
+}
+
+// Run
+// Connects, subscribes and handles events until the context is cancelled, reconnecting whenever the connection drops
+func (c *WebsocketClient) Run(ctx context.Context) {
+	// When the last good connection dropped, so the gap can be caught up on once reconnected
+	var disconnectedAt time.Time
+	failures := 0
+
+	for {
+		connectedAt, err := c.session(ctx, disconnectedAt)
+		if ctx.Err() != nil {
+			c.updateStatus(
+				func(status *ConnectionStatus) {
+					status.State = StateStopped
+					status.ConnectedSince = nil
+					status.NextAttemptAt = nil
+				},
+			)
+			return
+		}
+
+		if !connectedAt.IsZero() {
+			disconnectedAt = time.Now().UTC()
+			if disconnectedAt.Sub(connectedAt) >= stableConnection {
+				failures = 0
+			}
+		}
+
+		failures++
+		delay := c.backoff(failures)
+		nextAttempt := time.Now().UTC().Add(delay)
+
+		c.updateStatus(
+			func(status *ConnectionStatus) {
+				status.State = StateBackingOff
+				status.ConnectedSince = nil
+				status.ConsecutiveFailures = failures
+				status.LastError = err.Error()
+				status.NextAttemptAt = &nextAttempt
+			},
+		)
+
+		log.Printf("universalis websocket %s disconnected (%s), reconnecting in %s\n", c.Name, err, delay)
+
+		select {
+		case <-ctx.Done():
+			c.updateStatus(
+				func(status *ConnectionStatus) {
+					status.State = StateStopped
+					status.NextAttemptAt = nil
+				},
+			)
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// session
+// Makes a single connection and reads from it until it drops, returning when it was connected (zero if it never was)
+// and why it dropped
+func (c *WebsocketClient) session(ctx context.Context, disconnectedAt time.Time) (time.Time, error) {
+	c.updateStatus(
+		func(status *ConnectionStatus) {
+			status.State = StateConnecting
+			status.NextAttemptAt = nil
+		},
+	)
+
+	conn, _, err := c.dialer.DialContext(ctx, c.Url, nil)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("dial: %w", err)
+	}
+
+	defer conn.Close()
+
+	for _, channel := range c.channels {
+		if err = subscribe(conn, channel); err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	connectedAt := time.Now().UTC()
+	c.updateStatus(
+		func(status *ConnectionStatus) {
+			status.State = StateConnected
+			status.ConnectedSince = &connectedAt
+			if !disconnectedAt.IsZero() {
+				status.Reconnects++
+			}
+		},
+	)
+
+	if !disconnectedAt.IsZero() && c.OnReconnect != nil {
+		go c.OnReconnect(ctx, Gap{From: disconnectedAt, To: connectedAt})
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(
+		func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(pongWait))
+		},
+	)
+
+	// Keep the connection alive, and close it cleanly once we're told to stop
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ticker := time.NewTicker(pingPeriod)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				_ = conn.WriteControl(
+					websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+					time.Now().Add(writeWait),
+				)
+				_ = conn.SetReadDeadline(time.Now().Add(closeWait))
+				return
+			case <-ticker.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+					_ = conn.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		msgType, message, err := conn.ReadMessage()
+		if err != nil {
+			return connectedAt, fmt.Errorf("read: %w", err)
+		}
+
+		if msgType != websocket.BinaryMessage {
+			continue
+		}
+
+		receivedAt := time.Now().UTC()
+		c.updateStatus(
+			func(status *ConnectionStatus) {
+				status.LastMessageAt = &receivedAt
+				status.MessagesReceived++
+			},
+		)
+
+		if c.Recorder != nil {
+			c.Recorder.RecordMessage(c.Name, message)
+		}
+
+		var entry Entry
+		if err = bson.Unmarshal(message, &entry); err != nil {
+			log.Printf("failed to unmarshal universalis message on %s: %s\n", c.Name, err)
+			continue
+		}
+
+		if c.OnEntry != nil {
+			c.OnEntry(&entry)
+		}
+	}
+}
+
+func subscribe(conn *websocket.Conn, channel string) error {
+	message, err := bson.Marshal(
+		map[string]string{
+			"event":   "subscribe",
+			"channel": channel,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("marshal subscription to %s: %w", channel, err)
+	}
+
+	_ = conn.SetWriteDeadline(time.Now().Add(writeWait))
+	if err = conn.WriteMessage(websocket.BinaryMessage, message); err != nil {
+		return fmt.Errorf("subscribe to %s: %w", channel, err)
+	}
+
+	return nil
+}
+
+// backoff
+// Doubles the wait for each failure in a row up to MaxBackoff, then picks somewhere between half and all of it, so
+// clients that dropped together don't all reconnect at once
+func (c *WebsocketClient) backoff(failures int) time.Duration {
+	delay := c.MinBackoff << min(failures-1, 30)
+	if delay <= 0 || delay > c.MaxBackoff {
+		delay = c.MaxBackoff
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay)/2+1))
+}
+
+func (c *WebsocketClient) updateStatus(update func(status *ConnectionStatus)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	update(&c.status)
+}
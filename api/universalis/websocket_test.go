@@ -0,0 +1,174 @@
+package universalis
+
+import (
+	"context"
+	"github.com/gorilla/websocket"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeUniversalis
+// Accepts websocket connections, keeping every subscription it's sent. Each connection is sent an entry once it has
+// subscribed to everything, then dropped straight away unless it's the last connection the test expects.
+type fakeUniversalis struct {
+	t           *testing.T
+	channels    int
+	connections int
+
+	mutex         sync.Mutex
+	subscriptions []string
+	connected     int
+}
+
+func (f *fakeUniversalis) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		f.t.Errorf("failed to upgrade: %s", err)
+		return
+	}
+	defer conn.Close()
+
+	for i := 0; i < f.channels; i++ {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var subscription map[string]string
+		if err = bson.Unmarshal(message, &subscription); err != nil || subscription["event"] != "subscribe" {
+			f.t.Errorf("expected a subscription, got %v (%v)", subscription, err)
+			return
+		}
+
+		f.mutex.Lock()
+		f.subscriptions = append(f.subscriptions, subscription["channel"])
+		f.mutex.Unlock()
+	}
+
+	f.mutex.Lock()
+	f.connected++
+	last := f.connected >= f.connections
+	f.mutex.Unlock()
+
+	entry, _ := bson.Marshal(Entry{Event: "sales/add", Item: 5057, World: 63})
+	if err = conn.WriteMessage(websocket.BinaryMessage, entry); err != nil {
+		return
+	}
+
+	if !last {
+		return
+	}
+
+	// Wait for the client to hang up
+	for {
+		if _, _, err = conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func TestWebsocketClient_Run(t *testing.T) {
+	channels := WorldChannels(63)
+	fake := &fakeUniversalis{t: t, channels: len(channels), connections: 2}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	entries := make(chan *Entry, 4)
+	gaps := make(chan Gap, 2)
+
+	client := NewWebsocketClient(
+		"Ultros", channels, func(entry *Entry) {
+			entries <- entry
+		},
+	)
+	client.Url = "ws" + strings.TrimPrefix(server.URL, "http")
+	client.MinBackoff = time.Millisecond
+	client.MaxBackoff = 10 * time.Millisecond
+	client.OnReconnect = func(ctx context.Context, gap Gap) {
+		gaps <- gap
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		client.Run(ctx)
+	}()
+
+	for i := 0; i < fake.connections; i++ {
+		select {
+		case entry := <-entries:
+			if entry.Item != 5057 || entry.World != 63 {
+				t.Errorf("OnEntry() got %+v, want the sale sent by the server", entry)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("only got %d entries, want one per connection", i)
+		}
+	}
+
+	select {
+	case gap := <-gaps:
+		if gap.To.Before(gap.From) {
+			t.Errorf("OnReconnect() got a gap ending before it started: %+v", gap)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("OnReconnect() was never called")
+	}
+
+	status := client.Status()
+	if status.State != StateConnected || status.Reconnects != 1 || status.MessagesReceived != 2 {
+		t.Errorf("Status() = %+v, want connected after 1 reconnect and 2 messages", status)
+	}
+
+	fake.mutex.Lock()
+	if len(fake.subscriptions) != len(channels)*fake.connections {
+		t.Errorf("client subscribed to %v, want every channel again after reconnecting", fake.subscriptions)
+	}
+	fake.mutex.Unlock()
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Run() didn't return after the context was cancelled")
+	}
+
+	if state := client.Status().State; state != StateStopped {
+		t.Errorf("Status().State = %s after stopping, want %s", state, StateStopped)
+	}
+}
+
+func TestWebsocketClient_backoff(t *testing.T) {
+	client := NewWebsocketClient("Ultros", nil, nil)
+	client.MinBackoff = time.Second
+	client.MaxBackoff = time.Minute
+
+	tests := []struct {
+		name     string
+		failures int
+		// The most the backoff can be before jitter is applied
+		ceiling time.Duration
+	}{
+		{name: "First failure", failures: 1, ceiling: time.Second},
+		{name: "Doubles each failure", failures: 4, ceiling: 8 * time.Second},
+		{name: "Capped at the max", failures: 20, ceiling: time.Minute},
+		{name: "Doesn't overflow", failures: 100, ceiling: time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				for i := 0; i < 20; i++ {
+					if got := client.backoff(tt.failures); got < tt.ceiling/2 || got > tt.ceiling {
+						t.Fatalf("backoff(%d) = %s, want between %s and %s", tt.failures, got, tt.ceiling/2, tt.ceiling)
+					}
+				}
+			},
+		)
+	}
+}
@@ -1,23 +1,60 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
+	"github.com/level-5-pidgey/MarketMoogle/api/universalis"
 	dc "github.com/level-5-pidgey/MarketMoogle/csv/datacollection"
 	"github.com/level-5-pidgey/MarketMoogle/csv/readertype"
+	"github.com/level-5-pidgey/MarketMoogle/db"
 	profitCalc "github.com/level-5-pidgey/MarketMoogle/profit"
+	"github.com/level-5-pidgey/MarketMoogle/stream"
 	"github.com/level-5-pidgey/MarketMoogle/util"
 	"net/http"
-	"sort"
 	"strconv"
 	"strings"
-	"sync"
+	"time"
 )
 
 type Controller struct {
 	dataCollection *dc.DataCollection
 	worlds         *map[int]*readertype.World
 	profitCalc     *profitCalc.ProfitCalculator
+	repository     db.Repository
+	leaderboard    *profitCalc.ProfitLeaderboard
+	alerts         *profitCalc.AlertMonitor
+	marketStream   *stream.Hub
+	marketFeeds    *universalis.WebsocketPool
+	// Shared by every request, so only so many on demand calculations can run at once
+	onDemandSlots chan struct{}
+}
+
+// profitWorkers is how many items have their profit calculated at once for a single request
+const profitWorkers = 8
+
+// maxOnDemandCalculations is how many requests can calculate profits for a customised player at the same time
+const maxOnDemandCalculations = 2
+
+// errTooManyCalculations is returned when every on demand calculation slot is in use
+var errTooManyCalculations = errors.New("too many custom profit calculations are running, try again shortly")
+
+// calculateOnDemand
+// Calculates profits for a customised player, unless too many other requests are already doing so
+func (c Controller) calculateOnDemand(
+	items []*profitCalc.Item,
+	playerInfo *profitCalc.PlayerInfo,
+) ([]*profitCalc.ProfitInfo, []error, error) {
+	select {
+	case c.onDemandSlots <- struct{}{}:
+		defer func() { <-c.onDemandSlots }()
+	default:
+		return nil, nil, errTooManyCalculations
+	}
+
+	results, errs := c.profitCalc.CalculateProfitForItems(items, playerInfo, profitWorkers)
+
+	return results, errs, nil
 }
 
 func (c Controller) getDcIdFromWorldId(queryWorldId int) int {
@@ -48,197 +85,578 @@ func (c Controller) getWorldIdFromRequest(r *http.Request) int {
 	return 0
 }
 
+// getPlayerInfoFromRequest
+// Builds the player used for profit calculations. Starts from the stored profile if a "profile" id is given (or the
+// default max level player if not), then applies any jobs, gcRank, skipCrystals, recipeBooks, specialists, stats or
+// retainerCity query overrides.
+func (c Controller) getPlayerInfoFromRequest(r *http.Request) (*profitCalc.PlayerInfo, error) {
+	query := r.URL.Query()
+	worldId := c.getWorldIdFromRequest(r)
+
+	var playerInfo *profitCalc.PlayerInfo
+	if profileParam := query.Get("profile"); profileParam != "" {
+		profileId, err := strconv.Atoi(profileParam)
+		if err != nil {
+			return nil, fmt.Errorf("invalid profile id %q", profileParam)
+		}
+
+		profile, err := c.repository.GetPlayerProfile(profileId)
+		if err != nil {
+			return nil, err
+		}
+
+		// The world in the route takes priority over the profile's home world
+		if worldId == 0 {
+			worldId = profile.HomeWorldId
+		}
+
+		playerInfo = profitCalc.NewPlayerInfoFromProfile(profile, c.getDcIdFromWorldId(worldId))
+		playerInfo.HomeServer = worldId
+	} else {
+		playerInfo = profitCalc.NewDefaultPlayerInfo(worldId, c.getDcIdFromWorldId(worldId))
+	}
+
+	if jobsParam := query.Get("jobs"); jobsParam != "" {
+		// Job levels are given as a comma separated list, e.g. jobs=CRP:90,BSM:70
+		playerInfo.JobLevels = make(map[readertype.Job]int)
+		for _, jobLevel := range strings.Split(jobsParam, ",") {
+			jobAndLevel := strings.SplitN(jobLevel, ":", 2)
+			if len(jobAndLevel) != 2 {
+				return nil, fmt.Errorf("invalid job level %q", jobLevel)
+			}
+
+			job := readertype.FromShortString(jobAndLevel[0])
+			level, err := strconv.Atoi(jobAndLevel[1])
+			if job == readertype.JobNone || err != nil {
+				return nil, fmt.Errorf("invalid job level %q", jobLevel)
+			}
+
+			playerInfo.JobLevels[job] = level
+		}
+	}
+
+	if rankParam := query.Get("gcRank"); rankParam != "" {
+		rank, err := strconv.Atoi(rankParam)
+		if err != nil || rank < int(readertype.GrandCompanyRankNone) || rank > int(readertype.Captain) {
+			return nil, fmt.Errorf("invalid grand company rank %q", rankParam)
+		}
+
+		playerInfo.GrandCompanyRank = readertype.GrandCompanyRank(rank)
+	}
+
+	if skipParam := query.Get("skipCrystals"); skipParam != "" {
+		playerInfo.SkipCrystals = util.SafeStringToBool(skipParam)
+	}
+
+	if booksParam, ok := query["recipeBooks"]; ok {
+		// An empty value is allowed here, as that's a player with no secret recipe books
+		playerInfo.SecretRecipeBooks = make(map[string]struct{})
+		for _, book := range strings.Split(booksParam[0], ",") {
+			if book = strings.TrimSpace(book); book != "" {
+				playerInfo.SecretRecipeBooks[book] = struct{}{}
+			}
+		}
+	}
+
+	if specialistsParam, ok := query["specialists"]; ok {
+		// An empty value is allowed here, as that's a player with no specialists
+		playerInfo.Specialists = make(map[readertype.Job]struct{})
+		for _, jobParam := range strings.Split(specialistsParam[0], ",") {
+			if jobParam = strings.TrimSpace(jobParam); jobParam == "" {
+				continue
+			}
+
+			job := readertype.FromShortString(jobParam)
+			if job == readertype.JobNone {
+				return nil, fmt.Errorf("invalid specialist %q", jobParam)
+			}
+
+			playerInfo.Specialists[job] = struct{}{}
+		}
+	}
+
+	if statsParam := query.Get("stats"); statsParam != "" {
+		// Crafter stats are given as craftsmanship/control/cp per job, e.g. stats=CRP:4000/3800/600,ALC:3900/3700/580
+		playerInfo.CrafterStats = make(map[readertype.Job]db.CrafterStats)
+		for _, jobStats := range strings.Split(statsParam, ",") {
+			jobAndStats := strings.SplitN(jobStats, ":", 2)
+			if len(jobAndStats) != 2 {
+				return nil, fmt.Errorf("invalid crafter stats %q", jobStats)
+			}
+
+			job := readertype.FromShortString(jobAndStats[0])
+			stats := strings.Split(jobAndStats[1], "/")
+			if job == readertype.JobNone || len(stats) != 3 {
+				return nil, fmt.Errorf("invalid crafter stats %q", jobStats)
+			}
+
+			craftsmanship, craftsmanshipErr := strconv.Atoi(stats[0])
+			control, controlErr := strconv.Atoi(stats[1])
+			cp, cpErr := strconv.Atoi(stats[2])
+			if err := errors.Join(craftsmanshipErr, controlErr, cpErr); err != nil {
+				return nil, fmt.Errorf("invalid crafter stats %q", jobStats)
+			}
+
+			playerInfo.CrafterStats[job] = db.CrafterStats{
+				Craftsmanship: craftsmanship,
+				Control:       control,
+				CP:            cp,
+			}
+		}
+	}
+
+	if cityParam := query.Get("retainerCity"); cityParam != "" {
+		city, err := strconv.Atoi(cityParam)
+		if err != nil || (city != profitCalc.RetainerCityNone && !profitCalc.IsRetainerCity(city)) {
+			return nil, fmt.Errorf("invalid retainer city %q", cityParam)
+		}
+
+		playerInfo.RetainerCity = city
+	}
+
+	// Overrides are held to the same limits as stored profiles
+	if err := playerInfo.Validate(); err != nil {
+		return nil, err
+	}
+
+	return playerInfo, nil
+}
+
+// writePlayerInfoError
+// Profile lookups that fail because the profile doesn't exist are a 404, anything else is a bad request.
+func writePlayerInfoError(w http.ResponseWriter, err error) {
+	if errors.Is(err, db.ErrProfileNotFound) {
+		util.ErrorJSON(w, err, http.StatusNotFound)
+		return
+	}
+
+	util.ErrorJSON(w, err)
+}
+
+// getProfitFilterFromRequest
+// Reads the filters and sort key for profit lists from the query string
+func getProfitFilterFromRequest(r *http.Request) (profitCalc.ProfitFilter, profitCalc.ProfitSortKey, error) {
+	query := r.URL.Query()
+
+	filter := profitCalc.ProfitFilter{
+		MinProfit:    util.SafeStringToInt(query.Get("minProfit")),
+		MinVelocity:  util.SafeStringToFloat(query.Get("minVelocity")),
+		MaxValuePer:  util.SafeStringToInt(query.Get("maxValuePer")),
+		UiCategory:   util.SafeStringToInt(query.Get("uiCategory")),
+		MinItemLevel: util.SafeStringToInt(query.Get("minItemLevel")),
+		MaxItemLevel: util.SafeStringToInt(query.Get("maxItemLevel")),
+	}
+
+	if jobParam := query.Get("job"); jobParam != "" {
+		filter.Job = readertype.FromShortString(jobParam)
+		if filter.Job == readertype.JobNone {
+			return filter, "", fmt.Errorf("invalid job %q", jobParam)
+		}
+	}
+
+	if obtainParam := query.Get("obtainType"); obtainParam != "" {
+		// Obtain types can be combined, e.g. obtainType=craft,gather
+		for _, typeParam := range strings.Split(obtainParam, ",") {
+			obtainType, ok := profitCalc.ObtainTypeFromString(strings.ToLower(typeParam))
+			if !ok {
+				return filter, "", fmt.Errorf("invalid obtain type %q", typeParam)
+			}
+
+			filter.ObtainTypes = append(filter.ObtainTypes, obtainType)
+		}
+	}
+
+	sortKey := profitCalc.SortByProfitScore
+	if sortParam := query.Get("sort"); sortParam != "" {
+		var ok bool
+		sortKey, ok = profitCalc.ProfitSortKeyFromString(sortParam)
+		if !ok {
+			return filter, "", fmt.Errorf("invalid sort key %q", sortParam)
+		}
+	}
+
+	return filter, sortKey, nil
+}
+
+// unobtainableItem
+// What's returned instead of profit for an item the player can't obtain without unlocking recipes
+type unobtainableItem struct {
+	ItemId         int
+	BlockedRecipes []profitCalc.BlockedRecipe
+}
+
 func (c Controller) GetItemProfit(w http.ResponseWriter, r *http.Request) {
 	itemId := util.SafeStringToInt(chi.URLParam(r, "itemId"))
-	queryWorldId := c.getWorldIdFromRequest(r)
-	dcId := c.getDcIdFromWorldId(queryWorldId)
-
-	playerInfo := profitCalc.PlayerInfo{
-		HomeServer:       queryWorldId,
-		DataCenter:       dcId,
-		SkipCrystals:     true,
-		GrandCompanyRank: readertype.Captain,
-		JobLevels: map[readertype.Job]int{
-			readertype.JobCarpenter:     90,
-			readertype.JobBlacksmith:    90,
-			readertype.JobArmourer:      90,
-			readertype.JobGoldsmith:     90,
-			readertype.JobLeatherworker: 90,
-			readertype.JobWeaver:        90,
-			readertype.JobAlchemist:     90,
-			readertype.JobCulinarian:    90,
-			readertype.JobMiner:         90,
-			readertype.JobBotanist:      90,
-			readertype.JobFisher:        90,
-			readertype.JobPaladin:       90,
-		},
+
+	playerInfo, err := c.getPlayerInfoFromRequest(r)
+	if err != nil {
+		writePlayerInfoError(w, err)
+		return
 	}
+
 	itemMap := *c.profitCalc.Items
 	item, ok := itemMap[itemId]
 
 	if !ok {
-		util.ErrorJSON(w, nil, http.StatusNotFound)
+		util.ErrorJSON(w, fmt.Errorf("item %d not found", itemId), http.StatusNotFound)
 		return
 	}
 
-	profitInfo, err := c.profitCalc.CalculateProfitForItem(item, &playerInfo)
+	profitInfo, err := c.profitCalc.CalculateProfitForItem(item, playerInfo)
 	if err != nil {
 		util.ErrorJSON(w, err, http.StatusInternalServerError)
 		return
 	}
 
+	// Explain items the player can't obtain because of recipes they haven't unlocked
+	if profitInfo == nil {
+		blocked, err := c.profitCalc.BlockedRecipesForItem(item, playerInfo)
+		if err != nil {
+			util.ErrorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		if len(blocked) > 0 {
+			_ = util.WriteJSON(w, http.StatusOK, unobtainableItem{ItemId: itemId, BlockedRecipes: blocked})
+			return
+		}
+	}
+
 	err = util.WriteJSON(w, http.StatusOK, profitInfo)
 	if err != nil {
 		util.ErrorJSON(w, err, http.StatusNotFound)
 	}
 }
 
-func (c Controller) GetAllItemProfit(w http.ResponseWriter, r *http.Request) {
-	worldId := c.getWorldIdFromRequest(r)
-	dcId := c.getDcIdFromWorldId(worldId)
-
-	playerInfo := profitCalc.PlayerInfo{
-		HomeServer:       worldId,
-		DataCenter:       dcId,
-		SkipCrystals:     true,
-		GrandCompanyRank: readertype.Captain,
-		JobLevels: map[readertype.Job]int{
-			readertype.JobCarpenter:     90,
-			readertype.JobBlacksmith:    90,
-			readertype.JobArmourer:      90,
-			readertype.JobGoldsmith:     90,
-			readertype.JobLeatherworker: 90,
-			readertype.JobWeaver:        90,
-			readertype.JobAlchemist:     90,
-			readertype.JobCulinarian:    90,
-			readertype.JobMiner:         90,
-			readertype.JobBotanist:      90,
-			readertype.JobFisher:        90,
-			readertype.JobPaladin:       90,
-		},
+// GetItemUsedIn
+// Lists everything that can be crafted from an item, with how profitable each product currently is
+func (c Controller) GetItemUsedIn(w http.ResponseWriter, r *http.Request) {
+	itemId := util.SafeStringToInt(chi.URLParam(r, "itemId"))
+	if _, ok := (*c.profitCalc.Items)[itemId]; !ok {
+		util.ErrorJSON(w, fmt.Errorf("item %d not found", itemId), http.StatusNotFound)
+		return
 	}
 
-	var wg sync.WaitGroup
-	resultsChan := make(chan *profitCalc.ProfitInfo)
-	errorsChan := make(chan error)
+	var (
+		profits    map[int]*profitCalc.ProfitInfo
+		computedAt time.Time
+	)
+
+	if hasPlayerParams(r) {
+		playerInfo, err := c.getPlayerInfoFromRequest(r)
+		if err != nil {
+			writePlayerInfoError(w, err)
+			return
+		}
+
+		results, errs, err := c.calculateOnDemand(c.profitCalc.GetUsageProducts(itemId), playerInfo)
+		if err != nil {
+			util.ErrorJSON(w, err, http.StatusServiceUnavailable)
+			return
+		}
 
-	for _, item := range *c.profitCalc.Items {
-		if item.MarketProhibited {
-			continue
+		if len(errs) > 0 {
+			util.ErrorJSON(w, errors.Join(errs...), http.StatusInternalServerError)
+			return
 		}
 
-		wg.Add(1)
+		profits = make(map[int]*profitCalc.ProfitInfo, len(results))
+		for _, result := range results {
+			profits[result.ItemId] = result
+		}
 
-		go func(item *profitCalc.Item, playerInfo *profitCalc.PlayerInfo) {
-			defer wg.Done()
+		computedAt = time.Now().UTC()
+	} else {
+		worldId := c.getWorldIdFromRequest(r)
+		if !c.leaderboard.IsTracked(worldId) {
+			util.ErrorJSON(w, fmt.Errorf("world %q is not tracked", chi.URLParam(r, "worldId")), http.StatusNotFound)
+			return
+		}
 
-			profitInfo, err := c.profitCalc.CalculateProfitForItem(item, playerInfo)
+		var (
+			snapshot *profitCalc.ProfitSnapshot
+			ok       bool
+		)
 
-			if err != nil {
-				errorsChan <- err
-				return
-			} else {
-				if profitInfo == nil || profitInfo.SaleMethod.ValuePer > 1000000 {
-					return
-				}
+		profits, snapshot, ok = c.leaderboard.GetProfits(worldId)
+		if !ok {
+			util.ErrorJSON(
+				w,
+				fmt.Errorf("profits for world %d are still being calculated", worldId),
+				http.StatusServiceUnavailable,
+			)
 
-				resultsChan <- profitInfo
-			}
-		}(item, &playerInfo)
+			return
+		}
+
+		computedAt = snapshot.UpdatedAt
 	}
 
-	go func() {
-		wg.Wait()
-		close(resultsChan)
-		close(errorsChan)
-	}()
+	err := util.WriteJSON(
+		w, http.StatusOK, profitCalc.ItemUsageList{
+			ItemId:     itemId,
+			Usages:     c.profitCalc.GetItemUsages(itemId, profits),
+			ComputedAt: computedAt,
+		},
+	)
+	if err != nil {
+		util.ErrorJSON(w, err, http.StatusNotFound)
+	}
+}
 
-	result := make([]*profitCalc.ProfitInfo, 0)
-	errors := make([]error, 0)
+// GetItemHistory
+// Charts an item's sale prices on a world over time, bucketed by the "interval" query parameter between "from" and
+// "to" (RFC 3339 or unix timestamps)
+func (c Controller) GetItemHistory(w http.ResponseWriter, r *http.Request) {
+	itemId := util.SafeStringToInt(chi.URLParam(r, "itemId"))
+	if _, ok := (*c.profitCalc.Items)[itemId]; !ok {
+		util.ErrorJSON(w, fmt.Errorf("item %d not found", itemId), http.StatusNotFound)
+		return
+	}
 
-	for {
-		select {
-		case resultInfo, ok := <-resultsChan:
-			if !ok {
-				resultsChan = nil
-			} else {
-				result = append(result, resultInfo)
-			}
+	worldId := c.getWorldIdFromRequest(r)
+	if _, ok := (*c.worlds)[worldId]; !ok {
+		util.ErrorJSON(w, fmt.Errorf("world %q not found", chi.URLParam(r, "worldId")), http.StatusNotFound)
+		return
+	}
 
-		case err, ok := <-errorsChan:
-			if !ok {
-				errorsChan = nil
-			} else {
-				errors = append(errors, err)
-			}
-		}
+	query := r.URL.Query()
+	from, err := parseHistoryTime(query.Get("from"))
+	if err != nil {
+		util.ErrorJSON(w, err)
+		return
+	}
+
+	to, err := parseHistoryTime(query.Get("to"))
+	if err != nil {
+		util.ErrorJSON(w, err)
+		return
+	}
+
+	history, err := c.profitCalc.GetPriceHistory(itemId, worldId, query.Get("interval"), from, to)
+	if err != nil {
+		util.ErrorJSON(w, err)
+		return
+	}
+
+	err = util.WriteJSON(w, http.StatusOK, history)
+	if err != nil {
+		util.ErrorJSON(w, err, http.StatusInternalServerError)
+	}
+}
+
+// parseHistoryTime
+// Reads a time given as either RFC 3339 or a unix timestamp in seconds. An empty value is the zero time.
+func parseHistoryTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", value)
+	}
+
+	return parsed, nil
+}
+
+type craftingPlanRequest struct {
+	Targets []profitCalc.CraftTarget
+}
+
+// PlanCrafts
+// Builds a single plan for crafting or buying several items at once
+func (c Controller) PlanCrafts(w http.ResponseWriter, r *http.Request) {
+	playerInfo, err := c.getPlayerInfoFromRequest(r)
+	if err != nil {
+		writePlayerInfoError(w, err)
+		return
+	}
+
+	var request craftingPlanRequest
+	if err := util.ReadJSON(w, r, &request); err != nil {
+		util.ErrorJSON(w, err)
+		return
+	}
+
+	plan, err := c.profitCalc.PlanCrafts(request.Targets, playerInfo)
+	if err != nil {
+		util.ErrorJSON(w, err)
+		return
+	}
+
+	err = util.WriteJSON(w, http.StatusOK, plan)
+	if err != nil {
+		util.ErrorJSON(w, err, http.StatusInternalServerError)
+	}
+}
+
+// PlanPurchaseRoute
+// Works out which worlds to visit to buy everything needed for several items, and in which order
+func (c Controller) PlanPurchaseRoute(w http.ResponseWriter, r *http.Request) {
+	playerInfo, err := c.getPlayerInfoFromRequest(r)
+	if err != nil {
+		writePlayerInfoError(w, err)
+		return
+	}
 
-		if resultsChan == nil && errorsChan == nil {
-			break
+	travelCost := profitCalc.DefaultWorldTravelCost
+	if travelParam := r.URL.Query().Get("travelCost"); travelParam != "" {
+		travelCost, err = strconv.Atoi(travelParam)
+		if err != nil || travelCost < 0 {
+			util.ErrorJSON(w, fmt.Errorf("invalid travel cost %q", travelParam))
+			return
 		}
 	}
 
-	if len(errors) > 0 {
-		fmt.Printf("Multiple (%d) errors occurred: ", len(errors))
-		for index, err := range errors {
-			fmt.Printf("Error #%d: %v\n", index+1, err)
+	var request craftingPlanRequest
+	if err := util.ReadJSON(w, r, &request); err != nil {
+		util.ErrorJSON(w, err)
+		return
+	}
+
+	plan, err := c.profitCalc.PlanCrafts(request.Targets, playerInfo)
+	if err != nil {
+		util.ErrorJSON(w, err)
+		return
+	}
+
+	route, err := c.profitCalc.PlanPurchaseRoute(plan.ShoppingCart, playerInfo, travelCost)
+	if err != nil {
+		util.ErrorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	err = util.WriteJSON(w, http.StatusOK, route)
+	if err != nil {
+		util.ErrorJSON(w, err, http.StatusInternalServerError)
+	}
+}
+
+// playerParams are the query parameters that change the player used for profit calculations
+var playerParams = []string{
+	"profile", "jobs", "gcRank", "skipCrystals", "recipeBooks", "specialists", "stats", "retainerCity",
+}
+
+func hasPlayerParams(r *http.Request) bool {
+	query := r.URL.Query()
+	for _, param := range playerParams {
+		if query.Has(param) {
+			return true
 		}
+	}
 
-		util.ErrorJSON(
-			w,
-			fmt.Errorf("multiple (%d) errors occurred", len(errors)),
-			http.StatusInternalServerError,
-		)
+	return false
+}
 
+func (c Controller) GetAllItemProfit(w http.ResponseWriter, r *http.Request) {
+	filter, sortKey, err := getProfitFilterFromRequest(r)
+	if err != nil {
+		util.ErrorJSON(w, err)
 		return
 	}
 
-	sort.Slice(
-		result, func(i, j int) bool {
-			if result[i].ProfitScore == result[j].ProfitScore {
-				return result[i].ObtainMethod.GetCost() > result[j].ObtainMethod.GetCost()
-			}
+	query := r.URL.Query()
+	page := util.SafeStringToInt(query.Get("page"))
+	pageSize := util.SafeStringToInt(query.Get("pageSize"))
 
-			return result[i].ProfitScore > result[j].ProfitScore
-		},
+	var (
+		results    []*profitCalc.ProfitInfo
+		computedAt time.Time
+		updatedAt  time.Time
 	)
 
-	top25 := result[0:25]
+	if hasPlayerParams(r) {
+		// Customised players can't use the precomputed leaderboard, so their profits are calculated on demand
+		playerInfo, err := c.getPlayerInfoFromRequest(r)
+		if err != nil {
+			writePlayerInfoError(w, err)
+			return
+		}
+
+		items := make([]*profitCalc.Item, 0, len(*c.profitCalc.Items))
+		for _, item := range *c.profitCalc.Items {
+			if !item.MarketProhibited {
+				items = append(items, item)
+			}
+		}
+
+		var errs []error
+		results, errs, err = c.calculateOnDemand(items, playerInfo)
+		if err != nil {
+			util.ErrorJSON(w, err, http.StatusServiceUnavailable)
+			return
+		}
+
+		if len(errs) > 0 {
+			fmt.Printf("Multiple (%d) errors occurred: ", len(errs))
+			for index, err := range errs {
+				fmt.Printf("Error #%d: %v\n", index+1, err)
+			}
+
+			util.ErrorJSON(
+				w,
+				fmt.Errorf("multiple (%d) errors occurred", len(errs)),
+				http.StatusInternalServerError,
+			)
+
+			return
+		}
+
+		computedAt = time.Now().UTC()
+		updatedAt = computedAt
+	} else {
+		worldId := c.getWorldIdFromRequest(r)
+		if !c.leaderboard.IsTracked(worldId) {
+			util.ErrorJSON(w, fmt.Errorf("world %q is not tracked", chi.URLParam(r, "worldId")), http.StatusNotFound)
+			return
+		}
+
+		snapshot, ok := c.leaderboard.GetSnapshot(worldId)
+		if !ok {
+			util.ErrorJSON(
+				w,
+				fmt.Errorf("profits for world %d are still being calculated", worldId),
+				http.StatusServiceUnavailable,
+			)
 
-	err := util.WriteJSON(w, http.StatusOK, top25)
+			return
+		}
+
+		results = snapshot.Results
+		computedAt = snapshot.ComputedAt
+		updatedAt = snapshot.UpdatedAt
+	}
+
+	// Filtering copies the results, so the shared snapshot isn't reordered by sorting
+	results = c.profitCalc.FilterProfits(results, filter)
+	profitCalc.SortProfits(results, sortKey)
+
+	profitPage := profitCalc.PaginateProfits(results, page, pageSize)
+	profitPage.ComputedAt = computedAt
+	profitPage.UpdatedAt = updatedAt
+
+	err = util.WriteJSON(w, http.StatusOK, profitPage)
 	if err != nil {
 		util.ErrorJSON(w, err, http.StatusNotFound)
 	}
 }
 
 func (c Controller) GetGilValueOfCurrency(w http.ResponseWriter, r *http.Request) {
-	serverId := c.getWorldIdFromRequest(r)
 	currency := chi.URLParam(r, "currency")
-	dcId := c.getDcIdFromWorldId(serverId)
-
-	playerInfo := profitCalc.PlayerInfo{
-		HomeServer:       serverId,
-		DataCenter:       dcId,
-		SkipCrystals:     true,
-		GrandCompanyRank: readertype.Captain,
-		JobLevels: map[readertype.Job]int{
-			readertype.JobCarpenter:     90,
-			readertype.JobBlacksmith:    90,
-			readertype.JobArmourer:      90,
-			readertype.JobGoldsmith:     90,
-			readertype.JobLeatherworker: 90,
-			readertype.JobWeaver:        90,
-			readertype.JobAlchemist:     90,
-			readertype.JobCulinarian:    90,
-			readertype.JobMiner:         90,
-			readertype.JobBotanist:      90,
-			readertype.JobFisher:        90,
-			readertype.JobPaladin:       90,
-		},
+
+	playerInfo, err := c.getPlayerInfoFromRequest(r)
+	if err != nil {
+		writePlayerInfoError(w, err)
+		return
 	}
 
 	exchangeType := readertype.FromApiParam(currency)
-	value, err := c.profitCalc.GetGilValueForCurrency(exchangeType.String(), &playerInfo)
+	value, err := c.profitCalc.GetGilValueForCurrency(exchangeType.String(), playerInfo)
 
 	if err != nil {
 		util.ErrorJSON(w, err, http.StatusNotFound)
@@ -252,33 +670,16 @@ func (c Controller) GetGilValueOfCurrency(w http.ResponseWriter, r *http.Request
 }
 
 func (c Controller) GetBestItemToSellForCurrency(w http.ResponseWriter, r *http.Request) {
-	serverId := c.getWorldIdFromRequest(r)
 	currency := chi.URLParam(r, "currency")
-	dcId := c.getDcIdFromWorldId(serverId)
-
-	playerInfo := profitCalc.PlayerInfo{
-		HomeServer:       serverId,
-		DataCenter:       dcId,
-		SkipCrystals:     true,
-		GrandCompanyRank: readertype.Captain,
-		JobLevels: map[readertype.Job]int{
-			readertype.JobCarpenter:     90,
-			readertype.JobBlacksmith:    90,
-			readertype.JobArmourer:      90,
-			readertype.JobGoldsmith:     90,
-			readertype.JobLeatherworker: 90,
-			readertype.JobWeaver:        90,
-			readertype.JobAlchemist:     90,
-			readertype.JobCulinarian:    90,
-			readertype.JobMiner:         90,
-			readertype.JobBotanist:      90,
-			readertype.JobFisher:        90,
-			readertype.JobPaladin:       90,
-		},
+
+	playerInfo, err := c.getPlayerInfoFromRequest(r)
+	if err != nil {
+		writePlayerInfoError(w, err)
+		return
 	}
 
 	exchangeType := readertype.FromApiParam(currency)
-	sale, err := c.profitCalc.GetBestItemToSellForCurrency(exchangeType.String(), &playerInfo)
+	sale, err := c.profitCalc.GetBestItemToSellForCurrency(exchangeType.String(), playerInfo)
 
 	if err != nil {
 		util.ErrorJSON(w, err, http.StatusNotFound)
@@ -0,0 +1,24 @@
+package db
+
+import "time"
+
+// BackfillStatus is how fetching an item for a world went during the setup backfill
+type BackfillStatus string
+
+const (
+	BackfillDone   BackfillStatus = "done"
+	BackfillFailed BackfillStatus = "failed"
+)
+
+// BackfillProgress
+// A checkpoint for a single item on a world, so an interrupted backfill doesn't fetch it again
+type BackfillProgress struct {
+	ItemId    int            `json:"item_id"`
+	WorldId   int            `json:"world_id"`
+	Status    BackfillStatus `json:"status"`
+	Listings  int            `json:"listings"`
+	Sales     int            `json:"sales"`
+	Attempts  int            `json:"attempts"`
+	Error     string         `json:"error"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
@@ -2,12 +2,14 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/level-5-pidgey/MarketMoogle/csv/readertype"
 	"log"
+	"sync"
 	"time"
 
 	_ "github.com/jackc/pgx/v5/pgxpool"
@@ -64,14 +66,15 @@ func (c *CacheableRepository) CreateListing(listing Listing) (*Listing, error) {
 			 price_per_unit, quantity, 
 			 total_price, is_high_quality, 
 			 retainer_name, retainer_city, 
-			 last_review_time)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+			 last_review_time, tax)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 		ON CONFLICT (universalis_listing_id) DO UPDATE SET
 		    item_id = EXCLUDED.item_id,
 			price_per_unit = EXCLUDED.price_per_unit,
 			quantity = EXCLUDED.quantity,
 			total_price = EXCLUDED.total_price,
-			last_review_time = EXCLUDED.last_review_time
+			last_review_time = EXCLUDED.last_review_time,
+			tax = EXCLUDED.tax
 		RETURNING listing_id`
 
 	serverInfo := (*c.worlds)[listing.WorldId]
@@ -84,6 +87,7 @@ func (c *CacheableRepository) CreateListing(listing Listing) (*Listing, error) {
 		listing.Quantity, listing.Total,
 		listing.IsHighQuality, listing.RetainerName,
 		listing.RetainerCity, listing.LastReview,
+		listing.Tax,
 	)
 
 	if err != nil {
@@ -116,14 +120,15 @@ func (c *CacheableRepository) CreateListings(listings *[]Listing) error {
 			 price_per_unit, quantity, 
 			 total_price, is_high_quality, 
 			 retainer_name, retainer_city, 
-			 last_review_time)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+			 last_review_time, tax)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 		ON CONFLICT (universalis_listing_id, data_center_id) DO UPDATE SET
 		    item_id = EXCLUDED.item_id,
 			price_per_unit = EXCLUDED.price_per_unit,
 			quantity = EXCLUDED.quantity,
 			total_price = EXCLUDED.total_price,
-			last_review_time = EXCLUDED.last_review_time
+			last_review_time = EXCLUDED.last_review_time,
+			tax = EXCLUDED.tax
 		RETURNING listing_id`
 
 		listingWorldRelation := (*c.worlds)[listing.WorldId]
@@ -136,35 +141,29 @@ func (c *CacheableRepository) CreateListings(listings *[]Listing) error {
 			listing.Quantity, listing.Total,
 			listing.IsHighQuality, listing.RetainerName,
 			listing.RetainerCity, listing.LastReview,
+			listing.Tax,
 		)
 	}
 
 	// Execute the query with all arguments
-	result := tx.SendBatch(ctx, batch)
-	defer func() {
-		if e := result.Close(); e != nil {
-			log.Printf("Failed to close batch: %s", e)
-			err = e
-		}
+	return sendBatchInTx(ctx, tx, batch)
+}
 
-		if err != nil {
-			err = tx.Rollback(ctx)
-
-			if err != nil {
-				log.Printf("Failed to rollback transaction: %s", err)
-			}
-		} else {
-			if e := tx.Commit(ctx); e != nil {
-				log.Printf("Failed to commit transaction: %s", e)
-				err = e
-			}
+// sendBatchInTx
+// Runs every query in the batch then commits the transaction, rolling it back if any query failed
+func sendBatchInTx(ctx context.Context, tx pgx.Tx, batch *pgx.Batch) error {
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		if rollbackErr := tx.Rollback(ctx); rollbackErr != nil {
+			log.Printf("Failed to rollback transaction: %s", rollbackErr)
 		}
-	}()
 
-	if err != nil {
 		return fmt.Errorf("failed to execute batch: %s", err)
 	}
 
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit batch: %s", err)
+	}
+
 	return nil
 }
 
@@ -205,58 +204,109 @@ func (c *CacheableRepository) DeleteListings(universalisListingIds []string) err
 	}
 
 	// Execute the query with all arguments
-	result := tx.SendBatch(ctx, batch)
-	defer func() {
-		if e := result.Close(); e != nil {
-			log.Printf("Failed to close batch: %s", e)
-			err = e
+	return sendBatchInTx(ctx, tx, batch)
+}
+
+// insertSaleQuery inserts a sale and adds it to the hourly and daily rollups in the same statement, so the rollups
+// only ever count sales that were actually inserted. Sales that were already stored are skipped, so receiving the same
+// sale twice doesn't count it twice.
+var insertSaleQuery = sync.OnceValues(
+	func() (string, error) {
+		hourly, err := addToRollupQuery(RollupHourly)
+		if err != nil {
+			return "", err
 		}
 
+		daily, err := addToRollupQuery(RollupDaily)
 		if err != nil {
-			err = tx.Rollback(ctx)
-
-			if err != nil {
-				log.Printf("Failed to rollback transaction: %s", err)
-			}
-		} else {
-			if e := tx.Commit(ctx); e != nil {
-				log.Printf("Failed to commit transaction: %s", e)
-				err = e
-			}
+			return "", err
 		}
-	}()
 
+		return fmt.Sprintf(
+			`WITH inserted AS (
+				INSERT INTO sales
+					(item_id, world_id, 
+					 price_per_unit, quantity, 
+					 total_price, is_high_quality, 
+					 buyer_name, sale_time) 
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+				ON CONFLICT ON CONSTRAINT sales_natural_key DO NOTHING
+				RETURNING *
+			), hourly AS (%s
+			), daily AS (%s
+			)
+			SELECT sales_id FROM inserted`,
+			hourly,
+			daily,
+		), nil
+	},
+)
+
+func addToRollupQuery(period RollupPeriod) (string, error) {
+	table, err := period.tableName()
 	if err != nil {
-		return fmt.Errorf("failed to execute batch: %s", err)
+		return "", err
 	}
 
-	return nil
+	return fmt.Sprintf(
+		`
+		INSERT INTO %[1]s AS rollup
+			(item_id, world_id,
+			 bucket_start, is_high_quality,
+			 sale_count, quantity,
+			 total_price, min_price,
+			 max_price)
+		SELECT item_id, world_id,
+			   date_trunc('%[2]s', sale_time), is_high_quality,
+			   1, quantity,
+			   total_price, price_per_unit,
+			   price_per_unit
+		FROM inserted
+		ON CONFLICT (item_id, world_id, bucket_start, is_high_quality) DO UPDATE SET
+			sale_count = rollup.sale_count + EXCLUDED.sale_count,
+			quantity = rollup.quantity + EXCLUDED.quantity,
+			total_price = rollup.total_price + EXCLUDED.total_price,
+			min_price = least(rollup.min_price, EXCLUDED.min_price),
+			max_price = greatest(rollup.max_price, EXCLUDED.max_price)`,
+		table,
+		period,
+	), nil
 }
 
+// CreateSale
+// Stores a sale, or returns the one already stored if it was received before
 func (c *CacheableRepository) CreateSale(sale Sale) (*Sale, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	query := `
-		INSERT INTO sales
-			(item_id, world_id, 
-			 price_per_unit, quantity, 
-			 total_price, is_high_quality, 
-			 buyer_name, sale_time) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		ON CONFLICT (sales_id, sale_time) DO NOTHING
-		RETURNING sales_id
-	`
+	query, err := insertSaleQuery()
+	if err != nil {
+		return nil, err
+	}
 
-	returnedRow := c.DbPool.QueryRow(
+	err = c.DbPool.QueryRow(
 		ctx, query,
 		sale.ItemId, sale.WorldId,
 		sale.PricePer, sale.Quantity,
 		sale.TotalPrice, sale.IsHighQuality,
 		sale.BuyerName, sale.Timestamp,
-	)
-
-	err := returnedRow.Scan(&sale.Id)
+	).Scan(&sale.Id)
+
+	// Nothing's returned when the sale was already stored. The natural key treats nulls as equal, so the lookup does too.
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = c.DbPool.QueryRow(
+			ctx,
+			`SELECT sales_id FROM sales
+			WHERE item_id = $1 AND world_id = $2
+			  AND sale_time IS NOT DISTINCT FROM $3 AND buyer_name IS NOT DISTINCT FROM $4
+			  AND price_per_unit IS NOT DISTINCT FROM $5 AND quantity IS NOT DISTINCT FROM $6
+			  AND is_high_quality IS NOT DISTINCT FROM $7`,
+			sale.ItemId, sale.WorldId,
+			sale.Timestamp, sale.BuyerName,
+			sale.PricePer, sale.Quantity,
+			sale.IsHighQuality,
+		).Scan(&sale.Id)
+	}
 
 	if err != nil {
 		return nil, err
@@ -269,6 +319,11 @@ func (c *CacheableRepository) CreateSales(sales *[]Sale) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
+	query, err := insertSaleQuery()
+	if err != nil {
+		return err
+	}
+
 	tx, err := c.DbPool.Begin(ctx)
 	if err != nil {
 		return err
@@ -276,15 +331,6 @@ func (c *CacheableRepository) CreateSales(sales *[]Sale) error {
 
 	batch := new(pgx.Batch)
 	for _, listing := range *sales {
-		query := `INSERT INTO sales 
-			(item_id, world_id, 
-			 price_per_unit, quantity, 
-			 total_price, is_high_quality, 
-			 buyer_name, sale_time)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		ON CONFLICT (sales_id, sale_time) DO NOTHING
-		RETURNING sales_id`
-
 		_ = batch.Queue(
 			query,
 			listing.ItemId, listing.WorldId,
@@ -295,49 +341,152 @@ func (c *CacheableRepository) CreateSales(sales *[]Sale) error {
 	}
 
 	// Execute the query with all arguments
-	result := tx.SendBatch(ctx, batch)
+	return sendBatchInTx(ctx, tx, batch)
+}
+
+func (c *CacheableRepository) DeleteSaleById(saleId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `DELETE FROM sales WHERE sales_id = $1 RETURNING item_id, sale_time`
+
+	var (
+		itemId   int
+		saleTime time.Time
+	)
+
+	err := c.DbPool.QueryRow(ctx, query, saleId).Scan(&itemId, &saleTime)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// Minimum and maximum prices can't be taken back out of a rollup, so the rollups the sale was in are rebuilt
+	return c.rebuildSaleRollups(ctx, saleTime, saleTime, &itemId)
+}
+
+// HasMarketData
+// Whether any listings or sales are stored
+func (c *CacheableRepository) HasMarketData() (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var hasData bool
+	err := c.DbPool.QueryRow(
+		ctx, `SELECT EXISTS (SELECT 1 FROM listings) OR EXISTS (SELECT 1 FROM sales)`,
+	).Scan(&hasData)
+
+	return hasData, err
+}
+
+// RebuildSaleRollups
+// Recalculates the hourly and daily rollups of every sale between from and to, widened out to whole days
+func (c *CacheableRepository) RebuildSaleRollups(from, to time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	return c.rebuildSaleRollups(ctx, from, to, nil)
+}
+
+func (c *CacheableRepository) rebuildSaleRollups(ctx context.Context, from, to time.Time, itemId *int) error {
+	// Daily rollups can only be rebuilt from every sale in the day, and whole days cover whole hours as well
+	from = from.UTC().Truncate(24 * time.Hour)
+	to = to.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+
+	tx, err := c.DbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Does nothing once the transaction is committed
 	defer func() {
-		if e := result.Close(); e != nil {
-			log.Printf("Failed to close batch: %s", e)
-			err = e
+		if rollbackErr := tx.Rollback(ctx); rollbackErr != nil && !errors.Is(rollbackErr, pgx.ErrTxClosed) {
+			log.Printf("Failed to rollback transaction: %s", rollbackErr)
 		}
+	}()
 
+	batch := new(pgx.Batch)
+	for _, period := range RollupPeriods {
+		table, err := period.tableName()
 		if err != nil {
-			err = tx.Rollback(ctx)
-
-			if err != nil {
-				log.Printf("Failed to rollback transaction: %s", err)
-			}
-		} else {
-			if e := tx.Commit(ctx); e != nil {
-				log.Printf("Failed to commit transaction: %s", e)
-				err = e
-			}
+			return err
 		}
-	}()
 
+		deleteQuery := fmt.Sprintf(
+			`DELETE FROM %s
+			WHERE bucket_start >= $1 AND bucket_start < $2 AND ($3::integer IS NULL OR item_id = $3)`,
+			table,
+		)
+
+		insertQuery := fmt.Sprintf(
+			`INSERT INTO %s
+				(item_id, world_id,
+				 bucket_start, is_high_quality,
+				 sale_count, quantity,
+				 total_price, min_price,
+				 max_price)
+			SELECT item_id, world_id,
+				   date_trunc('%s', sale_time) AS bucket_start, is_high_quality,
+				   count(*), sum(quantity),
+				   sum(total_price), min(price_per_unit),
+				   max(price_per_unit)
+			FROM sales
+			WHERE sale_time >= $1 AND sale_time < $2 AND ($3::integer IS NULL OR item_id = $3)
+			GROUP BY item_id, world_id, bucket_start, is_high_quality`,
+			table,
+			period,
+		)
+
+		_ = batch.Queue(deleteQuery, from, to, itemId)
+		_ = batch.Queue(insertQuery, from, to, itemId)
+	}
+
+	err = tx.SendBatch(ctx, batch).Close()
 	if err != nil {
-		return fmt.Errorf("failed to execute batch: %s", err)
+		return fmt.Errorf("failed to rebuild sale rollups: %s", err)
 	}
 
-	return nil
+	return tx.Commit(ctx)
 }
 
-func (c *CacheableRepository) DeleteSaleById(saleId int) error {
+func (c *CacheableRepository) GetSaleRollupsForItemOnWorld(
+	itemId, worldId int, period RollupPeriod, from time.Time,
+) (*[]*SaleRollup, error) {
+	return c.GetSaleRollupsForItemsOnWorld([]int{itemId}, worldId, period, from)
+}
+
+func (c *CacheableRepository) GetSaleRollupsForItemsOnWorld(
+	itemIds []int, worldId int, period RollupPeriod, from time.Time,
+) (*[]*SaleRollup, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	query := `DELETE FROM sales WHERE sales_id = $1`
+	table, err := period.tableName()
+	if err != nil {
+		return nil, err
+	}
 
-	_, err := c.DbPool.Exec(
-		ctx, query, saleId,
+	query := fmt.Sprintf(
+		`SELECT item_id, world_id,
+			   bucket_start, is_high_quality,
+			   sale_count, quantity,
+			   total_price, min_price,
+			   max_price
+		FROM %s
+		WHERE item_id = ANY($1) AND world_id = $2 AND bucket_start >= $3
+		ORDER BY bucket_start`,
+		table,
 	)
 
+	rows, err := c.DbPool.Query(ctx, query, itemIds, worldId, from.UTC())
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return extractSaleRollups(rows)
 }
 
 func (c *CacheableRepository) Connect(connectionInfo string) error {
@@ -409,32 +558,7 @@ func (c *CacheableRepository) CreatePartitions() error {
 	c.createListingPartitionsForDc(batch)
 
 	// Execute the query with all arguments
-	result := tx.SendBatch(ctx, batch)
-	defer func() {
-		if e := result.Close(); e != nil {
-			log.Printf("Failed to close batch: %s", e)
-			err = e
-		}
-
-		if err != nil {
-			err = tx.Rollback(ctx)
-
-			if err != nil {
-				log.Printf("Failed to rollback transaction: %s", err)
-			}
-		} else {
-			if e := tx.Commit(ctx); e != nil {
-				log.Printf("Failed to commit transaction: %s", e)
-				err = e
-			}
-		}
-	}()
-
-	if err != nil {
-		return fmt.Errorf("failed to execute batch: %s", err)
-	}
-
-	return nil
+	return sendBatchInTx(ctx, tx, batch)
 }
 
 func (c *CacheableRepository) createListingPartitionsForDc(
@@ -708,6 +832,44 @@ func (c *CacheableRepository) GetSalesForItemsOnDataCenter(itemIds []int, dataCe
 	return sales, nil
 }
 
+func (c *CacheableRepository) GetPriceHistoryForItemOnWorld(
+	itemId, worldId int, interval time.Duration, from, to time.Time,
+) (*[]*PriceHistoryBucket, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	// Filtering on sale_time lets postgres skip the partitions outside the range. The grouping sets return a bucket
+	// per quality along with a bucket for both qualities combined, told apart with grouping() as sales without a
+	// quality are null too. Those are counted as normal quality, like the column's default.
+	query := `
+		SELECT date_bin($3, sale_time, $6) AS bucket_start,
+			   coalesce(is_high_quality, false) AS high_quality,
+			   grouping(coalesce(is_high_quality, false)) = 1 AS combined,
+			   (array_agg(price_per_unit ORDER BY sale_time, sales_id))[1] AS open,
+			   max(price_per_unit) AS high,
+			   min(price_per_unit) AS low,
+			   (array_agg(price_per_unit ORDER BY sale_time DESC, sales_id DESC))[1] AS close,
+			   sum(quantity) AS volume,
+			   count(*) AS sale_count,
+			   sum(total_price)::float8 / nullif(sum(quantity), 0)::float8 AS vwap
+		FROM sales
+		WHERE item_id = $1 AND world_id = $2 AND sale_time >= $4 AND sale_time < $5
+		GROUP BY GROUPING SETS ((bucket_start, coalesce(is_high_quality, false)), (bucket_start))
+		ORDER BY bucket_start, combined DESC, high_quality`
+
+	rows, err := c.DbPool.Query(
+		ctx, query,
+		itemId, worldId,
+		interval, from.UTC(),
+		to.UTC(), PriceHistoryOrigin,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return extractPriceHistory(rows)
+}
+
 func getWorldsOnDc(c *CacheableRepository, dataCenterId int) *pgtype.Array[int] {
 	// The smallest data center currently has 4 worlds on it, and the largest has 8
 	worldsOnDc := make([]int, 4, 8)
@@ -741,7 +903,7 @@ func extractListings(rows pgx.Rows, err error, len int) (*[]*Listing, error) {
 			&listing.PricePer, &listing.Quantity,
 			&listing.Total, &listing.IsHighQuality,
 			&listing.RetainerName, &listing.RetainerCity,
-			&listing.LastReview,
+			&listing.LastReview, &listing.Tax,
 		)
 		if err != nil {
 			return nil, err
@@ -773,3 +935,546 @@ func extractSales(rows pgx.Rows, err error) (*[]*Sale, error) {
 
 	return &sales, nil
 }
+
+func extractPriceHistory(rows pgx.Rows) (*[]*PriceHistoryBucket, error) {
+	defer rows.Close()
+
+	buckets := make([]*PriceHistoryBucket, 0)
+	for rows.Next() {
+		var (
+			bucket        PriceHistoryBucket
+			isHighQuality *bool
+			combined      bool
+			vwap          *float64
+		)
+		err := rows.Scan(
+			&bucket.Start, &isHighQuality,
+			&combined, &bucket.Open,
+			&bucket.High, &bucket.Low,
+			&bucket.Close, &bucket.Volume,
+			&bucket.SaleCount, &vwap,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		// The quality is null for the combined bucket
+		if !combined {
+			bucket.IsHighQuality = isHighQuality
+		}
+
+		if vwap != nil {
+			bucket.Vwap = *vwap
+		}
+
+		bucket.Start = bucket.Start.UTC()
+		buckets = append(buckets, &bucket)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &buckets, nil
+}
+
+func extractSaleRollups(rows pgx.Rows) (*[]*SaleRollup, error) {
+	defer rows.Close()
+
+	rollups := make([]*SaleRollup, 0)
+	for rows.Next() {
+		var rollup SaleRollup
+		err := rows.Scan(
+			&rollup.ItemId, &rollup.WorldId,
+			&rollup.BucketStart, &rollup.IsHighQuality,
+			&rollup.SaleCount, &rollup.Quantity,
+			&rollup.TotalPrice, &rollup.MinPrice,
+			&rollup.MaxPrice,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		rollup.BucketStart = rollup.BucketStart.UTC()
+		rollups = append(rollups, &rollup)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &rollups, nil
+}
+
+func (c *CacheableRepository) GetPlayerProfile(profileId int) (*PlayerProfile, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `SELECT * FROM player_profiles WHERE profile_id = $1`
+
+	rows, err := c.DbPool.Query(ctx, query, profileId)
+	if err != nil {
+		return nil, err
+	}
+
+	profiles, err := extractPlayerProfiles(rows, err)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(*profiles) == 0 {
+		return nil, ErrProfileNotFound
+	}
+
+	return (*profiles)[0], nil
+}
+
+func (c *CacheableRepository) GetPlayerProfiles() (*[]*PlayerProfile, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `SELECT * FROM player_profiles ORDER BY profile_id`
+
+	rows, err := c.DbPool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return extractPlayerProfiles(rows, err)
+}
+
+func (c *CacheableRepository) CreatePlayerProfile(profile PlayerProfile) (*PlayerProfile, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO player_profiles
+			(name, home_world_id,
+			 grand_company_rank, skip_crystals,
+			 job_levels, recipe_books,
+			 specialists, crafter_stats,
+			 retainer_city)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING profile_id, created_at, updated_at`
+
+	returnedRow := c.DbPool.QueryRow(
+		ctx, query,
+		profile.Name, profile.HomeWorldId,
+		profile.GrandCompanyRank, profile.SkipCrystals,
+		profile.JobLevels, profile.RecipeBooks,
+		profile.Specialists, profile.CrafterStats,
+		profile.RetainerCity,
+	)
+
+	err := returnedRow.Scan(&profile.Id, &profile.CreatedAt, &profile.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &profile, nil
+}
+
+func (c *CacheableRepository) UpdatePlayerProfile(profile PlayerProfile) (*PlayerProfile, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE player_profiles SET
+			name = $2,
+			home_world_id = $3,
+			grand_company_rank = $4,
+			skip_crystals = $5,
+			job_levels = $6,
+			recipe_books = $7,
+			specialists = $8,
+			crafter_stats = $9,
+			retainer_city = $10,
+			updated_at = (now() at time zone 'utc')
+		WHERE profile_id = $1
+		RETURNING created_at, updated_at`
+
+	returnedRow := c.DbPool.QueryRow(
+		ctx, query,
+		profile.Id, profile.Name,
+		profile.HomeWorldId, profile.GrandCompanyRank,
+		profile.SkipCrystals, profile.JobLevels,
+		profile.RecipeBooks, profile.Specialists,
+		profile.CrafterStats, profile.RetainerCity,
+	)
+
+	err := returnedRow.Scan(&profile.CreatedAt, &profile.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrProfileNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &profile, nil
+}
+
+func (c *CacheableRepository) DeletePlayerProfile(profileId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `DELETE FROM player_profiles WHERE profile_id = $1`
+
+	tag, err := c.DbPool.Exec(ctx, query, profileId)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrProfileNotFound
+	}
+
+	return nil
+}
+
+func extractPlayerProfiles(rows pgx.Rows, err error) (*[]*PlayerProfile, error) {
+	profiles := make([]*PlayerProfile, 0)
+	for rows.Next() {
+		var profile PlayerProfile
+		err = rows.Scan(
+			&profile.Id, &profile.Name,
+			&profile.HomeWorldId, &profile.GrandCompanyRank,
+			&profile.SkipCrystals, &profile.JobLevels,
+			&profile.RecipeBooks, &profile.CreatedAt,
+			&profile.UpdatedAt, &profile.Specialists,
+			&profile.CrafterStats, &profile.RetainerCity,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		profiles = append(profiles, &profile)
+	}
+
+	return &profiles, nil
+}
+
+func (c *CacheableRepository) GetPriceAlert(alertId int) (*PriceAlert, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `SELECT * FROM price_alerts WHERE alert_id = $1`
+
+	rows, err := c.DbPool.Query(ctx, query, alertId)
+	if err != nil {
+		return nil, err
+	}
+
+	alerts, err := extractPriceAlerts(rows, err)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(*alerts) == 0 {
+		return nil, ErrAlertNotFound
+	}
+
+	return (*alerts)[0], nil
+}
+
+func (c *CacheableRepository) GetPriceAlerts() (*[]*PriceAlert, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `SELECT * FROM price_alerts ORDER BY alert_id`
+
+	rows, err := c.DbPool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return extractPriceAlerts(rows, err)
+}
+
+func (c *CacheableRepository) CreatePriceAlert(alert PriceAlert) (*PriceAlert, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO price_alerts
+			(kind, world_id,
+			 item_id, currency,
+			 comparison, threshold,
+			 webhook_url, enabled,
+			 format)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING alert_id, created_at, updated_at`
+
+	returnedRow := c.DbPool.QueryRow(
+		ctx, query,
+		alert.Kind, alert.WorldId,
+		alert.ItemId, alert.Currency,
+		alert.Comparison, alert.Threshold,
+		alert.WebhookUrl, alert.Enabled,
+		alert.Format,
+	)
+
+	err := returnedRow.Scan(&alert.Id, &alert.CreatedAt, &alert.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &alert, nil
+}
+
+func (c *CacheableRepository) UpdatePriceAlert(alert PriceAlert) (*PriceAlert, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE price_alerts SET
+			kind = $2,
+			world_id = $3,
+			item_id = $4,
+			currency = $5,
+			comparison = $6,
+			threshold = $7,
+			webhook_url = $8,
+			enabled = $9,
+			format = $10,
+			updated_at = (now() at time zone 'utc')
+		WHERE alert_id = $1
+		RETURNING last_triggered_at, created_at, updated_at`
+
+	returnedRow := c.DbPool.QueryRow(
+		ctx, query,
+		alert.Id, alert.Kind,
+		alert.WorldId, alert.ItemId,
+		alert.Currency, alert.Comparison,
+		alert.Threshold, alert.WebhookUrl,
+		alert.Enabled, alert.Format,
+	)
+
+	err := returnedRow.Scan(&alert.LastTriggeredAt, &alert.CreatedAt, &alert.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAlertNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &alert, nil
+}
+
+func (c *CacheableRepository) DeletePriceAlert(alertId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `DELETE FROM price_alerts WHERE alert_id = $1`
+
+	tag, err := c.DbPool.Exec(ctx, query, alertId)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrAlertNotFound
+	}
+
+	return nil
+}
+
+func (c *CacheableRepository) MarkPriceAlertTriggered(alertId int, triggeredAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `UPDATE price_alerts SET last_triggered_at = $2 WHERE alert_id = $1`
+
+	tag, err := c.DbPool.Exec(ctx, query, alertId, triggeredAt.UTC())
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrAlertNotFound
+	}
+
+	return nil
+}
+
+func (c *CacheableRepository) CreateAlertDelivery(delivery AlertDelivery) (*AlertDelivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO alert_deliveries
+			(alert_id, payload,
+			 attempts, status_code,
+			 error, delivered,
+			 delivered_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING delivery_id, created_at`
+
+	returnedRow := c.DbPool.QueryRow(
+		ctx, query,
+		delivery.AlertId, delivery.Payload,
+		delivery.Attempts, delivery.StatusCode,
+		delivery.Error, delivery.Delivered,
+		delivery.DeliveredAt,
+	)
+
+	err := returnedRow.Scan(&delivery.Id, &delivery.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &delivery, nil
+}
+
+func (c *CacheableRepository) UpdateAlertDelivery(delivery AlertDelivery) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		UPDATE alert_deliveries SET
+			attempts = $2,
+			status_code = $3,
+			error = $4,
+			delivered = $5,
+			delivered_at = $6
+		WHERE delivery_id = $1`
+
+	_, err := c.DbPool.Exec(
+		ctx, query,
+		delivery.Id, delivery.Attempts,
+		delivery.StatusCode, delivery.Error,
+		delivery.Delivered, delivery.DeliveredAt,
+	)
+
+	return err
+}
+
+func (c *CacheableRepository) GetAlertDeliveries(alertId int) (*[]*AlertDelivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `SELECT * FROM alert_deliveries WHERE alert_id = $1 ORDER BY created_at DESC LIMIT 100`
+
+	rows, err := c.DbPool.Query(ctx, query, alertId)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]*AlertDelivery, 0)
+	for rows.Next() {
+		var delivery AlertDelivery
+		err = rows.Scan(
+			&delivery.Id, &delivery.AlertId,
+			&delivery.Payload, &delivery.Attempts,
+			&delivery.StatusCode, &delivery.Error,
+			&delivery.Delivered, &delivery.CreatedAt,
+			&delivery.DeliveredAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, &delivery)
+	}
+
+	return &deliveries, nil
+}
+
+func extractPriceAlerts(rows pgx.Rows, err error) (*[]*PriceAlert, error) {
+	alerts := make([]*PriceAlert, 0)
+	for rows.Next() {
+		var alert PriceAlert
+		err = rows.Scan(
+			&alert.Id, &alert.Kind,
+			&alert.WorldId, &alert.ItemId,
+			&alert.Currency, &alert.Comparison,
+			&alert.Threshold, &alert.WebhookUrl,
+			&alert.Enabled, &alert.LastTriggeredAt,
+			&alert.CreatedAt, &alert.UpdatedAt,
+			&alert.Format,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		alerts = append(alerts, &alert)
+	}
+
+	return &alerts, nil
+}
+
+func (c *CacheableRepository) GetBackfillProgress(worldIds []int) (*[]*BackfillProgress, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	// No worlds means every world
+	query := `SELECT * FROM backfill_progress WHERE $1::integer[] IS NULL OR world_id = ANY($1)`
+
+	rows, err := c.DbPool.Query(ctx, query, worldIds)
+	if err != nil {
+		return nil, err
+	}
+
+	progress := make([]*BackfillProgress, 0)
+	for rows.Next() {
+		var checkpoint BackfillProgress
+		err = rows.Scan(
+			&checkpoint.ItemId, &checkpoint.WorldId,
+			&checkpoint.Status, &checkpoint.Listings,
+			&checkpoint.Sales, &checkpoint.Attempts,
+			&checkpoint.Error, &checkpoint.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		progress = append(progress, &checkpoint)
+	}
+
+	return &progress, nil
+}
+
+func (c *CacheableRepository) SaveBackfillProgress(progress *[]BackfillProgress) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		INSERT INTO backfill_progress
+			(item_id, world_id,
+			 status, listings,
+			 sales, error)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (item_id, world_id) DO UPDATE SET
+			status = EXCLUDED.status,
+			listings = EXCLUDED.listings,
+			sales = EXCLUDED.sales,
+			attempts = backfill_progress.attempts + 1,
+			error = EXCLUDED.error,
+			updated_at = now() at time zone 'utc'`
+
+	batch := new(pgx.Batch)
+	for _, checkpoint := range *progress {
+		_ = batch.Queue(
+			query,
+			checkpoint.ItemId, checkpoint.WorldId,
+			checkpoint.Status, checkpoint.Listings,
+			checkpoint.Sales, checkpoint.Error,
+		)
+	}
+
+	if err := c.DbPool.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to save backfill progress: %s", err)
+	}
+
+	return nil
+}
+
+func (c *CacheableRepository) ResetBackfillProgress() error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := c.DbPool.Exec(ctx, `TRUNCATE backfill_progress`)
+
+	return err
+}
@@ -16,4 +16,6 @@ type Listing struct {
 	RetainerName  string    `json:"retainer_name"`
 	RetainerCity  int       `json:"retainer_city"`
 	LastReview    time.Time `json:"last_review_time"`
+	// Sales tax the buyer pays on top of Total, 0 when the listing is tax free
+	Tax int `json:"tax"`
 }
@@ -1,14 +1,36 @@
 package db
 
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
 type MockRepository struct {
-	listings map[int]*Listing
-	sales    map[int]*Sale
+	listings   map[int]*Listing
+	sales      map[int]*Sale
+	profiles   map[int]*PlayerProfile
+	alerts     map[int]*PriceAlert
+	deliveries map[int]*AlertDelivery
+	// Keyed by item id then world id
+	backfill map[[2]int]*BackfillProgress
+
+	lastListingId  int
+	lastSaleId     int
+	lastProfileId  int
+	lastAlertId    int
+	lastDeliveryId int
 }
 
 func NewMockRepository() *MockRepository {
 	return &MockRepository{
-		listings: make(map[int]*Listing),
-		sales:    make(map[int]*Sale),
+		listings:   make(map[int]*Listing),
+		sales:      make(map[int]*Sale),
+		profiles:   make(map[int]*PlayerProfile),
+		alerts:     make(map[int]*PriceAlert),
+		deliveries: make(map[int]*AlertDelivery),
+		backfill:   make(map[[2]int]*BackfillProgress),
 	}
 }
 
@@ -18,8 +40,27 @@ func (r *MockRepository) CreateListing(listing Listing) (*Listing, error) {
 	return &listing, nil
 }
 
+// CreateListings
+// Behaves like the database: listings are given an id, and ones already stored with the same universalis id are
+// updated instead
 func (r *MockRepository) CreateListings(listings *[]Listing) error {
 	for _, listing := range *listings {
+		listing := listing
+
+		for _, stored := range r.listings {
+			if listing.UniversalisId != "" && stored.UniversalisId == listing.UniversalisId {
+				listing.Id = stored.Id
+			}
+		}
+
+		if listing.Id == 0 {
+			// Skip past ids given to listings created one at a time
+			for r.lastListingId++; r.listings[r.lastListingId] != nil; r.lastListingId++ {
+			}
+
+			listing.Id = r.lastListingId
+		}
+
 		r.listings[listing.Id] = &listing
 	}
 
@@ -150,6 +191,10 @@ func (r *MockRepository) GetSalesForItemsOnDataCenter(itemIds []int, dataCenterI
 }
 
 func (r *MockRepository) CreateSale(sale Sale) (*Sale, error) {
+	if existing := r.findSale(sale); existing != nil {
+		return existing, nil
+	}
+
 	r.sales[sale.Id] = &sale
 
 	return &sale, nil
@@ -157,12 +202,40 @@ func (r *MockRepository) CreateSale(sale Sale) (*Sale, error) {
 
 func (r *MockRepository) CreateSales(sales *[]Sale) error {
 	for _, sale := range *sales {
+		sale := sale
+
+		// Sales that were already stored are skipped, the same as the database does
+		if r.findSale(sale) != nil {
+			continue
+		}
+
+		if sale.Id == 0 {
+			// Skip past ids given to sales created one at a time
+			for r.lastSaleId++; r.sales[r.lastSaleId] != nil; r.lastSaleId++ {
+			}
+
+			sale.Id = r.lastSaleId
+		}
+
 		r.sales[sale.Id] = &sale
 	}
 
 	return nil
 }
 
+// findSale
+// The stored sale that's the same as the given one, if there is one
+func (r *MockRepository) findSale(sale Sale) *Sale {
+	key := sale.key()
+	for _, stored := range r.sales {
+		if stored.key() == key {
+			return stored
+		}
+	}
+
+	return nil
+}
+
 func (r *MockRepository) DeleteSaleById(saleId int) error {
 	if _, ok := r.sales[saleId]; ok {
 		delete(r.sales, saleId)
@@ -172,6 +245,160 @@ func (r *MockRepository) DeleteSaleById(saleId int) error {
 	return nil
 }
 
+func (r *MockRepository) HasMarketData() (bool, error) {
+	return len(r.listings) > 0 || len(r.sales) > 0, nil
+}
+
+func (r *MockRepository) RebuildSaleRollups(from, to time.Time) error {
+	// Rollups are calculated from the stored sales whenever they're asked for, so there's nothing to rebuild
+	return nil
+}
+
+func (r *MockRepository) GetSaleRollupsForItemOnWorld(
+	itemId, worldId int, period RollupPeriod, from time.Time,
+) (*[]*SaleRollup, error) {
+	return r.GetSaleRollupsForItemsOnWorld([]int{itemId}, worldId, period, from)
+}
+
+func (r *MockRepository) GetSaleRollupsForItemsOnWorld(
+	itemIds []int, worldId int, period RollupPeriod, from time.Time,
+) (*[]*SaleRollup, error) {
+	type rollupKey struct {
+		itemId        int
+		bucketStart   int64
+		isHighQuality bool
+	}
+
+	rollups := make(map[rollupKey]*SaleRollup)
+	result := make([]*SaleRollup, 0)
+	for _, itemId := range itemIds {
+		for _, sale := range r.sales {
+			if sale.ItemId != itemId || sale.WorldId != worldId {
+				continue
+			}
+
+			bucketStart := sale.Timestamp.UTC().Truncate(period.Duration())
+			if bucketStart.Before(from) {
+				continue
+			}
+
+			key := rollupKey{itemId, bucketStart.Unix(), sale.IsHighQuality}
+			rollup, ok := rollups[key]
+			if !ok {
+				rollup = &SaleRollup{
+					ItemId:        itemId,
+					WorldId:       worldId,
+					BucketStart:   bucketStart,
+					IsHighQuality: sale.IsHighQuality,
+					MinPrice:      sale.PricePer,
+					MaxPrice:      sale.PricePer,
+				}
+
+				rollups[key] = rollup
+				result = append(result, rollup)
+			}
+
+			rollup.SaleCount++
+			rollup.Quantity += sale.Quantity
+			rollup.TotalPrice += sale.TotalPrice
+			rollup.MinPrice = min(rollup.MinPrice, sale.PricePer)
+			rollup.MaxPrice = max(rollup.MaxPrice, sale.PricePer)
+		}
+	}
+
+	sort.SliceStable(
+		result, func(i, j int) bool {
+			return result[i].BucketStart.Before(result[j].BucketStart)
+		},
+	)
+
+	return &result, nil
+}
+
+func (r *MockRepository) GetPriceHistoryForItemOnWorld(
+	itemId, worldId int, interval time.Duration, from, to time.Time,
+) (*[]*PriceHistoryBucket, error) {
+	sales := make([]*Sale, 0)
+	for _, sale := range r.sales {
+		if sale.ItemId == itemId && sale.WorldId == worldId && !sale.Timestamp.Before(from) && sale.Timestamp.Before(to) {
+			sales = append(sales, sale)
+		}
+	}
+
+	sort.Slice(
+		sales, func(i, j int) bool {
+			if sales[i].Timestamp.Equal(sales[j].Timestamp) {
+				return sales[i].Id < sales[j].Id
+			}
+
+			return sales[i].Timestamp.Before(sales[j].Timestamp)
+		},
+	)
+
+	// Buckets are keyed by their start and quality, with "" used for both qualities combined
+	type bucketKey struct {
+		start   int64
+		quality string
+	}
+
+	buckets := make(map[bucketKey]*PriceHistoryBucket)
+	totals := make(map[bucketKey]int)
+	result := make([]*PriceHistoryBucket, 0)
+	for _, sale := range sales {
+		start := PriceHistoryBucketStart(sale.Timestamp, interval)
+		isHighQuality := sale.IsHighQuality
+
+		keys := []bucketKey{{start.UnixNano(), ""}, {start.UnixNano(), fmt.Sprint(sale.IsHighQuality)}}
+		for index, key := range keys {
+			bucket, ok := buckets[key]
+			if !ok {
+				bucket = &PriceHistoryBucket{Start: start, Open: sale.PricePer, High: sale.PricePer, Low: sale.PricePer}
+				if index > 0 {
+					bucket.IsHighQuality = &isHighQuality
+				}
+
+				buckets[key] = bucket
+				result = append(result, bucket)
+			}
+
+			bucket.High = max(bucket.High, sale.PricePer)
+			bucket.Low = min(bucket.Low, sale.PricePer)
+			bucket.Close = sale.PricePer
+			bucket.Volume += sale.Quantity
+			bucket.SaleCount++
+
+			totals[key] += sale.TotalPrice
+			if bucket.Volume > 0 {
+				bucket.Vwap = float64(totals[key]) / float64(bucket.Volume)
+			}
+		}
+	}
+
+	// Same order as the database: by bucket, then combined, normal and high quality
+	sort.SliceStable(
+		result, func(i, j int) bool {
+			if !result[i].Start.Equal(result[j].Start) {
+				return result[i].Start.Before(result[j].Start)
+			}
+
+			return qualityOrder(result[i].IsHighQuality) < qualityOrder(result[j].IsHighQuality)
+		},
+	)
+
+	return &result, nil
+}
+
+func qualityOrder(isHighQuality *bool) int {
+	switch {
+	case isHighQuality == nil:
+		return 0
+	case !*isHighQuality:
+		return 1
+	default:
+		return 2
+	}
+}
+
 func (r *MockRepository) Connect(connectionInfo string) error {
 	return nil
 }
@@ -179,3 +406,201 @@ func (r *MockRepository) Connect(connectionInfo string) error {
 func (r *MockRepository) CreatePartitions() error {
 	return nil
 }
+
+func (r *MockRepository) GetPlayerProfile(profileId int) (*PlayerProfile, error) {
+	if profile, ok := r.profiles[profileId]; ok {
+		return profile, nil
+	}
+
+	return nil, ErrProfileNotFound
+}
+
+func (r *MockRepository) GetPlayerProfiles() (*[]*PlayerProfile, error) {
+	result := make([]*PlayerProfile, 0, len(r.profiles))
+	for _, profile := range r.profiles {
+		result = append(result, profile)
+	}
+
+	sort.Slice(
+		result, func(i, j int) bool {
+			return result[i].Id < result[j].Id
+		},
+	)
+
+	return &result, nil
+}
+
+func (r *MockRepository) CreatePlayerProfile(profile PlayerProfile) (*PlayerProfile, error) {
+	r.lastProfileId++
+	profile.Id = r.lastProfileId
+	r.profiles[profile.Id] = &profile
+
+	return &profile, nil
+}
+
+func (r *MockRepository) UpdatePlayerProfile(profile PlayerProfile) (*PlayerProfile, error) {
+	if _, ok := r.profiles[profile.Id]; !ok {
+		return nil, ErrProfileNotFound
+	}
+
+	r.profiles[profile.Id] = &profile
+
+	return &profile, nil
+}
+
+func (r *MockRepository) DeletePlayerProfile(profileId int) error {
+	if _, ok := r.profiles[profileId]; !ok {
+		return ErrProfileNotFound
+	}
+
+	delete(r.profiles, profileId)
+
+	return nil
+}
+
+func (r *MockRepository) GetPriceAlert(alertId int) (*PriceAlert, error) {
+	if alert, ok := r.alerts[alertId]; ok {
+		return alert, nil
+	}
+
+	return nil, ErrAlertNotFound
+}
+
+func (r *MockRepository) GetPriceAlerts() (*[]*PriceAlert, error) {
+	result := make([]*PriceAlert, 0, len(r.alerts))
+	for _, alert := range r.alerts {
+		result = append(result, alert)
+	}
+
+	sort.Slice(
+		result, func(i, j int) bool {
+			return result[i].Id < result[j].Id
+		},
+	)
+
+	return &result, nil
+}
+
+func (r *MockRepository) CreatePriceAlert(alert PriceAlert) (*PriceAlert, error) {
+	r.lastAlertId++
+	alert.Id = r.lastAlertId
+	r.alerts[alert.Id] = &alert
+
+	return &alert, nil
+}
+
+func (r *MockRepository) UpdatePriceAlert(alert PriceAlert) (*PriceAlert, error) {
+	existing, ok := r.alerts[alert.Id]
+	if !ok {
+		return nil, ErrAlertNotFound
+	}
+
+	alert.LastTriggeredAt = existing.LastTriggeredAt
+	r.alerts[alert.Id] = &alert
+
+	return &alert, nil
+}
+
+func (r *MockRepository) DeletePriceAlert(alertId int) error {
+	if _, ok := r.alerts[alertId]; !ok {
+		return ErrAlertNotFound
+	}
+
+	delete(r.alerts, alertId)
+
+	for deliveryId, delivery := range r.deliveries {
+		if delivery.AlertId == alertId {
+			delete(r.deliveries, deliveryId)
+		}
+	}
+
+	return nil
+}
+
+func (r *MockRepository) MarkPriceAlertTriggered(alertId int, triggeredAt time.Time) error {
+	alert, ok := r.alerts[alertId]
+	if !ok {
+		return ErrAlertNotFound
+	}
+
+	triggeredAt = triggeredAt.UTC()
+	alert.LastTriggeredAt = &triggeredAt
+
+	return nil
+}
+
+func (r *MockRepository) CreateAlertDelivery(delivery AlertDelivery) (*AlertDelivery, error) {
+	r.lastDeliveryId++
+	delivery.Id = r.lastDeliveryId
+	delivery.CreatedAt = time.Now().UTC()
+	r.deliveries[delivery.Id] = &delivery
+
+	return &delivery, nil
+}
+
+func (r *MockRepository) UpdateAlertDelivery(delivery AlertDelivery) error {
+	if _, ok := r.deliveries[delivery.Id]; !ok {
+		return fmt.Errorf("alert delivery %d not found", delivery.Id)
+	}
+
+	r.deliveries[delivery.Id] = &delivery
+
+	return nil
+}
+
+func (r *MockRepository) GetAlertDeliveries(alertId int) (*[]*AlertDelivery, error) {
+	result := make([]*AlertDelivery, 0)
+	for _, delivery := range r.deliveries {
+		if delivery.AlertId == alertId {
+			result = append(result, delivery)
+		}
+	}
+
+	// Newest first, like the database
+	sort.Slice(
+		result, func(i, j int) bool {
+			return result[i].Id > result[j].Id
+		},
+	)
+
+	return &result, nil
+}
+
+// Setup Backfill
+
+func (r *MockRepository) GetBackfillProgress(worldIds []int) (*[]*BackfillProgress, error) {
+	result := make([]*BackfillProgress, 0)
+	for key, checkpoint := range r.backfill {
+		if len(worldIds) > 0 && !slices.Contains(worldIds, key[1]) {
+			continue
+		}
+
+		checkpoint := *checkpoint
+		result = append(result, &checkpoint)
+	}
+
+	return &result, nil
+}
+
+func (r *MockRepository) SaveBackfillProgress(progress *[]BackfillProgress) error {
+	for _, checkpoint := range *progress {
+		checkpoint := checkpoint
+		key := [2]int{checkpoint.ItemId, checkpoint.WorldId}
+
+		checkpoint.Attempts = 1
+		if stored, ok := r.backfill[key]; ok {
+			checkpoint.Attempts = stored.Attempts + 1
+		}
+
+		checkpoint.UpdatedAt = time.Now().UTC()
+		r.backfill[key] = &checkpoint
+	}
+
+	return nil
+}
+
+func (r *MockRepository) ResetBackfillProgress() error {
+	r.backfill = make(map[[2]int]*BackfillProgress)
+
+	return nil
+}
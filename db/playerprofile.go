@@ -0,0 +1,34 @@
+package db
+
+import (
+	"errors"
+	"github.com/level-5-pidgey/MarketMoogle/csv/readertype"
+	"time"
+)
+
+var ErrProfileNotFound = errors.New("player profile not found")
+
+type PlayerProfile struct {
+	Id               int                         `json:"profile_id"`
+	Name             string                      `json:"name"`
+	HomeWorldId      int                         `json:"home_world_id"`
+	GrandCompanyRank readertype.GrandCompanyRank `json:"grand_company_rank"`
+	SkipCrystals     bool                        `json:"skip_crystals"`
+	JobLevels        map[readertype.Job]int      `json:"job_levels"`
+	// Names of the secret (master) recipe books this player has unlocked
+	RecipeBooks []string `json:"recipe_books"`
+	// Crafting jobs this player has specialised in
+	Specialists []readertype.Job `json:"specialists"`
+	// Gear stats for each crafting job the player has filled in
+	CrafterStats map[readertype.Job]CrafterStats `json:"crafter_stats"`
+	// Universalis id of the city this player's retainers list items in, 0 if not set
+	RetainerCity int       `json:"retainer_city"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type CrafterStats struct {
+	Craftsmanship int `json:"craftsmanship"`
+	Control       int `json:"control"`
+	CP            int `json:"cp"`
+}
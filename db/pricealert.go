@@ -0,0 +1,87 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var ErrAlertNotFound = errors.New("price alert not found")
+
+// AlertKind is what a price alert watches
+type AlertKind string
+
+const (
+	// AlertItemPrice watches the price of new listings and sales of an item
+	AlertItemPrice AlertKind = "item_price"
+	// AlertRecipeMargin watches the profit margin of an item
+	AlertRecipeMargin AlertKind = "recipe_margin"
+	// AlertCurrencyValue watches how much gil a currency is worth
+	AlertCurrencyValue AlertKind = "currency_value"
+)
+
+// AlertComparison is which side of the threshold a price alert matches on
+type AlertComparison string
+
+const (
+	AlertBelow AlertComparison = "below"
+	AlertAbove AlertComparison = "above"
+)
+
+// AlertFormat is how a price alert's matches are sent to its webhook
+type AlertFormat string
+
+const (
+	// AlertFormatJson sends matches as signed JSON
+	AlertFormatJson AlertFormat = "json"
+	// AlertFormatDiscord sends matches as Discord messages, for Discord channel webhooks
+	AlertFormatDiscord AlertFormat = "discord"
+)
+
+type PriceAlert struct {
+	Id      int       `json:"alert_id"`
+	Kind    AlertKind `json:"kind"`
+	WorldId int       `json:"world_id"`
+	// Item watched by price and margin alerts
+	ItemId int `json:"item_id"`
+	// Name of the currency watched by currency value alerts
+	Currency   string          `json:"currency"`
+	Comparison AlertComparison `json:"comparison"`
+	Threshold  int             `json:"threshold"`
+	WebhookUrl string          `json:"webhook_url"`
+	Format     AlertFormat     `json:"format"`
+	Enabled    bool            `json:"enabled"`
+	// When the alert last matched, nil if it never has
+	LastTriggeredAt *time.Time `json:"last_triggered_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// Matches
+// Checks if a value is on the alerting side of the threshold
+func (a *PriceAlert) Matches(value float64) bool {
+	switch a.Comparison {
+	case AlertBelow:
+		return value < float64(a.Threshold)
+	case AlertAbove:
+		return value > float64(a.Threshold)
+	default:
+		return false
+	}
+}
+
+// AlertDelivery
+// A webhook sent for a price alert, along with how sending it went
+type AlertDelivery struct {
+	Id      int             `json:"delivery_id"`
+	AlertId int             `json:"alert_id"`
+	Payload json.RawMessage `json:"payload"`
+	// How many times sending the webhook has been tried
+	Attempts int `json:"attempts"`
+	// HTTP status of the last attempt, 0 if it failed before getting a response
+	StatusCode  int        `json:"status_code"`
+	Error       string     `json:"error"`
+	Delivered   bool       `json:"delivered"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DeliveredAt *time.Time `json:"delivered_at"`
+}
@@ -0,0 +1,36 @@
+package db
+
+import "time"
+
+// PriceHistoryOrigin is the time buckets are aligned to, so the same interval always produces the same buckets
+var PriceHistoryOrigin = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// PriceHistoryBucket
+// The sales of an item within one time bucket
+type PriceHistoryBucket struct {
+	Start time.Time `json:"bucket_start"`
+	// Nil when the bucket covers sales of both qualities
+	IsHighQuality *bool `json:"is_high_quality,omitempty"`
+	Open          int   `json:"open"`
+	High          int   `json:"high"`
+	Low           int   `json:"low"`
+	Close         int   `json:"close"`
+	// Number of items sold
+	Volume int `json:"volume"`
+	// Number of sales made
+	SaleCount int `json:"sale_count"`
+	// Average price per item, weighted by how many were sold at each price
+	Vwap float64 `json:"vwap"`
+}
+
+// PriceHistoryBucketStart
+// The start of the bucket a sale made at the given time falls into
+func PriceHistoryBucketStart(saleTime time.Time, interval time.Duration) time.Time {
+	sinceOrigin := saleTime.Sub(PriceHistoryOrigin)
+	buckets := sinceOrigin / interval
+	if sinceOrigin%interval < 0 {
+		buckets--
+	}
+
+	return PriceHistoryOrigin.Add(buckets * interval)
+}
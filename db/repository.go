@@ -1,5 +1,7 @@
 package db
 
+import "time"
+
 type Repository interface {
 	Connect(connectionInfo string) error
 	CreatePartitions() error
@@ -22,5 +24,40 @@ type Repository interface {
 	CreateSale(sale Sale) (*Sale, error)
 	CreateSales(sales *[]Sale) error
 	DeleteSaleById(saleId int) error
+	RebuildSaleRollups(from, to time.Time) error
+	GetSaleRollupsForItemOnWorld(itemId, worldId int, period RollupPeriod, from time.Time) (*[]*SaleRollup, error)
+	GetSaleRollupsForItemsOnWorld(itemIds []int, worldId int, period RollupPeriod, from time.Time) (
+		*[]*SaleRollup, error,
+	)
+	GetPriceHistoryForItemOnWorld(
+		itemId, worldId int, interval time.Duration, from, to time.Time,
+	) (*[]*PriceHistoryBucket, error)
 	// DeleteSales(universalisSalesId []string) error
+	HasMarketData() (bool, error)
+
+	// Player Profiles
+
+	GetPlayerProfile(profileId int) (*PlayerProfile, error)
+	GetPlayerProfiles() (*[]*PlayerProfile, error)
+	CreatePlayerProfile(profile PlayerProfile) (*PlayerProfile, error)
+	UpdatePlayerProfile(profile PlayerProfile) (*PlayerProfile, error)
+	DeletePlayerProfile(profileId int) error
+
+	// Price Alerts
+
+	GetPriceAlert(alertId int) (*PriceAlert, error)
+	GetPriceAlerts() (*[]*PriceAlert, error)
+	CreatePriceAlert(alert PriceAlert) (*PriceAlert, error)
+	UpdatePriceAlert(alert PriceAlert) (*PriceAlert, error)
+	DeletePriceAlert(alertId int) error
+	MarkPriceAlertTriggered(alertId int, triggeredAt time.Time) error
+	CreateAlertDelivery(delivery AlertDelivery) (*AlertDelivery, error)
+	UpdateAlertDelivery(delivery AlertDelivery) error
+	GetAlertDeliveries(alertId int) (*[]*AlertDelivery, error)
+
+	// Setup Backfill
+
+	GetBackfillProgress(worldIds []int) (*[]*BackfillProgress, error)
+	SaveBackfillProgress(progress *[]BackfillProgress) error
+	ResetBackfillProgress() error
 }
@@ -14,3 +14,27 @@ type Sale struct {
 	// Unix timestamp of sale
 	Timestamp time.Time `json:"sale_time"`
 }
+
+// saleKey
+// What identifies a sale, as Universalis doesn't give sales ids. Matches the sales_natural_key constraint.
+type saleKey struct {
+	itemId        int
+	worldId       int
+	timestamp     time.Time
+	buyerName     string
+	pricePer      int
+	quantity      int
+	isHighQuality bool
+}
+
+func (s Sale) key() saleKey {
+	return saleKey{
+		itemId:        s.ItemId,
+		worldId:       s.WorldId,
+		timestamp:     s.Timestamp.UTC(),
+		buyerName:     s.BuyerName,
+		pricePer:      s.PricePer,
+		quantity:      s.Quantity,
+		isHighQuality: s.IsHighQuality,
+	}
+}
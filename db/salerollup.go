@@ -0,0 +1,64 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// RollupPeriod is the length of time a sale rollup covers
+type RollupPeriod string
+
+const (
+	RollupHourly RollupPeriod = "hour"
+	RollupDaily  RollupPeriod = "day"
+)
+
+// RollupPeriods are every period sales are rolled up into
+var RollupPeriods = []RollupPeriod{RollupHourly, RollupDaily}
+
+// Duration
+// How long a single rollup of this period covers
+func (p RollupPeriod) Duration() time.Duration {
+	if p == RollupDaily {
+		return 24 * time.Hour
+	}
+
+	return time.Hour
+}
+
+// tableName
+// The table the rollups of this period are stored in
+func (p RollupPeriod) tableName() (string, error) {
+	switch p {
+	case RollupHourly:
+		return "sales_hourly", nil
+	case RollupDaily:
+		return "sales_daily", nil
+	default:
+		return "", fmt.Errorf("unknown rollup period %q", p)
+	}
+}
+
+// SaleRollup
+// The combined sales of an item of one quality on a world within an hour or a day
+type SaleRollup struct {
+	ItemId        int       `json:"item_id"`
+	WorldId       int       `json:"world_id"`
+	BucketStart   time.Time `json:"bucket_start"`
+	IsHighQuality bool      `json:"is_high_quality"`
+	SaleCount     int       `json:"sale_count"`
+	Quantity      int       `json:"quantity"`
+	TotalPrice    int       `json:"total_price"`
+	MinPrice      int       `json:"min_price"`
+	MaxPrice      int       `json:"max_price"`
+}
+
+// AveragePrice
+// The average price per item sold, weighted by quantity
+func (r *SaleRollup) AveragePrice() float64 {
+	if r.Quantity == 0 {
+		return 0
+	}
+
+	return float64(r.TotalPrice) / float64(r.Quantity)
+}
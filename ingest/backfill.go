@@ -0,0 +1,337 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"github.com/level-5-pidgey/MarketMoogle/api/universalis"
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	"log"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBackfillWorkers = 4
+	// DefaultBackfillChunkSize is how many items are fetched in each request, and checkpointed together
+	DefaultBackfillChunkSize = 50
+	DefaultReportInterval    = 30 * time.Second
+
+	// The most item ids Universalis takes in a single request
+	maxBackfillChunkSize = 100
+
+	backfillListings = 40
+	backfillSales    = 20
+)
+
+// BackfillConfig
+// What the setup backfill fetches, and how quickly
+type BackfillConfig struct {
+	WorldIds []int
+	ItemIds  []int
+	// How many requests are made at once
+	Workers   int
+	ChunkSize int
+	// How often progress is logged
+	ReportInterval time.Duration
+	// Forget what earlier runs fetched and fetch everything again. Sales already stored aren't stored twice.
+	Restart bool
+}
+
+// BackfillReport
+// How far along a backfill is. Items are counted once for each world they're fetched for.
+type BackfillReport struct {
+	// Items left to fetch when the backfill started
+	Total int `json:"total"`
+	// Items already fetched by an earlier run
+	Skipped  int           `json:"skipped"`
+	Done     int           `json:"done"`
+	Failed   int           `json:"failed"`
+	Listings int           `json:"listings"`
+	Sales    int           `json:"sales"`
+	Elapsed  time.Duration `json:"elapsed"`
+	// Estimated time left, from how quickly items have been fetched so far
+	Eta time.Duration `json:"eta"`
+}
+
+func (r BackfillReport) String() string {
+	percent := 100.0
+	if r.Total > 0 {
+		percent = float64(r.Done+r.Failed) / float64(r.Total) * 100
+	}
+
+	return fmt.Sprintf(
+		"%d/%d items fetched (%.1f%%, %d skipped), %d failed, %d listings and %d sales stored, %s elapsed, about %s left",
+		r.Done+r.Failed,
+		r.Total,
+		percent,
+		r.Skipped,
+		r.Failed,
+		r.Listings,
+		r.Sales,
+		r.Elapsed.Round(time.Second),
+		r.Eta.Round(time.Second),
+	)
+}
+
+// backfillTask
+// Items to fetch from a world in a single request
+type backfillTask struct {
+	worldId int
+	itemIds []int
+}
+
+// Backfill
+// Fetches the current listings and recent sales of items on worlds from Universalis, checkpointing every item once it's
+// stored. Items that were fetched by an earlier run are skipped, so an interrupted backfill carries on where it
+// stopped, and items that failed are tried again.
+type Backfill struct {
+	repository db.Repository
+	api        MarketApi
+	config     BackfillConfig
+
+	mutex   sync.Mutex
+	report  BackfillReport
+	started time.Time
+}
+
+func NewBackfill(repository db.Repository, api MarketApi, config BackfillConfig) *Backfill {
+	if config.Workers <= 0 {
+		config.Workers = DefaultBackfillWorkers
+	}
+
+	if config.ChunkSize <= 0 {
+		config.ChunkSize = DefaultBackfillChunkSize
+	}
+
+	if config.ReportInterval <= 0 {
+		config.ReportInterval = DefaultReportInterval
+	}
+
+	config.ChunkSize = min(config.ChunkSize, maxBackfillChunkSize)
+
+	return &Backfill{
+		repository: repository,
+		api:        api,
+		config:     config,
+	}
+}
+
+// Run
+// Fetches every item that hasn't been fetched yet, logging progress as it goes. Returns early with the context's
+// error if it's cancelled, leaving the rest to be fetched by the next run.
+func (b *Backfill) Run(ctx context.Context) (BackfillReport, error) {
+	if b.config.Restart {
+		if err := b.repository.ResetBackfillProgress(); err != nil {
+			return b.Report(), err
+		}
+	}
+
+	tasks, err := b.plan()
+	if err != nil {
+		return b.Report(), err
+	}
+
+	b.mutex.Lock()
+	b.started = time.Now()
+	b.mutex.Unlock()
+
+	log.Printf("backfill starting: %s\n", b.Report())
+
+	queue := make(chan backfillTask)
+	go func() {
+		defer close(queue)
+
+		for _, task := range tasks {
+			select {
+			case <-ctx.Done():
+				return
+			case queue <- task:
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < b.config.Workers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for task := range queue {
+				b.fetch(ctx, task)
+			}
+		}()
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(b.config.ReportInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-finished:
+				return
+			case <-ticker.C:
+				log.Printf("backfill progress: %s\n", b.Report())
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(finished)
+
+	report := b.Report()
+	if ctx.Err() != nil {
+		log.Printf("backfill interrupted, run it again to carry on: %s\n", report)
+		return report, ctx.Err()
+	}
+
+	log.Printf("backfill finished: %s\n", report)
+
+	return report, nil
+}
+
+// Report
+// How far along the backfill is right now
+func (b *Backfill) Report() BackfillReport {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	report := b.report
+	if b.started.IsZero() {
+		return report
+	}
+
+	report.Elapsed = time.Since(b.started)
+	if processed := report.Done + report.Failed; processed > 0 {
+		report.Eta = report.Elapsed / time.Duration(processed) * time.Duration(report.Total-processed)
+	}
+
+	return report
+}
+
+// plan
+// Splits the items that still need fetching into requests for each world
+func (b *Backfill) plan() ([]backfillTask, error) {
+	progress, err := b.repository.GetBackfillProgress(b.config.WorldIds)
+	if err != nil {
+		return nil, err
+	}
+
+	fetched := make(map[[2]int]struct{}, len(*progress))
+	for _, checkpoint := range *progress {
+		if checkpoint.Status == db.BackfillDone {
+			fetched[[2]int{checkpoint.ItemId, checkpoint.WorldId}] = struct{}{}
+		}
+	}
+
+	itemIds := slices.Clone(b.config.ItemIds)
+	slices.Sort(itemIds)
+
+	tasks, total, skipped := make([]backfillTask, 0), 0, 0
+	for _, worldId := range b.config.WorldIds {
+		pending := make([]int, 0, len(itemIds))
+		for _, itemId := range itemIds {
+			if _, ok := fetched[[2]int{itemId, worldId}]; ok {
+				skipped++
+				continue
+			}
+
+			pending = append(pending, itemId)
+		}
+
+		total += len(pending)
+		for start := 0; start < len(pending); start += b.config.ChunkSize {
+			tasks = append(
+				tasks, backfillTask{
+					worldId: worldId,
+					itemIds: pending[start:min(start+b.config.ChunkSize, len(pending))],
+				},
+			)
+		}
+	}
+
+	b.mutex.Lock()
+	b.report.Total, b.report.Skipped = total, skipped
+	b.mutex.Unlock()
+
+	return tasks, nil
+}
+
+// fetch
+// Fetches and stores a single request's worth of items, then checkpoints them
+func (b *Backfill) fetch(ctx context.Context, task backfillTask) {
+	entries, err := b.api.MarketData(
+		ctx,
+		strconv.Itoa(task.worldId),
+		task.itemIds,
+		universalis.MarketOptions{Listings: backfillListings, Entries: backfillSales},
+	)
+
+	// Being stopped isn't the items' fault, so they're left to be fetched next time
+	if ctx.Err() != nil {
+		return
+	}
+
+	progress := make([]db.BackfillProgress, 0, len(task.itemIds))
+	for _, itemId := range task.itemIds {
+		checkpoint := db.BackfillProgress{ItemId: itemId, WorldId: task.worldId, Status: db.BackfillDone}
+
+		// Items Universalis doesn't know about are left out of the response, and are done as there's nothing to store
+		if err != nil {
+			checkpoint.Status, checkpoint.Error = db.BackfillFailed, err.Error()
+		} else if entry, ok := entries[itemId]; ok {
+			checkpoint.Listings, checkpoint.Sales, checkpoint.Error = b.store(task.worldId, itemId, entry)
+			if checkpoint.Error != "" {
+				checkpoint.Status = db.BackfillFailed
+			}
+		}
+
+		progress = append(progress, checkpoint)
+	}
+
+	if err != nil {
+		log.Printf("failed to backfill %d items on world %d: %s\n", len(task.itemIds), task.worldId, err)
+	}
+
+	if saveErr := b.repository.SaveBackfillProgress(&progress); saveErr != nil {
+		log.Printf("failed to save backfill progress for world %d: %s\n", task.worldId, saveErr)
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, checkpoint := range progress {
+		if checkpoint.Status == db.BackfillDone {
+			b.report.Done++
+		} else {
+			b.report.Failed++
+		}
+
+		b.report.Listings += checkpoint.Listings
+		b.report.Sales += checkpoint.Sales
+	}
+}
+
+// store
+// Writes an item's listings and sales, returning how many there were or why they couldn't be written. Sales that are
+// already stored, from an earlier run or the live feed, are skipped, so retrying or restarting never stores one twice.
+func (b *Backfill) store(worldId, itemId int, entry *universalis.Entry) (int, int, string) {
+	entry.Item = itemId
+	entry.World = worldId
+
+	listings := entry.ConvertToDbListings()
+	if err := b.repository.CreateListings(listings); err != nil {
+		return 0, 0, fmt.Sprintf("failed to store listings: %s", err)
+	}
+
+	sales := entry.ConvertToDbSales()
+	if err := b.repository.CreateSales(sales); err != nil {
+		return len(*listings), 0, fmt.Sprintf("failed to store sales: %s", err)
+	}
+
+	return len(*listings), len(*sales), ""
+}
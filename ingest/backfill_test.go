@@ -0,0 +1,179 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"github.com/level-5-pidgey/MarketMoogle/api/universalis"
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	"testing"
+	"time"
+)
+
+func newTestBackfill(api MarketApi, repo *db.MockRepository, restart bool) *Backfill {
+	// The mock repository isn't safe to use from more than one worker
+	return NewBackfill(
+		repo, api, BackfillConfig{
+			WorldIds:  []int{1, 2},
+			ItemIds:   []int{3, 1, 2},
+			Workers:   1,
+			ChunkSize: 2,
+			Restart:   restart,
+		},
+	)
+}
+
+func TestBackfill_Run(t *testing.T) {
+	withSale := *listingEntry("", 0, 0, "a", "b")
+	withSale.Sales = []universalis.Sale{
+		{MarketInfo: universalis.MarketInfo{PricePerUnit: 100, Quantity: 1, Total: 100}, Timestamp: time.Now().Unix()},
+	}
+
+	api := &fakeMarketApi{
+		items: map[int]universalis.Entry{
+			1: withSale,
+			2: *listingEntry("", 0, 0, "c"),
+		},
+	}
+	repo := db.NewMockRepository()
+
+	report, err := newTestBackfill(api, repo, false).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Item 3 isn't on Universalis, so it's done with nothing to store
+	if report.Total != 6 || report.Done != 6 || report.Failed != 0 || report.Listings != 6 {
+		t.Errorf("Run() report = %+v, want 6 items done with 6 listings", report)
+	}
+
+	if listings := storedListingIds(t, repo, 1, 2); len(listings) != 2 {
+		t.Errorf("Run() stored listings %v for item 1 on world 2, want a and b", listings)
+	}
+
+	// Everything was fetched, so running again has nothing to do
+	api.requested = 0
+	report, err = newTestBackfill(api, repo, false).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Total != 0 || report.Skipped != 6 || api.requested != 0 {
+		t.Errorf("Run() again report = %+v after %d items requested, want all 6 skipped", report, api.requested)
+	}
+
+	// Restarting forgets what was fetched
+	report, err = newTestBackfill(api, repo, true).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Total != 6 || report.Skipped != 0 {
+		t.Errorf("Run() restarted report = %+v, want all 6 fetched again", report)
+	}
+
+	// Fetching the same sales again doesn't store them twice
+	sales, err := repo.GetSalesForItemOnWorld(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*sales) != 1 {
+		t.Errorf("Run() restarted stored %d sales for item 1 on world 1, want 1", len(*sales))
+	}
+}
+
+func TestBackfill_RetriesFailures(t *testing.T) {
+	api := &fakeMarketApi{err: errors.New("universalis is down")}
+	repo := db.NewMockRepository()
+
+	report, err := newTestBackfill(api, repo, false).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Failed != 6 || report.Done != 0 {
+		t.Errorf("Run() report = %+v, want all 6 items failed", report)
+	}
+
+	progress, _ := repo.GetBackfillProgress([]int{1})
+	if len(*progress) != 3 || (*progress)[0].Status != db.BackfillFailed || (*progress)[0].Error == "" {
+		t.Errorf("Run() saved progress %+v for world 1, want 3 failed checkpoints with the error", *progress)
+	}
+
+	// Failed items are tried again on the next run
+	api.err = nil
+	report, err = newTestBackfill(api, repo, false).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Total != 6 || report.Done != 6 {
+		t.Errorf("Run() retry report = %+v, want the 6 failed items done", report)
+	}
+
+	progress, _ = repo.GetBackfillProgress(nil)
+	for _, checkpoint := range *progress {
+		if checkpoint.Status != db.BackfillDone || checkpoint.Attempts != 2 {
+			t.Errorf("Run() retry left checkpoint %+v, want done on the second attempt", *checkpoint)
+		}
+	}
+}
+
+func TestBackfill_StoreFailures(t *testing.T) {
+	unpriced := *listingEntry("", 0, 0, "a")
+	unpriced.Sales = []universalis.Sale{
+		{MarketInfo: universalis.MarketInfo{Quantity: 1}, Timestamp: time.Now().Unix()},
+	}
+
+	api := &fakeMarketApi{items: map[int]universalis.Entry{1: unpriced, 2: *listingEntry("", 0, 0, "b")}}
+	repo := db.NewMockRepository()
+
+	backfill := NewBackfill(
+		rejectingRepository{repo}, api, BackfillConfig{
+			WorldIds: []int{1}, ItemIds: []int{1, 2}, Workers: 1, ChunkSize: 2,
+		},
+	)
+
+	report, err := backfill.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Done != 1 || report.Failed != 1 {
+		t.Errorf("Run() report = %+v, want 1 item done and 1 failed", report)
+	}
+
+	// The item whose sales couldn't be stored is left to be tried again on the next run
+	progress, _ := repo.GetBackfillProgress([]int{1})
+	if len(*progress) != 2 {
+		t.Fatalf("Run() saved %d checkpoints for world 1, want 2", len(*progress))
+	}
+
+	for _, checkpoint := range *progress {
+		wantStatus := db.BackfillDone
+		if checkpoint.ItemId == 1 {
+			wantStatus = db.BackfillFailed
+		}
+
+		if checkpoint.Status != wantStatus {
+			t.Errorf("Run() saved checkpoint %+v, want %s", *checkpoint, wantStatus)
+		}
+	}
+}
+
+func TestBackfill_Interrupted(t *testing.T) {
+	api := &fakeMarketApi{}
+	repo := db.NewMockRepository()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := newTestBackfill(api, repo, false).Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() error = %v, want it to stop when cancelled", err)
+	}
+
+	// Nothing's checkpointed, so it's all fetched next time
+	if progress, _ := repo.GetBackfillProgress(nil); len(*progress) != 0 {
+		t.Errorf("Run() saved progress %+v after being cancelled, want none", *progress)
+	}
+}
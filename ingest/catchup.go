@@ -0,0 +1,165 @@
+package ingest
+
+import (
+	"context"
+	"github.com/level-5-pidgey/MarketMoogle/api/universalis"
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	"log"
+	"strconv"
+	"time"
+)
+
+const (
+	// How many recently updated items are asked for when catching up, the most Universalis will return
+	catchUpEntries = 200
+
+	// How many recent sales are fetched for each item when catching up
+	catchUpSales = 20
+
+	// Events queued for a world's worker while catching up on it. They're never received from Universalis.
+	catchUpStarted  = "catchup/started"
+	catchUpRefresh  = "catchup/refresh"
+	catchUpFinished = "catchup/finished"
+)
+
+// MarketApi
+// The parts of the Universalis REST API needed to catch up on events missed while disconnected
+type MarketApi interface {
+	// RecentlyUpdated lists the items most recently uploaded to a world, newest first
+	RecentlyUpdated(ctx context.Context, worldId, entries int) (*universalis.RecentlyUpdated, error)
+	// MarketData gets the current listings and recent sales of items on a world, keyed by item id
+	MarketData(
+		ctx context.Context,
+		scope string,
+		itemIds []int,
+		options universalis.MarketOptions,
+	) (map[int]*universalis.Entry, error)
+}
+
+// CatchUp
+// Refreshes every item uploaded to the worlds while their websocket was down, since none of those events were
+// received. Universalis only lists the most recent uploads, so very long gaps on busy worlds can't be fully caught up
+// on. What's fetched is written by each world's worker, in order with the live events, so it's stored and announced
+// the same way they are.
+func (i *Ingester) CatchUp(ctx context.Context, worldIds []int, gap universalis.Gap) {
+	for _, worldId := range worldIds {
+		i.catchUpWorld(ctx, worldId, gap)
+	}
+}
+
+func (i *Ingester) catchUpWorld(ctx context.Context, worldId int, gap universalis.Gap) {
+	recent, err := i.api.RecentlyUpdated(ctx, worldId, catchUpEntries)
+	if err != nil {
+		log.Printf("failed to catch up on world %d: %s\n", worldId, err)
+		return
+	}
+
+	itemIds, complete := make([]int, 0, len(recent.Items)), false
+	for _, item := range recent.Items {
+		// Newest uploads come first, so everything after this was already received
+		if item.UploadedAt().Before(gap.From) {
+			complete = true
+			break
+		}
+
+		itemIds = append(itemIds, item.ItemId)
+	}
+
+	if !complete && len(recent.Items) >= catchUpEntries {
+		log.Printf("more than %d items were updated on world %d while disconnected, some were missed\n", catchUpEntries, worldId)
+	}
+
+	// Live events queued from here on may be newer than what's fetched, so the worker keeps track of them until
+	// everything fetched has been written
+	if !i.enqueue(ctx, &universalis.Entry{Event: catchUpStarted, World: worldId}) {
+		return
+	}
+
+	defer i.enqueue(ctx, &universalis.Entry{Event: catchUpFinished, World: worldId})
+
+	// Every listing is needed to tell which stored ones are gone
+	entries, err := i.api.MarketData(
+		ctx, strconv.Itoa(worldId), itemIds, universalis.MarketOptions{Entries: catchUpSales},
+	)
+	if err != nil {
+		log.Printf("failed to catch up on world %d: %s\n", worldId, err)
+		return
+	}
+
+	for itemId, entry := range entries {
+		// Make sure the listings and sales are stored against the world asked for
+		entry.Event = catchUpRefresh
+		entry.Item = itemId
+		entry.World = worldId
+
+		// Sales already stored are skipped by the database, but only the ones made while disconnected are kept so
+		// alerts and subscribers aren't told about older ones again
+		history := entry.RecentHistory
+		if len(history) == 0 {
+			history = entry.Sales
+		}
+
+		sales := make([]universalis.Sale, 0)
+		for _, sale := range history {
+			if time.Unix(sale.Timestamp, 0).After(gap.From) {
+				sales = append(sales, sale)
+			}
+		}
+
+		entry.Sales, entry.RecentHistory = sales, nil
+
+		if !i.enqueue(ctx, entry) {
+			return
+		}
+	}
+
+	log.Printf(
+		"queued %d items to catch up on for world %d after being disconnected for %s\n",
+		len(entries),
+		worldId,
+		gap.To.Sub(gap.From).Round(time.Second),
+	)
+}
+
+// refreshItem
+// Replaces an item's listings on a world with the ones fetched while catching up, and queues its sales to be written
+// with the rest of the batch. Listings are left alone if a live event changed them after they were fetched, as the
+// fetched ones are older.
+func (i *Ingester) refreshItem(entry *universalis.Entry, sales *[]ingestedEntry) {
+	if len(entry.Sales) > 0 {
+		*sales = append(*sales, ingestedEntry{entry: entry, sales: *entry.ConvertToDbSales()})
+	}
+
+	if i.changedWhileCatchingUp(entry.World, entry.Item) {
+		return
+	}
+
+	listings := *entry.ConvertToDbListings()
+	if len(listings) > 0 {
+		i.writeListings("listings/add", []ingestedEntry{{entry: entry, listings: listings}})
+	}
+
+	// Remove listings that sold or were taken down while we weren't listening
+	stored, err := i.repository.GetListingsForItemOnWorld(entry.Item, entry.World)
+	if err != nil {
+		log.Printf("failed to catch up on item %d on world %d: %s\n", entry.Item, entry.World, err)
+		return
+	}
+
+	current := make(map[string]struct{}, len(listings))
+	for _, listing := range listings {
+		current[listing.UniversalisId] = struct{}{}
+	}
+
+	gone := make([]db.Listing, 0)
+	for _, listing := range *stored {
+		if _, ok := current[listing.UniversalisId]; !ok {
+			gone = append(gone, *listing)
+		}
+	}
+
+	if len(gone) > 0 {
+		removed := &universalis.Entry{Event: "listings/remove", Item: entry.Item, World: entry.World}
+		i.writeListings("listings/remove", []ingestedEntry{{entry: removed, listings: gone}})
+	}
+}
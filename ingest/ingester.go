@@ -0,0 +1,366 @@
+package ingest
+
+import (
+	"context"
+	"github.com/level-5-pidgey/MarketMoogle/api/universalis"
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	profitCalc "github.com/level-5-pidgey/MarketMoogle/profit"
+	"github.com/level-5-pidgey/MarketMoogle/stream"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultWorkers = 4
+	// DefaultBatchSize is how many events are written together at most
+	DefaultBatchSize = 100
+	// DefaultBatchWait is how long a worker waits for more events before writing the ones it has
+	DefaultBatchWait = 250 * time.Millisecond
+
+	// How many events can wait for each worker before the websocket is held up
+	queueSize = 1024
+)
+
+// Ingester
+// Writes market events from Universalis to the repository, then lets everything watching the market know. Events are
+// shared out between a fixed number of workers by world, so each world's events are still written in order, and each
+// worker writes the events it's given in batches.
+type Ingester struct {
+	repository   db.Repository
+	leaderboard  *profitCalc.ProfitLeaderboard
+	alerts       *profitCalc.AlertMonitor
+	marketStream *stream.Hub
+	api          MarketApi
+
+	BatchSize int
+	BatchWait time.Duration
+
+	queues []chan *universalis.Entry
+
+	catchUpMutex sync.Mutex
+	// Worlds being caught up on, keyed by world id
+	catchingUp map[int]*catchUpTracking
+}
+
+// catchUpTracking
+// The items on a world whose listings were changed by live events while it was being caught up on
+type catchUpTracking struct {
+	// How many catch ups are running for the world, as it could reconnect again before one finishes
+	running int
+	changed map[int]struct{}
+}
+
+func NewIngester(
+	repository db.Repository,
+	leaderboard *profitCalc.ProfitLeaderboard,
+	alerts *profitCalc.AlertMonitor,
+	marketStream *stream.Hub,
+	api MarketApi,
+	workers int,
+) *Ingester {
+	queues := make([]chan *universalis.Entry, max(workers, 1))
+	for index := range queues {
+		queues[index] = make(chan *universalis.Entry, queueSize)
+	}
+
+	return &Ingester{
+		repository:   repository,
+		leaderboard:  leaderboard,
+		alerts:       alerts,
+		marketStream: marketStream,
+		api:          api,
+		BatchSize:    DefaultBatchSize,
+		BatchWait:    DefaultBatchWait,
+		queues:       queues,
+		catchingUp:   make(map[int]*catchUpTracking),
+	}
+}
+
+// Handle
+// Queues an event to be written by its world's worker. Blocks if that worker has fallen too far behind, so a slow
+// database slows down reading from the websocket rather than losing events.
+func (i *Ingester) Handle(entry *universalis.Entry) {
+	if entry.World == 0 {
+		log.Printf("ignoring %s event for item %d without a world\n", entry.Event, entry.Item)
+		return
+	}
+
+	i.queues[entry.World%len(i.queues)] <- entry
+}
+
+// enqueue
+// Queues an event like Handle, but gives up if the context is cancelled first, as the workers stop then
+func (i *Ingester) enqueue(ctx context.Context, entry *universalis.Entry) bool {
+	select {
+	case i.queues[entry.World%len(i.queues)] <- entry:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Run
+// Writes queued events until the context is cancelled, then writes whatever was still queued or batched
+func (i *Ingester) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, queue := range i.queues {
+		wg.Add(1)
+
+		go func(queue chan *universalis.Entry) {
+			defer wg.Done()
+
+			i.work(ctx, queue)
+		}(queue)
+	}
+
+	wg.Wait()
+}
+
+// work
+// Collects events into a batch until it's full or BatchWait has passed since its first event, then writes it
+func (i *Ingester) work(ctx context.Context, queue chan *universalis.Entry) {
+	batchSize := max(i.BatchSize, 1)
+	batch := make([]*universalis.Entry, 0, batchSize)
+	// Only set while there's a batch waiting to be written
+	var flush <-chan time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Events already queued were received, so they're written too rather than lost
+			for len(queue) > 0 {
+				batch = append(batch, <-queue)
+			}
+
+			i.writeBatch(batch)
+			return
+		case entry := <-queue:
+			if len(batch) == 0 {
+				flush = time.After(i.BatchWait)
+			}
+
+			batch = append(batch, entry)
+			if len(batch) < batchSize {
+				continue
+			}
+		case <-flush:
+		}
+
+		i.writeBatch(batch)
+		batch = batch[:0]
+		flush = nil
+	}
+}
+
+// ingestedEntry
+// An event along with the listings or sales it was converted to
+type ingestedEntry struct {
+	entry    *universalis.Entry
+	listings []db.Listing
+	sales    []db.Sale
+}
+
+// writeBatch
+// Writes a batch of events with as few repository calls as possible. Sales are all written together, but listings
+// can be added and removed again within the same batch, so each run of adds or removes is written in turn.
+func (i *Ingester) writeBatch(batch []*universalis.Entry) {
+	if len(batch) == 0 {
+		return
+	}
+
+	sales := make([]ingestedEntry, 0)
+	listingRun := make([]ingestedEntry, 0)
+	runEvent := ""
+
+	for _, entry := range batch {
+		switch entry.Event {
+		case "listings/add", "listings/remove":
+			i.markChangedWhileCatchingUp(entry.World, entry.Item)
+
+			if entry.Event != runEvent {
+				i.writeListings(runEvent, listingRun)
+				listingRun, runEvent = make([]ingestedEntry, 0), entry.Event
+			}
+
+			listingRun = append(listingRun, ingestedEntry{entry: entry, listings: *entry.ConvertToDbListings()})
+		case "sales/add":
+			sales = append(sales, ingestedEntry{entry: entry, sales: *entry.ConvertToDbSales()})
+		case catchUpStarted, catchUpFinished:
+			i.trackCatchUp(entry.World, entry.Event == catchUpStarted)
+		case catchUpRefresh:
+			// Listings queued before the refresh are written first, so it sees them when working out what's gone
+			i.writeListings(runEvent, listingRun)
+			listingRun, runEvent = make([]ingestedEntry, 0), ""
+
+			i.refreshItem(entry, &sales)
+		}
+	}
+
+	i.writeListings(runEvent, listingRun)
+	i.writeSales(sales)
+}
+
+// trackCatchUp
+// Starts or stops keeping track of which items live events change on a world while it's caught up on
+func (i *Ingester) trackCatchUp(worldId int, started bool) {
+	i.catchUpMutex.Lock()
+	defer i.catchUpMutex.Unlock()
+
+	tracking, ok := i.catchingUp[worldId]
+	if started {
+		if !ok {
+			tracking = &catchUpTracking{changed: make(map[int]struct{})}
+			i.catchingUp[worldId] = tracking
+		}
+
+		tracking.running++
+		return
+	}
+
+	if !ok {
+		return
+	}
+
+	if tracking.running--; tracking.running <= 0 {
+		delete(i.catchingUp, worldId)
+	}
+}
+
+func (i *Ingester) markChangedWhileCatchingUp(worldId, itemId int) {
+	i.catchUpMutex.Lock()
+	defer i.catchUpMutex.Unlock()
+
+	if tracking, ok := i.catchingUp[worldId]; ok {
+		tracking.changed[itemId] = struct{}{}
+	}
+}
+
+func (i *Ingester) changedWhileCatchingUp(worldId, itemId int) bool {
+	i.catchUpMutex.Lock()
+	defer i.catchUpMutex.Unlock()
+
+	tracking, ok := i.catchingUp[worldId]
+	if !ok {
+		return false
+	}
+
+	_, changed := tracking.changed[itemId]
+	return changed
+}
+
+func (i *Ingester) writeListings(event string, entries []ingestedEntry) {
+	switch event {
+	case "listings/add":
+		stored := storeWithFallback(
+			event, entries, func(entries []ingestedEntry) error {
+				listings := make([]db.Listing, 0)
+				for _, ingested := range entries {
+					listings = append(listings, ingested.listings...)
+				}
+
+				return i.repository.CreateListings(&listings)
+			},
+		)
+
+		for _, ingested := range stored {
+			worldId, itemId := ingested.entry.World, ingested.entry.Item
+
+			i.leaderboard.MarkListingsChanged(worldId, itemId)
+			i.alerts.ListingsAdded(worldId, itemId, ingested.listings)
+			i.marketStream.Publish(
+				stream.MarketEvent{
+					Type: stream.ListingsAdded, ItemId: itemId, WorldId: worldId, Listings: ingested.listings,
+				},
+			)
+		}
+	case "listings/remove":
+		stored := storeWithFallback(
+			event, entries, func(entries []ingestedEntry) error {
+				listingIds := make([]string, 0)
+				for _, ingested := range entries {
+					for _, listing := range ingested.listings {
+						listingIds = append(listingIds, listing.UniversalisId)
+					}
+				}
+
+				return i.repository.DeleteListings(listingIds)
+			},
+		)
+
+		for _, ingested := range stored {
+			worldId, itemId := ingested.entry.World, ingested.entry.Item
+
+			i.leaderboard.MarkListingsChanged(worldId, itemId)
+			i.marketStream.Publish(
+				stream.MarketEvent{
+					Type: stream.ListingsRemoved, ItemId: itemId, WorldId: worldId, Listings: ingested.listings,
+				},
+			)
+		}
+	}
+}
+
+func (i *Ingester) writeSales(entries []ingestedEntry) {
+	stored := storeWithFallback(
+		"sales/add", entries, func(entries []ingestedEntry) error {
+			sales := make([]db.Sale, 0)
+			for _, ingested := range entries {
+				sales = append(sales, ingested.sales...)
+			}
+
+			return i.repository.CreateSales(&sales)
+		},
+	)
+
+	for _, ingested := range stored {
+		worldId, itemId := ingested.entry.World, ingested.entry.Item
+
+		i.leaderboard.MarkSalesChanged(worldId, itemId)
+		i.alerts.SalesAdded(worldId, itemId, ingested.sales)
+		i.marketStream.Publish(
+			stream.MarketEvent{Type: stream.SalesAdded, ItemId: itemId, WorldId: worldId, Sales: ingested.sales},
+		)
+	}
+}
+
+// storeWithFallback
+// Stores events together, and if that fails stores them one at a time, so one bad event doesn't lose every other
+// event in the batch. Returns the events that were stored.
+func storeWithFallback(
+	event string,
+	entries []ingestedEntry,
+	store func(entries []ingestedEntry) error,
+) []ingestedEntry {
+	if len(entries) == 0 {
+		return entries
+	}
+
+	err := store(entries)
+	if err == nil {
+		return entries
+	}
+
+	if len(entries) == 1 {
+		log.Printf(
+			"failed to write %s for item %d on world %d: %s\n", event, entries[0].entry.Item, entries[0].entry.World, err,
+		)
+		return nil
+	}
+
+	log.Printf("failed to write %d %s events together, writing them one at a time: %s\n", len(entries), event, err)
+
+	stored := make([]ingestedEntry, 0, len(entries))
+	for _, ingested := range entries {
+		if err := store([]ingestedEntry{ingested}); err != nil {
+			log.Printf(
+				"failed to write %s for item %d on world %d: %s\n", event, ingested.entry.Item, ingested.entry.World, err,
+			)
+			continue
+		}
+
+		stored = append(stored, ingested)
+	}
+
+	return stored
+}
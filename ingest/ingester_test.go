@@ -0,0 +1,442 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/level-5-pidgey/MarketMoogle/api/universalis"
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	profitCalc "github.com/level-5-pidgey/MarketMoogle/profit"
+	"github.com/level-5-pidgey/MarketMoogle/stream"
+	"gopkg.in/mgo.v2/bson"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+// fakeMarketApi
+// Answers catch-up and backfill requests from fixed data
+type fakeMarketApi struct {
+	recent universalis.RecentlyUpdated
+	items  map[int]universalis.Entry
+	// Market data requests fail with this while it's set
+	err error
+	// How many items market data was asked for
+	requested int
+	// Called while market data is being fetched, if set
+	fetching func()
+}
+
+func (f *fakeMarketApi) RecentlyUpdated(
+	ctx context.Context,
+	worldId, entries int,
+) (*universalis.RecentlyUpdated, error) {
+	return &f.recent, nil
+}
+
+func (f *fakeMarketApi) MarketData(
+	ctx context.Context,
+	scope string,
+	itemIds []int,
+	options universalis.MarketOptions,
+) (map[int]*universalis.Entry, error) {
+	f.requested += len(itemIds)
+	if f.fetching != nil {
+		f.fetching()
+	}
+
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	entries := make(map[int]*universalis.Entry)
+	for _, itemId := range itemIds {
+		if entry, ok := f.items[itemId]; ok {
+			entries[itemId] = &entry
+		}
+	}
+
+	return entries, nil
+}
+
+func newTestIngester(t *testing.T, api MarketApi) (*Ingester, *db.MockRepository, *stream.Subscription) {
+	t.Helper()
+
+	worlds := map[int]int{1: 1, 2: 1}
+	itemMap := map[int]*profitCalc.Item{1: {Id: 1, CanBeTraded: true}, 2: {Id: 2, CanBeTraded: true}}
+	repo := db.NewMockRepository()
+	calculator := profitCalc.NewProfitCalculator(&itemMap, nil, nil, repo, nil)
+
+	hub := stream.NewHub(worlds)
+	subscription := hub.Subscribe(stream.Filter{})
+	t.Cleanup(
+		func() {
+			hub.Unsubscribe(subscription)
+		},
+	)
+
+	ingester := NewIngester(
+		repo,
+		profitCalc.NewProfitLeaderboard(calculator, worlds, 1),
+		profitCalc.NewAlertMonitor(calculator, repo, nil, worlds),
+		hub,
+		api,
+		2,
+	)
+
+	return ingester, repo, subscription
+}
+
+func listingEntry(event string, worldId, itemId int, listingIds ...string) *universalis.Entry {
+	entry := &universalis.Entry{Event: event, Item: itemId, World: worldId}
+	for _, listingId := range listingIds {
+		entry.Listings = append(
+			entry.Listings, universalis.Listing{
+				MarketInfo: universalis.MarketInfo{PricePerUnit: 100, Quantity: 1, Total: 100},
+				ListingId:  listingId,
+			},
+		)
+	}
+
+	return entry
+}
+
+// writeQueued
+// Writes every queued event in a single batch, the way a worker would
+func writeQueued(ingester *Ingester) {
+	batch := make([]*universalis.Entry, 0)
+	for _, queue := range ingester.queues {
+		for len(queue) > 0 {
+			batch = append(batch, <-queue)
+		}
+	}
+
+	ingester.writeBatch(batch)
+}
+
+func storedListingIds(t *testing.T, repo *db.MockRepository, itemId, worldId int) map[string]struct{} {
+	t.Helper()
+
+	listings, err := repo.GetListingsForItemOnWorld(itemId, worldId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make(map[string]struct{}, len(*listings))
+	for _, listing := range *listings {
+		ids[listing.UniversalisId] = struct{}{}
+	}
+
+	return ids
+}
+
+func TestIngester_writeBatch(t *testing.T) {
+	ingester, repo, subscription := newTestIngester(t, nil)
+
+	now := time.Now().Unix()
+	ingester.writeBatch(
+		[]*universalis.Entry{
+			listingEntry("listings/add", 1, 1, "a", "b"),
+			// Relisted straight away, so removing it has to happen before it's added again
+			listingEntry("listings/remove", 1, 1, "b"),
+			listingEntry("listings/add", 1, 1, "b", "c"),
+			listingEntry("listings/remove", 1, 1, "a"),
+			{
+				Event: "sales/add", Item: 2, World: 2,
+				Sales: []universalis.Sale{
+					{MarketInfo: universalis.MarketInfo{PricePerUnit: 50, Quantity: 2, Total: 100}, Timestamp: now},
+				},
+			},
+			{Event: "sales/remove", Item: 2, World: 2},
+		},
+	)
+
+	listings := storedListingIds(t, repo, 1, 1)
+	if _, ok := listings["a"]; ok || len(listings) != 2 {
+		t.Errorf("writeBatch() left listings %v, want b and c", listings)
+	}
+
+	sales, _ := repo.GetSalesForItemOnWorld(2, 2)
+	if len(*sales) != 1 {
+		t.Errorf("writeBatch() stored %d sales, want 1", len(*sales))
+	}
+
+	// Every event but the removed sale is rebroadcast
+	if got := len(subscription.Events()); got != 5 {
+		t.Errorf("writeBatch() published %d events, want 5", got)
+	}
+}
+
+// rejectingRepository
+// Refuses to create any batch of sales with a sale that has no price, the way the database's price check does
+type rejectingRepository struct {
+	*db.MockRepository
+}
+
+func (r rejectingRepository) CreateSales(sales *[]db.Sale) error {
+	for _, sale := range *sales {
+		if sale.PricePer <= 0 {
+			return errors.New("sales_price_check")
+		}
+	}
+
+	return r.MockRepository.CreateSales(sales)
+}
+
+func TestIngester_writeBatchFallback(t *testing.T) {
+	ingester, repo, _ := newTestIngester(t, nil)
+	ingester.repository = rejectingRepository{repo}
+
+	now := time.Now().Unix()
+	ingester.writeBatch(
+		[]*universalis.Entry{
+			{
+				Event: "sales/add", Item: 1, World: 1,
+				Sales: []universalis.Sale{
+					{MarketInfo: universalis.MarketInfo{PricePerUnit: 100, Quantity: 1, Total: 100}, Timestamp: now},
+				},
+			},
+			{
+				Event: "sales/add", Item: 2, World: 1,
+				Sales: []universalis.Sale{{MarketInfo: universalis.MarketInfo{Quantity: 1}, Timestamp: now}},
+			},
+			{
+				Event: "sales/add", Item: 1, World: 2,
+				Sales: []universalis.Sale{
+					{MarketInfo: universalis.MarketInfo{PricePerUnit: 50, Quantity: 2, Total: 100}, Timestamp: now},
+				},
+			},
+		},
+	)
+
+	// Only the sale that can't be written is lost, rather than the whole batch
+	tests := []struct {
+		name      string
+		itemId    int
+		worldId   int
+		wantSales int
+	}{
+		{name: "Sale before the bad one", itemId: 1, worldId: 1, wantSales: 1},
+		{name: "Bad sale", itemId: 2, worldId: 1, wantSales: 0},
+		{name: "Sale after the bad one", itemId: 1, worldId: 2, wantSales: 1},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				sales, err := repo.GetSalesForItemOnWorld(tt.itemId, tt.worldId)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(*sales) != tt.wantSales {
+					t.Errorf("writeBatch() stored %d sales, want %d", len(*sales), tt.wantSales)
+				}
+			},
+		)
+	}
+}
+
+func TestIngester_Run(t *testing.T) {
+	ingester, repo, subscription := newTestIngester(t, nil)
+	ingester.BatchSize = 3
+	ingester.BatchWait = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		ingester.Run(ctx)
+	}()
+
+	// A full batch is written without waiting
+	for _, listingId := range []string{"a", "b", "c"} {
+		ingester.Handle(listingEntry("listings/add", 1, 1, listingId))
+	}
+
+	select {
+	case <-subscription.Events():
+	case <-time.After(2 * time.Second):
+		t.Fatalf("a full batch wasn't written straight away")
+	}
+
+	// Anything left is written when stopping
+	ingester.Handle(listingEntry("listings/add", 1, 2, "d"))
+	cancel()
+	<-stopped
+
+	if listings := storedListingIds(t, repo, 2, 1); len(listings) != 1 {
+		t.Errorf("Run() left listings %v for item 2 after stopping, want the unfinished batch written", listings)
+	}
+
+	// Events without a world can't be routed, so they're dropped
+	ingester.Handle(&universalis.Entry{Event: "listings/add", Item: 1})
+}
+
+func TestIngester_CatchUp(t *testing.T) {
+	gap := universalis.Gap{From: time.Now().Add(-time.Hour), To: time.Now()}
+
+	api := &fakeMarketApi{
+		recent: universalis.RecentlyUpdated{
+			Items: []universalis.RecentlyUpdatedItem{
+				{ItemId: 1, WorldId: 1, LastUploadTime: gap.To.UnixMilli()},
+				// Uploaded before the connection dropped, so already received
+				{ItemId: 2, WorldId: 1, LastUploadTime: gap.From.Add(-time.Minute).UnixMilli()},
+			},
+		},
+		items: map[int]universalis.Entry{
+			1: {
+				Listings: listingEntry("", 0, 0, "kept", "new").Listings,
+				RecentHistory: []universalis.Sale{
+					{MarketInfo: universalis.MarketInfo{PricePerUnit: 10, Quantity: 1}, Timestamp: gap.To.Unix()},
+					{
+						MarketInfo: universalis.MarketInfo{PricePerUnit: 10, Quantity: 1},
+						Timestamp:  gap.From.Add(-time.Minute).Unix(),
+					},
+				},
+			},
+		},
+	}
+
+	ingester, repo, subscription := newTestIngester(t, api)
+	ingester.writeBatch(
+		[]*universalis.Entry{
+			listingEntry("listings/add", 1, 1, "kept", "sold"),
+			listingEntry("listings/add", 1, 2, "untouched"),
+		},
+	)
+
+	for len(subscription.Events()) > 0 {
+		<-subscription.Events()
+	}
+
+	ingester.CatchUp(context.Background(), []int{1}, gap)
+	writeQueued(ingester)
+
+	listings := storedListingIds(t, repo, 1, 1)
+	_, kept := listings["kept"]
+	_, added := listings["new"]
+	if len(listings) != 2 || !kept || !added {
+		t.Errorf("CatchUp() left listings %v, want kept and new", listings)
+	}
+
+	if listings = storedListingIds(t, repo, 2, 1); len(listings) != 1 {
+		t.Errorf("CatchUp() changed listings for an item that wasn't updated: %v", listings)
+	}
+
+	sales, _ := repo.GetSalesForItemOnWorld(1, 1)
+	if len(*sales) != 1 {
+		t.Errorf("CatchUp() stored %d sales, want only the one made while disconnected", len(*sales))
+	}
+
+	// Caught up changes are announced like live ones
+	published := make(map[stream.EventType]int)
+	for len(subscription.Events()) > 0 {
+		event := <-subscription.Events()
+		published[event.Type] += len(event.Listings) + len(event.Sales)
+	}
+
+	want := map[stream.EventType]int{stream.ListingsAdded: 2, stream.ListingsRemoved: 1, stream.SalesAdded: 1}
+	if !reflect.DeepEqual(published, want) {
+		t.Errorf("CatchUp() published %v listings and sales, want %v", published, want)
+	}
+
+	if len(ingester.catchingUp) != 0 {
+		t.Errorf("CatchUp() is still tracking worlds %v after finishing", ingester.catchingUp)
+	}
+}
+
+func TestIngester_CatchUpWithLiveEvents(t *testing.T) {
+	gap := universalis.Gap{From: time.Now().Add(-time.Hour), To: time.Now()}
+
+	api := &fakeMarketApi{
+		recent: universalis.RecentlyUpdated{
+			Items: []universalis.RecentlyUpdatedItem{
+				{ItemId: 1, WorldId: 1, LastUploadTime: gap.To.UnixMilli()},
+				{ItemId: 2, WorldId: 1, LastUploadTime: gap.To.UnixMilli()},
+			},
+		},
+		items: map[int]universalis.Entry{
+			1: {Listings: listingEntry("", 0, 0, "old").Listings},
+			2: {Listings: listingEntry("", 0, 0, "fetched").Listings},
+		},
+	}
+
+	ingester, repo, _ := newTestIngester(t, api)
+	ingester.writeBatch([]*universalis.Entry{listingEntry("listings/add", 1, 2, "sold")})
+
+	// A listing arrives over the websocket after item 1's listings were fetched, so it's newer than them
+	api.fetching = func() {
+		ingester.Handle(listingEntry("listings/add", 1, 1, "old", "live"))
+	}
+
+	ingester.CatchUp(context.Background(), []int{1}, gap)
+	writeQueued(ingester)
+
+	tests := []struct {
+		name         string
+		itemId       int
+		wantListings []string
+	}{
+		{name: "Changed by a live event", itemId: 1, wantListings: []string{"live", "old"}},
+		{name: "Only caught up", itemId: 2, wantListings: []string{"fetched"}},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				listings := storedListingIds(t, repo, tt.itemId, 1)
+				got := make([]string, 0, len(listings))
+				for listingId := range listings {
+					got = append(got, listingId)
+				}
+
+				slices.Sort(got)
+				if !slices.Equal(got, tt.wantListings) {
+					t.Errorf("CatchUp() left listings %v, want %v", got, tt.wantListings)
+				}
+			},
+		)
+	}
+}
+
+func TestIngester_Replay(t *testing.T) {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	for _, entry := range []*universalis.Entry{
+		listingEntry("listings/add", 1, 1, "a", "b"),
+		listingEntry("listings/remove", 1, 1, "a"),
+	} {
+		message, _ := bson.Marshal(entry)
+		_ = encoder.Encode(universalis.Record{Kind: universalis.RecordMessage, At: time.Now(), Data: message})
+	}
+
+	recording, err := universalis.ReadRecording(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ingester, repo, _ := newTestIngester(t, nil)
+	ingester.BatchWait = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		ingester.Run(ctx)
+	}()
+
+	if _, err = recording.Replay(context.Background(), 0, ingester.Handle); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	<-stopped
+
+	listings := storedListingIds(t, repo, 1, 1)
+	if _, ok := listings["b"]; !ok || len(listings) != 1 {
+		t.Errorf("replaying left listings %v, want b", listings)
+	}
+}
@@ -1,45 +1,78 @@
 package main
 
 import (
-	"encoding/json"
-	"errors"
+	"context"
 	"flag"
 	"fmt"
 	cache "github.com/go-pkgz/expirable-cache"
-	"github.com/gorilla/websocket"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/level-5-pidgey/MarketMoogle/api/universalis"
 	"github.com/level-5-pidgey/MarketMoogle/csv"
 	dc "github.com/level-5-pidgey/MarketMoogle/csv/datacollection"
 	"github.com/level-5-pidgey/MarketMoogle/csv/readertype"
 	"github.com/level-5-pidgey/MarketMoogle/db"
+	"github.com/level-5-pidgey/MarketMoogle/ingest"
+	"github.com/level-5-pidgey/MarketMoogle/notify"
 	"github.com/level-5-pidgey/MarketMoogle/profit"
 	"github.com/level-5-pidgey/MarketMoogle/profit/exchange"
-	"gopkg.in/mgo.v2/bson"
-	"io"
+	"github.com/level-5-pidgey/MarketMoogle/stream"
+	"github.com/level-5-pidgey/MarketMoogle/util"
 	"log"
 	"net/http"
-	"net/url"
 	"os"
-	"reflect"
+	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 )
 
 const (
-	writeWait = 8 * time.Second
+	leaderboardInterval = 15 * time.Minute
 
-	pongWait = 60 * time.Second
+	leaderboardDirtyInterval = 5 * time.Second
 
-	pingPeriod = (pongWait * 6) / 10
+	leaderboardWorkers = 8
+
+	// Tax rates change once a week, so checking a few times a day picks up the new rates soon enough
+	taxRateInterval = 6 * time.Hour
+
+	alertReloadInterval = 5 * time.Minute
+
+	alertCheckInterval = 10 * time.Second
+
+	webhookWorkers = 4
+
+	ingestWorkers = 4
+
+	// How many websockets the subscriptions for every world are spread over, unless configured
+	defaultMarketConnections = 4
+
+	// Sales older than two years aren't stored, so there's nothing to roll up past that
+	rollupBackfillDays = 730
 )
 
 func main() {
 	setupFlag := flag.Bool("setup", false, "runs setup code to initialize db and populate item data")
+	backfillFlag := flag.Bool("backfill-rollups", false, "rebuilds the hourly and daily sales rollups, then exits")
+	backfillDays := flag.Int("backfill-days", rollupBackfillDays, "how many days of sales to rebuild rollups for")
+	setupWorlds := flag.String("setup-worlds", "", "comma separated worlds to populate during setup, all of them if empty")
+	setupItems := flag.String("setup-items", "", "comma separated item ids to populate during setup, all of them if empty")
+	setupWorkers := flag.Int("setup-workers", ingest.DefaultBackfillWorkers, "how many requests setup makes at once")
+	setupRestart := flag.Bool("setup-restart", false, "forgets what earlier setup runs populated and starts over")
+	replayFile := flag.String(
+		"replay", "", "replays market data from a recording into an empty database instead of listening to universalis",
+	)
+	replaySpeed := flag.Float64("replay-speed", 1, "how many times faster than real time to replay, 0 for no waiting")
 
 	flag.Parse()
 
+	// Stop cleanly on ctrl+c or when docker stops the container
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	collection, err := dc.CreateDataCollection()
 	if err != nil {
 		log.Fatal(err)
@@ -190,6 +223,11 @@ func main() {
 		database.Close()
 	}(repository.DbPool)
 
+	if *backfillFlag {
+		backfillSaleRollups(repository, *backfillDays)
+		return
+	}
+
 	app := &Application{
 		Config: Config{
 			Port: os.Getenv("API_PORT"),
@@ -199,9 +237,163 @@ func main() {
 	// Create Profit Calculator
 	p := profitCalc.NewProfitCalculator(&profitItems, &itemsByObtainInfo, &itemsByExchangeMethod, repository, c)
 
+	// The data center each world is in
+	worldDataCenters := make(map[int]int, len(*worlds))
+	for worldId, world := range *worlds {
+		worldDataCenters[worldId] = world.DataCenterId
+	}
+
+	marketWorlds := selectMarketWorlds(
+		worlds,
+		os.Getenv("UNIVERSALIS_REGIONS"),
+		os.Getenv("UNIVERSALIS_DATA_CENTERS"),
+		os.Getenv("UNIVERSALIS_WORLDS"),
+	)
+
+	// Keep a ranked list of every item's profit on each tracked world up to date in the background. Only worlds with
+	// market data coming in are tracked unless others are chosen, as every tracked world is a full sweep of every item.
+	leaderboardWorldIds := marketWorlds
+	leaderboardRegions := os.Getenv("LEADERBOARD_REGIONS")
+	leaderboardDataCenters := os.Getenv("LEADERBOARD_DATA_CENTERS")
+	leaderboardWorldList := os.Getenv("LEADERBOARD_WORLDS")
+	if strings.TrimSpace(leaderboardRegions+leaderboardDataCenters+leaderboardWorldList) != "" {
+		leaderboardWorldIds = selectMarketWorlds(worlds, leaderboardRegions, leaderboardDataCenters, leaderboardWorldList)
+	}
+
+	leaderboardWorlds := make(map[int]int, len(leaderboardWorldIds))
+	for _, worldId := range leaderboardWorldIds {
+		leaderboardWorlds[worldId] = worldDataCenters[worldId]
+	}
+
+	leaderboard := profitCalc.NewProfitLeaderboard(p, leaderboardWorlds, leaderboardWorkers)
+	go leaderboard.Run(ctx, leaderboardInterval, leaderboardDirtyInterval)
+
+	// Check price alerts as market data comes in, sending matches to their webhooks
+	webhookSecret := readDockerSecret("webhook_secret")
+	if strings.TrimSpace(webhookSecret) == "" {
+		log.Printf("no webhook_secret is set, so JSON price alerts won't be sent until one is\n")
+	}
+
+	webhooks := notify.NewWebhookSender(repository, webhookSecret)
+	webhooks.Discord = notify.DiscordFormatter{
+		ItemName: func(itemId int) string {
+			if item, ok := (*collection.Items)[itemId]; ok {
+				return item.Name
+			}
+
+			return ""
+		},
+		WorldName: func(worldId int) string {
+			if world, ok := (*worlds)[worldId]; ok {
+				return world.Name
+			}
+
+			return ""
+		},
+	}
+	go webhooks.Run(ctx, webhookWorkers)
+
+	// Post the best flips on each digest world to Discord once a day
+	if digestUrl := os.Getenv("DIGEST_WEBHOOK_URL"); digestUrl != "" {
+		digest := notify.NewDigest(
+			leaderboard, webhooks, webhooks.Discord, notify.DigestConfig{
+				WebhookUrl: digestUrl,
+				WorldIds:   parseWorldIds(os.Getenv("DIGEST_WORLDS"), worlds),
+				Hour:       util.SafeStringToInt(os.Getenv("DIGEST_HOUR")),
+			},
+		)
+		go digest.Run(ctx)
+	}
+
+	alerts := profitCalc.NewAlertMonitor(p, repository, webhooks, worldDataCenters)
+	go alerts.Run(ctx, alertReloadInterval, alertCheckInterval)
+
+	// Rebroadcast market changes to anyone streaming them from the API
+	marketStream := stream.NewHub(worldDataCenters)
+
+	// Rate limited client for the Universalis REST API, which can be pointed at a local server
+	universalisClient := universalis.NewClient(os.Getenv("UNIVERSALIS_API_URL"))
+
+	// Replaying a recording answers every request from it, so nothing needs Universalis
+	var recording *universalis.Recording
+	if *replayFile != "" {
+		recording, err = universalis.LoadRecording(*replayFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Replayed data is written like live data, so it would be mixed in with (and could overwrite) whatever's stored
+		hasData, err := repository.HasMarketData()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if hasData {
+			log.Fatal("refusing to replay into a database that already has market data, replay into an empty one instead")
+		}
+
+		universalisClient = universalis.NewReplayClient(recording)
+	}
+
+	// Record everything received from Universalis so problems can be reproduced offline later
+	var recorder *universalis.Recorder
+	if recordDir := os.Getenv("UNIVERSALIS_RECORD_DIR"); recordDir != "" && recording == nil {
+		recorder, err = universalis.NewRecorder(recordDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		defer recorder.Close()
+
+		universalisClient.Recorder = recorder
+		log.Printf("recording universalis market data to %s\n", recorder.Path())
+	}
+
+	// Keep each world's tax rates current, as they set what players can list items for. Replays have no tax rates
+	// recorded, so they use the default rate.
+	if recording == nil {
+		taxWorlds := slices.Clone(marketWorlds)
+		for _, worldId := range leaderboardWorldIds {
+			if !slices.Contains(taxWorlds, worldId) {
+				taxWorlds = append(taxWorlds, worldId)
+			}
+		}
+
+		go p.TaxRates.Run(ctx, universalisClient, taxWorlds, taxRateInterval)
+	}
+
+	// Listen to the chosen worlds over a few shared websockets, writing their events in batches and catching up on
+	// anything missed whenever a connection comes back
+	ingester := ingest.NewIngester(repository, leaderboard, alerts, marketStream, universalisClient, ingestWorkers)
+	ingesterDone := make(chan struct{})
+	go func() {
+		defer close(ingesterDone)
+
+		ingester.Run(ctx)
+	}()
+
+	// Deferred after the database so it runs first, letting the ingester write what it still has before the pool
+	// closes. Stopping first makes sure the ingester finishes even when the feeds or a replay stopped on their own.
+	defer func() {
+		stop()
+		<-ingesterDone
+		log.Println("finished writing market data")
+	}()
+
+	connections := defaultMarketConnections
+	if configured := util.SafeStringToInt(os.Getenv("UNIVERSALIS_CONNECTIONS")); configured > 0 {
+		connections = configured
+	}
+
+	marketFeeds := universalis.NewWebsocketPool(marketWorlds, connections, ingester.Handle)
+	marketFeeds.OnReconnect(ingester.CatchUp)
+	if recorder != nil {
+		marketFeeds.SetRecorder(recorder)
+	}
+
 	// Start up API server
 	go func() {
-		err = app.Serve(collection, worlds, p)
+		err = app.Serve(collection, worlds, p, repository, leaderboard, alerts, marketStream, marketFeeds)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -217,114 +409,159 @@ func main() {
 			log.Fatal(err)
 		}
 
-		// Get initial listing and sales data with Universalis API
-		for _, item := range profitItems {
-			if item.MarketProhibited {
-				continue
-			}
+		itemIds, err := selectBackfillItems(profitItems, *setupItems)
+		if err != nil {
+			log.Fatal(err)
+		}
 
-			itemWaitGroup := &sync.WaitGroup{}
-
-			// Search for listings for this item on all data centers
-			for _, world := range *worlds {
-				itemWaitGroup.Add(1)
-
-				go func(world *readertype.World, group *sync.WaitGroup) {
-					defer group.Done()
-
-					listingsUrl := fmt.Sprintf(
-						"https://universalis.app/api/v2/%s/%d?listings=40&entries=20",
-						strings.ToLower(world.DataCenterName),
-						item.Id,
-					)
-
-					data, apiErr := makeApiRequest[universalis.Entry](listingsUrl)
-					if apiErr != nil && apiErr.Error() != "response object is empty" {
-						log.Printf("failed to get listings from universalis: %s\n", apiErr)
-					}
-
-					if data == nil {
-						return
-					}
-
-					// Assign the item id to the data because for some reason universalis uses 2 different "item id" names
-					data.Item = item.Id
-
-					listings := data.ConvertToDbListings()
-
-					apiErr = repository.CreateListings(listings)
-					if apiErr != nil {
-						log.Printf("failed to create listings in db: %s\n", apiErr)
-					} else {
-						fmt.Printf(
-							"Added %d listings for item #%d on the %s datacenter\n",
-							len(*listings),
-							item.Id,
-							world.Name,
-						)
-					}
-
-					sales := data.ConvertToDbSales()
-					apiErr = repository.CreateSales(sales)
-					if apiErr != nil {
-						log.Printf("failed to create listings in db: %s\n", apiErr)
-					} else {
-						fmt.Printf(
-							"Added %d sales for item #%d on the %s datacenter\n",
-							len(*sales),
-							item.Id,
-							world.Name,
-						)
-					}
-				}(world, itemWaitGroup)
-			}
+		// Get initial listing and sales data with Universalis API, carrying on from the last run if it was stopped
+		backfill := ingest.NewBackfill(
+			repository, universalisClient, ingest.BackfillConfig{
+				WorldIds: selectMarketWorlds(worlds, "", "", *setupWorlds),
+				ItemIds:  itemIds,
+				Workers:  *setupWorkers,
+				Restart:  *setupRestart,
+			},
+		)
 
-			itemWaitGroup.Wait()
+		if _, err = backfill.Run(ctx); err != nil {
+			log.Printf("setup didn't finish: %s\n", err)
 		}
 	}
 
-	// Poll Universalis for Market data
-	wg := &sync.WaitGroup{}
+	if recording != nil {
+		replayMarketData(ctx, recording, *replaySpeed, ingester)
+		return
+	}
 
-	for worldId := range *worlds {
-		wg.Add(1)
-		go dialUp(repository, wg, worldId)
+	// Listen to Universalis for market data until we're told to stop
+	log.Printf("listening to %d worlds over %d connections\n", len(marketWorlds), len(marketFeeds.Status()))
+	marketFeeds.Run(ctx)
+	log.Println("stopped listening to universalis")
+}
+
+// replayMarketData
+// Feeds a recording's websocket messages through the ingester as if they'd just been received, then keeps serving the
+// API until we're told to stop. Replayed data is stored like live data, so main only replays into an empty database.
+func replayMarketData(ctx context.Context, recording *universalis.Recording, speed float64, ingester *ingest.Ingester) {
+	log.Printf("replaying %d market messages at %gx speed\n", recording.MessageCount(), speed)
+
+	replayed, err := recording.Replay(ctx, speed, ingester.Handle)
+	if err != nil {
+		log.Printf("stopped replaying after %d messages: %s\n", replayed, err)
+		return
+	}
+
+	log.Printf("replayed %d market messages\n", replayed)
+	<-ctx.Done()
+}
+
+// backfillSaleRollups
+// Rebuilds the sale rollups one day at a time, oldest first, so each transaction stays small
+func backfillSaleRollups(repository db.Repository, days int) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	start := time.Now()
+
+	for day := days; day >= 0; day-- {
+		dayStart := today.AddDate(0, 0, -day)
+
+		err := repository.RebuildSaleRollups(dayStart, dayStart)
+		if err != nil {
+			log.Printf("failed to rebuild sale rollups for %s: %s\n", dayStart.Format(time.DateOnly), err)
+			continue
+		}
+
+		if day%30 == 0 {
+			log.Printf("Rebuilt sale rollups up to %s (%d days left)\n", dayStart.Format(time.DateOnly), day)
+		}
 	}
 
-	wg.Wait()
+	log.Printf("Finished rebuilding %d days of sale rollups in %s\n", days+1, time.Since(start))
 }
 
-func makeApiRequest[T any](url string) (*T, error) {
-	resp, requestError := http.Get(url)
-	if requestError != nil {
-		log.Fatal(requestError)
-		return nil, requestError
+// parseWorldIds
+// Reads a comma separated list of world ids, leaving out any that don't exist
+func parseWorldIds(list string, worlds *map[int]*readertype.World) []int {
+	worldIds := make([]int, 0)
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		worldId, err := strconv.Atoi(field)
+		if _, ok := (*worlds)[worldId]; err != nil || !ok {
+			log.Printf("ignoring unknown world %q\n", field)
+			continue
+		}
+
+		worldIds = append(worldIds, worldId)
 	}
 
-	// API has a DNS problem or is offline, cancel unmarshalling
-	if resp.StatusCode == 522 {
-		return nil, errors.New("522 code returned from api request")
+	return worldIds
+}
+
+// selectMarketWorlds
+// The worlds to listen to for market data: any in the given comma separated regions, data centers or worlds, which can
+// be names or ids. Every world is listened to if none are given.
+func selectMarketWorlds(worlds *map[int]*readertype.World, regions, dataCenters, worldList string) []int {
+	listenToAll := strings.TrimSpace(regions+dataCenters+worldList) == ""
+
+	worldIds := make([]int, 0, len(*worlds))
+	for worldId, world := range *worlds {
+		// Region, data center and world ids overlap, so each list is only checked against its own kind
+		if listenToAll ||
+			listContains(regions, world.RegionId, world.RegionName) ||
+			listContains(dataCenters, world.DataCenterId, world.DataCenterName) ||
+			listContains(worldList, worldId, world.Name) {
+			worldIds = append(worldIds, worldId)
+		}
 	}
 
-	body, readAllError := io.ReadAll(resp.Body)
-	if readAllError != nil {
-		log.Fatal(readAllError)
-		return nil, readAllError
+	if len(worldIds) == 0 {
+		log.Printf("no worlds match the configured regions, data centers or worlds\n")
 	}
 
-	var responseObject T
-	var empty T
-	err := json.Unmarshal(body, &responseObject)
-	if err != nil {
-		return nil, err
+	return worldIds
+}
+
+// selectBackfillItems
+// Parses a comma separated list of item ids to populate during setup, or every item on the market board if it's empty
+func selectBackfillItems(items map[int]*profitCalc.Item, itemList string) ([]int, error) {
+	itemIds := make([]int, 0)
+	if strings.TrimSpace(itemList) == "" {
+		for itemId, item := range items {
+			if !item.MarketProhibited {
+				itemIds = append(itemIds, itemId)
+			}
+		}
+
+		return itemIds, nil
 	}
 
-	// Check if the response object is empty
-	if reflect.DeepEqual(responseObject, empty) {
-		return nil, errors.New("response object is empty")
+	for _, field := range strings.Split(itemList, ",") {
+		itemId, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, fmt.Errorf("invalid item id %q in setup items: %w", field, err)
+		}
+
+		itemIds = append(itemIds, itemId)
 	}
 
-	return &responseObject, nil
+	return itemIds, nil
+}
+
+// listContains
+// Checks if a comma separated list has the given id or name in it
+func listContains(list string, id int, name string) bool {
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field != "" && (field == strconv.Itoa(id) || strings.EqualFold(field, name)) {
+			return true
+		}
+	}
+
+	return false
 }
 
 func getGameServers() (*map[int]*readertype.World, *map[int]*readertype.DataCenter, error) {
@@ -450,151 +687,6 @@ func getGameServers() (*map[int]*readertype.World, *map[int]*readertype.DataCent
 	return &gameWorlds, &dataCenters, nil
 }
 
-func dialUp(repository db.Repository, wg *sync.WaitGroup, worldId int) {
-	defer wg.Done()
-
-	interrupt := make(chan os.Signal, 1)
-
-	u := url.URL{
-		Scheme: "wss",
-		Host:   "universalis.app",
-		Path:   "/api/ws",
-	}
-
-	log.Printf("subscribing to ws %s with worldId %d\n", u.String(), worldId)
-
-	c, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
-	if err != nil {
-		log.Fatal("dial:", err)
-	}
-
-	done := make(chan struct{})
-
-	go func() {
-		defer close(done)
-
-		subscribeToChannel("listings/add", worldId, c)
-		subscribeToChannel("sales/add", worldId, c)
-		subscribeToChannel("listings/remove", worldId, c)
-		subscribeToChannel("sales/remove", worldId, c)
-
-		for {
-			msgType, message, err := c.ReadMessage()
-
-			if err != nil {
-				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-					log.Printf("error: %v", err)
-				}
-				break
-			}
-
-			if msgType != websocket.BinaryMessage {
-				break
-			}
-
-			var data universalis.Entry
-			err = bson.Unmarshal(message, &data)
-			if err != nil {
-				log.Printf("failed to unmarshal: %s\n", err)
-				return
-			}
-
-			switch data.Event {
-			case "listings/add":
-				dbListings := data.ConvertToDbListings()
-				err := repository.CreateListings(dbListings)
-
-				if err != nil {
-					log.Printf("failed to create listings in db: %s\n", err)
-				}
-			case "sales/add":
-				dbSales := data.ConvertToDbSales()
-				err := repository.CreateSales(dbSales)
-
-				if err != nil {
-					log.Printf("failed to create sales in db: %s\n", err)
-				}
-			case "listings/remove":
-				listingIds := make([]string, len(data.Listings))
-				for index, listing := range data.Listings {
-					listingIds[index] = listing.ListingId
-				}
-
-				err := repository.DeleteListings(listingIds)
-				if err != nil {
-					log.Printf("failed to delete listings in db: %s\n", err)
-				}
-			case "sales/remove":
-				log.Printf("removed sale\n")
-			}
-		}
-	}()
-
-	ticker := time.NewTicker(pingPeriod)
-
-	/*defer func() {
-		ticker.Stop()
-		log.Printf("closed connection on worldId %d\n", worldId)
-		err := c.Close()
-		if err != nil {
-			return
-		}
-	}()*/
-
-	for {
-		select {
-		case <-done:
-			return
-		case <-ticker.C:
-			err := c.SetWriteDeadline(time.Now().Add(writeWait))
-			if err != nil {
-				log.Println(err)
-				return
-			}
-
-			if err := c.WriteMessage(websocket.PingMessage, nil); err != nil {
-				log.Println(err)
-				return
-			}
-		case <-interrupt:
-			log.Println("interrupted")
-
-			err := c.WriteMessage(
-				websocket.CloseMessage,
-				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
-			)
-
-			if err != nil {
-				log.Println("write closed", err)
-				return
-			}
-			select {
-			case <-done:
-			case <-time.After(time.Second):
-			}
-			return
-		}
-	}
-}
-
-func subscribeToChannel(channelName string, worldId int, c *websocket.Conn) {
-	subMsg, err := bson.Marshal(
-		map[string]string{
-			"event":   "subscribe",
-			"channel": fmt.Sprintf("%s{world=%d}", channelName, worldId),
-		},
-	)
-
-	if err != nil {
-		log.Fatal("marshal:", err)
-	}
-
-	err = c.WriteMessage(websocket.BinaryMessage, subMsg)
-	if err != nil {
-		log.Fatal("write:", err)
-	}
-}
-
 func readDockerSecret(secretName string) string {
 	secretPath := os.Getenv("SECRETS_DIR") + secretName + os.Getenv("SECRETS_SUFFIX")
 	secret, err := os.ReadFile(secretPath)
@@ -617,12 +709,17 @@ func (app *Application) Serve(
 	collection *dc.DataCollection,
 	worlds *map[int]*readertype.World,
 	profitCalc *profitCalc.ProfitCalculator,
+	repository db.Repository,
+	leaderboard *profitCalc.ProfitLeaderboard,
+	alerts *profitCalc.AlertMonitor,
+	marketStream *stream.Hub,
+	marketFeeds *universalis.WebsocketPool,
 ) error {
 	port := app.Config.Port
 
 	srv := &http.Server{
 		Addr:    fmt.Sprintf(":%s", port),
-		Handler: Routes(collection, worlds, profitCalc),
+		Handler: Routes(collection, worlds, profitCalc, repository, leaderboard, alerts, marketStream, marketFeeds),
 	}
 
 	return srv.ListenAndServe()
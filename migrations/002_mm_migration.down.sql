@@ -0,0 +1 @@
+DROP TABLE IF EXISTS public.player_profiles;
\ No newline at end of file
@@ -0,0 +1,24 @@
+create table public.player_profiles
+(
+    profile_id         integer generated always as identity
+        primary key,
+    name               varchar(50) not null,
+    home_world_id      integer     not null,
+    grand_company_rank smallint    default 0
+        constraint player_profiles_gc_rank_check
+            check (grand_company_rank >= 0 and grand_company_rank <= 11),
+    skip_crystals      boolean     default true,
+    job_levels         jsonb       default '{}'::jsonb not null,
+    recipe_books       varchar[]   default '{}'::varchar[] not null,
+    created_at         timestamp   default (now() at time zone 'utc') not null,
+    updated_at         timestamp   default (now() at time zone 'utc') not null
+);
+
+comment on table public.player_profiles is 'Player setups used to tailor profit calculations.';
+
+comment on column public.player_profiles.job_levels is 'Map of job abbreviation to level, e.g. {"CRP": 90}.';
+
+comment on column public.player_profiles.recipe_books is 'Names of the secret recipe books the player has unlocked.';
+
+alter table public.player_profiles
+    owner to admin;
@@ -0,0 +1 @@
+ALTER TABLE IF EXISTS public.player_profiles DROP COLUMN IF EXISTS specialists;
\ No newline at end of file
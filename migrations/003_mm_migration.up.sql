@@ -0,0 +1,4 @@
+alter table public.player_profiles
+    add column specialists varchar[] default '{}'::varchar[] not null;
+
+comment on column public.player_profiles.specialists is 'Abbreviations of the crafting jobs the player has specialised in.';
@@ -0,0 +1 @@
+ALTER TABLE IF EXISTS public.player_profiles DROP COLUMN IF EXISTS crafter_stats;
\ No newline at end of file
@@ -0,0 +1,4 @@
+alter table public.player_profiles
+    add column crafter_stats jsonb default '{}'::jsonb not null;
+
+comment on column public.player_profiles.crafter_stats is 'Map of crafting job abbreviation to gear stats, e.g. {"CRP": {"craftsmanship": 4000, "control": 3800, "cp": 600}}.';
@@ -0,0 +1,2 @@
+ALTER TABLE IF EXISTS public.player_profiles DROP COLUMN IF EXISTS retainer_city;
+ALTER TABLE IF EXISTS public.listings DROP COLUMN IF EXISTS tax;
\ No newline at end of file
@@ -0,0 +1,9 @@
+alter table public.listings
+    add column tax integer default 0 not null;
+
+comment on column public.listings.tax is 'Gil sales tax the buyer pays on top of the total price, 0 if the listing is tax free.';
+
+alter table public.player_profiles
+    add column retainer_city smallint default 0 not null;
+
+comment on column public.player_profiles.retainer_city is 'Universalis id of the city the player''s retainers list items in, 0 if not set.';
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS public.sales_daily;
+DROP TABLE IF EXISTS public.sales_hourly;
\ No newline at end of file
@@ -0,0 +1,37 @@
+create table public.sales_hourly
+(
+    item_id         integer   not null,
+    world_id        integer   not null,
+    bucket_start    timestamp not null,
+    is_high_quality boolean   not null,
+    sale_count      integer   default 0 not null,
+    quantity        integer   default 0 not null,
+    total_price     bigint    default 0 not null,
+    min_price       integer   not null,
+    max_price       integer   not null,
+    primary key (item_id, world_id, bucket_start, is_high_quality)
+);
+
+comment on table public.sales_hourly is 'Sales of each item and quality on each world, rolled up by hour.';
+
+alter table public.sales_hourly
+    owner to admin;
+
+create table public.sales_daily
+(
+    item_id         integer   not null,
+    world_id        integer   not null,
+    bucket_start    timestamp not null,
+    is_high_quality boolean   not null,
+    sale_count      integer   default 0 not null,
+    quantity        integer   default 0 not null,
+    total_price     bigint    default 0 not null,
+    min_price       integer   not null,
+    max_price       integer   not null,
+    primary key (item_id, world_id, bucket_start, is_high_quality)
+);
+
+comment on table public.sales_daily is 'Sales of each item and quality on each world, rolled up by day.';
+
+alter table public.sales_daily
+    owner to admin;
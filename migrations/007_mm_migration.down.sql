@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS public.alert_deliveries;
+DROP TABLE IF EXISTS public.price_alerts;
@@ -0,0 +1,58 @@
+create table public.price_alerts
+(
+    alert_id          integer generated always as identity
+        primary key,
+    kind              varchar(20)  not null
+        constraint price_alerts_kind_check
+            check (kind in ('item_price', 'recipe_margin', 'currency_value')),
+    world_id          integer      not null,
+    item_id           integer      default 0 not null,
+    currency          varchar(50)  default '' not null,
+    comparison        varchar(5)   not null
+        constraint price_alerts_comparison_check
+            check (comparison in ('below', 'above')),
+    threshold         integer      not null,
+    webhook_url       varchar(500) not null,
+    enabled           boolean      default true not null,
+    last_triggered_at timestamp,
+    created_at        timestamp    default (now() at time zone 'utc') not null,
+    updated_at        timestamp    default (now() at time zone 'utc') not null
+);
+
+comment on table public.price_alerts is 'Market conditions that send a webhook when they are met.';
+
+comment on column public.price_alerts.item_id is 'Item the alert watches, 0 for currency value alerts.';
+
+comment on column public.price_alerts.currency is 'Name of the currency a currency value alert watches, empty for other alerts.';
+
+comment on column public.price_alerts.last_triggered_at is 'When the alert last matched, used to stop it firing again straight away.';
+
+alter table public.price_alerts
+    owner to admin;
+
+create table public.alert_deliveries
+(
+    delivery_id  integer generated always as identity
+        primary key,
+    alert_id     integer   not null
+        constraint alert_deliveries_alert_id_fkey
+            references public.price_alerts
+            on delete cascade,
+    payload      jsonb     not null,
+    attempts     smallint  default 0 not null,
+    status_code  smallint  default 0 not null,
+    error        text      default '' not null,
+    delivered    boolean   default false not null,
+    created_at   timestamp default (now() at time zone 'utc') not null,
+    delivered_at timestamp
+);
+
+comment on table public.alert_deliveries is 'Log of every webhook sent for a price alert.';
+
+comment on column public.alert_deliveries.status_code is 'HTTP status of the last attempt, 0 if the request failed before a response.';
+
+create index alert_deliveries_alert_id_index
+    on public.alert_deliveries (alert_id, created_at);
+
+alter table public.alert_deliveries
+    owner to admin;
@@ -0,0 +1 @@
+ALTER TABLE IF EXISTS public.price_alerts DROP COLUMN IF EXISTS format;
@@ -0,0 +1,6 @@
+alter table public.price_alerts
+    add column format varchar(10) default 'json' not null
+        constraint price_alerts_format_check
+            check (format in ('json', 'discord'));
+
+comment on column public.price_alerts.format is 'How matches are sent to the webhook, either signed json or a discord message.';
@@ -0,0 +1,29 @@
+create table public.backfill_progress
+(
+    item_id    integer                                       not null,
+    world_id   integer                                       not null,
+    status     varchar(10)                                   not null
+        constraint backfill_progress_status_check
+            check (status in ('done', 'failed')),
+    listings   integer   default 0                           not null,
+    sales      integer   default 0                           not null,
+    attempts   smallint  default 1                           not null,
+    error      text      default ''                          not null,
+    updated_at timestamp default (now() at time zone 'utc') not null,
+    constraint backfill_progress_pkey
+        primary key (item_id, world_id)
+);
+
+comment on table public.backfill_progress is 'Which items the setup backfill has fetched for each world, so an interrupted backfill can carry on where it stopped.';
+
+comment on column public.backfill_progress.listings is 'How many listings were stored for the item on the world.';
+
+comment on column public.backfill_progress.attempts is 'How many times the item has been fetched for the world, including failed attempts.';
+
+comment on column public.backfill_progress.error is 'Why the last attempt failed, empty if it succeeded.';
+
+create index backfill_progress_world_id_index
+    on public.backfill_progress (world_id, status);
+
+alter table public.backfill_progress
+    owner to admin;
@@ -0,0 +1 @@
+ALTER TABLE public.sales DROP CONSTRAINT IF EXISTS sales_natural_key;
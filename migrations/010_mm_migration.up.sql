@@ -0,0 +1,41 @@
+-- Sales can be received more than once (catch up, backfill retries and replays), so only the first copy of each is kept
+delete
+from public.sales duplicate
+    using public.sales original
+where duplicate.item_id = original.item_id
+  and duplicate.world_id = original.world_id
+  and duplicate.sale_time = original.sale_time
+  and duplicate.buyer_name is not distinct from original.buyer_name
+  and duplicate.price_per_unit is not distinct from original.price_per_unit
+  and duplicate.quantity is not distinct from original.quantity
+  and duplicate.is_high_quality is not distinct from original.is_high_quality
+  and duplicate.sales_id > original.sales_id;
+
+alter table public.sales
+    add constraint sales_natural_key
+        unique nulls not distinct (item_id, world_id, sale_time, buyer_name, price_per_unit, quantity, is_high_quality);
+
+comment on constraint sales_natural_key on public.sales is 'Universalis doesn''t give sales ids, so a sale is identified by everything reported about it.';
+
+-- The rollups counted every duplicate, so they're rebuilt from the sales that are left
+truncate public.sales_hourly, public.sales_daily;
+
+insert into public.sales_hourly
+    (item_id, world_id, bucket_start, is_high_quality, sale_count, quantity, total_price, min_price, max_price)
+select item_id, world_id,
+       date_trunc('hour', sale_time) as bucket_start, is_high_quality,
+       count(*), sum(quantity),
+       sum(total_price), min(price_per_unit),
+       max(price_per_unit)
+from public.sales
+group by item_id, world_id, bucket_start, is_high_quality;
+
+insert into public.sales_daily
+    (item_id, world_id, bucket_start, is_high_quality, sale_count, quantity, total_price, min_price, max_price)
+select item_id, world_id,
+       date_trunc('day', sale_time) as bucket_start, is_high_quality,
+       count(*), sum(quantity),
+       sum(total_price), min(price_per_unit),
+       max(price_per_unit)
+from public.sales
+group by item_id, world_id, bucket_start, is_high_quality;
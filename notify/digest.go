@@ -0,0 +1,120 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/level-5-pidgey/MarketMoogle/profit"
+	"log"
+	"time"
+)
+
+const DefaultDigestSize = 10
+
+// DigestConfig
+// Where and when the daily flip digest is sent
+type DigestConfig struct {
+	// Discord webhook the digest is posted to
+	WebhookUrl string
+	WorldIds   []int
+	// Hour of the day (UTC) the digest is sent at
+	Hour int
+	// How many flips are listed for each world
+	Count int
+}
+
+// Digest
+// Posts the most profitable items to buy off the market and sell again on each configured world to Discord once a
+// day, taken from the profit leaderboard
+type Digest struct {
+	leaderboard *profitCalc.ProfitLeaderboard
+	sender      *WebhookSender
+	formatter   DiscordFormatter
+	config      DigestConfig
+
+	// Returns the current time, replaced in tests
+	now func() time.Time
+}
+
+func NewDigest(
+	leaderboard *profitCalc.ProfitLeaderboard,
+	sender *WebhookSender,
+	formatter DiscordFormatter,
+	config DigestConfig,
+) *Digest {
+	if config.Count <= 0 {
+		config.Count = DefaultDigestSize
+	}
+
+	return &Digest{
+		leaderboard: leaderboard,
+		sender:      sender,
+		formatter:   formatter,
+		config:      config,
+		now:         time.Now,
+	}
+}
+
+// Run
+// Sends the digest for every configured world at the configured hour each day until the context is cancelled
+func (d *Digest) Run(ctx context.Context) {
+	for {
+		timer := time.NewTimer(nextDigestTime(d.now(), d.config.Hour).Sub(d.now()))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		for _, worldId := range d.config.WorldIds {
+			if err := d.Send(ctx, worldId); err != nil {
+				log.Printf("failed to send the flip digest for world %d: %s\n", worldId, err)
+			}
+		}
+	}
+}
+
+// Send
+// Posts the digest for a single world straight away
+func (d *Digest) Send(ctx context.Context, worldId int) error {
+	message, err := d.Message(worldId)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	return d.sender.Post(ctx, d.config.WebhookUrl, body)
+}
+
+// Message
+// The digest for a world, ranking the items that make the most from buying them on the market and selling them
+func (d *Digest) Message(worldId int) (*DiscordMessage, error) {
+	filter := profitCalc.ProfitFilter{ObtainTypes: []profitCalc.ObtainType{profitCalc.ObtainTypeMarket}}
+
+	results, computedAt, ok := d.leaderboard.TopResults(worldId, filter, d.config.Count)
+	if !ok {
+		return nil, fmt.Errorf("profits for world %d haven't been calculated yet", worldId)
+	}
+
+	message := d.formatter.DigestMessage(worldId, results, computedAt)
+	return &message, nil
+}
+
+// nextDigestTime
+// The next time it's the given hour (UTC) after now
+func nextDigestTime(now time.Time, hour int) time.Time {
+	now = now.UTC()
+
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, time.UTC)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+
+	return next
+}
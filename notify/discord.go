@@ -0,0 +1,325 @@
+package notify
+
+import (
+	"fmt"
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	"github.com/level-5-pidgey/MarketMoogle/profit"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits on what Discord accepts in a single embed
+const (
+	discordMaxFields           = 25
+	discordMaxFieldValueLength = 1024
+	discordMaxDescription      = 4096
+)
+
+// Embed colours
+const (
+	discordGreen = 0x57F287
+	discordRed   = 0xED4245
+	discordBlue  = 0x5865F2
+)
+
+// DiscordMessage
+// The body of a Discord webhook execution, see https://discord.com/developers/docs/resources/webhook
+type DiscordMessage struct {
+	Username string         `json:"username,omitempty"`
+	Content  string         `json:"content,omitempty"`
+	Embeds   []DiscordEmbed `json:"embeds,omitempty"`
+}
+
+type DiscordEmbed struct {
+	Title       string              `json:"title,omitempty"`
+	Description string              `json:"description,omitempty"`
+	Color       int                 `json:"color,omitempty"`
+	Fields      []DiscordEmbedField `json:"fields,omitempty"`
+	Footer      *DiscordEmbedFooter `json:"footer,omitempty"`
+	// ISO 8601 timestamp shown next to the footer
+	Timestamp string `json:"timestamp,omitempty"`
+}
+
+type DiscordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+type DiscordEmbedFooter struct {
+	Text string `json:"text"`
+}
+
+// DiscordFormatter
+// Renders profit results and alerts as Discord messages. Items and worlds are shown by id unless lookups for their
+// names are given.
+type DiscordFormatter struct {
+	ItemName  func(itemId int) string
+	WorldName func(worldId int) string
+}
+
+func (f DiscordFormatter) itemName(itemId int) string {
+	if f.ItemName != nil {
+		if name := f.ItemName(itemId); name != "" {
+			return name
+		}
+	}
+
+	return fmt.Sprintf("Item #%d", itemId)
+}
+
+func (f DiscordFormatter) worldName(worldId int) string {
+	if f.WorldName != nil {
+		if name := f.WorldName(worldId); name != "" {
+			return name
+		}
+	}
+
+	return fmt.Sprintf("World #%d", worldId)
+}
+
+// ProfitEmbed
+// Shows how an item is obtained and sold, and how much is made doing so
+func (f DiscordFormatter) ProfitEmbed(info *profitCalc.ProfitInfo) DiscordEmbed {
+	title := f.itemName(info.ItemId)
+	if info.IsHighQuality {
+		title += " (HQ)"
+	}
+
+	margin := info.Margin()
+	color := discordGreen
+	if margin <= 0 {
+		color = discordRed
+	}
+
+	obtain := fmt.Sprintf("%s for %s", info.ObtainMethod.ObtainMethod, formatGil(info.ObtainMethod.GetCost()))
+	sell := fmt.Sprintf("%s for %s", info.SaleMethod.ExchangeType, formatGil(info.SaleMethod.Value))
+
+	fields := []DiscordEmbedField{
+		{Name: "Obtain", Value: obtain, Inline: true},
+		{Name: "Sell", Value: sell, Inline: true},
+		{Name: "Margin", Value: formatGil(margin), Inline: true},
+		{Name: "Return", Value: fmt.Sprintf("%.0f%%", info.ReturnOnInvestment()*100), Inline: true},
+	}
+
+	if info.Velocity != nil {
+		fields = append(
+			fields, DiscordEmbedField{
+				Name:   "Sales per day",
+				Value:  strconv.FormatFloat(info.Velocity.SalesPerDay, 'f', 1, 64),
+				Inline: true,
+			},
+		)
+	}
+
+	return DiscordEmbed{
+		Title:  title,
+		Color:  color,
+		Fields: fields,
+	}
+}
+
+// ShoppingCartEmbed
+// Lists everything that needs to be bought and who from, along with the total cost
+func (f DiscordFormatter) ShoppingCartEmbed(cart *profitCalc.ShoppingCart) DiscordEmbed {
+	// The cart isn't kept in any order, so items are listed by id to keep messages stable
+	items := slices.Clone(cart.ItemsToBuy)
+	slices.SortStableFunc(
+		items, func(a, b profitCalc.ShoppingItem) int {
+			return a.GetItemId() - b.GetItemId()
+		},
+	)
+
+	fields := make([]DiscordEmbedField, 0, min(len(items), discordMaxFields))
+	total := 0
+	for index, item := range items {
+		total += item.GetTotalCost()
+
+		// Leave room to say how many items didn't fit
+		if index >= discordMaxFields-1 && len(items) > discordMaxFields {
+			continue
+		}
+
+		fields = append(
+			fields, DiscordEmbedField{
+				Name: fmt.Sprintf("%dx %s", item.GetQuantity(), f.itemName(item.GetItemId())),
+				Value: truncate(
+					fmt.Sprintf(
+						"%s each from %s (%s)",
+						formatGil(item.GetCostPer()),
+						item.BuyFrom(),
+						formatGil(item.GetTotalCost()),
+					),
+					discordMaxFieldValueLength,
+				),
+			},
+		)
+	}
+
+	if len(items) > discordMaxFields {
+		fields = append(
+			fields, DiscordEmbedField{
+				Name:  "More items",
+				Value: fmt.Sprintf("...and %d more", len(items)-len(fields)),
+			},
+		)
+	}
+
+	return DiscordEmbed{
+		Title:  "Shopping list",
+		Color:  discordBlue,
+		Fields: fields,
+		Footer: &DiscordEmbedFooter{Text: fmt.Sprintf("Total cost: %s", formatGil(total))},
+	}
+}
+
+// AlertMessage
+// Says which price alert matched and what it matched on
+func (f DiscordFormatter) AlertMessage(match *profitCalc.AlertMatch) DiscordMessage {
+	alert := match.Alert
+
+	var subject string
+	switch alert.Kind {
+	case db.AlertItemPrice:
+		subject = fmt.Sprintf("%s price", f.itemName(match.ItemId))
+	case db.AlertRecipeMargin:
+		subject = fmt.Sprintf("%s margin", f.itemName(match.ItemId))
+	case db.AlertCurrencyValue:
+		subject = fmt.Sprintf("%s value", alert.Currency)
+	default:
+		subject = string(alert.Kind)
+	}
+
+	color := discordGreen
+	if alert.Comparison == db.AlertBelow {
+		color = discordRed
+	}
+
+	embeds := []DiscordEmbed{
+		{
+			Title: fmt.Sprintf("%s is %s %s", subject, alert.Comparison, formatGil(alert.Threshold)),
+			Description: fmt.Sprintf(
+				"%s on %s is now %s.",
+				subject,
+				f.worldName(match.WorldId),
+				formatGilValue(match.Value),
+			),
+			Color:     color,
+			Footer:    &DiscordEmbedFooter{Text: fmt.Sprintf("Alert #%d", alert.Id)},
+			Timestamp: match.MatchedAt.UTC().Format(time.RFC3339),
+		},
+	}
+
+	// Margin alerts also show how the margin is made and what to buy for it
+	if match.Profit != nil && match.Profit.ObtainMethod != nil && match.Profit.SaleMethod != nil {
+		embeds = append(embeds, f.ProfitEmbed(match.Profit))
+
+		if len(match.Profit.ObtainMethod.ShoppingCart.ItemsToBuy) > 0 {
+			embeds = append(embeds, f.ShoppingCartEmbed(&match.Profit.ObtainMethod.ShoppingCart))
+		}
+	}
+
+	return DiscordMessage{Embeds: embeds}
+}
+
+// DigestMessage
+// Ranks the best items to flip on a world in a single embed
+func (f DiscordFormatter) DigestMessage(
+	worldId int,
+	results []*profitCalc.ProfitInfo,
+	computedAt time.Time,
+) DiscordMessage {
+	lines := make([]string, 0, len(results))
+	for index, result := range results {
+		line := fmt.Sprintf(
+			"%d. **%s** buy %s, sell %s (%s profit",
+			index+1,
+			f.itemName(result.ItemId),
+			formatGil(result.ObtainMethod.GetCost()),
+			formatGil(result.SaleMethod.Value),
+			formatGil(result.Margin()),
+		)
+
+		if result.Velocity != nil {
+			line += fmt.Sprintf(", %.1f sales a day", result.Velocity.SalesPerDay)
+		}
+
+		lines = append(lines, line+")")
+	}
+
+	description := strings.Join(lines, "\n")
+	if len(lines) == 0 {
+		description = "Nothing worth flipping right now."
+	}
+
+	return DiscordMessage{
+		Embeds: []DiscordEmbed{
+			{
+				Title:       fmt.Sprintf("Top %d flips on %s today", len(results), f.worldName(worldId)),
+				Description: truncate(description, discordMaxDescription),
+				Color:       discordGreen,
+				Footer:      &DiscordEmbedFooter{Text: "Profits as of"},
+				Timestamp:   computedAt.UTC().Format(time.RFC3339),
+			},
+		},
+	}
+}
+
+// formatGil
+// Writes an amount of gil with thousands separators, e.g. "1,234,567 gil"
+func formatGil(amount int) string {
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+
+	return sign + groupDigits(amount) + " gil"
+}
+
+// formatGilValue
+// Writes a value that can be a fraction of a gil, like the gil a single tomestone is worth, to 2 decimal places when
+// it isn't whole, e.g. "1,234.56 gil"
+func formatGilValue(value float64) string {
+	sign := ""
+	hundredths := int(math.Round(value * 100))
+	if hundredths < 0 {
+		sign, hundredths = "-", -hundredths
+	}
+
+	if hundredths%100 == 0 {
+		return sign + groupDigits(hundredths/100) + " gil"
+	}
+
+	return fmt.Sprintf("%s%s.%02d gil", sign, groupDigits(hundredths/100), hundredths%100)
+}
+
+// groupDigits
+// Writes a positive number with a comma between every group of 3 digits
+func groupDigits(number int) string {
+	digits := strconv.Itoa(number)
+
+	var builder strings.Builder
+	for index, digit := range digits {
+		if index > 0 && (len(digits)-index)%3 == 0 {
+			builder.WriteByte(',')
+		}
+
+		builder.WriteRune(digit)
+	}
+
+	return builder.String()
+}
+
+// truncate
+// Shortens text to at most length characters, as Discord counts them
+func truncate(s string, length int) string {
+	runes := []rune(s)
+	if len(runes) <= length {
+		return s
+	}
+
+	return string(runes[:length-3]) + "..."
+}
@@ -0,0 +1,296 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	"github.com/level-5-pidgey/MarketMoogle/profit"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// discordStub
+// Stands in for a Discord channel webhook, keeping every message posted to it
+func discordStub(t *testing.T) (*httptest.Server, *[]DiscordMessage) {
+	t.Helper()
+
+	messages := make([]DiscordMessage, 0)
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				var message DiscordMessage
+				if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+
+				messages = append(messages, message)
+				w.WriteHeader(http.StatusNoContent)
+			},
+		),
+	)
+	t.Cleanup(server.Close)
+
+	return server, &messages
+}
+
+func testFormatter() DiscordFormatter {
+	return DiscordFormatter{
+		ItemName: func(itemId int) string {
+			return map[int]string{1: "Grade 8 Tincture of Strength"}[itemId]
+		},
+		WorldName: func(worldId int) string {
+			return map[int]string{1: "Gilgamesh"}[worldId]
+		},
+	}
+}
+
+func Test_formatGil(t *testing.T) {
+	tests := []struct {
+		amount int
+		want   string
+	}{
+		{amount: 0, want: "0 gil"},
+		{amount: 999, want: "999 gil"},
+		{amount: 1000, want: "1,000 gil"},
+		{amount: 1234567, want: "1,234,567 gil"},
+		{amount: -45000, want: "-45,000 gil"},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.want, func(t *testing.T) {
+				if got := formatGil(tt.amount); got != tt.want {
+					t.Errorf("formatGil() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestDiscordFormatter_ShoppingCartEmbed(t *testing.T) {
+	items := make([]profitCalc.ShoppingItem, 0, 30)
+	for itemId := 30; itemId > 0; itemId-- {
+		items = append(items, profitCalc.LocalItem{ItemId: itemId, Quantity: 2, ObtainedFrom: "Vendor", CostPer: 10})
+	}
+
+	embed := testFormatter().ShoppingCartEmbed(&profitCalc.ShoppingCart{ItemsToBuy: items})
+
+	if len(embed.Fields) != discordMaxFields {
+		t.Fatalf("ShoppingCartEmbed() has %d fields, want %d", len(embed.Fields), discordMaxFields)
+	}
+
+	if embed.Fields[0].Name != "2x Grade 8 Tincture of Strength" {
+		t.Errorf("ShoppingCartEmbed() first field = %q, want the lowest item id first", embed.Fields[0].Name)
+	}
+
+	if last := embed.Fields[len(embed.Fields)-1].Value; last != "...and 6 more" {
+		t.Errorf("ShoppingCartEmbed() last field = %q, want the number of items left out", last)
+	}
+
+	if embed.Footer == nil || embed.Footer.Text != "Total cost: 600 gil" {
+		t.Errorf("ShoppingCartEmbed() footer = %v, want the total of every item", embed.Footer)
+	}
+}
+
+func Test_formatGilValue(t *testing.T) {
+	tests := []struct {
+		value float64
+		want  string
+	}{
+		{value: 1200, want: "1,200 gil"},
+		{value: 3.5, want: "3.50 gil"},
+		{value: 1234.567, want: "1,234.57 gil"},
+		{value: 0.25, want: "0.25 gil"},
+		{value: -0.5, want: "-0.50 gil"},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.want, func(t *testing.T) {
+				if got := formatGilValue(tt.value); got != tt.want {
+					t.Errorf("formatGilValue() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestDiscordFormatter_AlertMessage(t *testing.T) {
+	profit := &profitCalc.ProfitInfo{
+		ItemId: 1,
+		ObtainMethod: &profitCalc.ObtainMethod{
+			ObtainMethod: "Craft with Alchemist",
+			ShoppingCart: profitCalc.ShoppingCart{
+				ItemsToBuy: []profitCalc.ShoppingItem{
+					profitCalc.LocalItem{ItemId: 2, Quantity: 3, ObtainedFrom: "Buy from NPC", CostPer: 100},
+				},
+			},
+		},
+		SaleMethod: &profitCalc.SaleMethod{ExchangeType: "Marketboard", Value: 1000, ValuePer: 1000, Quantity: 1},
+	}
+
+	tests := []struct {
+		name            string
+		match           *profitCalc.AlertMatch
+		wantEmbeds      int
+		wantDescription string
+	}{
+		{
+			name: "Currency values keep their fraction of a gil",
+			match: &profitCalc.AlertMatch{
+				Alert: &db.PriceAlert{
+					Id: 1, Kind: db.AlertCurrencyValue, Currency: "Poetics", Comparison: db.AlertAbove, Threshold: 3,
+				},
+				Value:   3.47,
+				WorldId: 1,
+			},
+			wantEmbeds:      1,
+			wantDescription: "Poetics value on Gilgamesh is now 3.47 gil.",
+		},
+		{
+			name: "Margin alerts show the profit and what to buy",
+			match: &profitCalc.AlertMatch{
+				Alert: &db.PriceAlert{
+					Id: 2, Kind: db.AlertRecipeMargin, ItemId: 1, Comparison: db.AlertAbove, Threshold: 500,
+				},
+				Value:   700,
+				ItemId:  1,
+				WorldId: 1,
+				Profit:  profit,
+			},
+			wantEmbeds:      3,
+			wantDescription: "Grade 8 Tincture of Strength margin on Gilgamesh is now 700 gil.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				message := testFormatter().AlertMessage(tt.match)
+				if len(message.Embeds) != tt.wantEmbeds {
+					t.Fatalf("AlertMessage() has %d embeds, want %d", len(message.Embeds), tt.wantEmbeds)
+				}
+
+				if message.Embeds[0].Description != tt.wantDescription {
+					t.Errorf("AlertMessage() description = %q, want %q", message.Embeds[0].Description, tt.wantDescription)
+				}
+
+				if tt.wantEmbeds > 1 && message.Embeds[2].Footer.Text != "Total cost: 300 gil" {
+					t.Errorf("AlertMessage() shopping list footer = %v, want the cost of the cart", message.Embeds[2].Footer)
+				}
+			},
+		)
+	}
+}
+
+func TestWebhookSender_DeliverToDiscord(t *testing.T) {
+	server, messages := discordStub(t)
+
+	repo := db.NewMockRepository()
+	alert, _ := repo.CreatePriceAlert(
+		db.PriceAlert{
+			Kind: db.AlertItemPrice, WorldId: 1, ItemId: 1, Comparison: db.AlertBelow, Threshold: 1500,
+			WebhookUrl: server.URL, Format: db.AlertFormatDiscord, Enabled: true,
+		},
+	)
+
+	sender := NewWebhookSender(repo, "")
+	sender.client = server.Client()
+	sender.Discord = testFormatter()
+
+	match := &profitCalc.AlertMatch{Alert: alert, Value: 1200, ItemId: 1, WorldId: 1, MatchedAt: time.Now()}
+	if _, err := sender.Deliver(context.Background(), match); err != nil {
+		t.Fatalf("Deliver() error = %v", err)
+	}
+
+	if len(*messages) != 1 || len((*messages)[0].Embeds) != 1 {
+		t.Fatalf("Deliver() posted %v, want a single embed", *messages)
+	}
+
+	embed := (*messages)[0].Embeds[0]
+	if embed.Title != "Grade 8 Tincture of Strength price is below 1,500 gil" {
+		t.Errorf("Deliver() embed title = %q", embed.Title)
+	}
+
+	if embed.Description != "Grade 8 Tincture of Strength price on Gilgamesh is now 1,200 gil." {
+		t.Errorf("Deliver() embed description = %q", embed.Description)
+	}
+}
+
+func TestDigest_Send(t *testing.T) {
+	server, messages := discordStub(t)
+
+	// Cheap on another world and expensive on the home world, so it can be flipped
+	itemMap := map[int]*profitCalc.Item{1: {Id: 1, CanBeTraded: true}}
+	repo := db.NewMockRepository()
+	listings := []db.Listing{
+		{Id: 1, ItemId: 1, WorldId: 2, PricePer: 100, Quantity: 1, Total: 100},
+		{Id: 2, ItemId: 1, WorldId: 1, PricePer: 5000, Quantity: 1, Total: 5000, Tax: 250},
+	}
+	for _, listing := range listings {
+		if _, err := repo.CreateListing(listing); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	calculator := profitCalc.NewProfitCalculator(&itemMap, nil, nil, repo, nil)
+	leaderboard := profitCalc.NewProfitLeaderboard(calculator, map[int]int{1: 1, 2: 1}, 1)
+
+	sender := NewWebhookSender(repo, "")
+	sender.client = server.Client()
+	digest := NewDigest(leaderboard, sender, testFormatter(), DigestConfig{WebhookUrl: server.URL})
+
+	if err := digest.Send(context.Background(), 1); err == nil {
+		t.Errorf("Send() sent a digest before profits were calculated")
+	}
+
+	leaderboard.RefreshWorld(1)
+	if err := digest.Send(context.Background(), 1); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	if len(*messages) != 1 || len((*messages)[0].Embeds) != 1 {
+		t.Fatalf("Send() posted %v, want a single embed", *messages)
+	}
+
+	embed := (*messages)[0].Embeds[0]
+	if embed.Title != "Top 1 flips on Gilgamesh today" {
+		t.Errorf("Send() embed title = %q", embed.Title)
+	}
+
+	if !strings.HasPrefix(embed.Description, "1. **Grade 8 Tincture of Strength** buy 100 gil") {
+		t.Errorf("Send() embed description = %q", embed.Description)
+	}
+}
+
+func Test_nextDigestTime(t *testing.T) {
+	tests := []struct {
+		name string
+		now  time.Time
+		hour int
+		want time.Time
+	}{
+		{
+			name: "Later today",
+			now:  time.Date(2024, time.March, 10, 9, 30, 0, 0, time.UTC),
+			hour: 18,
+			want: time.Date(2024, time.March, 10, 18, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "Already sent today",
+			now:  time.Date(2024, time.March, 10, 18, 0, 0, 0, time.UTC),
+			hour: 18,
+			want: time.Date(2024, time.March, 11, 18, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if got := nextDigestTime(tt.now, tt.hour); !got.Equal(tt.want) {
+					t.Errorf("nextDigestTime() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,375 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	"github.com/level-5-pidgey/MarketMoogle/profit"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// SignatureHeader holds the HMAC-SHA256 of the timestamp and body, so receivers can check a webhook came from us
+	SignatureHeader = "X-MarketMoogle-Signature"
+	// TimestampHeader holds when the webhook was signed, in unix seconds
+	TimestampHeader = "X-MarketMoogle-Timestamp"
+
+	DefaultMaxAttempts = 5
+	DefaultRetryDelay  = 2 * time.Second
+
+	maxRetryDelay  = 2 * time.Minute
+	requestTimeout = 10 * time.Second
+	// How many matches can wait to be sent before new ones are dropped
+	queueSize = 256
+)
+
+// AlertPayload
+// The JSON body sent to a webhook when an alert matches
+type AlertPayload struct {
+	AlertId    int                `json:"alert_id"`
+	Kind       db.AlertKind       `json:"kind"`
+	WorldId    int                `json:"world_id"`
+	ItemId     int                `json:"item_id"`
+	Currency   string             `json:"currency,omitempty"`
+	Comparison db.AlertComparison `json:"comparison"`
+	Threshold  int                `json:"threshold"`
+	Value      float64            `json:"value"`
+	MatchedAt  time.Time          `json:"matched_at"`
+}
+
+func NewAlertPayload(match *profitCalc.AlertMatch) AlertPayload {
+	return AlertPayload{
+		AlertId:    match.Alert.Id,
+		Kind:       match.Alert.Kind,
+		WorldId:    match.WorldId,
+		ItemId:     match.ItemId,
+		Currency:   match.Alert.Currency,
+		Comparison: match.Alert.Comparison,
+		Threshold:  match.Alert.Threshold,
+		Value:      match.Value,
+		MatchedAt:  match.MatchedAt,
+	}
+}
+
+// WebhookSender
+// Sends matched price alerts to their webhook as signed JSON POSTs (or Discord messages, if the alert asks for them),
+// retrying with backoff when the receiver is down and logging every delivery to the repository
+type WebhookSender struct {
+	repository db.Repository
+	client     *http.Client
+	secret     []byte
+	// How many times a webhook is tried before giving up
+	MaxAttempts int
+	// How long to wait before the first retry, doubling for each one after
+	RetryDelay time.Duration
+	// Renders matches for alerts sent to Discord
+	Discord DiscordFormatter
+
+	queue chan *profitCalc.AlertMatch
+}
+
+// ErrNoSecret is returned for JSON alerts when there's no secret to sign them with, as receivers couldn't tell them
+// apart from forgeries
+var ErrNoSecret = errors.New("no webhook secret is set, so JSON webhooks can't be signed")
+
+// NewWebhookSender
+// A sender that signs JSON webhooks with the secret. Whitespace around the secret, like the newline at the end of a
+// secret file, isn't part of it.
+func NewWebhookSender(repository db.Repository, secret string) *WebhookSender {
+	return &WebhookSender{
+		repository:  repository,
+		client:      newWebhookClient(),
+		secret:      []byte(strings.TrimSpace(secret)),
+		MaxAttempts: DefaultMaxAttempts,
+		RetryDelay:  DefaultRetryDelay,
+		queue:       make(chan *profitCalc.AlertMatch, queueSize),
+	}
+}
+
+// ErrPrivateDestination is returned when a webhook resolves to an address on this machine or its network. Anyone can
+// create an alert, so webhooks mustn't be usable to reach services that aren't public.
+var ErrPrivateDestination = errors.New("webhooks can't be sent to private, loopback or link-local addresses")
+
+// newWebhookClient
+// A client that refuses to connect anywhere but public addresses. The check happens as each connection is made, after
+// the host's been resolved, so hostnames pointing at private addresses and redirects to them are refused too.
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: requestTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			return checkPublicDestination(address)
+		},
+	}
+
+	return &http.Client{
+		Timeout: requestTimeout,
+		// No proxy, as it'd be the proxy's address that was checked rather than the webhook's
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   requestTimeout,
+			ExpectContinueTimeout: time.Second,
+		},
+	}
+}
+
+// checkPublicDestination
+// Returns ErrPrivateDestination unless the resolved host:port being connected to is a public address
+func checkPublicDestination(address string) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("can't check webhook address %s: %w", address, err)
+	}
+
+	ip := addrPort.Addr().Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast() || ip.IsInterfaceLocalMulticast() {
+		return fmt.Errorf("%w: %s", ErrPrivateDestination, ip)
+	}
+
+	return nil
+}
+
+// Notify
+// Queues up a match to be sent by Run. The market feed shouldn't wait on webhooks, so matches are dropped if the
+// queue is full.
+func (s *WebhookSender) Notify(match *profitCalc.AlertMatch) {
+	select {
+	case s.queue <- match:
+	default:
+		log.Printf("webhook queue is full, dropped match for price alert %d\n", match.Alert.Id)
+	}
+}
+
+// Run
+// Sends queued matches using a fixed number of workers until the context is cancelled
+func (s *WebhookSender) Run(ctx context.Context, workers int) {
+	var wg sync.WaitGroup
+	for i := 0; i < max(workers, 1); i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case match := <-s.queue:
+					if _, err := s.Deliver(ctx, match); err != nil {
+						log.Printf("failed to send webhook for price alert %d: %s\n", match.Alert.Id, err)
+					}
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// Deliver
+// Sends a match to its alert's webhook, retrying failed attempts. The delivery is logged to the repository before the
+// first attempt and updated after every one. JSON alerts aren't sent at all without a secret to sign them with.
+func (s *WebhookSender) Deliver(ctx context.Context, match *profitCalc.AlertMatch) (*db.AlertDelivery, error) {
+	body, err := s.alertBody(match)
+	if err != nil {
+		return nil, err
+	}
+
+	if match.Alert.Format != db.AlertFormatDiscord && len(s.secret) == 0 {
+		delivery, err := s.repository.CreateAlertDelivery(
+			db.AlertDelivery{AlertId: match.Alert.Id, Payload: body, Error: ErrNoSecret.Error()},
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		return delivery, ErrNoSecret
+	}
+
+	delivery, err := s.repository.CreateAlertDelivery(db.AlertDelivery{AlertId: match.Alert.Id, Payload: body})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.post(
+		ctx, match.Alert.WebhookUrl, body, func(attempt webhookAttempt) {
+			delivery.Attempts++
+			delivery.StatusCode = attempt.statusCode
+			delivery.Error = ""
+			if attempt.err != nil {
+				delivery.Error = attempt.err.Error()
+			}
+
+			if attempt.delivered() {
+				deliveredAt := time.Now().UTC()
+				delivery.Delivered = true
+				delivery.DeliveredAt = &deliveredAt
+			}
+
+			if updateErr := s.repository.UpdateAlertDelivery(*delivery); updateErr != nil {
+				log.Printf("failed to log webhook delivery %d: %s\n", delivery.Id, updateErr)
+			}
+		},
+	)
+
+	return delivery, err
+}
+
+// Post
+// Sends a JSON body to a webhook, retrying failed attempts, without logging it as an alert delivery
+func (s *WebhookSender) Post(ctx context.Context, webhookUrl string, body []byte) error {
+	return s.post(ctx, webhookUrl, body, nil)
+}
+
+// alertBody
+// The JSON sent for a match, in the format the alert asks for
+func (s *WebhookSender) alertBody(match *profitCalc.AlertMatch) ([]byte, error) {
+	if match.Alert.Format == db.AlertFormatDiscord {
+		return json.Marshal(s.Discord.AlertMessage(match))
+	}
+
+	return json.Marshal(NewAlertPayload(match))
+}
+
+// webhookAttempt
+// How a single try at sending a webhook went
+type webhookAttempt struct {
+	statusCode int
+	// How long the receiver asked us to wait before trying again, if at all
+	retryAfter time.Duration
+	err        error
+}
+
+func (a webhookAttempt) delivered() bool {
+	return a.err == nil && a.statusCode >= 200 && a.statusCode < 300
+}
+
+// retryable
+// Whether trying again could work: the request failed before getting a response, or the receiver is busy or down.
+// Other client errors mean the receiver won't accept the webhook no matter how often it's sent, and private
+// destinations are never connected to.
+func (a webhookAttempt) retryable() bool {
+	if errors.Is(a.err, ErrPrivateDestination) {
+		return false
+	}
+
+	return a.statusCode == 0 || a.statusCode == http.StatusTooManyRequests || a.statusCode >= 500
+}
+
+// post
+// Sends a body to a webhook until it's accepted, the receiver rejects it or MaxAttempts is reached, with a growing
+// delay between attempts. onAttempt is called after every attempt, if given.
+func (s *WebhookSender) post(
+	ctx context.Context,
+	webhookUrl string,
+	body []byte,
+	onAttempt func(attempt webhookAttempt),
+) error {
+	maxAttempts := max(s.MaxAttempts, 1)
+
+	for attempts := 1; ; attempts++ {
+		statusCode, retryAfter, err := s.send(ctx, webhookUrl, body)
+		if err == nil && (statusCode < 200 || statusCode >= 300) {
+			err = fmt.Errorf("webhook responded with %d", statusCode)
+		}
+
+		attempt := webhookAttempt{statusCode: statusCode, retryAfter: retryAfter, err: err}
+		if onAttempt != nil {
+			onAttempt(attempt)
+		}
+
+		if attempt.delivered() {
+			return nil
+		}
+
+		if !attempt.retryable() || attempts >= maxAttempts {
+			return fmt.Errorf("gave up after %d attempts: %w", attempts, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.retryDelay(attempts, retryAfter)):
+		}
+	}
+}
+
+// send
+// Makes a single signed POST, returning the response status and how long the receiver asked us to wait, if at all
+func (s *WebhookSender) send(ctx context.Context, webhookUrl string, body []byte) (int, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookUrl, bytes.NewReader(body))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "MarketMoogle-Webhook")
+	req.Header.Set(TimestampHeader, timestamp)
+	if len(s.secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(s.secret, timestamp, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	retryAfter := time.Duration(0)
+	// Discord sends fractions of a second here
+	if seconds, err := strconv.ParseFloat(resp.Header.Get("Retry-After"), 64); err == nil && seconds > 0 {
+		retryAfter = time.Duration(seconds * float64(time.Second))
+	}
+
+	return resp.StatusCode, retryAfter, nil
+}
+
+// retryDelay
+// Doubles the delay for each attempt with up to 50% jitter, so failed webhooks don't all retry at once. The
+// receiver's Retry-After is used instead if it's longer.
+func (s *WebhookSender) retryDelay(attempt int, retryAfter time.Duration) time.Duration {
+	delay := s.RetryDelay << (attempt - 1)
+	if delay <= 0 || delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+
+	delay += time.Duration(rand.Int63n(int64(delay)/2 + 1))
+
+	return max(delay, min(retryAfter, maxRetryDelay))
+}
+
+// Sign
+// The signature sent in SignatureHeader: the hex HMAC-SHA256 of "<timestamp>.<body>", prefixed with "sha256="
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,211 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	"github.com/level-5-pidgey/MarketMoogle/profit"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookSender_Deliver(t *testing.T) {
+	const secret = "hunter2"
+
+	tests := []struct {
+		name string
+		// Status codes returned for each attempt in order, the last one repeating
+		statuses      []int
+		maxAttempts   int
+		wantAttempts  int
+		wantDelivered bool
+		wantErr       bool
+	}{
+		{name: "Delivered first time", statuses: []int{200}, maxAttempts: 3, wantAttempts: 1, wantDelivered: true},
+		{
+			name:          "Retries until the receiver is back up",
+			statuses:      []int{500, 429, 204},
+			maxAttempts:   5,
+			wantAttempts:  3,
+			wantDelivered: true,
+		},
+		{name: "Gives up after the last attempt", statuses: []int{503}, maxAttempts: 3, wantAttempts: 3, wantErr: true},
+		{name: "Rejected webhooks aren't retried", statuses: []int{400}, maxAttempts: 3, wantAttempts: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				var requests atomic.Int32
+				server := httptest.NewServer(
+					http.HandlerFunc(
+						func(w http.ResponseWriter, r *http.Request) {
+							attempt := int(requests.Add(1)) - 1
+							body, _ := io.ReadAll(r.Body)
+
+							timestamp := r.Header.Get(TimestampHeader)
+							if r.Header.Get(SignatureHeader) != Sign([]byte(secret), timestamp, body) {
+								t.Errorf("webhook signature %q doesn't match its body", r.Header.Get(SignatureHeader))
+							}
+
+							var payload AlertPayload
+							if err := json.Unmarshal(body, &payload); err != nil || payload.AlertId != 1 {
+								t.Errorf("webhook body %s isn't the alert payload", body)
+							}
+
+							w.WriteHeader(tt.statuses[min(attempt, len(tt.statuses)-1)])
+						},
+					),
+				)
+				defer server.Close()
+
+				repo := db.NewMockRepository()
+				alert, _ := repo.CreatePriceAlert(
+					db.PriceAlert{
+						Kind: db.AlertItemPrice, WorldId: 1, ItemId: 2, Comparison: db.AlertBelow, Threshold: 100,
+						WebhookUrl: server.URL, Enabled: true,
+					},
+				)
+
+				// Secret files usually end in a newline, which isn't part of the secret
+				sender := NewWebhookSender(repo, secret+"\n")
+				// The stub server is on loopback, which webhooks are normally refused
+				sender.client = server.Client()
+				sender.MaxAttempts = tt.maxAttempts
+				sender.RetryDelay = time.Millisecond
+
+				match := &profitCalc.AlertMatch{Alert: alert, Value: 90, ItemId: 2, WorldId: 1, MatchedAt: time.Now()}
+				delivery, err := sender.Deliver(context.Background(), match)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("Deliver() error = %v, wantErr %v", err, tt.wantErr)
+				}
+
+				if delivery.Attempts != tt.wantAttempts || int(requests.Load()) != tt.wantAttempts {
+					t.Errorf(
+						"Deliver() made %d attempts (%d requests), want %d",
+						delivery.Attempts,
+						requests.Load(),
+						tt.wantAttempts,
+					)
+				}
+
+				logged, _ := repo.GetAlertDeliveries(alert.Id)
+				if len(*logged) != 1 {
+					t.Fatalf("Deliver() logged %d deliveries, want 1", len(*logged))
+				}
+
+				if (*logged)[0].Delivered != tt.wantDelivered || (*logged)[0].Attempts != tt.wantAttempts {
+					t.Errorf("Deliver() logged %+v, want delivered = %v", *(*logged)[0], tt.wantDelivered)
+				}
+			},
+		)
+	}
+}
+
+func TestWebhookSender_DeliverWithoutSecret(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+			},
+		),
+	)
+	defer server.Close()
+
+	repo := db.NewMockRepository()
+	alert, _ := repo.CreatePriceAlert(
+		db.PriceAlert{
+			Kind: db.AlertItemPrice, WorldId: 1, ItemId: 2, Comparison: db.AlertBelow, Threshold: 100,
+			WebhookUrl: server.URL, Enabled: true,
+		},
+	)
+
+	sender := NewWebhookSender(repo, " \n")
+	sender.client = server.Client()
+	match := &profitCalc.AlertMatch{Alert: alert, Value: 90, ItemId: 2, WorldId: 1, MatchedAt: time.Now()}
+
+	delivery, err := sender.Deliver(context.Background(), match)
+	if !errors.Is(err, ErrNoSecret) {
+		t.Fatalf("Deliver() error = %v, want ErrNoSecret", err)
+	}
+
+	if requests.Load() != 0 {
+		t.Errorf("Deliver() made %d requests, want none without a secret", requests.Load())
+	}
+
+	if delivery.Delivered || delivery.Error != ErrNoSecret.Error() {
+		t.Errorf("Deliver() logged %+v, want an undelivered delivery explaining why", *delivery)
+	}
+}
+
+func TestWebhookSender_DeliverToPrivateAddress(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+			},
+		),
+	)
+	defer server.Close()
+
+	repo := db.NewMockRepository()
+	alert, _ := repo.CreatePriceAlert(
+		db.PriceAlert{
+			Kind: db.AlertItemPrice, WorldId: 1, ItemId: 2, Comparison: db.AlertBelow, Threshold: 100,
+			WebhookUrl: server.URL, Enabled: true,
+		},
+	)
+
+	sender := NewWebhookSender(repo, "hunter2")
+	sender.RetryDelay = time.Millisecond
+	match := &profitCalc.AlertMatch{Alert: alert, Value: 90, ItemId: 2, WorldId: 1, MatchedAt: time.Now()}
+
+	// The stub server is on loopback, so it's never connected to or retried
+	delivery, err := sender.Deliver(context.Background(), match)
+	if !errors.Is(err, ErrPrivateDestination) {
+		t.Fatalf("Deliver() error = %v, want ErrPrivateDestination", err)
+	}
+
+	if requests.Load() != 0 || delivery.Attempts != 1 || delivery.Delivered {
+		t.Errorf("Deliver() logged %+v after %d requests, want a single refused attempt", *delivery, requests.Load())
+	}
+}
+
+func TestCheckPublicDestination(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		wantErr bool
+	}{
+		{name: "Public IPv4", address: "162.159.135.232:443", wantErr: false},
+		{name: "Public IPv6", address: "[2606:4700::6810:84e5]:443", wantErr: false},
+		{name: "Loopback", address: "127.0.0.1:5432", wantErr: true},
+		{name: "IPv6 loopback", address: "[::1]:80", wantErr: true},
+		{name: "Private network", address: "10.0.0.5:80", wantErr: true},
+		{name: "Docker network", address: "172.17.0.2:8080", wantErr: true},
+		{name: "Home network", address: "192.168.1.1:80", wantErr: true},
+		{name: "Cloud metadata", address: "169.254.169.254:80", wantErr: true},
+		{name: "IPv4 mapped loopback", address: "[::ffff:127.0.0.1]:80", wantErr: true},
+		{name: "Unspecified", address: "0.0.0.0:80", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				err := checkPublicDestination(tt.address)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("checkPublicDestination(%q) error = %v, wantErr %v", tt.address, err, tt.wantErr)
+				}
+
+				if tt.wantErr && !errors.Is(err, ErrPrivateDestination) {
+					t.Errorf("checkPublicDestination(%q) error = %v, want ErrPrivateDestination", tt.address, err)
+				}
+			},
+		)
+	}
+}
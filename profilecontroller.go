@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	profitCalc "github.com/level-5-pidgey/MarketMoogle/profit"
+	"github.com/level-5-pidgey/MarketMoogle/util"
+	"net/http"
+	"strconv"
+)
+
+func (c Controller) getProfileIdFromRequest(r *http.Request) (int, error) {
+	param := chi.URLParam(r, "profileId")
+
+	profileId, err := strconv.Atoi(param)
+	if err != nil {
+		return 0, errors.New("profile id must be a number")
+	}
+
+	return profileId, nil
+}
+
+// readProfileFromRequest
+// Decodes and validates a player profile from the request body
+func (c Controller) readProfileFromRequest(w http.ResponseWriter, r *http.Request) (*db.PlayerProfile, error) {
+	var profile db.PlayerProfile
+	err := util.ReadJSON(w, r, &profile)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := (*c.worlds)[profile.HomeWorldId]; !ok {
+		return nil, errors.New("home world does not exist")
+	}
+
+	err = profitCalc.ValidateProfile(&profile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &profile, nil
+}
+
+func writeProfileError(w http.ResponseWriter, err error) {
+	if errors.Is(err, db.ErrProfileNotFound) {
+		util.ErrorJSON(w, err, http.StatusNotFound)
+		return
+	}
+
+	util.ErrorJSON(w, err, http.StatusInternalServerError)
+}
+
+func (c Controller) GetPlayerProfiles(w http.ResponseWriter, r *http.Request) {
+	profiles, err := c.repository.GetPlayerProfiles()
+	if err != nil {
+		writeProfileError(w, err)
+		return
+	}
+
+	err = util.WriteJSON(w, http.StatusOK, profiles)
+	if err != nil {
+		util.ErrorJSON(w, err, http.StatusInternalServerError)
+	}
+}
+
+func (c Controller) GetPlayerProfile(w http.ResponseWriter, r *http.Request) {
+	profileId, err := c.getProfileIdFromRequest(r)
+	if err != nil {
+		util.ErrorJSON(w, err)
+		return
+	}
+
+	profile, err := c.repository.GetPlayerProfile(profileId)
+	if err != nil {
+		writeProfileError(w, err)
+		return
+	}
+
+	err = util.WriteJSON(w, http.StatusOK, profile)
+	if err != nil {
+		util.ErrorJSON(w, err, http.StatusInternalServerError)
+	}
+}
+
+func (c Controller) CreatePlayerProfile(w http.ResponseWriter, r *http.Request) {
+	profile, err := c.readProfileFromRequest(w, r)
+	if err != nil {
+		util.ErrorJSON(w, err)
+		return
+	}
+
+	created, err := c.repository.CreatePlayerProfile(*profile)
+	if err != nil {
+		writeProfileError(w, err)
+		return
+	}
+
+	err = util.WriteJSON(w, http.StatusCreated, created)
+	if err != nil {
+		util.ErrorJSON(w, err, http.StatusInternalServerError)
+	}
+}
+
+func (c Controller) UpdatePlayerProfile(w http.ResponseWriter, r *http.Request) {
+	profileId, err := c.getProfileIdFromRequest(r)
+	if err != nil {
+		util.ErrorJSON(w, err)
+		return
+	}
+
+	profile, err := c.readProfileFromRequest(w, r)
+	if err != nil {
+		util.ErrorJSON(w, err)
+		return
+	}
+
+	// The id in the route is the one being updated, regardless of what was sent in the body
+	profile.Id = profileId
+
+	updated, err := c.repository.UpdatePlayerProfile(*profile)
+	if err != nil {
+		writeProfileError(w, err)
+		return
+	}
+
+	err = util.WriteJSON(w, http.StatusOK, updated)
+	if err != nil {
+		util.ErrorJSON(w, err, http.StatusInternalServerError)
+	}
+}
+
+func (c Controller) DeletePlayerProfile(w http.ResponseWriter, r *http.Request) {
+	profileId, err := c.getProfileIdFromRequest(r)
+	if err != nil {
+		util.ErrorJSON(w, err)
+		return
+	}
+
+	err = c.repository.DeletePlayerProfile(profileId)
+	if err != nil {
+		writeProfileError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
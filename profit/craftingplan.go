@@ -0,0 +1,331 @@
+package profitCalc
+
+import (
+	"fmt"
+	"github.com/level-5-pidgey/MarketMoogle/csv/readertype"
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	"sort"
+)
+
+// MaxCraftTargets is the most items that can be planned for at once
+const MaxCraftTargets = 50
+
+type CraftTarget struct {
+	ItemId   int
+	Quantity int
+}
+
+// CraftStep
+// Crafting one item as many times as every target needs
+type CraftStep struct {
+	ItemId int
+	// How many of the item are needed in total
+	Quantity    int
+	Crafts      int
+	Yield       int
+	RecipeLevel int
+}
+
+// CraftStage
+// Crafts for a single job that can all be done in one go, since their ingredients were made in earlier stages
+type CraftStage struct {
+	Job   readertype.Job
+	Steps []CraftStep
+}
+
+// CraftingPlan
+// A single plan for obtaining several items at once
+type CraftingPlan struct {
+	Targets []CraftTarget
+
+	// Everything that has to be bought, across every target
+	ShoppingCart ShoppingCart `json:"ItemsToBuy"`
+	Cost         int
+
+	// Crafts in the order they should be done, grouped by job
+	CraftOrder []CraftStage
+
+	// Items that couldn't be obtained at all
+	Unobtainable []int `json:",omitempty"`
+	// Recipes that would have made the unobtainable items obtainable, if the player had their book or specialization
+	BlockedRecipes []BlockedRecipe `json:",omitempty"`
+
+	// Items (keyed by id) where the market doesn't have enough listings left, and how many are missing
+	Shortfall map[int]int `json:",omitempty"`
+}
+
+// plannedMethod is how an item will be obtained for every target in a plan
+type plannedMethod struct {
+	obtainType ObtainType
+	recipe     *RecipeInfo
+	// The vendor, gathering or currency purchase, with its per item cost
+	localItem *LocalItem
+}
+
+// PlanCrafts
+// Works out one plan for obtaining every target. The cheapest method for each item is found per target, then the
+// quantities of every item are added up across targets, so shared intermediates are crafted together and each
+// market listing is only bought once.
+func (p *ProfitCalculator) PlanCrafts(targets []CraftTarget, player *PlayerInfo) (*CraftingPlan, error) {
+	if len(targets) == 0 || len(targets) > MaxCraftTargets {
+		return nil, fmt.Errorf("between 1 and %d targets are required", MaxCraftTargets)
+	}
+
+	itemIds := make(map[int]struct{})
+	for _, target := range targets {
+		item, ok := (*p.Items)[target.ItemId]
+		if !ok {
+			return nil, fmt.Errorf("item %d not found", target.ItemId)
+		}
+
+		if target.Quantity < 1 {
+			return nil, fmt.Errorf("quantity for item %d must be at least 1", target.ItemId)
+		}
+
+		p.collectRecipeItems(itemIds, item, player)
+	}
+
+	listingItemIds := make([]int, 0, len(itemIds))
+	for itemId := range itemIds {
+		listingItemIds = append(listingItemIds, itemId)
+	}
+
+	listings, err := p.repository.GetListingsForItemsOnDataCenter(listingItemIds, player.DataCenter)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.planCrafts(targets, listings, player), nil
+}
+
+// collectRecipeItems
+// Adds the item and every item in its crafting tree (including intermediates) to itemIds
+func (p *ProfitCalculator) collectRecipeItems(itemIds map[int]struct{}, item *Item, player *PlayerInfo) {
+	if _, ok := itemIds[item.Id]; ok {
+		return
+	}
+
+	itemIds[item.Id] = struct{}{}
+	if item.CraftingRecipes == nil {
+		return
+	}
+
+	for _, recipe := range *item.CraftingRecipes {
+		for _, ingredient := range recipe.RecipeIngredients {
+			if ingredientItem, ok := (*p.Items)[ingredient.ItemId]; ok && !player.skipsIngredient(ingredientItem) {
+				p.collectRecipeItems(itemIds, ingredientItem, player)
+			}
+		}
+	}
+}
+
+func (p *ProfitCalculator) planCrafts(targets []CraftTarget, listings *[]*db.Listing, player *PlayerInfo) *CraftingPlan {
+	plan := &CraftingPlan{
+		Targets: targets,
+		ShoppingCart: ShoppingCart{
+			ItemsToBuy:    []ShoppingItem{},
+			itemsRequired: make(map[int]int),
+		},
+		CraftOrder: []CraftStage{},
+	}
+
+	// Decide how each item is obtained. The first target to need an item decides its method.
+	methods := make(map[int]*plannedMethod)
+	demand := make(map[int]int)
+	for _, target := range targets {
+		item := (*p.Items)[target.ItemId]
+
+		obtainMethod, blocked := p.getCheapestObtainMethodForQuality(item, target.Quantity, listings, player, AnyQuality)
+		if obtainMethod == nil {
+			plan.Unobtainable = append(plan.Unobtainable, target.ItemId)
+			plan.BlockedRecipes = append(plan.BlockedRecipes, blocked...)
+			continue
+		}
+
+		p.recordPlannedMethods(methods, obtainMethod)
+		demand[target.ItemId] += target.Quantity
+	}
+
+	// Ingredients come before the products made from them
+	craftOrder := make([]int, 0, len(methods))
+	visited := make(map[int]struct{}, len(methods))
+	for _, target := range targets {
+		craftOrder = appendCraftOrder(craftOrder, visited, target.ItemId, methods)
+	}
+
+	// How many crafting stages deep each crafted item is, with 1 being crafted only from bought ingredients
+	stages := make(map[int]int)
+	for _, itemId := range craftOrder {
+		method := methods[itemId]
+		if method.obtainType != ObtainTypeCraft {
+			continue
+		}
+
+		stages[itemId] = 1
+		for _, ingredient := range method.recipe.RecipeIngredients {
+			if ingredientStage, ok := stages[ingredient.ItemId]; ok {
+				stages[itemId] = max(stages[itemId], ingredientStage+1)
+			}
+		}
+	}
+
+	// Products are handled before their ingredients, so all of an item's demand is known before it's handled
+	for i := len(craftOrder) - 1; i >= 0; i-- {
+		itemId := craftOrder[i]
+		item := (*p.Items)[itemId]
+		method := methods[itemId]
+		required := demand[itemId]
+
+		switch method.obtainType {
+		case ObtainTypeCraft:
+			crafts := (required + method.recipe.Yield - 1) / method.recipe.Yield
+			for _, ingredient := range method.recipe.RecipeIngredients {
+				if _, ok := methods[ingredient.ItemId]; ok {
+					demand[ingredient.ItemId] += crafts * ingredient.Quantity
+				}
+			}
+		case ObtainTypeMarket:
+			itemListings := make([]*db.Listing, 0)
+			for _, listing := range *listings {
+				if listing.ItemId == itemId {
+					itemListings = append(itemListings, listing)
+				}
+			}
+
+			purchase := marketObtainMethod(item, nil, required, &itemListings, player)
+			plan.ShoppingCart.ItemsToBuy = append(plan.ShoppingCart.ItemsToBuy, purchase.ShoppingCart.ItemsToBuy...)
+			plan.ShoppingCart.itemsRequired[itemId] = required
+
+			if purchase.Quantity < required {
+				if plan.Shortfall == nil {
+					plan.Shortfall = make(map[int]int)
+				}
+
+				plan.Shortfall[itemId] = required - purchase.Quantity
+			}
+		default:
+			localItem := *method.localItem
+			localItem.Quantity = required
+
+			plan.ShoppingCart.ItemsToBuy = append(plan.ShoppingCart.ItemsToBuy, localItem)
+			plan.ShoppingCart.itemsRequired[itemId] = required
+		}
+	}
+
+	plan.CraftOrder = buildCraftOrder(craftOrder, methods, demand, stages)
+
+	// Whole listings have to be bought, so the cost is what's actually spent rather than the cost of what's needed
+	for _, cartItem := range plan.ShoppingCart.ItemsToBuy {
+		plan.Cost += cartItem.GetTotalCost()
+	}
+
+	return plan
+}
+
+// recordPlannedMethods
+// Records how every item in an obtain method's tree is obtained, unless an earlier target already decided it
+func (p *ProfitCalculator) recordPlannedMethods(methods map[int]*plannedMethod, obtainMethod *ObtainMethod) {
+	if _, ok := methods[obtainMethod.itemId]; ok {
+		return
+	}
+
+	method := &plannedMethod{obtainType: obtainMethod.Type}
+
+	switch obtainMethod.Type {
+	case ObtainTypeCraft:
+		method.recipe = obtainMethod.recipe
+		if method.recipe == nil {
+			return
+		}
+	case ObtainTypeMarket:
+	default:
+		for _, cartItem := range obtainMethod.ShoppingCart.ItemsToBuy {
+			if localItem, ok := cartItem.(LocalItem); ok && localItem.ItemId == obtainMethod.itemId {
+				method.localItem = &localItem
+			}
+		}
+
+		if method.localItem == nil {
+			return
+		}
+	}
+
+	methods[obtainMethod.itemId] = method
+	for _, ingredient := range obtainMethod.ingredients {
+		p.recordPlannedMethods(methods, ingredient)
+	}
+}
+
+// appendCraftOrder
+// Appends the item after every ingredient in its crafting tree
+func appendCraftOrder(order []int, visited map[int]struct{}, itemId int, methods map[int]*plannedMethod) []int {
+	method, ok := methods[itemId]
+	if !ok {
+		return order
+	}
+
+	if _, ok := visited[itemId]; ok {
+		return order
+	}
+
+	visited[itemId] = struct{}{}
+
+	if method.obtainType == ObtainTypeCraft {
+		for _, ingredient := range method.recipe.RecipeIngredients {
+			order = appendCraftOrder(order, visited, ingredient.ItemId, methods)
+		}
+	}
+
+	return append(order, itemId)
+}
+
+// buildCraftOrder
+// Groups crafts into stages, crafting stage by stage and job by job within each stage
+func buildCraftOrder(
+	order []int, methods map[int]*plannedMethod, demand map[int]int, stages map[int]int,
+) []CraftStage {
+	craftedItems := make([]int, 0, len(stages))
+	for _, itemId := range order {
+		if _, ok := stages[itemId]; ok {
+			craftedItems = append(craftedItems, itemId)
+		}
+	}
+
+	sort.SliceStable(
+		craftedItems, func(i, j int) bool {
+			iStage, jStage := stages[craftedItems[i]], stages[craftedItems[j]]
+			if iStage != jStage {
+				return iStage < jStage
+			}
+
+			iJob, jJob := methods[craftedItems[i]].recipe.JobRequired, methods[craftedItems[j]].recipe.JobRequired
+			if iJob != jJob {
+				return iJob < jJob
+			}
+
+			return craftedItems[i] < craftedItems[j]
+		},
+	)
+
+	result := make([]CraftStage, 0)
+	for _, itemId := range craftedItems {
+		recipe := methods[itemId].recipe
+		step := CraftStep{
+			ItemId:      itemId,
+			Quantity:    demand[itemId],
+			Crafts:      (demand[itemId] + recipe.Yield - 1) / recipe.Yield,
+			Yield:       recipe.Yield,
+			RecipeLevel: recipe.RecipeLevel,
+		}
+
+		// Consecutive crafts for the same job are merged, even across stages
+		if last := len(result) - 1; last >= 0 && result[last].Job == recipe.JobRequired {
+			result[last].Steps = append(result[last].Steps, step)
+			continue
+		}
+
+		result = append(result, CraftStage{Job: recipe.JobRequired, Steps: []CraftStep{step}})
+	}
+
+	return result
+}
@@ -0,0 +1,225 @@
+package profitCalc
+
+import (
+	"github.com/level-5-pidgey/MarketMoogle/csv/readertype"
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	"github.com/level-5-pidgey/MarketMoogle/profit/exchange"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestProfitCalculator_PlanCrafts(t *testing.T) {
+	itemMap := map[int]*Item{
+		// Two products that share an intermediate
+		10: {
+			Id:               10,
+			MarketProhibited: true,
+			CraftingRecipes: &[]RecipeInfo{
+				{
+					Yield:             1,
+					JobRequired:       readertype.JobCarpenter,
+					RecipeIngredients: []RecipeIngredients{{ItemId: 20, Quantity: 1}, {ItemId: 30, Quantity: 1}},
+				},
+			},
+		},
+		11: {
+			Id:               11,
+			MarketProhibited: true,
+			CraftingRecipes: &[]RecipeInfo{
+				{
+					Yield:             1,
+					JobRequired:       readertype.JobCarpenter,
+					RecipeIngredients: []RecipeIngredients{{ItemId: 20, Quantity: 1}},
+				},
+			},
+		},
+		// Can't be obtained at all
+		12: {Id: 12, MarketProhibited: true},
+		// Intermediate that makes 2 per craft
+		20: {
+			Id:               20,
+			MarketProhibited: true,
+			CraftingRecipes: &[]RecipeInfo{
+				{
+					Yield:             2,
+					JobRequired:       readertype.JobAlchemist,
+					RecipeIngredients: []RecipeIngredients{{ItemId: 40, Quantity: 2}},
+				},
+			},
+		},
+		30: {Id: 30},
+		40: {
+			Id:               40,
+			MarketProhibited: true,
+			ObtainMethods: &[]exchange.Method{
+				exchange.NewGilExchange(5, "NPC", ""),
+			},
+		},
+	}
+
+	repo := db.NewMockRepository()
+	listings := []db.Listing{
+		{Id: 1, ItemId: 30, WorldId: 1, PricePer: 100, Quantity: 1, Total: 100},
+		{Id: 2, ItemId: 30, WorldId: 1, PricePer: 120, Quantity: 2, Total: 240},
+	}
+	for _, listing := range listings {
+		if _, err := repo.CreateListing(listing); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := NewProfitCalculator(&itemMap, nil, nil, repo, nil)
+	player := &PlayerInfo{
+		HomeServer: 1,
+		DataCenter: 1,
+		JobLevels: map[readertype.Job]int{
+			readertype.JobCarpenter: 90,
+			readertype.JobAlchemist: 90,
+		},
+	}
+
+	plan, err := p.PlanCrafts(
+		[]CraftTarget{
+			{ItemId: 10, Quantity: 2},
+			{ItemId: 11, Quantity: 1},
+			{ItemId: 12, Quantity: 1},
+			{ItemId: 30, Quantity: 2},
+		},
+		player,
+	)
+	if err != nil {
+		t.Fatalf("PlanCrafts() error = %v", err)
+	}
+
+	sort.Slice(
+		plan.ShoppingCart.ItemsToBuy, func(i, j int) bool {
+			return plan.ShoppingCart.ItemsToBuy[i].GetHash() < plan.ShoppingCart.ItemsToBuy[j].GetHash()
+		},
+	)
+
+	// Both listings are only bought once, even though two targets need them
+	wantItems := []ShoppingItem{
+		ShoppingListing{ItemId: 30, Quantity: 1, listingId: 1, worldId: 1, CostPer: 100},
+		ShoppingListing{ItemId: 30, Quantity: 2, listingId: 2, worldId: 1, CostPer: 120},
+		LocalItem{ItemId: 40, Quantity: 4, ObtainedFrom: "Buy from NPC", CostPer: 5},
+	}
+	if !reflect.DeepEqual(plan.ShoppingCart.ItemsToBuy, wantItems) {
+		t.Errorf("PlanCrafts() items to buy = %v, want %v", plan.ShoppingCart.ItemsToBuy, wantItems)
+	}
+
+	if wantCost := 360; plan.Cost != wantCost {
+		t.Errorf("PlanCrafts() cost = %d, want %d", plan.Cost, wantCost)
+	}
+
+	// The shared intermediate is crafted once for both products, and before them
+	wantOrder := []CraftStage{
+		{
+			Job:   readertype.JobAlchemist,
+			Steps: []CraftStep{{ItemId: 20, Quantity: 3, Crafts: 2, Yield: 2}},
+		},
+		{
+			Job: readertype.JobCarpenter,
+			Steps: []CraftStep{
+				{ItemId: 10, Quantity: 2, Crafts: 2, Yield: 1},
+				{ItemId: 11, Quantity: 1, Crafts: 1, Yield: 1},
+			},
+		},
+	}
+	if !reflect.DeepEqual(plan.CraftOrder, wantOrder) {
+		t.Errorf("PlanCrafts() craft order = %+v, want %+v", plan.CraftOrder, wantOrder)
+	}
+
+	if want := []int{12}; !reflect.DeepEqual(plan.Unobtainable, want) {
+		t.Errorf("PlanCrafts() unobtainable = %v, want %v", plan.Unobtainable, want)
+	}
+
+	// 4 of item 30 are needed across targets, but only 3 are listed
+	if want := map[int]int{30: 1}; !reflect.DeepEqual(plan.Shortfall, want) {
+		t.Errorf("PlanCrafts() shortfall = %v, want %v", plan.Shortfall, want)
+	}
+}
+
+func TestProfitCalculator_PlanCrafts_InvalidTargets(t *testing.T) {
+	itemMap := map[int]*Item{1: {Id: 1}}
+	p := NewProfitCalculator(&itemMap, nil, nil, db.NewMockRepository(), nil)
+
+	tests := []struct {
+		name    string
+		targets []CraftTarget
+	}{
+		{name: "No targets", targets: nil},
+		{name: "Unknown item", targets: []CraftTarget{{ItemId: 2, Quantity: 1}}},
+		{name: "Quantity below 1", targets: []CraftTarget{{ItemId: 1, Quantity: 0}}},
+		{name: "Too many targets", targets: make([]CraftTarget, MaxCraftTargets+1)},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if _, err := p.PlanCrafts(tt.targets, NewDefaultPlayerInfo(1, 1)); err == nil {
+					t.Errorf("PlanCrafts() expected an error")
+				}
+			},
+		)
+	}
+}
+
+func TestProfitCalculator_PlanCrafts_ChosenRecipe(t *testing.T) {
+	itemMap := map[int]*Item{
+		// Two recipes for the same job, where the second one is cheaper
+		1: {
+			Id:               1,
+			MarketProhibited: true,
+			CraftingRecipes: &[]RecipeInfo{
+				{
+					Yield:             1,
+					JobRequired:       readertype.JobCarpenter,
+					RecipeIngredients: []RecipeIngredients{{ItemId: 2, Quantity: 1}},
+				},
+				{
+					Yield:             3,
+					JobRequired:       readertype.JobCarpenter,
+					RecipeIngredients: []RecipeIngredients{{ItemId: 3, Quantity: 1}},
+				},
+			},
+		},
+		2: {
+			Id:               2,
+			MarketProhibited: true,
+			ObtainMethods:    &[]exchange.Method{exchange.NewGilExchange(100, "NPC", "")},
+		},
+		3: {
+			Id:               3,
+			MarketProhibited: true,
+			ObtainMethods:    &[]exchange.Method{exchange.NewGilExchange(10, "NPC", "")},
+		},
+	}
+
+	p := NewProfitCalculator(&itemMap, nil, nil, db.NewMockRepository(), nil)
+	player := &PlayerInfo{
+		HomeServer: 1,
+		DataCenter: 1,
+		JobLevels:  map[readertype.Job]int{readertype.JobCarpenter: 90},
+	}
+
+	plan, err := p.PlanCrafts([]CraftTarget{{ItemId: 1, Quantity: 3}}, player)
+	if err != nil {
+		t.Fatalf("PlanCrafts() error = %v", err)
+	}
+
+	// The craft order follows the recipe that was priced, not the first one for the job
+	wantOrder := []CraftStage{
+		{
+			Job:   readertype.JobCarpenter,
+			Steps: []CraftStep{{ItemId: 1, Quantity: 3, Crafts: 1, Yield: 3}},
+		},
+	}
+	if !reflect.DeepEqual(plan.CraftOrder, wantOrder) {
+		t.Errorf("PlanCrafts() craft order = %+v, want %+v", plan.CraftOrder, wantOrder)
+	}
+
+	wantItems := []ShoppingItem{LocalItem{ItemId: 3, Quantity: 1, ObtainedFrom: "Buy from NPC", CostPer: 10}}
+	if !reflect.DeepEqual(plan.ShoppingCart.ItemsToBuy, wantItems) {
+		t.Errorf("PlanCrafts() items to buy = %v, want %v", plan.ShoppingCart.ItemsToBuy, wantItems)
+	}
+}
@@ -0,0 +1,50 @@
+package profitCalc
+
+import "github.com/level-5-pidgey/MarketMoogle/csv/readertype"
+
+// CraftingTreeNode
+// One step in obtaining an item. Crafted items have a child for each of their ingredients, which need to be obtained
+// first.
+type CraftingTreeNode struct {
+	ItemId int
+	// How many of the item are needed
+	Quantity int
+	Method   ObtainType
+	// Human readable description of the method, e.g. "Craft with Carpenter"
+	ObtainMethod string
+	// The crafter used and how many times the recipe is crafted, if this item is crafted
+	JobRequired readertype.Job `json:",omitempty"`
+	Crafts      int            `json:",omitempty"`
+	Cost        int
+	// Effort of this step alone, the effort of obtaining each ingredient is on its own node
+	EffortFactor float64
+	Children     []*CraftingTreeNode `json:",omitempty"`
+}
+
+// CraftingTree
+// Builds the tree of steps needed to obtain an item with this method
+func (o *ObtainMethod) CraftingTree() *CraftingTreeNode {
+	if o == nil {
+		return nil
+	}
+
+	node := &CraftingTreeNode{
+		ItemId:       o.itemId,
+		Quantity:     o.numRequired,
+		Method:       o.Type,
+		ObtainMethod: o.ObtainMethod,
+		JobRequired:  o.JobRequired,
+		Cost:         o.GetCost(),
+		EffortFactor: o.EffortFactor,
+	}
+
+	if o.Type == ObtainTypeCraft && o.Quantity > 0 {
+		node.Crafts = (o.numRequired + o.Quantity - 1) / o.Quantity
+	}
+
+	for _, ingredient := range o.ingredients {
+		node.Children = append(node.Children, ingredient.CraftingTree())
+	}
+
+	return node
+}
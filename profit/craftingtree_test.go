@@ -0,0 +1,119 @@
+package profitCalc
+
+import (
+	"github.com/level-5-pidgey/MarketMoogle/csv/readertype"
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	"github.com/level-5-pidgey/MarketMoogle/profit/exchange"
+	"reflect"
+	"testing"
+)
+
+func TestObtainMethod_CraftingTree(t *testing.T) {
+	item := &Item{
+		Id:               1,
+		MarketProhibited: true,
+		CraftingRecipes: &[]RecipeInfo{
+			{
+				Yield:       2,
+				JobRequired: readertype.JobCarpenter,
+				RecipeLevel: 90,
+				RecipeIngredients: []RecipeIngredients{
+					{ItemId: 2, Quantity: 1},
+					{ItemId: 4, Quantity: 1},
+				},
+			},
+		},
+	}
+
+	itemMap := map[int]*Item{
+		1: item,
+		// Intermediate crafted from a vendor item
+		2: {
+			Id:               2,
+			MarketProhibited: true,
+			CraftingRecipes: &[]RecipeInfo{
+				{
+					Yield:             1,
+					JobRequired:       readertype.JobAlchemist,
+					RecipeLevel:       90,
+					RecipeIngredients: []RecipeIngredients{{ItemId: 3, Quantity: 2}},
+				},
+			},
+		},
+		3: {
+			Id:               3,
+			MarketProhibited: true,
+			ObtainMethods: &[]exchange.Method{
+				exchange.NewGilExchange(5, "NPC", ""),
+			},
+		},
+		4: {Id: 4},
+	}
+
+	listings := []*db.Listing{
+		{Id: 1, ItemId: 4, WorldId: 1, PricePer: 30, Quantity: 2, Total: 60},
+	}
+
+	player := &PlayerInfo{
+		HomeServer: 1,
+		DataCenter: 1,
+		JobLevels: map[readertype.Job]int{
+			readertype.JobCarpenter: 90,
+			readertype.JobAlchemist: 90,
+		},
+	}
+
+	p := NewProfitCalculator(&itemMap, nil, nil, db.NewMockRepository(), nil)
+
+	// 3 items from a recipe that makes 2 needs 2 crafts, so 2 of each ingredient
+	want := &CraftingTreeNode{
+		ItemId:       1,
+		Quantity:     3,
+		Method:       ObtainTypeCraft,
+		ObtainMethod: "Craft with Carpenter",
+		JobRequired:  readertype.JobCarpenter,
+		Crafts:       2,
+		Cost:         80,
+		EffortFactor: 0.95,
+		Children: []*CraftingTreeNode{
+			{
+				ItemId:       2,
+				Quantity:     2,
+				Method:       ObtainTypeCraft,
+				ObtainMethod: "Craft with Alchemist",
+				JobRequired:  readertype.JobAlchemist,
+				Crafts:       2,
+				Cost:         20,
+				EffortFactor: 0.95,
+				Children: []*CraftingTreeNode{
+					{
+						ItemId:       3,
+						Quantity:     4,
+						Method:       ObtainTypeVendor,
+						ObtainMethod: "Gil",
+						Cost:         20,
+						EffortFactor: 0.8757558499999999,
+					},
+				},
+			},
+			{
+				ItemId:       4,
+				Quantity:     2,
+				Method:       ObtainTypeMarket,
+				ObtainMethod: "Market",
+				Cost:         60,
+				EffortFactor: 1.0,
+			},
+		},
+	}
+
+	got := p.GetCheapestObtainMethod(item, 3, &listings, player).CraftingTree()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CraftingTree() = %+v, want %+v", got, want)
+	}
+
+	var noMethod *ObtainMethod
+	if tree := noMethod.CraftingTree(); tree != nil {
+		t.Errorf("CraftingTree() = %+v for a missing obtain method, want nil", tree)
+	}
+}
@@ -0,0 +1,78 @@
+package profitCalc
+
+import "sort"
+
+// RecipeUsage
+// A recipe that uses an item as one of its ingredients
+type RecipeUsage struct {
+	ProductId int
+	// How many of the ingredient the recipe needs
+	Quantity int
+	Recipe   *RecipeInfo
+}
+
+// IngredientIndex
+// Points from an ingredient's item id to every recipe that uses it, the reverse of Item.CraftingRecipes
+type IngredientIndex map[int][]RecipeUsage
+
+func NewIngredientIndex(items map[int]*Item) IngredientIndex {
+	index := make(IngredientIndex)
+
+	for _, item := range items {
+		if item.CraftingRecipes == nil {
+			continue
+		}
+
+		for recipeIndex := range *item.CraftingRecipes {
+			recipe := &(*item.CraftingRecipes)[recipeIndex]
+
+			for _, ingredient := range recipe.RecipeIngredients {
+				index[ingredient.ItemId] = append(
+					index[ingredient.ItemId], RecipeUsage{
+						ProductId: item.Id,
+						Quantity:  ingredient.Quantity,
+						Recipe:    recipe,
+					},
+				)
+			}
+		}
+	}
+
+	// Keep the order stable, since the item map isn't
+	for _, usages := range index {
+		sort.Slice(
+			usages, func(i, j int) bool {
+				return usages[i].ProductId < usages[j].ProductId
+			},
+		)
+	}
+
+	return index
+}
+
+// UsedIn
+// Returns every recipe that directly uses the item as an ingredient
+func (index IngredientIndex) UsedIn(itemId int) []RecipeUsage {
+	return index[itemId]
+}
+
+// AffectedItems
+// Returns the item along with every product that uses it anywhere in its crafting tree, so a change in the item's
+// price can be carried up to everything crafted from it.
+func (index IngredientIndex) AffectedItems(itemId int) []int {
+	seen := map[int]struct{}{itemId: {}}
+	result := []int{itemId}
+
+	for i := 0; i < len(result); i++ {
+		for _, usage := range index[result[i]] {
+			if _, ok := seen[usage.ProductId]; ok {
+				continue
+			}
+
+			seen[usage.ProductId] = struct{}{}
+			result = append(result, usage.ProductId)
+		}
+	}
+
+	return result
+}
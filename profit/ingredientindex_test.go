@@ -0,0 +1,68 @@
+package profitCalc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIngredientIndex(t *testing.T) {
+	items := map[int]*Item{
+		1: {Id: 1},
+		2: {Id: 2},
+		// Made from 1 and 2
+		3: {
+			Id: 3,
+			CraftingRecipes: &[]RecipeInfo{
+				{RecipeIngredients: []RecipeIngredients{{ItemId: 1, Quantity: 2}, {ItemId: 2, Quantity: 1}}},
+			},
+		},
+		// Made from 3, or from 1 with a second recipe
+		4: {
+			Id: 4,
+			CraftingRecipes: &[]RecipeInfo{
+				{RecipeIngredients: []RecipeIngredients{{ItemId: 3, Quantity: 1}}},
+				{RecipeIngredients: []RecipeIngredients{{ItemId: 1, Quantity: 5}}},
+			},
+		},
+	}
+
+	index := NewIngredientIndex(items)
+
+	t.Run(
+		"UsedIn returns every recipe that directly uses an item", func(t *testing.T) {
+			usages := index.UsedIn(1)
+
+			got := make([][2]int, 0, len(usages))
+			for _, usage := range usages {
+				got = append(got, [2]int{usage.ProductId, usage.Quantity})
+			}
+
+			if want := [][2]int{{3, 2}, {4, 5}}; !reflect.DeepEqual(got, want) {
+				t.Errorf("UsedIn() = %v, want %v", got, want)
+			}
+
+			if usages[1].Recipe != &(*items[4].CraftingRecipes)[1] {
+				t.Errorf("UsedIn() didn't point to the recipe that uses the item")
+			}
+		},
+	)
+
+	tests := []struct {
+		name   string
+		itemId int
+		want   []int
+	}{
+		{name: "Products crafted from an ingredient further up the tree are included", itemId: 2, want: []int{2, 3, 4}},
+		{name: "Products reached through several recipes are only included once", itemId: 1, want: []int{1, 3, 4}},
+		{name: "Items that aren't used in anything only affect themselves", itemId: 4, want: []int{4}},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if got := index.AffectedItems(tt.itemId); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("AffectedItems() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
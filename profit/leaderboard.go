@@ -0,0 +1,397 @@
+package profitCalc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ProfitSnapshot
+// The ranked profit of every marketable item on a world, as of ComputedAt
+type ProfitSnapshot struct {
+	WorldId int
+	// When every item was last calculated
+	ComputedAt time.Time
+	// When any item was last recalculated because its market data changed
+	UpdatedAt time.Time
+	Results   []*ProfitInfo
+}
+
+// ProfitLeaderboard
+// Periodically calculates the profit of every marketable item on each tracked world in the background, so requests
+// can be served from memory instead of querying the database for every item.
+type ProfitLeaderboard struct {
+	calculator *ProfitCalculator
+	// The data center of each tracked world, keyed by world id
+	worlds  map[int]int
+	workers int
+
+	mutex     sync.RWMutex
+	snapshots map[int]*ProfitSnapshot
+
+	dirtyMutex sync.Mutex
+	// Items waiting to be recalculated on each world
+	dirty map[int]map[int]struct{}
+	// When each item on each world was last marked dirty, so full refreshes don't overwrite newer results
+	changedAt map[int]map[int]time.Time
+}
+
+func NewProfitLeaderboard(calculator *ProfitCalculator, worlds map[int]int, workers int) *ProfitLeaderboard {
+	return &ProfitLeaderboard{
+		calculator: calculator,
+		worlds:     worlds,
+		workers:    max(workers, 1),
+		snapshots:  make(map[int]*ProfitSnapshot, len(worlds)),
+		dirty:      make(map[int]map[int]struct{}),
+		changedAt:  make(map[int]map[int]time.Time),
+	}
+}
+
+// TopResults
+// The best results on a world's snapshot (by profit score) that match the filter, up to count of them, along with
+// when the snapshot was last updated. Returns false if the world doesn't have a snapshot yet.
+func (l *ProfitLeaderboard) TopResults(worldId int, filter ProfitFilter, count int) ([]*ProfitInfo, time.Time, bool) {
+	snapshot, ok := l.GetSnapshot(worldId)
+	if !ok {
+		return nil, time.Time{}, false
+	}
+
+	results := l.calculator.FilterProfits(snapshot.Results, filter)
+	if len(results) > count {
+		results = results[:count]
+	}
+
+	return results, snapshot.UpdatedAt, true
+}
+
+// IsTracked
+// Checks if the leaderboard calculates profits for the given world
+func (l *ProfitLeaderboard) IsTracked(worldId int) bool {
+	_, ok := l.worlds[worldId]
+	return ok
+}
+
+// GetSnapshot
+// Returns the latest snapshot for a world, or false if one hasn't been computed yet.
+// The snapshot is shared between callers and must not be modified.
+func (l *ProfitLeaderboard) GetSnapshot(worldId int) (*ProfitSnapshot, bool) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	snapshot, ok := l.snapshots[worldId]
+	return snapshot, ok
+}
+
+// Run
+// Refreshes every tracked world straight away and then once per refreshInterval until the context is cancelled.
+// Items marked dirty in between are recalculated every dirtyInterval.
+func (l *ProfitLeaderboard) Run(ctx context.Context, refreshInterval, dirtyInterval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(dirtyInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				l.RefreshDirty()
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		l.Refresh()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh
+// Recalculates the snapshot of every tracked world one at a time
+func (l *ProfitLeaderboard) Refresh() {
+	for worldId := range l.worlds {
+		start := time.Now()
+		snapshot, errs := l.RefreshWorld(worldId)
+
+		if len(errs) > 0 {
+			log.Printf("%d items failed to calculate profit on world %d, first error: %s\n", len(errs), worldId, errs[0])
+		}
+
+		log.Printf(
+			"Calculated profit leaderboard for world %d with %d items in %s\n",
+			worldId,
+			len(snapshot.Results),
+			time.Since(start),
+		)
+	}
+}
+
+// RefreshWorld
+// Recalculates and stores the snapshot for a single world. Items that failed to calculate are left out of the
+// snapshot and their errors are returned.
+func (l *ProfitLeaderboard) RefreshWorld(worldId int) (*ProfitSnapshot, []error) {
+	start := time.Now()
+	playerInfo := NewDefaultPlayerInfo(worldId, l.worlds[worldId])
+	results, errs := l.calculator.CalculateProfitForItems(l.calculator.marketableItems(), playerInfo, l.workers)
+
+	SortProfits(results, SortByProfitScore)
+
+	computedAt := time.Now().UTC()
+	snapshot := &ProfitSnapshot{
+		WorldId:    worldId,
+		ComputedAt: computedAt,
+		UpdatedAt:  computedAt,
+		Results:    results,
+	}
+
+	l.mutex.Lock()
+	l.snapshots[worldId] = snapshot
+	l.mutex.Unlock()
+
+	// Anything that changed while the refresh was running may have been calculated with old data, so it's queued
+	// up again. Anything older is covered by this refresh.
+	l.dirtyMutex.Lock()
+	for itemId, changedAt := range l.changedAt[worldId] {
+		if changedAt.After(start) {
+			l.markDirty(worldId, itemId)
+		} else {
+			delete(l.changedAt[worldId], itemId)
+		}
+	}
+	l.dirtyMutex.Unlock()
+
+	return snapshot, errs
+}
+
+// MarkListingsChanged
+// Queues up an item to be recalculated after its market listings change, along with everything crafted from it.
+// Listings can be bought from any world on the data center, so every tracked world on it is affected.
+func (l *ProfitLeaderboard) MarkListingsChanged(worldId, itemId int) {
+	dataCenterId, ok := l.worlds[worldId]
+	if !ok {
+		return
+	}
+
+	affectedItems := l.calculator.Ingredients.AffectedItems(itemId)
+	now := time.Now()
+
+	l.dirtyMutex.Lock()
+	defer l.dirtyMutex.Unlock()
+
+	for trackedWorldId, trackedDataCenterId := range l.worlds {
+		if trackedDataCenterId != dataCenterId {
+			continue
+		}
+
+		for _, affectedItemId := range affectedItems {
+			l.markChanged(trackedWorldId, affectedItemId, now)
+		}
+	}
+}
+
+// MarkSalesChanged
+// Queues up an item to be recalculated after it's sold. Sale history is only used to value the item itself on the
+// world it sold on, so products crafted from it aren't affected.
+func (l *ProfitLeaderboard) MarkSalesChanged(worldId, itemId int) {
+	if !l.IsTracked(worldId) {
+		return
+	}
+
+	l.dirtyMutex.Lock()
+	defer l.dirtyMutex.Unlock()
+
+	l.markChanged(worldId, itemId, time.Now())
+}
+
+func (l *ProfitLeaderboard) markChanged(worldId, itemId int, changedAt time.Time) {
+	if l.changedAt[worldId] == nil {
+		l.changedAt[worldId] = make(map[int]time.Time)
+	}
+
+	l.changedAt[worldId][itemId] = changedAt
+	l.markDirty(worldId, itemId)
+}
+
+func (l *ProfitLeaderboard) markDirty(worldId, itemId int) {
+	if l.dirty[worldId] == nil {
+		l.dirty[worldId] = make(map[int]struct{})
+	}
+
+	l.dirty[worldId][itemId] = struct{}{}
+}
+
+// RefreshDirty
+// Recalculates every item that's been marked dirty since the last call and swaps them into each world's snapshot.
+// Worlds without a snapshot yet are skipped, as their first full refresh will include the changes.
+func (l *ProfitLeaderboard) RefreshDirty() {
+	l.dirtyMutex.Lock()
+	dirty := l.dirty
+	l.dirty = make(map[int]map[int]struct{})
+	l.dirtyMutex.Unlock()
+
+	for worldId, itemIds := range dirty {
+		if _, ok := l.GetSnapshot(worldId); !ok {
+			continue
+		}
+
+		if errs := l.refreshItems(worldId, itemIds); len(errs) > 0 {
+			log.Printf("%d items failed to recalculate profit on world %d, first error: %s\n", len(errs), worldId, errs[0])
+		}
+	}
+}
+
+func (l *ProfitLeaderboard) refreshItems(worldId int, itemIds map[int]struct{}) []error {
+	items := make([]*Item, 0, len(itemIds))
+	for itemId := range itemIds {
+		if item, ok := (*l.calculator.Items)[itemId]; ok && !item.MarketProhibited {
+			items = append(items, item)
+		}
+	}
+
+	playerInfo := NewDefaultPlayerInfo(worldId, l.worlds[worldId])
+	updatedResults, errs := l.calculator.CalculateProfitForItems(items, playerInfo, l.workers)
+
+	// Items that failed keep their previous result rather than disappearing from the leaderboard
+	failedItems := make(map[int]struct{})
+	for _, err := range errs {
+		var itemErr *ItemProfitError
+		if errors.As(err, &itemErr) {
+			failedItems[itemErr.ItemId] = struct{}{}
+		}
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	snapshot, ok := l.snapshots[worldId]
+	if !ok {
+		return errs
+	}
+
+	// Snapshots are shared with readers, so a new one is built rather than changing the old one
+	results := make([]*ProfitInfo, 0, len(snapshot.Results)+len(updatedResults))
+	for _, result := range snapshot.Results {
+		_, isDirty := itemIds[result.ItemId]
+		_, hasFailed := failedItems[result.ItemId]
+		if isDirty && !hasFailed {
+			continue
+		}
+
+		results = append(results, result)
+	}
+
+	results = append(results, updatedResults...)
+	SortProfits(results, SortByProfitScore)
+
+	l.snapshots[worldId] = &ProfitSnapshot{
+		WorldId:    worldId,
+		ComputedAt: snapshot.ComputedAt,
+		UpdatedAt:  time.Now().UTC(),
+		Results:    results,
+	}
+
+	return errs
+}
+
+// ItemProfitError
+// An error from calculating the profit of one item in a batch
+type ItemProfitError struct {
+	ItemId int
+	Err    error
+}
+
+func (e *ItemProfitError) Error() string {
+	return fmt.Sprintf("item %d: %s", e.ItemId, e.Err)
+}
+
+func (e *ItemProfitError) Unwrap() error {
+	return e.Err
+}
+
+func (p *ProfitCalculator) marketableItems() []*Item {
+	items := make([]*Item, 0, len(*p.Items))
+	for _, item := range *p.Items {
+		if item.MarketProhibited {
+			continue
+		}
+
+		items = append(items, item)
+	}
+
+	return items
+}
+
+// CalculateProfitForItems
+// Calculates the profit of many items at once using a fixed number of workers, so the database isn't flooded with
+// one query per item all at once. Items that can't be obtained or sold are left out.
+func (p *ProfitCalculator) CalculateProfitForItems(
+	items []*Item,
+	info *PlayerInfo,
+	workers int,
+) ([]*ProfitInfo, []error) {
+	itemsChan := make(chan *Item)
+	resultsChan := make(chan *ProfitInfo)
+	errorsChan := make(chan error)
+
+	var wg sync.WaitGroup
+	for i := 0; i < max(workers, 1); i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for item := range itemsChan {
+				profitInfo, err := p.CalculateProfitForItem(item, info)
+				if err != nil {
+					errorsChan <- &ItemProfitError{ItemId: item.Id, Err: err}
+				} else if profitInfo != nil {
+					resultsChan <- profitInfo
+				}
+			}
+		}()
+	}
+
+	go func() {
+		for _, item := range items {
+			itemsChan <- item
+		}
+
+		close(itemsChan)
+		wg.Wait()
+		close(resultsChan)
+		close(errorsChan)
+	}()
+
+	results := make([]*ProfitInfo, 0, len(items))
+	errs := make([]error, 0)
+
+	for resultsChan != nil || errorsChan != nil {
+		select {
+		case result, ok := <-resultsChan:
+			if !ok {
+				resultsChan = nil
+			} else {
+				results = append(results, result)
+			}
+		case err, ok := <-errorsChan:
+			if !ok {
+				errorsChan = nil
+			} else {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return results, errs
+}
@@ -0,0 +1,191 @@
+package profitCalc
+
+import (
+	"github.com/level-5-pidgey/MarketMoogle/csv/readertype"
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	"github.com/level-5-pidgey/MarketMoogle/profit/exchange"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func newLeaderboardTestCalculator(t *testing.T) *ProfitCalculator {
+	t.Helper()
+
+	itemMap := map[int]*Item{
+		// Cheap on the market and sells to an NPC for more
+		1: {
+			Id:          1,
+			CanBeTraded: true,
+			ExchangeMethods: &[]exchange.Method{
+				exchange.NewGilExchange(500, "NPC", ""),
+			},
+		},
+		2: {
+			Id:          2,
+			CanBeTraded: true,
+			ExchangeMethods: &[]exchange.Method{
+				exchange.NewGilExchange(1000, "NPC", ""),
+			},
+		},
+		// Crafted from the first item
+		4: {
+			Id:          4,
+			CanBeTraded: true,
+			ExchangeMethods: &[]exchange.Method{
+				exchange.NewGilExchange(2000, "NPC", ""),
+			},
+			CraftingRecipes: &[]RecipeInfo{
+				{
+					Yield:             1,
+					JobRequired:       readertype.JobCarpenter,
+					RecipeLevel:       1,
+					RecipeIngredients: []RecipeIngredients{{ItemId: 1, Quantity: 2}},
+				},
+			},
+		},
+		// Can't be traded on the market, so isn't part of the leaderboard
+		3: {
+			Id:               3,
+			MarketProhibited: true,
+			CanBeTraded:      true,
+			ExchangeMethods: &[]exchange.Method{
+				exchange.NewGilExchange(50, "NPC", ""),
+			},
+		},
+	}
+
+	repo := db.NewMockRepository()
+	listings := []db.Listing{
+		{Id: 1, ItemId: 1, WorldId: 1, PricePer: 100, Quantity: 1, Total: 100},
+		{Id: 2, ItemId: 2, WorldId: 1, PricePer: 100, Quantity: 1, Total: 100},
+		{Id: 3, ItemId: 1, WorldId: 1, PricePer: 100, Quantity: 1, Total: 100},
+	}
+	for _, listing := range listings {
+		if _, err := repo.CreateListing(listing); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return NewProfitCalculator(&itemMap, nil, nil, repo, nil)
+}
+
+func TestProfitCalculator_CalculateProfitForItems(t *testing.T) {
+	p := newLeaderboardTestCalculator(t)
+	items := []*Item{(*p.Items)[1], (*p.Items)[2]}
+
+	for _, workers := range []int{0, 1, 4} {
+		results, errs := p.CalculateProfitForItems(items, NewDefaultPlayerInfo(1, 1), workers)
+		if len(errs) > 0 {
+			t.Fatalf("CalculateProfitForItems() with %d workers errors = %v", workers, errs)
+		}
+
+		ids := profitResultIds(results)
+		sort.Ints(ids)
+		if want := []int{1, 2}; !reflect.DeepEqual(ids, want) {
+			t.Errorf("CalculateProfitForItems() with %d workers = %v, want %v", workers, ids, want)
+		}
+	}
+}
+
+func TestProfitLeaderboard_RefreshWorld(t *testing.T) {
+	leaderboard := NewProfitLeaderboard(newLeaderboardTestCalculator(t), map[int]int{1: 1}, 2)
+
+	if _, ok := leaderboard.GetSnapshot(1); ok {
+		t.Fatalf("GetSnapshot() found a snapshot before the leaderboard was refreshed")
+	}
+
+	snapshot, errs := leaderboard.RefreshWorld(1)
+	if len(errs) > 0 {
+		t.Fatalf("RefreshWorld() errors = %v", errs)
+	}
+
+	if snapshot.ComputedAt.IsZero() {
+		t.Errorf("RefreshWorld() didn't set when the snapshot was computed")
+	}
+
+	// Ranked by profit score, without the market prohibited item
+	if got, want := profitResultIds(snapshot.Results), []int{4, 2, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("RefreshWorld() results = %v, want %v", got, want)
+	}
+
+	if got, ok := leaderboard.GetSnapshot(1); !ok || got != snapshot {
+		t.Errorf("GetSnapshot() = %v, want %v", got, snapshot)
+	}
+
+	if leaderboard.IsTracked(2) {
+		t.Errorf("IsTracked() = true for a world that isn't tracked")
+	}
+}
+
+func TestProfitLeaderboard_RefreshDirty(t *testing.T) {
+	p := newLeaderboardTestCalculator(t)
+	// Worlds 1 and 2 share a data center, world 3 is on another one
+	leaderboard := NewProfitLeaderboard(p, map[int]int{1: 1, 2: 1, 3: 2}, 2)
+
+	before := make(map[int]map[int]*ProfitInfo)
+	for _, worldId := range []int{1, 2, 3} {
+		snapshot, errs := leaderboard.RefreshWorld(worldId)
+		if len(errs) > 0 {
+			t.Fatalf("RefreshWorld() errors = %v", errs)
+		}
+
+		before[worldId] = make(map[int]*ProfitInfo)
+		for _, result := range snapshot.Results {
+			before[worldId][result.ItemId] = result
+		}
+	}
+
+	// A cheaper listing of the ingredient shows up
+	if _, err := p.repository.CreateListing(
+		db.Listing{Id: 4, ItemId: 1, WorldId: 1, PricePer: 10, Quantity: 5, Total: 50},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	leaderboard.MarkListingsChanged(1, 1)
+	leaderboard.RefreshDirty()
+
+	tests := []struct {
+		name        string
+		worldId     int
+		itemId      int
+		wantChanged bool
+	}{
+		{name: "Ingredient is recalculated", worldId: 1, itemId: 1, wantChanged: true},
+		{name: "Product crafted from the ingredient is recalculated", worldId: 1, itemId: 4, wantChanged: true},
+		{name: "Unrelated item is left alone", worldId: 1, itemId: 2, wantChanged: false},
+		{name: "Worlds on the same data center are recalculated", worldId: 2, itemId: 4, wantChanged: true},
+		{name: "Worlds on other data centers are left alone", worldId: 3, itemId: 1, wantChanged: false},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				snapshot, ok := leaderboard.GetSnapshot(tt.worldId)
+				if !ok {
+					t.Fatalf("GetSnapshot() found no snapshot for world %d", tt.worldId)
+				}
+
+				var got *ProfitInfo
+				for _, result := range snapshot.Results {
+					if result.ItemId == tt.itemId {
+						got = result
+					}
+				}
+
+				if got == nil {
+					t.Fatalf("item %d is missing from the snapshot", tt.itemId)
+				}
+
+				if changed := got != before[tt.worldId][tt.itemId]; changed != tt.wantChanged {
+					t.Errorf("item %d changed = %v, want %v", tt.itemId, changed, tt.wantChanged)
+				}
+			},
+		)
+	}
+
+	// Nothing is left to recalculate
+	if len(leaderboard.dirty) > 0 {
+		t.Errorf("RefreshDirty() left dirty items %v", leaderboard.dirty)
+	}
+}
@@ -0,0 +1,117 @@
+package profitCalc
+
+import (
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	"math"
+	"sync"
+)
+
+// maxKnapsackQuantity is the largest quantity the exact listing search is used for, above it listings are bought
+// cheapest first instead
+const maxKnapsackQuantity = 5000
+
+// knapsackBuffer
+// The tables for one listing search, pooled so searches across every item and request reuse the same memory
+type knapsackBuffer struct {
+	cheapest []float64
+	taken    []bool
+}
+
+var knapsackBuffers = sync.Pool{
+	New: func() any {
+		return &knapsackBuffer{}
+	},
+}
+
+// reset
+// Sizes the tables for a search, growing them only if they're too small
+func (b *knapsackBuffer) reset(listingCount, numRequired int) {
+	if cap(b.cheapest) < numRequired+1 {
+		b.cheapest = make([]float64, numRequired+1)
+	}
+
+	b.cheapest = b.cheapest[:numRequired+1]
+	b.cheapest[0] = 0
+	for quantity := 1; quantity <= numRequired; quantity++ {
+		b.cheapest[quantity] = math.Inf(1)
+	}
+
+	size := listingCount * (numRequired + 1)
+	if cap(b.taken) < size {
+		b.taken = make([]bool, size)
+	}
+
+	b.taken = b.taken[:size]
+	clear(b.taken)
+}
+
+// cheapestListingCombination
+// Picks the set of whole listings with the lowest effort weighted cost that adds up to at least numRequired items.
+// Buying 3 items shouldn't mean buying a stack of 99 when a few small listings are cheaper overall. If there aren't
+// enough listings, all of them are returned. Listings are expected to be sorted from cheapest to most expensive.
+func cheapestListingCombination(listings []*db.Listing, numRequired, homeServer int) []*db.Listing {
+	available := 0
+	for _, listing := range listings {
+		available += listing.Quantity
+	}
+
+	if available <= numRequired {
+		return listings
+	}
+
+	if numRequired > maxKnapsackQuantity {
+		return greedyListingCombination(listings, numRequired)
+	}
+
+	buffer := knapsackBuffers.Get().(*knapsackBuffer)
+	defer knapsackBuffers.Put(buffer)
+	buffer.reset(len(listings), numRequired)
+
+	// cheapest[q] is the lowest cost of buying at least q items with the listings seen so far
+	cheapest := buffer.cheapest
+
+	// taken[i*width+q] records whether listing i is part of the cheapest way to buy at least q items
+	width := numRequired + 1
+	taken := buffer.taken
+	for index, listing := range listings {
+		cost := calculateListingEffortCost(listing, homeServer)
+
+		for quantity := numRequired; quantity > 0; quantity-- {
+			withListing := cheapest[max(quantity-listing.Quantity, 0)] + cost
+			if withListing < cheapest[quantity] {
+				cheapest[quantity] = withListing
+				taken[index*width+quantity] = true
+			}
+		}
+	}
+
+	result := make([]*db.Listing, 0)
+	quantity := numRequired
+	for index := len(listings) - 1; index >= 0 && quantity > 0; index-- {
+		if taken[index*width+quantity] {
+			result = append(result, listings[index])
+			quantity = max(quantity-listings[index].Quantity, 0)
+		}
+	}
+
+	// Keep the same cheapest first order the listings came in
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+
+	return result
+}
+
+func greedyListingCombination(listings []*db.Listing, numRequired int) []*db.Listing {
+	result := make([]*db.Listing, 0)
+	for _, listing := range listings {
+		if numRequired <= 0 {
+			break
+		}
+
+		result = append(result, listing)
+		numRequired -= listing.Quantity
+	}
+
+	return result
+}
@@ -0,0 +1,90 @@
+package profitCalc
+
+import (
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	"reflect"
+	"testing"
+)
+
+func Test_cheapestListingCombination(t *testing.T) {
+	single := &db.Listing{Id: 1, ItemId: 1, WorldId: 1, PricePer: 10, Quantity: 1, Total: 10}
+	bigStack := &db.Listing{Id: 2, ItemId: 1, WorldId: 1, PricePer: 20, Quantity: 5, Total: 100}
+	smallStack := &db.Listing{Id: 3, ItemId: 1, WorldId: 1, PricePer: 30, Quantity: 4, Total: 120}
+	homeListing := &db.Listing{Id: 4, ItemId: 2, WorldId: 1, PricePer: 100, Quantity: 1, Total: 100}
+	awayListing := &db.Listing{Id: 5, ItemId: 2, WorldId: 2, PricePer: 100, Quantity: 1, Total: 100}
+
+	tests := []struct {
+		name        string
+		listings    []*db.Listing
+		numRequired int
+		want        []*db.Listing
+	}{
+		{
+			name:        "Finds a cheaper combination than buying the cheapest listings first",
+			listings:    []*db.Listing{single, bigStack, smallStack},
+			numRequired: 5,
+			want:        []*db.Listing{bigStack},
+		},
+		{
+			name:        "Buys a single listing when that's all that's needed",
+			listings:    []*db.Listing{single, bigStack, smallStack},
+			numRequired: 1,
+			want:        []*db.Listing{single},
+		},
+		{
+			name:        "Buys everything when there isn't enough",
+			listings:    []*db.Listing{single, bigStack},
+			numRequired: 10,
+			want:        []*db.Listing{single, bigStack},
+		},
+		{
+			name:        "Prefers the home world when prices are equal",
+			listings:    []*db.Listing{awayListing, homeListing},
+			numRequired: 1,
+			want:        []*db.Listing{homeListing},
+		},
+		{
+			name:        "Nothing required buys nothing",
+			listings:    []*db.Listing{single},
+			numRequired: 0,
+			want:        []*db.Listing{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if got := cheapestListingCombination(tt.listings, tt.numRequired, 1); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("cheapestListingCombination() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestObtainMethod_GetSurplus(t *testing.T) {
+	method := &ObtainMethod{
+		ShoppingCart: ShoppingCart{
+			ItemsToBuy: []ShoppingItem{
+				ShoppingListing{ItemId: 1, Quantity: 99, listingId: 1, worldId: 1, CostPer: 10},
+				ShoppingListing{ItemId: 2, Quantity: 2, listingId: 2, worldId: 1, CostPer: 30},
+				ShoppingListing{ItemId: 2, Quantity: 1, listingId: 3, worldId: 1, CostPer: 60},
+				LocalItem{ItemId: 3, Quantity: 2, ObtainedFrom: "Buy from NPC", CostPer: 5},
+			},
+			itemsRequired: map[int]int{1: 3, 2: 2, 3: 2},
+		},
+	}
+
+	// The whole stack is paid for, not just the 3 needed
+	if got, want := method.GetCost(), 1120; got != want {
+		t.Errorf("GetCost() = %d, want %d", got, want)
+	}
+
+	if got, want := method.GetSurplus(), map[int]int{1: 96, 2: 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetSurplus() = %v, want %v", got, want)
+	}
+
+	// 96 at 10 each, and 1 at the 40 average paid for item 2
+	if got, want := method.GetSurplusValue(), 1000; got != want {
+		t.Errorf("GetSurplusValue() = %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,151 @@
+package profitCalc
+
+import (
+	"context"
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	"log"
+	"maps"
+	"sync"
+	"time"
+)
+
+// Retainer cities, using the same ids Universalis reports listings with
+const (
+	RetainerCityNone         = 0
+	RetainerCityLimsaLominsa = 1
+	RetainerCityGridania     = 2
+	RetainerCityUldah        = 3
+	RetainerCityIshgard      = 4
+	RetainerCityKugane       = 7
+	RetainerCityCrystarium   = 10
+	RetainerCityOldSharlayan = 12
+	RetainerCityTuliyollal   = 14
+)
+
+// DefaultMarketTaxRate is the percentage of a purchase buyers pay as tax when a city's rate isn't known
+const DefaultMarketTaxRate = 5
+
+// retainerCities are the cities retainers can list items in
+var retainerCities = map[int]struct{}{
+	RetainerCityLimsaLominsa: {},
+	RetainerCityGridania:     {},
+	RetainerCityUldah:        {},
+	RetainerCityIshgard:      {},
+	RetainerCityKugane:       {},
+	RetainerCityCrystarium:   {},
+	RetainerCityOldSharlayan: {},
+	RetainerCityTuliyollal:   {},
+}
+
+// IsRetainerCity
+// Checks if the id is a city retainers can list items in
+func IsRetainerCity(city int) bool {
+	_, ok := retainerCities[city]
+	return ok
+}
+
+// TaxRateSource
+// Where the current tax rate of each city on a world comes from, keyed by retainer city
+type TaxRateSource interface {
+	TaxRates(ctx context.Context, worldId int) (map[int]int, error)
+}
+
+// MarketTaxRates
+// The percentage buyers pay as tax for listings in each city on each world. Rates change every week and a city can be
+// tax free, so they're loaded from a TaxRateSource. Cities without a loaded rate use DefaultMarketTaxRate.
+type MarketTaxRates struct {
+	mutex sync.RWMutex
+	// Rates keyed by world id, then retainer city
+	rates map[int]map[int]int
+}
+
+func NewMarketTaxRates() *MarketTaxRates {
+	return &MarketTaxRates{
+		rates: make(map[int]map[int]int),
+	}
+}
+
+// Set
+// Replaces the tax rates of every city on a world
+func (r *MarketTaxRates) Set(worldId int, rates map[int]int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.rates[worldId] = maps.Clone(rates)
+}
+
+// Rate
+// The percentage buyers pay on top of the price of listings in a city on a world, or the default rate if it isn't
+// known
+func (r *MarketTaxRates) Rate(worldId, city int) int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if rate, ok := r.rates[worldId][city]; ok {
+		return rate
+	}
+
+	return DefaultMarketTaxRate
+}
+
+// Refresh
+// Loads the current tax rates of each world, keeping the last known rates of any world that fails to load
+func (r *MarketTaxRates) Refresh(ctx context.Context, source TaxRateSource, worldIds []int) {
+	for _, worldId := range worldIds {
+		rates, err := source.TaxRates(ctx, worldId)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			log.Printf("failed to load tax rates for world %d: %s\n", worldId, err)
+			continue
+		}
+
+		r.Set(worldId, rates)
+	}
+}
+
+// Run
+// Refreshes the tax rates of each world straight away and then once per interval until the context is cancelled
+func (r *MarketTaxRates) Run(ctx context.Context, source TaxRateSource, worldIds []int, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		r.Refresh(ctx, source, worldIds)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// listingCost
+// What buying a whole listing actually costs, including the tax the buyer pays on top of its price
+func listingCost(listing *db.Listing) int {
+	return listing.Total + listing.Tax
+}
+
+// undercutPricePer
+// The highest price per item a listing in the seller's retainer city, with the given tax rate, can have while still
+// costing buyers less than the given listing once tax is paid on both. Buyers compare prices with tax included, so
+// listing in a city with a lower tax rate leaves room to charge more.
+func undercutPricePer(listing *db.Listing, taxRate int) int {
+	if listing.Quantity <= 0 {
+		return 0
+	}
+
+	// price * (100 + rate) / 100 has to be less than the buyer's cost per item
+	divisor := listing.Quantity * (100 + taxRate)
+	return max((listingCost(listing)*100+divisor-1)/divisor-1, 0)
+}
+
+// pricePerAfterTax
+// Converts a price paid in a city with the default tax rate to the price that costs buyers the same in the seller's
+// retainer city, with the given tax rate
+func pricePerAfterTax(pricePer, taxRate int) int {
+	return pricePer * (100 + DefaultMarketTaxRate) / (100 + taxRate)
+}
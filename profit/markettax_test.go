@@ -0,0 +1,156 @@
+package profitCalc
+
+import (
+	"context"
+	"errors"
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	"testing"
+)
+
+func TestUndercutPricePer(t *testing.T) {
+	tests := []struct {
+		name    string
+		listing *db.Listing
+		taxRate int
+		want    int
+	}{
+		{
+			name:    "Taxed listing is undercut by 1 gil when both cities have the same rate",
+			listing: &db.Listing{PricePer: 100, Quantity: 5, Total: 500, Tax: 25},
+			taxRate: 5,
+			want:    99,
+		},
+		{
+			name:    "Tax free listing has to be undercut by the tax buyers pay on ours",
+			listing: &db.Listing{PricePer: 100, Quantity: 1, Total: 100},
+			taxRate: 5,
+			want:    95,
+		},
+		{
+			name:    "Listing from a tax free city can charge what buyers pay for a taxed listing",
+			listing: &db.Listing{PricePer: 100, Quantity: 1, Total: 100, Tax: 5},
+			taxRate: 0,
+			want:    104,
+		},
+		{
+			name:    "Lower tax rate leaves room to charge more",
+			listing: &db.Listing{PricePer: 1000, Quantity: 2, Total: 2000, Tax: 100},
+			taxRate: 3,
+			want:    1019,
+		},
+		{
+			name:    "Price never goes below 0",
+			listing: &db.Listing{PricePer: 1, Quantity: 1, Total: 1},
+			taxRate: 5,
+			want:    0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if got := undercutPricePer(tt.listing, tt.taxRate); got != tt.want {
+					t.Errorf("undercutPricePer() = %d, want %d", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+// fakeTaxRateSource returns fixed rates for each world, failing for any world it doesn't have
+type fakeTaxRateSource map[int]map[int]int
+
+func (s fakeTaxRateSource) TaxRates(_ context.Context, worldId int) (map[int]int, error) {
+	rates, ok := s[worldId]
+	if !ok {
+		return nil, errors.New("world not found")
+	}
+
+	return rates, nil
+}
+
+func TestMarketTaxRates_Refresh(t *testing.T) {
+	rates := NewMarketTaxRates()
+	rates.Set(2, map[int]int{RetainerCityGridania: 3})
+
+	source := fakeTaxRateSource{
+		1: {RetainerCityLimsaLominsa: 0, RetainerCityGridania: 3},
+	}
+	rates.Refresh(context.Background(), source, []int{1, 2})
+
+	tests := []struct {
+		name    string
+		worldId int
+		city    int
+		want    int
+	}{
+		{name: "Tax free city keeps its rate of 0", worldId: 1, city: RetainerCityLimsaLominsa, want: 0},
+		{name: "Loaded rate is used", worldId: 1, city: RetainerCityGridania, want: 3},
+		{name: "City without a loaded rate uses the default", worldId: 1, city: RetainerCityKugane, want: 5},
+		{name: "World that failed to load keeps its last rates", worldId: 2, city: RetainerCityGridania, want: 3},
+		{name: "No retainer city uses the default", worldId: 1, city: RetainerCityNone, want: 5},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if got := rates.Rate(tt.worldId, tt.city); got != tt.want {
+					t.Errorf("Rate() = %d, want %d", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestProfitCalculator_GetBestSaleMethod_TaxRate(t *testing.T) {
+	item := &Item{Id: 1}
+	listings := &[]*db.Listing{
+		{Id: 1, ItemId: 1, WorldId: 1, PricePer: 100, Quantity: 1, Total: 100, Tax: 5},
+	}
+
+	itemMap := map[int]*Item{item.Id: item}
+	p := NewProfitCalculator(&itemMap, nil, nil, db.NewMockRepository(), nil)
+	p.TaxRates.Set(1, map[int]int{RetainerCityLimsaLominsa: 5, RetainerCityKugane: 0})
+
+	tests := []struct {
+		name         string
+		retainerCity int
+		want         int
+	}{
+		{name: "Taxed retainer city undercuts by 1 gil", retainerCity: RetainerCityLimsaLominsa, want: 99},
+		{name: "Tax free retainer city charges what buyers pay", retainerCity: RetainerCityKugane, want: 104},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				info := &PlayerInfo{HomeServer: 1, DataCenter: 1, RetainerCity: tt.retainerCity}
+
+				got := p.GetBestSaleMethod(item, listings, nil, info, false)
+				if got == nil || got.ValuePer != tt.want {
+					t.Errorf("GetBestSaleMethod() = %+v, want ValuePer %d", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestMarketObtainMethod_IncludesTax(t *testing.T) {
+	item := &Item{Id: 1, CanBeTraded: true}
+	listings := &[]*db.Listing{
+		// Cheaper before tax, but more expensive once it's paid
+		{Id: 1, UniversalisId: "1", ItemId: 1, WorldId: 1, PricePer: 100, Quantity: 1, Total: 100, Tax: 5},
+		{Id: 2, UniversalisId: "2", ItemId: 1, WorldId: 1, PricePer: 102, Quantity: 1, Total: 102},
+	}
+
+	got := marketObtainMethod(item, nil, 1, listings, &PlayerInfo{HomeServer: 1, DataCenter: 1})
+	if got == nil {
+		t.Fatalf("marketObtainMethod() = nil, want a market purchase")
+	}
+
+	if cost := got.GetCost(); cost != 102 {
+		t.Errorf("marketObtainMethod() cost = %d, want 102", cost)
+	}
+
+	taxed := ShoppingListing{ItemId: 1, Quantity: 2, CostPer: 100, Tax: 10}
+	if cost := taxed.GetTotalCost(); cost != 210 {
+		t.Errorf("GetTotalCost() = %d, want 210", cost)
+	}
+}
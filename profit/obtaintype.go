@@ -0,0 +1,35 @@
+package profitCalc
+
+import "github.com/level-5-pidgey/MarketMoogle/csv/readertype"
+
+type ObtainType string
+
+const (
+	ObtainTypeCraft    ObtainType = "craft"
+	ObtainTypeMarket   ObtainType = "market"
+	ObtainTypeVendor   ObtainType = "vendor"
+	ObtainTypeGather   ObtainType = "gather"
+	ObtainTypeCurrency ObtainType = "currency"
+)
+
+// obtainTypeFromExchangeType
+// Groups the exchange types of non-market obtain methods into the broader obtain types
+func obtainTypeFromExchangeType(exchangeType string) ObtainType {
+	switch exchangeType {
+	case readertype.Gil:
+		return ObtainTypeVendor
+	case readertype.Gathering:
+		return ObtainTypeGather
+	default:
+		return ObtainTypeCurrency
+	}
+}
+
+func ObtainTypeFromString(s string) (ObtainType, bool) {
+	switch obtainType := ObtainType(s); obtainType {
+	case ObtainTypeCraft, ObtainTypeMarket, ObtainTypeVendor, ObtainTypeGather, ObtainTypeCurrency:
+		return obtainType, true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,192 @@
+package profitCalc
+
+import (
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	"math"
+	"slices"
+	"time"
+)
+
+const (
+	// outlierScore is how many (scaled) median absolute deviations from the median a price has to be to be an outlier
+	outlierScore = 3.5
+	// outlierPriceRatio is how many times above or below the median a price also has to be, so items that always sell
+	// for the same price don't have every small change flagged
+	outlierPriceRatio = 3.0
+	// minOutlierSamples is the fewest prices needed to tell what's typical
+	minOutlierSamples = 3
+)
+
+// Why a price was ignored
+const (
+	OutlierAboveTypical = "Price is far above what the item usually goes for"
+	OutlierBelowTypical = "Price is far below what the item usually goes for"
+)
+
+// FlaggedListing
+// A market listing left out of an item's valuation because its price is an outlier
+type FlaggedListing struct {
+	RetainerName string
+	// Price per item, including tax
+	PricePer int
+	Quantity int
+	Reason   string
+}
+
+// FlaggedSale
+// A day of sales left out of an item's valuation because the average price is an outlier, such as wash trading
+type FlaggedSale struct {
+	Day          time.Time
+	AveragePrice int
+	SaleCount    int
+	Quantity     int
+	Reason       string
+}
+
+// OutlierReport
+// The listings and sales ignored when valuing an item, and the typical price they were compared against
+type OutlierReport struct {
+	MedianPrice int
+	Listings    []FlaggedListing `json:",omitempty"`
+	Sales       []FlaggedSale    `json:",omitempty"`
+}
+
+// filterOutliers
+// Removes listings and days of sales priced far from what's typical for the item. Listing prices and daily average
+// sale prices are pooled together, and anything too far from their median (measured with the median absolute
+// deviation, so outliers don't skew it) is left out. The report is nil when nothing was flagged.
+func filterOutliers(listings *[]*db.Listing, rollups *[]*db.SaleRollup) (
+	*[]*db.Listing, *[]*db.SaleRollup, *OutlierReport,
+) {
+	prices := make([]float64, 0)
+	if listings != nil {
+		for _, listing := range *listings {
+			prices = append(prices, listingPricePer(listing))
+		}
+	}
+
+	if rollups != nil {
+		for _, rollup := range *rollups {
+			if rollup.Quantity > 0 {
+				prices = append(prices, rollup.AveragePrice())
+			}
+		}
+	}
+
+	if len(prices) < minOutlierSamples {
+		return listings, rollups, nil
+	}
+
+	median := medianOf(prices)
+	deviations := make([]float64, len(prices))
+	for index, price := range prices {
+		deviations[index] = math.Abs(price - median)
+	}
+
+	deviation := medianOf(deviations)
+	report := &OutlierReport{MedianPrice: int(math.Round(median))}
+
+	var cleanListings *[]*db.Listing
+	if listings != nil {
+		result := make([]*db.Listing, 0, len(*listings))
+		for _, listing := range *listings {
+			reason := outlierReason(listingPricePer(listing), median, deviation)
+			if reason == "" {
+				result = append(result, listing)
+				continue
+			}
+
+			report.Listings = append(
+				report.Listings, FlaggedListing{
+					RetainerName: listing.RetainerName,
+					PricePer:     int(math.Round(listingPricePer(listing))),
+					Quantity:     listing.Quantity,
+					Reason:       reason,
+				},
+			)
+		}
+
+		cleanListings = &result
+	}
+
+	var cleanRollups *[]*db.SaleRollup
+	if rollups != nil {
+		result := make([]*db.SaleRollup, 0, len(*rollups))
+		for _, rollup := range *rollups {
+			reason := ""
+			if rollup.Quantity > 0 {
+				reason = outlierReason(rollup.AveragePrice(), median, deviation)
+			}
+
+			if reason == "" {
+				result = append(result, rollup)
+				continue
+			}
+
+			report.Sales = append(
+				report.Sales, FlaggedSale{
+					Day:          rollup.BucketStart,
+					AveragePrice: int(math.Round(rollup.AveragePrice())),
+					SaleCount:    rollup.SaleCount,
+					Quantity:     rollup.Quantity,
+					Reason:       reason,
+				},
+			)
+		}
+
+		cleanRollups = &result
+	}
+
+	if len(report.Listings) == 0 && len(report.Sales) == 0 {
+		return listings, rollups, nil
+	}
+
+	return cleanListings, cleanRollups, report
+}
+
+// outlierReason
+// Why the price is an outlier compared to the median, or "" if it isn't one
+func outlierReason(price, median, deviation float64) string {
+	if median <= 0 {
+		return ""
+	}
+
+	// Scaled so the deviation matches a standard deviation for normally distributed prices
+	score := math.Inf(1)
+	if deviation > 0 {
+		score = 0.6745 * math.Abs(price-median) / deviation
+	}
+
+	if score <= outlierScore {
+		return ""
+	}
+
+	switch {
+	case price > median*outlierPriceRatio:
+		return OutlierAboveTypical
+	case price*outlierPriceRatio < median:
+		return OutlierBelowTypical
+	default:
+		return ""
+	}
+}
+
+func listingPricePer(listing *db.Listing) float64 {
+	if listing.Quantity <= 0 {
+		return float64(listing.PricePer)
+	}
+
+	return float64(listingCost(listing)) / float64(listing.Quantity)
+}
+
+func medianOf(values []float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+
+	return sorted[middle]
+}
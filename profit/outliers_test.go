@@ -0,0 +1,121 @@
+package profitCalc
+
+import (
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_filterOutliers(t *testing.T) {
+	start := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	listingsAt := func(prices ...int) []*db.Listing {
+		listings := make([]*db.Listing, 0, len(prices))
+		for index, price := range prices {
+			listings = append(
+				listings, &db.Listing{
+					Id:           index + 1,
+					RetainerName: "Retainer",
+					PricePer:     price,
+					Quantity:     1,
+					Total:        price,
+				},
+			)
+		}
+
+		return listings
+	}
+
+	rollupsAt := func(prices ...int) []*db.SaleRollup {
+		rollups := make([]*db.SaleRollup, 0, len(prices))
+		for index, price := range prices {
+			rollups = append(
+				rollups, &db.SaleRollup{
+					BucketStart: start.AddDate(0, 0, index),
+					SaleCount:   1,
+					Quantity:    1,
+					TotalPrice:  price,
+				},
+			)
+		}
+
+		return rollups
+	}
+
+	tests := []struct {
+		name         string
+		listings     []*db.Listing
+		rollups      []*db.SaleRollup
+		wantListings int
+		wantRollups  int
+		want         *OutlierReport
+	}{
+		{
+			name:         "Troll listing far above the rest is ignored",
+			listings:     listingsAt(100, 105, 110, 1000),
+			wantListings: 3,
+			want: &OutlierReport{
+				MedianPrice: 108,
+				Listings: []FlaggedListing{
+					{RetainerName: "Retainer", PricePer: 1000, Quantity: 1, Reason: OutlierAboveTypical},
+				},
+			},
+		},
+		{
+			name:         "Bait listing far below the rest is ignored",
+			listings:     listingsAt(100, 100, 110, 20),
+			wantListings: 3,
+			want: &OutlierReport{
+				MedianPrice: 100,
+				Listings: []FlaggedListing{
+					{RetainerName: "Retainer", PricePer: 20, Quantity: 1, Reason: OutlierBelowTypical},
+				},
+			},
+		},
+		{
+			name:         "Wash traded day of sales is ignored",
+			listings:     listingsAt(100),
+			rollups:      rollupsAt(100, 95, 5000, 105),
+			wantListings: 1,
+			wantRollups:  3,
+			want: &OutlierReport{
+				MedianPrice: 100,
+				Sales: []FlaggedSale{
+					{Day: start.AddDate(0, 0, 2), AveragePrice: 5000, SaleCount: 1, Quantity: 1, Reason: OutlierAboveTypical},
+				},
+			},
+		},
+		{
+			name:         "Small changes to a fixed price aren't flagged",
+			listings:     listingsAt(100, 100, 100, 150),
+			wantListings: 4,
+		},
+		{
+			name:         "Too few prices to tell what's typical",
+			listings:     listingsAt(1000),
+			rollups:      rollupsAt(100),
+			wantListings: 1,
+			wantRollups:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				gotListings, gotRollups, got := filterOutliers(&tt.listings, &tt.rollups)
+
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("filterOutliers() report = %+v, want %+v", got, tt.want)
+				}
+
+				if len(*gotListings) != tt.wantListings {
+					t.Errorf("filterOutliers() kept %d listings, want %d", len(*gotListings), tt.wantListings)
+				}
+
+				if len(*gotRollups) != tt.wantRollups {
+					t.Errorf("filterOutliers() kept %d rollups, want %d", len(*gotRollups), tt.wantRollups)
+				}
+			},
+		)
+	}
+}
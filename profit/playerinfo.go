@@ -1,6 +1,10 @@
 package profitCalc
 
-import "github.com/level-5-pidgey/MarketMoogle/csv/readertype"
+import (
+	"fmt"
+	"github.com/level-5-pidgey/MarketMoogle/csv/readertype"
+	"github.com/level-5-pidgey/MarketMoogle/db"
+)
 
 type PlayerInfo struct {
 	HomeServer int
@@ -12,4 +16,187 @@ type PlayerInfo struct {
 	GrandCompanyRank readertype.GrandCompanyRank
 
 	JobLevels map[readertype.Job]int
+
+	// Secret recipe books the player has unlocked, keyed by book name. A nil map means every book is unlocked.
+	SecretRecipeBooks map[string]struct{}
+
+	// Crafters the player has specialised in. A nil map means every crafter is a specialist.
+	Specialists map[readertype.Job]struct{}
+
+	// Gear stats for each crafter. Recipes for crafters without stats aren't limited by them.
+	CrafterStats map[readertype.Job]db.CrafterStats
+
+	// City the player's retainers list items in, which sets the tax buyers pay on their listings. RetainerCityNone
+	// uses the default tax rate.
+	RetainerCity int
+}
+
+// maxSpecialists is the number of crafters a player can specialise in at once
+const maxSpecialists = 3
+
+var crafterJobs = map[readertype.Job]struct{}{
+	readertype.JobCarpenter:     {},
+	readertype.JobBlacksmith:    {},
+	readertype.JobArmourer:      {},
+	readertype.JobGoldsmith:     {},
+	readertype.JobLeatherworker: {},
+	readertype.JobWeaver:        {},
+	readertype.JobAlchemist:     {},
+	readertype.JobCulinarian:    {},
+}
+
+func (info *PlayerInfo) hasRecipeBook(book string) bool {
+	if book == "" || info.SecretRecipeBooks == nil {
+		return true
+	}
+
+	_, ok := info.SecretRecipeBooks[book]
+	return ok
+}
+
+func (info *PlayerInfo) isSpecialist(job readertype.Job) bool {
+	if info.Specialists == nil {
+		return true
+	}
+
+	_, ok := info.Specialists[job]
+	return ok
+}
+
+// skipsIngredient
+// Checks if the player already has plenty of an ingredient (crystals, shards and clusters) so it isn't worth buying
+func (info *PlayerInfo) skipsIngredient(item *Item) bool {
+	return info.SkipCrystals && item.UiCategory == 59 && item.Id < 20
+}
+
+// NewDefaultPlayerInfo
+// Creates the player used when a request doesn't specify a profile: max rank in their grand company, skipping
+// crystals, every job at the level cap and no restrictions on secret recipes or specialist crafts.
+func NewDefaultPlayerInfo(homeServer, dataCenter int) *PlayerInfo {
+	return &PlayerInfo{
+		HomeServer:       homeServer,
+		DataCenter:       dataCenter,
+		SkipCrystals:     true,
+		GrandCompanyRank: readertype.Captain,
+		JobLevels: map[readertype.Job]int{
+			readertype.JobCarpenter:     maxLevel,
+			readertype.JobBlacksmith:    maxLevel,
+			readertype.JobArmourer:      maxLevel,
+			readertype.JobGoldsmith:     maxLevel,
+			readertype.JobLeatherworker: maxLevel,
+			readertype.JobWeaver:        maxLevel,
+			readertype.JobAlchemist:     maxLevel,
+			readertype.JobCulinarian:    maxLevel,
+			readertype.JobMiner:         maxLevel,
+			readertype.JobBotanist:      maxLevel,
+			readertype.JobFisher:        maxLevel,
+			readertype.JobPaladin:       maxLevel,
+		},
+	}
+}
+
+// NewPlayerInfoFromProfile
+// Builds the player info used by the profit calculator from a stored player profile.
+func NewPlayerInfoFromProfile(profile *db.PlayerProfile, dataCenter int) *PlayerInfo {
+	jobLevels := make(map[readertype.Job]int, len(profile.JobLevels))
+	for job, level := range profile.JobLevels {
+		jobLevels[readertype.FromShortString(string(job))] = level
+	}
+
+	recipeBooks := make(map[string]struct{}, len(profile.RecipeBooks))
+	for _, book := range profile.RecipeBooks {
+		recipeBooks[book] = struct{}{}
+	}
+
+	specialists := make(map[readertype.Job]struct{}, len(profile.Specialists))
+	for _, job := range profile.Specialists {
+		specialists[readertype.FromShortString(string(job))] = struct{}{}
+	}
+
+	crafterStats := make(map[readertype.Job]db.CrafterStats, len(profile.CrafterStats))
+	for job, stats := range profile.CrafterStats {
+		crafterStats[readertype.FromShortString(string(job))] = stats
+	}
+
+	return &PlayerInfo{
+		HomeServer:        profile.HomeWorldId,
+		DataCenter:        dataCenter,
+		SkipCrystals:      profile.SkipCrystals,
+		GrandCompanyRank:  profile.GrandCompanyRank,
+		JobLevels:         jobLevels,
+		SecretRecipeBooks: recipeBooks,
+		Specialists:       specialists,
+		CrafterStats:      crafterStats,
+		RetainerCity:      profile.RetainerCity,
+	}
+}
+
+// ValidateProfile
+// Checks that a player profile only contains jobs, levels and ranks that exist in game.
+func ValidateProfile(profile *db.PlayerProfile) error {
+	if profile.Name == "" {
+		return fmt.Errorf("profile name is required")
+	}
+
+	// Jobs are checked by name here, as they can't be told apart once they're converted
+	for job := range profile.JobLevels {
+		if readertype.FromShortString(string(job)) == readertype.JobNone {
+			return fmt.Errorf("job %s is invalid", job)
+		}
+	}
+
+	for _, job := range profile.Specialists {
+		if _, ok := crafterJobs[readertype.FromShortString(string(job))]; !ok {
+			return fmt.Errorf("job %s can't be a specialist", job)
+		}
+	}
+
+	for job := range profile.CrafterStats {
+		if _, ok := crafterJobs[readertype.FromShortString(string(job))]; !ok {
+			return fmt.Errorf("job %s isn't a crafter", job)
+		}
+	}
+
+	return NewPlayerInfoFromProfile(profile, 0).Validate()
+}
+
+// Validate
+// Checks that the player's levels, rank, specialists, stats and retainer city are all possible in game, whether they
+// came from a stored profile or from query overrides.
+func (info *PlayerInfo) Validate() error {
+	if info.GrandCompanyRank < readertype.GrandCompanyRankNone || info.GrandCompanyRank > readertype.Captain {
+		return fmt.Errorf("grand company rank %d is invalid", info.GrandCompanyRank)
+	}
+
+	for job, level := range info.JobLevels {
+		if level < 1 || level > maxLevel {
+			return fmt.Errorf("level %d for job %s must be between 1 and %d", level, job, maxLevel)
+		}
+	}
+
+	if len(info.Specialists) > maxSpecialists {
+		return fmt.Errorf("a player can only have %d specialists", maxSpecialists)
+	}
+
+	for job := range info.Specialists {
+		if _, ok := crafterJobs[job]; !ok {
+			return fmt.Errorf("job %s can't be a specialist", job)
+		}
+	}
+
+	for job, stats := range info.CrafterStats {
+		if _, ok := crafterJobs[job]; !ok {
+			return fmt.Errorf("job %s isn't a crafter", job)
+		}
+
+		if stats.Craftsmanship < 0 || stats.Control < 0 || stats.CP < 0 {
+			return fmt.Errorf("stats for job %s can't be negative", job)
+		}
+	}
+
+	if info.RetainerCity != RetainerCityNone && !IsRetainerCity(info.RetainerCity) {
+		return fmt.Errorf("retainer city %d is invalid", info.RetainerCity)
+	}
+
+	return nil
 }
@@ -0,0 +1,192 @@
+package profitCalc
+
+import (
+	"github.com/level-5-pidgey/MarketMoogle/csv/readertype"
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	"reflect"
+	"testing"
+)
+
+func TestNewPlayerInfoFromProfile(t *testing.T) {
+	tests := []struct {
+		name       string
+		profile    *db.PlayerProfile
+		dataCenter int
+		want       *PlayerInfo
+	}{
+		{
+			name: "Builds player info from a low level profile with no grand company rank",
+			profile: &db.PlayerProfile{
+				Id:               1,
+				Name:             "Alt",
+				HomeWorldId:      21,
+				GrandCompanyRank: readertype.GrandCompanyRankNone,
+				SkipCrystals:     false,
+				JobLevels: map[readertype.Job]int{
+					readertype.JobCarpenter: 70,
+					readertype.JobWeaver:    70,
+				},
+				RecipeBooks: []string{"Master Carpenter I"},
+				CrafterStats: map[readertype.Job]db.CrafterStats{
+					"crp": {Craftsmanship: 2500, Control: 2400, CP: 450},
+				},
+			},
+			dataCenter: 2,
+			want: &PlayerInfo{
+				HomeServer:       21,
+				DataCenter:       2,
+				SkipCrystals:     false,
+				GrandCompanyRank: readertype.GrandCompanyRankNone,
+				JobLevels: map[readertype.Job]int{
+					readertype.JobCarpenter: 70,
+					readertype.JobWeaver:    70,
+				},
+				SecretRecipeBooks: map[string]struct{}{
+					"Master Carpenter I": {},
+				},
+				Specialists: map[readertype.Job]struct{}{},
+				CrafterStats: map[readertype.Job]db.CrafterStats{
+					readertype.JobCarpenter: {Craftsmanship: 2500, Control: 2400, CP: 450},
+				},
+			},
+		},
+		{
+			name: "Normalises lower case job abbreviations",
+			profile: &db.PlayerProfile{
+				Name:        "Lower",
+				HomeWorldId: 21,
+				JobLevels: map[readertype.Job]int{
+					"alc": 50,
+				},
+			},
+			dataCenter: 2,
+			want: &PlayerInfo{
+				HomeServer: 21,
+				DataCenter: 2,
+				JobLevels: map[readertype.Job]int{
+					readertype.JobAlchemist: 50,
+				},
+				SecretRecipeBooks: map[string]struct{}{},
+				Specialists:       map[readertype.Job]struct{}{},
+				CrafterStats:      map[readertype.Job]db.CrafterStats{},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if got := NewPlayerInfoFromProfile(tt.profile, tt.dataCenter); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("NewPlayerInfoFromProfile() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestValidateProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile *db.PlayerProfile
+		wantErr bool
+	}{
+		{
+			name: "Valid profile passes",
+			profile: &db.PlayerProfile{
+				Name:             "Main",
+				GrandCompanyRank: readertype.Captain,
+				JobLevels:        map[readertype.Job]int{readertype.JobCulinarian: 90},
+			},
+			wantErr: false,
+		},
+		{
+			name:    "Profile without a name fails",
+			profile: &db.PlayerProfile{},
+			wantErr: true,
+		},
+		{
+			name: "Unknown job fails",
+			profile: &db.PlayerProfile{
+				Name:      "Main",
+				JobLevels: map[readertype.Job]int{"XYZ": 50},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Level above the cap fails",
+			profile: &db.PlayerProfile{
+				Name:      "Main",
+				JobLevels: map[readertype.Job]int{readertype.JobMiner: 91},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Grand company rank above captain fails",
+			profile: &db.PlayerProfile{
+				Name:             "Main",
+				GrandCompanyRank: readertype.Captain + 1,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if err := ValidateProfile(tt.profile); (err != nil) != tt.wantErr {
+					t.Errorf("ValidateProfile() error = %v, wantErr %v", err, tt.wantErr)
+				}
+			},
+		)
+	}
+}
+
+func TestPlayerInfo_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		info    *PlayerInfo
+		wantErr bool
+	}{
+		{
+			name:    "Default player passes",
+			info:    NewDefaultPlayerInfo(0, 0),
+			wantErr: false,
+		},
+		{
+			name:    "Level above the cap fails",
+			info:    &PlayerInfo{JobLevels: map[readertype.Job]int{readertype.JobCarpenter: 9999}},
+			wantErr: true,
+		},
+		{
+			name:    "Negative level fails",
+			info:    &PlayerInfo{JobLevels: map[readertype.Job]int{readertype.JobCarpenter: -1}},
+			wantErr: true,
+		},
+		{
+			name: "Too many specialists fails",
+			info: &PlayerInfo{
+				Specialists: map[readertype.Job]struct{}{
+					readertype.JobCarpenter:  {},
+					readertype.JobBlacksmith: {},
+					readertype.JobArmourer:   {},
+					readertype.JobWeaver:     {},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Negative crafter stats fail",
+			info: &PlayerInfo{
+				CrafterStats: map[readertype.Job]db.CrafterStats{readertype.JobWeaver: {Craftsmanship: -1}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if err := tt.info.Validate(); (err != nil) != tt.wantErr {
+					t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+				}
+			},
+		)
+	}
+}
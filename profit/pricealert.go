@@ -0,0 +1,408 @@
+package profitCalc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// DefaultAlertCooldown is how long an alert waits after matching before it can match again
+const DefaultAlertCooldown = time.Hour
+
+// AlertMatch
+// A price alert whose condition was met, along with the value that met it
+type AlertMatch struct {
+	Alert *db.PriceAlert
+	// The price, margin or currency value that crossed the alert's threshold
+	Value float64
+	// The item whose listings or sales caused the match, 0 for currency value alerts
+	ItemId    int
+	WorldId   int
+	MatchedAt time.Time
+	// How the margin of a recipe margin match was made, nil for other kinds of alert
+	Profit *ProfitInfo
+}
+
+// AlertNotifier
+// Sends out price alerts that have matched
+type AlertNotifier interface {
+	Notify(match *AlertMatch)
+}
+
+// AlertMonitor
+// Checks price alerts against market data as it comes in. Item price alerts are checked against new listings and
+// sales straight away, while margin and currency alerts need a full profit calculation so they're queued up and
+// checked together every so often.
+type AlertMonitor struct {
+	calculator *ProfitCalculator
+	repository db.Repository
+	notifier   AlertNotifier
+	// The data center of each world, keyed by world id
+	worlds map[int]int
+	// How long an alert waits after matching before it can match again
+	Cooldown time.Duration
+
+	mutex sync.Mutex
+	// Enabled alerts, keyed by world id
+	alerts map[int][]*db.PriceAlert
+	// Margin and currency alerts waiting to be checked, keyed by alert id
+	pending map[int]*db.PriceAlert
+
+	// Returns the current time, replaced in tests
+	now func() time.Time
+}
+
+func NewAlertMonitor(
+	calculator *ProfitCalculator,
+	repository db.Repository,
+	notifier AlertNotifier,
+	worlds map[int]int,
+) *AlertMonitor {
+	return &AlertMonitor{
+		calculator: calculator,
+		repository: repository,
+		notifier:   notifier,
+		worlds:     worlds,
+		Cooldown:   DefaultAlertCooldown,
+		alerts:     make(map[int][]*db.PriceAlert),
+		pending:    make(map[int]*db.PriceAlert),
+		now:        time.Now,
+	}
+}
+
+// ValidateAlert
+// Checks an alert watches something that exists and has somewhere to send matches to
+func (p *ProfitCalculator) ValidateAlert(alert *db.PriceAlert) error {
+	if alert.Comparison != db.AlertBelow && alert.Comparison != db.AlertAbove {
+		return fmt.Errorf("comparison must be %q or %q", db.AlertBelow, db.AlertAbove)
+	}
+
+	if alert.Threshold < 0 {
+		return errors.New("threshold can't be negative")
+	}
+
+	if alert.Format != db.AlertFormatJson && alert.Format != db.AlertFormatDiscord {
+		return fmt.Errorf("format must be %q or %q", db.AlertFormatJson, db.AlertFormatDiscord)
+	}
+
+	webhookUrl, err := url.Parse(alert.WebhookUrl)
+	if err != nil || (webhookUrl.Scheme != "http" && webhookUrl.Scheme != "https") || webhookUrl.Host == "" {
+		return errors.New("webhook url must be an http or https url")
+	}
+
+	switch alert.Kind {
+	case db.AlertItemPrice:
+		item, ok := (*p.Items)[alert.ItemId]
+		if !ok {
+			return fmt.Errorf("item %d not found", alert.ItemId)
+		}
+
+		if item.MarketProhibited {
+			return fmt.Errorf("item %d can't be sold on the market", alert.ItemId)
+		}
+	case db.AlertRecipeMargin:
+		item, ok := (*p.Items)[alert.ItemId]
+		if !ok {
+			return fmt.Errorf("item %d not found", alert.ItemId)
+		}
+
+		if item.CraftingRecipes == nil || len(*item.CraftingRecipes) == 0 {
+			return fmt.Errorf("item %d has no recipe", alert.ItemId)
+		}
+	case db.AlertCurrencyValue:
+		if p.currencyByObtainMethod == nil {
+			return errors.New("currency values aren't available")
+		}
+
+		if _, ok := (*p.currencyByObtainMethod)[alert.Currency]; !ok {
+			return fmt.Errorf("currency %q not found", alert.Currency)
+		}
+	default:
+		return fmt.Errorf("unknown alert kind %q", alert.Kind)
+	}
+
+	return nil
+}
+
+// Reload
+// Replaces the alerts being checked with the enabled alerts in the repository
+func (m *AlertMonitor) Reload() error {
+	alerts, err := m.repository.GetPriceAlerts()
+	if err != nil {
+		return err
+	}
+
+	alertsByWorld := make(map[int][]*db.PriceAlert)
+	for _, alert := range *alerts {
+		if !alert.Enabled {
+			continue
+		}
+
+		alertsByWorld[alert.WorldId] = append(alertsByWorld[alert.WorldId], alert)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.alerts = alertsByWorld
+
+	// Queued alerts that were changed or removed are checked with their new settings, or not at all
+	pending := make(map[int]*db.PriceAlert, len(m.pending))
+	for _, worldAlerts := range alertsByWorld {
+		for _, alert := range worldAlerts {
+			if _, ok := m.pending[alert.Id]; ok {
+				pending[alert.Id] = alert
+			}
+		}
+	}
+
+	m.pending = pending
+
+	return nil
+}
+
+// Run
+// Loads the alerts straight away and then once per reloadInterval, in case they were changed elsewhere, until the
+// context is cancelled. Queued margin and currency alerts are checked every checkInterval.
+func (m *AlertMonitor) Run(ctx context.Context, reloadInterval, checkInterval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.CheckPending()
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.Reload(); err != nil {
+			log.Printf("failed to load price alerts: %s\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ListingsAdded
+// Checks alerts affected by new listings of an item on a world. Listings can be bought from any world on the data
+// center, so margins on every world of it are affected.
+func (m *AlertMonitor) ListingsAdded(worldId, itemId int, listings []db.Listing) {
+	prices := make([]int, 0, len(listings))
+	for _, listing := range listings {
+		prices = append(prices, listing.PricePer)
+	}
+
+	m.marketChanged(worldId, itemId, prices, true)
+}
+
+// SalesAdded
+// Checks alerts affected by new sales of an item on a world. Sale history only values items on the world they sold
+// on, so only that world's alerts are affected.
+func (m *AlertMonitor) SalesAdded(worldId, itemId int, sales []db.Sale) {
+	prices := make([]int, 0, len(sales))
+	for _, sale := range sales {
+		prices = append(prices, sale.PricePer)
+	}
+
+	m.marketChanged(worldId, itemId, prices, false)
+}
+
+func (m *AlertMonitor) marketChanged(worldId, itemId int, prices []int, wholeDataCenter bool) {
+	dataCenterId, ok := m.worlds[worldId]
+	if !ok {
+		return
+	}
+
+	affectedItems := make(map[int]struct{})
+	for _, affectedItemId := range m.calculator.Ingredients.AffectedItems(itemId) {
+		affectedItems[affectedItemId] = struct{}{}
+	}
+
+	matches := make([]*AlertMatch, 0)
+
+	m.mutex.Lock()
+	for alertWorldId, worldAlerts := range m.alerts {
+		sameWorld := alertWorldId == worldId
+		if !sameWorld && (!wholeDataCenter || m.worlds[alertWorldId] != dataCenterId) {
+			continue
+		}
+
+		for _, alert := range worldAlerts {
+			switch alert.Kind {
+			case db.AlertItemPrice:
+				if !sameWorld || alert.ItemId != itemId {
+					continue
+				}
+
+				if value, ok := extremePrice(prices, alert.Comparison); ok && alert.Matches(float64(value)) {
+					matches = append(matches, m.newMatch(alert, float64(value), itemId))
+				}
+			case db.AlertRecipeMargin:
+				if _, ok := affectedItems[alert.ItemId]; ok {
+					m.pending[alert.Id] = alert
+				}
+			case db.AlertCurrencyValue:
+				if sameWorld && m.calculator.isObtainedWithCurrency(itemId, alert.Currency) {
+					m.pending[alert.Id] = alert
+				}
+			}
+		}
+	}
+	m.mutex.Unlock()
+
+	m.trigger(matches)
+}
+
+// CheckPending
+// Calculates the margin or currency value of every queued alert and sends out the ones that match
+func (m *AlertMonitor) CheckPending() {
+	m.mutex.Lock()
+	pending := m.pending
+	m.pending = make(map[int]*db.PriceAlert)
+	m.mutex.Unlock()
+
+	matches := make([]*AlertMatch, 0)
+	for _, alert := range pending {
+		if m.isCoolingDown(alert) {
+			continue
+		}
+
+		value, profit, err := m.alertValue(alert)
+		if err != nil {
+			log.Printf("failed to check price alert %d: %s\n", alert.Id, err)
+			continue
+		}
+
+		if value != nil && alert.Matches(*value) {
+			match := m.newMatch(alert, *value, alert.ItemId)
+			match.Profit = profit
+			matches = append(matches, match)
+		}
+	}
+
+	m.trigger(matches)
+}
+
+// alertValue
+// The current margin or currency value an alert watches, or nil if there isn't one (such as an item that can't be
+// sold right now). Margins come with the profit calculation they were taken from.
+func (m *AlertMonitor) alertValue(alert *db.PriceAlert) (*float64, *ProfitInfo, error) {
+	info := NewDefaultPlayerInfo(alert.WorldId, m.worlds[alert.WorldId])
+
+	switch alert.Kind {
+	case db.AlertRecipeMargin:
+		item, ok := (*m.calculator.Items)[alert.ItemId]
+		if !ok {
+			return nil, nil, fmt.Errorf("item %d not found", alert.ItemId)
+		}
+
+		profit, err := m.calculator.CalculateProfitForItem(item, info)
+		if err != nil || profit == nil {
+			return nil, nil, err
+		}
+
+		margin := float64(profit.Margin())
+		return &margin, profit, nil
+	case db.AlertCurrencyValue:
+		value, _, err := m.calculator.getGilValueAndBestSaleForCurrency(alert.Currency, info)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return &value, nil, nil
+	default:
+		return nil, nil, fmt.Errorf("alert kind %q isn't checked in the background", alert.Kind)
+	}
+}
+
+func (m *AlertMonitor) newMatch(alert *db.PriceAlert, value float64, itemId int) *AlertMatch {
+	return &AlertMatch{
+		Alert:     alert,
+		Value:     value,
+		ItemId:    itemId,
+		WorldId:   alert.WorldId,
+		MatchedAt: m.now().UTC(),
+	}
+}
+
+func (m *AlertMonitor) isCoolingDown(alert *db.PriceAlert) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return alert.LastTriggeredAt != nil && m.now().Sub(*alert.LastTriggeredAt) < m.Cooldown
+}
+
+// trigger
+// Sends out matches, skipping alerts that matched too recently
+func (m *AlertMonitor) trigger(matches []*AlertMatch) {
+	for _, match := range matches {
+		m.mutex.Lock()
+		alert := match.Alert
+		if alert.LastTriggeredAt != nil && match.MatchedAt.Sub(*alert.LastTriggeredAt) < m.Cooldown {
+			m.mutex.Unlock()
+			continue
+		}
+
+		triggeredAt := match.MatchedAt
+		alert.LastTriggeredAt = &triggeredAt
+
+		// The notifier gets its own copy, as the monitor keeps updating the original
+		sentAlert := *alert
+		match.Alert = &sentAlert
+		m.mutex.Unlock()
+
+		err := m.repository.MarkPriceAlertTriggered(alert.Id, triggeredAt)
+		if err != nil {
+			log.Printf("failed to mark price alert %d as triggered: %s\n", alert.Id, err)
+		}
+
+		m.notifier.Notify(match)
+	}
+}
+
+// extremePrice
+// The lowest price for alerts watching for prices below their threshold, otherwise the highest
+func extremePrice(prices []int, comparison db.AlertComparison) (int, bool) {
+	if len(prices) == 0 {
+		return 0, false
+	}
+
+	extreme := prices[0]
+	for _, price := range prices[1:] {
+		if comparison == db.AlertBelow {
+			extreme = min(extreme, price)
+		} else {
+			extreme = max(extreme, price)
+		}
+	}
+
+	return extreme, true
+}
+
+// isObtainedWithCurrency
+// Checks if an item can be bought with a currency, meaning its market data affects what the currency is worth
+func (p *ProfitCalculator) isObtainedWithCurrency(itemId int, currency string) bool {
+	if p.currencyByObtainMethod == nil {
+		return false
+	}
+
+	_, ok := (*p.currencyByObtainMethod)[currency][itemId]
+	return ok
+}
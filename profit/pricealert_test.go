@@ -0,0 +1,273 @@
+package profitCalc
+
+import (
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	"testing"
+	"time"
+)
+
+type recordingNotifier struct {
+	matches []*AlertMatch
+}
+
+func (n *recordingNotifier) Notify(match *AlertMatch) {
+	n.matches = append(n.matches, match)
+}
+
+func newTestAlertMonitor(t *testing.T, alerts ...db.PriceAlert) (*AlertMonitor, *recordingNotifier) {
+	t.Helper()
+
+	p := newLeaderboardTestCalculator(t)
+	for _, alert := range alerts {
+		if _, err := p.repository.CreatePriceAlert(alert); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	notifier := &recordingNotifier{}
+	// Worlds 1 and 2 share a data center
+	monitor := NewAlertMonitor(p, p.repository, notifier, map[int]int{1: 1, 2: 1, 3: 2})
+	monitor.now = func() time.Time {
+		return time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+	}
+
+	if err := monitor.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	return monitor, notifier
+}
+
+func TestAlertMonitor_ListingsAdded(t *testing.T) {
+	priceAlert := func(comparison db.AlertComparison, threshold int) db.PriceAlert {
+		return db.PriceAlert{
+			Kind:       db.AlertItemPrice,
+			WorldId:    1,
+			ItemId:     1,
+			Comparison: comparison,
+			Threshold:  threshold,
+			WebhookUrl: "http://localhost/hook",
+			Enabled:    true,
+		}
+	}
+
+	tests := []struct {
+		name      string
+		alert     db.PriceAlert
+		worldId   int
+		itemId    int
+		prices    []int
+		wantValue float64
+		wantMatch bool
+	}{
+		{
+			name:      "Cheapest new listing below the threshold matches",
+			alert:     priceAlert(db.AlertBelow, 150),
+			worldId:   1,
+			itemId:    1,
+			prices:    []int{200, 120, 140},
+			wantValue: 120,
+			wantMatch: true,
+		},
+		{
+			name:      "Priciest new listing above the threshold matches",
+			alert:     priceAlert(db.AlertAbove, 150),
+			worldId:   1,
+			itemId:    1,
+			prices:    []int{200, 120},
+			wantValue: 200,
+			wantMatch: true,
+		},
+		{
+			name:    "Listings on the wrong side of the threshold don't match",
+			alert:   priceAlert(db.AlertBelow, 100),
+			worldId: 1,
+			itemId:  1,
+			prices:  []int{100, 120},
+		},
+		{
+			name:    "Listings on another world don't match",
+			alert:   priceAlert(db.AlertBelow, 150),
+			worldId: 2,
+			itemId:  1,
+			prices:  []int{50},
+		},
+		{
+			name:    "Listings of another item don't match",
+			alert:   priceAlert(db.AlertBelow, 150),
+			worldId: 1,
+			itemId:  2,
+			prices:  []int{50},
+		},
+		{
+			name: "Disabled alerts don't match",
+			alert: db.PriceAlert{
+				Kind: db.AlertItemPrice, WorldId: 1, ItemId: 1, Comparison: db.AlertBelow, Threshold: 150,
+				WebhookUrl: "http://localhost/hook",
+			},
+			worldId: 1,
+			itemId:  1,
+			prices:  []int{50},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				monitor, notifier := newTestAlertMonitor(t, tt.alert)
+
+				listings := make([]db.Listing, 0, len(tt.prices))
+				for _, price := range tt.prices {
+					listings = append(listings, db.Listing{ItemId: tt.itemId, WorldId: tt.worldId, PricePer: price})
+				}
+
+				monitor.ListingsAdded(tt.worldId, tt.itemId, listings)
+
+				if !tt.wantMatch {
+					if len(notifier.matches) != 0 {
+						t.Errorf("ListingsAdded() matched %v, want no matches", notifier.matches[0])
+					}
+
+					return
+				}
+
+				if len(notifier.matches) != 1 {
+					t.Fatalf("ListingsAdded() made %d matches, want 1", len(notifier.matches))
+				}
+
+				if notifier.matches[0].Value != tt.wantValue {
+					t.Errorf("ListingsAdded() matched at %v, want %v", notifier.matches[0].Value, tt.wantValue)
+				}
+
+				alert, _ := monitor.repository.GetPriceAlert(notifier.matches[0].Alert.Id)
+				if alert.LastTriggeredAt == nil {
+					t.Errorf("ListingsAdded() didn't mark the alert as triggered")
+				}
+			},
+		)
+	}
+}
+
+func TestAlertMonitor_Cooldown(t *testing.T) {
+	monitor, notifier := newTestAlertMonitor(
+		t, db.PriceAlert{
+			Kind: db.AlertItemPrice, WorldId: 1, ItemId: 1, Comparison: db.AlertBelow, Threshold: 150,
+			WebhookUrl: "http://localhost/hook", Enabled: true,
+		},
+	)
+
+	now := monitor.now()
+	sales := []db.Sale{{ItemId: 1, WorldId: 1, PricePer: 100}}
+
+	monitor.SalesAdded(1, 1, sales)
+	monitor.SalesAdded(1, 1, sales)
+	if len(notifier.matches) != 1 {
+		t.Fatalf("SalesAdded() made %d matches within the cooldown, want 1", len(notifier.matches))
+	}
+
+	monitor.now = func() time.Time {
+		return now.Add(DefaultAlertCooldown)
+	}
+
+	monitor.SalesAdded(1, 1, sales)
+	if len(notifier.matches) != 2 {
+		t.Errorf("SalesAdded() made %d matches after the cooldown, want 2", len(notifier.matches))
+	}
+}
+
+func TestAlertMonitor_CheckPending(t *testing.T) {
+	marginAlert := db.PriceAlert{
+		Kind: db.AlertRecipeMargin, WorldId: 2, ItemId: 4, Comparison: db.AlertAbove, Threshold: 1000,
+		WebhookUrl: "http://localhost/hook", Enabled: true,
+	}
+	monitor, notifier := newTestAlertMonitor(t, marginAlert)
+
+	// Ingredient listings on another world of the data center affect the margin
+	monitor.ListingsAdded(1, 1, []db.Listing{{ItemId: 1, WorldId: 1, PricePer: 100}})
+	if len(notifier.matches) != 0 {
+		t.Fatalf("ListingsAdded() sent a margin alert before it was checked")
+	}
+
+	monitor.CheckPending()
+	if len(notifier.matches) != 1 {
+		t.Fatalf("CheckPending() made %d matches, want 1", len(notifier.matches))
+	}
+
+	if notifier.matches[0].Value <= float64(marginAlert.Threshold) {
+		t.Errorf("CheckPending() matched a margin of %v, want above %d", notifier.matches[0].Value, marginAlert.Threshold)
+	}
+
+	// Checking again without any new market data does nothing
+	monitor.CheckPending()
+	if len(notifier.matches) != 1 {
+		t.Errorf("CheckPending() made %d matches without new data, want 1", len(notifier.matches))
+	}
+
+	// Listings on another data center don't affect the margin
+	monitor.ListingsAdded(3, 1, []db.Listing{{ItemId: 1, WorldId: 3, PricePer: 100}})
+	if len(monitor.pending) != 0 {
+		t.Errorf("ListingsAdded() queued %d alerts from another data center, want 0", len(monitor.pending))
+	}
+}
+
+func TestProfitCalculator_ValidateAlert(t *testing.T) {
+	p := newLeaderboardTestCalculator(t)
+
+	valid := db.PriceAlert{
+		Kind: db.AlertItemPrice, WorldId: 1, ItemId: 1, Comparison: db.AlertBelow, Threshold: 100,
+		WebhookUrl: "https://example.com/hook", Format: db.AlertFormatJson,
+	}
+
+	tests := []struct {
+		name    string
+		change  func(alert *db.PriceAlert)
+		wantErr bool
+	}{
+		{name: "Valid price alert", change: func(alert *db.PriceAlert) {}},
+		{
+			name: "Margin alert on a crafted item",
+			change: func(alert *db.PriceAlert) {
+				alert.Kind = db.AlertRecipeMargin
+				alert.ItemId = 4
+			},
+		},
+		{
+			name: "Margin alert on an item without a recipe",
+			change: func(alert *db.PriceAlert) {
+				alert.Kind = db.AlertRecipeMargin
+			},
+			wantErr: true,
+		},
+		{name: "Unknown kind", change: func(alert *db.PriceAlert) { alert.Kind = "volume" }, wantErr: true},
+		{name: "Unknown item", change: func(alert *db.PriceAlert) { alert.ItemId = 99 }, wantErr: true},
+		{name: "Item can't be sold", change: func(alert *db.PriceAlert) { alert.ItemId = 3 }, wantErr: true},
+		{name: "Unknown comparison", change: func(alert *db.PriceAlert) { alert.Comparison = "equal" }, wantErr: true},
+		{name: "Negative threshold", change: func(alert *db.PriceAlert) { alert.Threshold = -1 }, wantErr: true},
+		{name: "Sent to Discord", change: func(alert *db.PriceAlert) { alert.Format = db.AlertFormatDiscord }},
+		{name: "Unknown format", change: func(alert *db.PriceAlert) { alert.Format = "xml" }, wantErr: true},
+		{
+			name:    "Webhook isn't http",
+			change:  func(alert *db.PriceAlert) { alert.WebhookUrl = "ftp://example.com/hook" },
+			wantErr: true,
+		},
+		{
+			name: "Currency isn't known",
+			change: func(alert *db.PriceAlert) {
+				alert.Kind = db.AlertCurrencyValue
+				alert.Currency = "Purple Crafters' Scrip"
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				alert := valid
+				tt.change(&alert)
+
+				if err := p.ValidateAlert(&alert); (err != nil) != tt.wantErr {
+					t.Errorf("ValidateAlert() error = %v, wantErr %v", err, tt.wantErr)
+				}
+			},
+		)
+	}
+}
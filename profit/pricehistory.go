@@ -0,0 +1,130 @@
+package profitCalc
+
+import (
+	"fmt"
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultHistoryInterval is the bucket size used when a request doesn't give one
+	DefaultHistoryInterval = "1h"
+	// DefaultHistoryBuckets is how many buckets back the history starts from when a request doesn't give a start
+	DefaultHistoryBuckets = 168
+	// MaxHistoryBuckets is the most buckets a single history request can cover
+	MaxHistoryBuckets = 2000
+
+	minHistoryInterval = 5 * time.Minute
+)
+
+// PriceHistory
+// An item's sales on a world grouped into buckets of the same length, for charting prices over time
+type PriceHistory struct {
+	ItemId   int
+	WorldId  int
+	Interval string
+	From     time.Time
+	To       time.Time
+	// Buckets covering sales of both qualities
+	All           []*db.PriceHistoryBucket
+	NormalQuality []*db.PriceHistoryBucket
+	HighQuality   []*db.PriceHistoryBucket
+}
+
+// ParseHistoryInterval
+// Reads a bucket length such as "15m", "1h", "1d" or "1w". Days and weeks are supported on top of Go durations.
+func ParseHistoryInterval(interval string) (time.Duration, error) {
+	var duration time.Duration
+
+	switch {
+	case strings.HasSuffix(interval, "d"), strings.HasSuffix(interval, "w"):
+		count, err := strconv.Atoi(interval[:len(interval)-1])
+		if err != nil {
+			return 0, fmt.Errorf("invalid interval %q", interval)
+		}
+
+		duration = time.Duration(count) * 24 * time.Hour
+		if strings.HasSuffix(interval, "w") {
+			duration *= 7
+		}
+	default:
+		var err error
+		duration, err = time.ParseDuration(interval)
+		if err != nil {
+			return 0, fmt.Errorf("invalid interval %q", interval)
+		}
+	}
+
+	if duration < minHistoryInterval {
+		return 0, fmt.Errorf("interval must be at least %s", minHistoryInterval)
+	}
+
+	return duration, nil
+}
+
+// GetPriceHistory
+// Buckets an item's sales on a world between from and to. A zero to means now, and a zero from means
+// DefaultHistoryBuckets intervals before to.
+func (p *ProfitCalculator) GetPriceHistory(itemId, worldId int, interval string, from, to time.Time) (
+	*PriceHistory, error,
+) {
+	if interval == "" {
+		interval = DefaultHistoryInterval
+	}
+
+	bucketLength, err := ParseHistoryInterval(interval)
+	if err != nil {
+		return nil, err
+	}
+
+	if to.IsZero() {
+		to = time.Now()
+	}
+
+	if from.IsZero() {
+		from = to.Add(-DefaultHistoryBuckets * bucketLength)
+	}
+
+	if !from.Before(to) {
+		return nil, fmt.Errorf("from must be before to")
+	}
+
+	if to.Sub(from)/bucketLength > MaxHistoryBuckets {
+		return nil, fmt.Errorf("a history can cover at most %d intervals", MaxHistoryBuckets)
+	}
+
+	buckets, err := p.repository.GetPriceHistoryForItemOnWorld(itemId, worldId, bucketLength, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPriceHistory(itemId, worldId, interval, from.UTC(), to.UTC(), *buckets), nil
+}
+
+func newPriceHistory(itemId, worldId int, interval string, from, to time.Time, buckets []*db.PriceHistoryBucket) *PriceHistory {
+	history := &PriceHistory{
+		ItemId:        itemId,
+		WorldId:       worldId,
+		Interval:      interval,
+		From:          from,
+		To:            to,
+		All:           []*db.PriceHistoryBucket{},
+		NormalQuality: []*db.PriceHistoryBucket{},
+		HighQuality:   []*db.PriceHistoryBucket{},
+	}
+
+	for _, bucket := range buckets {
+		switch {
+		case bucket.IsHighQuality == nil:
+			history.All = append(history.All, bucket)
+		case *bucket.IsHighQuality:
+			history.HighQuality = append(history.HighQuality, bucket)
+		default:
+			history.NormalQuality = append(history.NormalQuality, bucket)
+		}
+	}
+
+	return history
+}
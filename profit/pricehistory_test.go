@@ -0,0 +1,115 @@
+package profitCalc
+
+import (
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseHistoryInterval(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval string
+		want     time.Duration
+		wantErr  bool
+	}{
+		{name: "Go durations are supported", interval: "15m", want: 15 * time.Minute},
+		{name: "Hours", interval: "1h", want: time.Hour},
+		{name: "Days", interval: "1d", want: 24 * time.Hour},
+		{name: "Weeks", interval: "2w", want: 14 * 24 * time.Hour},
+		{name: "Too short", interval: "1m", wantErr: true},
+		{name: "Not a duration", interval: "hourly", wantErr: true},
+		{name: "Not a number of days", interval: "xd", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, err := ParseHistoryInterval(tt.interval)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("ParseHistoryInterval() error = %v, wantErr %v", err, tt.wantErr)
+				}
+
+				if got != tt.want {
+					t.Errorf("ParseHistoryInterval() = %s, want %s", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestProfitCalculator_GetPriceHistory(t *testing.T) {
+	start := time.Date(2024, time.March, 1, 10, 0, 0, 0, time.UTC)
+
+	repo := db.NewMockRepository()
+	sales := []db.Sale{
+		{Id: 1, ItemId: 1, WorldId: 1, PricePer: 100, Quantity: 1, TotalPrice: 100, Timestamp: start.Add(5 * time.Minute)},
+		{Id: 2, ItemId: 1, WorldId: 1, PricePer: 120, Quantity: 3, TotalPrice: 360, Timestamp: start.Add(20 * time.Minute)},
+		{
+			Id: 3, ItemId: 1, WorldId: 1, PricePer: 300, Quantity: 1, TotalPrice: 300, IsHighQuality: true,
+			Timestamp: start.Add(30 * time.Minute),
+		},
+		{Id: 4, ItemId: 1, WorldId: 1, PricePer: 90, Quantity: 2, TotalPrice: 180, Timestamp: start.Add(50 * time.Minute)},
+		{Id: 5, ItemId: 1, WorldId: 1, PricePer: 110, Quantity: 1, TotalPrice: 110, Timestamp: start.Add(70 * time.Minute)},
+		// Another world and a sale outside the range are left out
+		{Id: 6, ItemId: 1, WorldId: 2, PricePer: 500, Quantity: 1, TotalPrice: 500, Timestamp: start.Add(10 * time.Minute)},
+		{Id: 7, ItemId: 1, WorldId: 1, PricePer: 500, Quantity: 1, TotalPrice: 500, Timestamp: start.Add(-time.Minute)},
+	}
+	for _, sale := range sales {
+		if _, err := repo.CreateSale(sale); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	itemMap := map[int]*Item{1: {Id: 1}}
+	p := NewProfitCalculator(&itemMap, nil, nil, repo, nil)
+
+	got, err := p.GetPriceHistory(1, 1, "1h", start, start.Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("GetPriceHistory() error = %v", err)
+	}
+
+	isHighQuality, isNormalQuality := true, false
+	secondHour := start.Add(time.Hour)
+
+	wantAll := []*db.PriceHistoryBucket{
+		{Start: start, Open: 100, High: 300, Low: 90, Close: 90, Volume: 7, SaleCount: 4, Vwap: 940.0 / 7},
+		{Start: secondHour, Open: 110, High: 110, Low: 110, Close: 110, Volume: 1, SaleCount: 1, Vwap: 110},
+	}
+	wantNormalQuality := []*db.PriceHistoryBucket{
+		{
+			Start: start, IsHighQuality: &isNormalQuality, Open: 100, High: 120, Low: 90, Close: 90, Volume: 6,
+			SaleCount: 3, Vwap: 640.0 / 6,
+		},
+		{
+			Start: secondHour, IsHighQuality: &isNormalQuality, Open: 110, High: 110, Low: 110, Close: 110, Volume: 1,
+			SaleCount: 1, Vwap: 110,
+		},
+	}
+	wantHighQuality := []*db.PriceHistoryBucket{
+		{
+			Start: start, IsHighQuality: &isHighQuality, Open: 300, High: 300, Low: 300, Close: 300, Volume: 1,
+			SaleCount: 1, Vwap: 300,
+		},
+	}
+
+	if !reflect.DeepEqual(got.All, wantAll) {
+		t.Errorf("GetPriceHistory() All = %v, want %v", got.All, wantAll)
+	}
+
+	if !reflect.DeepEqual(got.NormalQuality, wantNormalQuality) {
+		t.Errorf("GetPriceHistory() NormalQuality = %v, want %v", got.NormalQuality, wantNormalQuality)
+	}
+
+	if !reflect.DeepEqual(got.HighQuality, wantHighQuality) {
+		t.Errorf("GetPriceHistory() HighQuality = %v, want %v", got.HighQuality, wantHighQuality)
+	}
+
+	if _, err := p.GetPriceHistory(1, 1, "5m", start.AddDate(-1, 0, 0), start); err == nil {
+		t.Errorf("GetPriceHistory() allowed more than %d buckets", MaxHistoryBuckets)
+	}
+
+	if _, err := p.GetPriceHistory(1, 1, "1h", start, start); err == nil {
+		t.Errorf("GetPriceHistory() allowed an empty range")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/level-5-pidgey/MarketMoogle/db"
 	"github.com/level-5-pidgey/MarketMoogle/profit/exchange"
 	"math"
+	"slices"
 	"sort"
 	"sync"
 	"time"
@@ -19,6 +20,14 @@ type ProfitCalculator struct {
 	currencyByExchangeMethod *map[string]map[int]*Item
 	repository               db.Repository
 	cache                    cache.Cache
+	Ingredients              IngredientIndex
+	// How sale velocity is estimated from sale history
+	Velocity VelocityConfig
+	// The tax buyers pay in each city, which sets how much a listing can be priced at
+	TaxRates *MarketTaxRates
+
+	// Returns the current time, replaced in tests so sale history can be placed at fixed times
+	now func() time.Time
 }
 
 const (
@@ -26,6 +35,12 @@ const (
 	noMethodFoundError   = "no exchangeType method found"
 	competitionThreshold = 3.0
 	salesDayRange        = 7
+
+	// How far (as a ratio) a crafter can be below a recipe's suggested stats before it's too hard to finish
+	maxStatShortfall = 0.25
+	// The game data doesn't list CP requirements, so these are rough amounts needed to finish harder recipes
+	expertRecipeCp   = 600
+	maxLevelRecipeCp = 500
 )
 
 func NewProfitCalculator(
@@ -41,6 +56,10 @@ func NewProfitCalculator(
 		Items:                    itemMap,
 		repository:               repo,
 		cache:                    cache,
+		Ingredients:              NewIngredientIndex(*itemMap),
+		Velocity:                 DefaultVelocityConfig,
+		TaxRates:                 NewMarketTaxRates(),
+		now:                      time.Now,
 	}
 }
 
@@ -66,12 +85,15 @@ func calculateCompetitionFactor(numOfListings int) float64 {
 // Get the method of exchange that returns the most gil on this item.
 // Includes selling this item on the marketboard
 func (p *ProfitCalculator) GetBestSaleMethod(
-	item *Item, listings *[]*db.Listing, sales *[]*db.Sale, info *PlayerInfo, gilOnly bool,
+	item *Item, listings *[]*db.Listing, rollups *[]*db.SaleRollup, info *PlayerInfo, gilOnly bool,
 ) *SaleMethod {
 	var bestSale *SaleMethod
 
 	competitionFactor := 1.0
-	saleVelocity := math.Max(p.salesPerHour(sales, salesDayRange), 0.0001)
+	saleVelocity := math.Max(p.estimateSaleVelocity(rollups).SalesPerHour(), 0.0001)
+
+	// Buyers pay this rate on top of the price of the player's listings on their home world
+	taxRate := p.TaxRates.Rate(info.HomeServer, info.RetainerCity)
 
 	if listings != nil {
 		// If there's any market listings for this item then see what it's currently being sold for
@@ -84,11 +106,13 @@ func (p *ProfitCalculator) GetBestSaleMethod(
 					continue
 				}
 
+				// Undercut by 1 gil per item on what buyers pay once tax is added
+				valuePer := undercutPricePer(listing, taxRate)
 				listingSale := SaleMethod{
-					ExchangeType:      readertype.Marketboard,           // TODO put info's world name here, change this to a more complex type
-					Value:             listing.Total - listing.Quantity, // 1 gil undercut per item
+					ExchangeType:      readertype.Marketboard, // TODO put info's world name here, change this to a more complex type
+					Value:             valuePer * listing.Quantity,
 					Quantity:          listing.Quantity,
-					ValuePer:          listing.PricePer - 1, // 1 gil undercut
+					ValuePer:          valuePer,
 					SaleVelocity:      saleVelocity,
 					CompetitionFactor: competitionFactor,
 				}
@@ -105,18 +129,26 @@ func (p *ProfitCalculator) GetBestSaleMethod(
 			from recent sales
 		*/
 		if bestSale == nil || bestSale.ValuePer == 0 {
-			if sales != nil {
-				if len(*sales) > 0 {
-					totalSaleValue := 0
-					totalQuantity := 0
-
-					for _, sale := range *sales {
-						totalSaleValue += sale.PricePer
-						totalQuantity += sale.Quantity
+			if rollups != nil {
+				totalSaleValue := 0
+				totalQuantity := 0
+				saleCount := 0
+
+				since := p.now().UTC().Truncate(day).AddDate(0, 0, 1-salesDayRange)
+				for _, rollup := range *rollups {
+					if rollup.BucketStart.Before(since) {
+						continue
 					}
 
-					averageSale := totalSaleValue / totalQuantity
-					averageQuantity := totalQuantity / len(*sales)
+					totalSaleValue += rollup.TotalPrice
+					totalQuantity += rollup.Quantity
+					saleCount += rollup.SaleCount
+				}
+
+				if saleCount > 0 && totalQuantity > 0 {
+					// Sale prices don't include tax, so the average is adjusted for what the retainer city charges buyers
+					averageSale := pricePerAfterTax(totalSaleValue/totalQuantity, taxRate)
+					averageQuantity := max(totalQuantity/saleCount, 1)
 
 					historySale := SaleMethod{
 						ExchangeType:      readertype.Marketboard, // TODO put info's world name here, change this to a more complex type
@@ -205,25 +237,98 @@ type ObtainMethod struct {
 	// TODO expand this into an object (with a type enum and human readable value)
 	ObtainMethod string
 
+	// Broad category of ObtainMethod, used for filtering
+	Type ObtainType
+
+	// The crafter used, if this item is crafted
+	JobRequired readertype.Job `json:",omitempty"`
+
 	Quantity int
 
 	EffortFactor float64
+
+	// Cheaper recipes (for this item or its ingredients) the player can't use yet
+	BlockedRecipes []BlockedRecipe `json:",omitempty"`
+
+	// The item obtained and how many of it are needed
+	itemId      int
+	numRequired int
+
+	// The recipe used and how each ingredient is obtained, if this item is crafted
+	recipe      *RecipeInfo
+	ingredients []*ObtainMethod
+}
+
+type BlockedRecipe struct {
+	ItemId int
+
+	JobRequired readertype.Job
+
+	// Name of the secret recipe book the player needs to unlock
+	MissingRecipeBook string `json:",omitempty"`
+
+	// Whether the player needs to specialise in the recipe's job
+	MissingSpecialization bool `json:",omitempty"`
+
+	// How much crafting with this recipe would have cost
+	Cost int
+
+	method *ObtainMethod
 }
 
+// GetCost
+// How much is actually spent obtaining the item. Market listings have to be bought whole, so this includes any
+// surplus bought along with what's required.
 func (o *ObtainMethod) GetCost() int {
 	cost := 0
-	if o.ShoppingCart.itemsRequired == nil || o.ShoppingCart.ItemsToBuy == nil {
-		return cost
+	for _, item := range o.ShoppingCart.ItemsToBuy {
+		cost += item.GetTotalCost()
 	}
 
-	// Since the list of items you're buying might over-buy, we get the Quantity from the actual required item counts
+	return cost
+}
+
+// GetSurplus
+// How many more of each item (keyed by id) are bought than are required
+func (o *ObtainMethod) GetSurplus() map[int]int {
+	bought := make(map[int]int)
 	for _, item := range o.ShoppingCart.ItemsToBuy {
-		if quantity, ok := o.ShoppingCart.itemsRequired[item.GetItemId()]; ok {
-			cost += item.GetCostPer() * quantity
+		bought[item.GetItemId()] += item.GetQuantity()
+	}
+
+	surplus := make(map[int]int)
+	for itemId, quantity := range bought {
+		if required, ok := o.ShoppingCart.itemsRequired[itemId]; ok && quantity > required {
+			surplus[itemId] = quantity - required
 		}
 	}
 
-	return cost
+	return surplus
+}
+
+// GetSurplusValue
+// What the surplus items are worth, valued at the average price paid for each of them
+func (o *ObtainMethod) GetSurplusValue() int {
+	surplus := o.GetSurplus()
+	if len(surplus) == 0 {
+		return 0
+	}
+
+	spent := make(map[int]int, len(surplus))
+	bought := make(map[int]int, len(surplus))
+	for _, item := range o.ShoppingCart.ItemsToBuy {
+		if _, ok := surplus[item.GetItemId()]; ok {
+			spent[item.GetItemId()] += item.GetTotalCost()
+			bought[item.GetItemId()] += item.GetQuantity()
+		}
+	}
+
+	value := 0
+	for itemId, quantity := range surplus {
+		value += spent[itemId] * quantity / bought[itemId]
+	}
+
+	return value
 }
 
 func (o *ObtainMethod) GetCostPerItem() int {
@@ -258,16 +363,28 @@ func isEasierToObtain(curr, new *ObtainMethod) bool {
 func (p *ProfitCalculator) GetCheapestObtainMethod(
 	item *Item, numRequired int, listings *[]*db.Listing, player *PlayerInfo,
 ) *ObtainMethod {
+	method, _ := p.getCheapestObtainMethodForQuality(item, numRequired, listings, player, AnyQuality)
+	return method
+}
+
+// getCheapestObtainMethodForQuality
+// Get the cheapest way to obtain an item at a specific quality. Vendors, gathering and currency exchanges only
+// provide normal quality items, so high quality items have to be bought from the market or crafted. If there's no
+// way to obtain it, the recipes the player would need a book or specialization for are returned instead.
+func (p *ProfitCalculator) getCheapestObtainMethodForQuality(
+	item *Item, numRequired int, listings *[]*db.Listing, player *PlayerInfo, quality ItemQuality,
+) (*ObtainMethod, []BlockedRecipe) {
 	var cheapestMethod *ObtainMethod
+	var blockedRecipes []BlockedRecipe
 
-	if item.ObtainMethods != nil {
+	if item.ObtainMethods != nil && quality != HighQuality {
 		cheapestMethod = p.nonMarketObtainMethod(item, numRequired, cheapestMethod, player)
 	}
 
 	if !item.MarketProhibited && listings != nil {
 		var filteredListings []*db.Listing
 		for _, listing := range *listings {
-			if listing.ItemId == item.Id {
+			if listing.ItemId == item.Id && quality.matches(listing.IsHighQuality) {
 				filteredListings = append(filteredListings, listing)
 			}
 		}
@@ -277,11 +394,11 @@ func (p *ProfitCalculator) GetCheapestObtainMethod(
 		}
 	}
 
-	if item.CraftingRecipes != nil {
-		cheapestMethod = p.craftingObtainMethod(item, numRequired, listings, cheapestMethod, player)
+	if item.CraftingRecipes != nil && (quality != HighQuality || item.CanBeHq) {
+		cheapestMethod, blockedRecipes = p.craftingObtainMethod(item, numRequired, listings, cheapestMethod, player, quality)
 	}
 
-	return cheapestMethod
+	return cheapestMethod, blockedRecipes
 }
 
 func (p *ProfitCalculator) getPossibleSubItems(
@@ -323,9 +440,22 @@ func (p *ProfitCalculator) getPossibleSubItems(
 	return itemsAndQuantities
 }
 
+// craftingObtainMethod
+// Picks the cheapest recipe the player can use if it beats cheapestMethod. Recipes the player is missing a book or
+// specialization for are attached to the method when they'd have been cheaper, or returned on their own when there's
+// no method at all, so it's clear why the item can't be obtained.
 func (p *ProfitCalculator) craftingObtainMethod(
-	item *Item, numRequired int, listings *[]*db.Listing, cheapestMethod *ObtainMethod, player *PlayerInfo,
-) *ObtainMethod {
+	item *Item,
+	numRequired int,
+	listings *[]*db.Listing,
+	cheapestMethod *ObtainMethod,
+	player *PlayerInfo,
+	quality ItemQuality,
+) (*ObtainMethod, []BlockedRecipe) {
+	blockedRecipes := make([]BlockedRecipe, 0)
+	// Ingredients that couldn't be obtained because of their own blocked recipes
+	blockedIngredients := make([]BlockedRecipe, 0)
+
 	for _, craftingRecipe := range *item.CraftingRecipes {
 		// Check if the player is capable of crafting this recipe
 		if jobLevel, ok := player.JobLevels[craftingRecipe.JobRequired]; ok {
@@ -337,53 +467,144 @@ func (p *ProfitCalculator) craftingObtainMethod(
 			continue
 		}
 
-		recipeCost := ObtainMethod{
-			ShoppingCart: ShoppingCart{
-				ItemsToBuy:    []ShoppingItem{},
-				itemsRequired: make(map[int]int),
-			},
-			Quantity:     craftingRecipe.Yield,
-			EffortFactor: recipeEffort(&craftingRecipe, item),
-			ObtainMethod: fmt.Sprintf("Craft with %s", craftingRecipe.JobRequired), // TODO expand with type
-		}
+		statEffort := 1.0
+		if stats, ok := player.CrafterStats[craftingRecipe.JobRequired]; ok {
+			var canFinish bool
+			statEffort, canFinish = recipeStatEffort(&craftingRecipe, stats)
 
-		canCraft := true
-		for _, ingredient := range craftingRecipe.RecipeIngredients {
-			ingredientItem, ok := (*p.Items)[ingredient.ItemId]
-			if !ok {
+			if !canFinish {
 				continue
 			}
+		}
 
-			if player.SkipCrystals && ingredientItem.UiCategory == 59 && ingredientItem.Id < 20 {
-				continue
-			}
+		recipeCost, blockedIngredient := p.recipeObtainMethod(
+			item, &craftingRecipe, numRequired, listings, cheapestMethod, player,
+		)
+		if recipeCost == nil {
+			blockedIngredients = append(blockedIngredients, blockedIngredient...)
+			continue
+		}
 
-			ingredientQuantity := (ingredient.Quantity*numRequired + craftingRecipe.Yield - 1) / craftingRecipe.Yield
+		recipeCost.EffortFactor *= statEffort
+		if quality == HighQuality {
+			recipeCost.EffortFactor *= hqCraftEffort
+		}
 
-			// Get the best way to obtain this ingredient
-			ingredientObtain := p.GetCheapestObtainMethod(
-				ingredientItem,
-				ingredientQuantity,
-				listings,
-				player,
-			)
+		// Recipes locked behind a book or specialization the player doesn't have are only kept for reporting
+		missingBook := !player.hasRecipeBook(craftingRecipe.SecretRecipeBook)
+		missingSpecialization := craftingRecipe.SpecializationRequired && !player.isSpecialist(craftingRecipe.JobRequired)
+		if missingBook || missingSpecialization {
+			blocked := BlockedRecipe{
+				ItemId:                item.Id,
+				JobRequired:           craftingRecipe.JobRequired,
+				MissingSpecialization: missingSpecialization,
+				Cost:                  recipeCost.GetCost(),
+				method:                recipeCost,
+			}
 
-			// Automatically skip out of unobtainable or expensive ingredients
-			if ingredientObtain == nil || !isEasierToObtain(cheapestMethod, ingredientObtain) {
-				canCraft = false
-				break
+			if missingBook {
+				blocked.MissingRecipeBook = craftingRecipe.SecretRecipeBook
 			}
 
-			// Merge shopping carts together
-			recipeCost.ShoppingCart.mergeWith(ingredientObtain.ShoppingCart)
+			blockedRecipes = append(blockedRecipes, blocked)
+			continue
 		}
 
-		if canCraft && isEasierToObtain(cheapestMethod, &recipeCost) {
-			cheapestMethod = &recipeCost
+		if isEasierToObtain(cheapestMethod, recipeCost) {
+			cheapestMethod = recipeCost
 		}
 	}
 
-	return cheapestMethod
+	if cheapestMethod == nil {
+		return nil, append(blockedRecipes, blockedIngredients...)
+	}
+
+	// Only report the recipes that would have beaten the method the player can actually use
+	var beaten []BlockedRecipe
+	for _, blocked := range blockedRecipes {
+		if isEasierToObtain(cheapestMethod, blocked.method) {
+			beaten = append(beaten, blocked)
+		}
+	}
+
+	if len(beaten) == 0 {
+		return cheapestMethod, nil
+	}
+
+	// The method may be the market or vendor one passed in, which is shared, so it's copied rather than changed
+	withBlocked := *cheapestMethod
+	withBlocked.BlockedRecipes = append(slices.Clone(cheapestMethod.BlockedRecipes), beaten...)
+
+	return &withBlocked, nil
+}
+
+// recipeObtainMethod
+// Get the cost of crafting an item with a specific recipe, or nil if any of the ingredients can't be obtained. When an
+// ingredient can't be obtained because of recipes the player is missing a book or specialization for, those are
+// returned instead.
+func (p *ProfitCalculator) recipeObtainMethod(
+	item *Item,
+	craftingRecipe *RecipeInfo,
+	numRequired int,
+	listings *[]*db.Listing,
+	cheapestMethod *ObtainMethod,
+	player *PlayerInfo,
+) (*ObtainMethod, []BlockedRecipe) {
+	recipeCost := ObtainMethod{
+		ShoppingCart: ShoppingCart{
+			ItemsToBuy:    []ShoppingItem{},
+			itemsRequired: make(map[int]int),
+		},
+		Quantity:     craftingRecipe.Yield,
+		EffortFactor: recipeEffort(craftingRecipe, item),
+		ObtainMethod: fmt.Sprintf("Craft with %s", craftingRecipe.JobRequired), // TODO expand with type
+		Type:         ObtainTypeCraft,
+		JobRequired:  craftingRecipe.JobRequired,
+		itemId:       item.Id,
+		numRequired:  numRequired,
+	}
+
+	// Callers may pass a loop variable, so the method keeps its own copy of the recipe
+	recipe := *craftingRecipe
+	recipeCost.recipe = &recipe
+
+	for _, ingredient := range craftingRecipe.RecipeIngredients {
+		ingredientItem, ok := (*p.Items)[ingredient.ItemId]
+		if !ok {
+			continue
+		}
+
+		if player.skipsIngredient(ingredientItem) {
+			continue
+		}
+
+		ingredientQuantity := (ingredient.Quantity*numRequired + craftingRecipe.Yield - 1) / craftingRecipe.Yield
+
+		// Get the best way to obtain this ingredient. Recipes never need high quality ingredients, so any quality will do
+		ingredientObtain, blockedIngredient := p.getCheapestObtainMethodForQuality(
+			ingredientItem,
+			ingredientQuantity,
+			listings,
+			player,
+			AnyQuality,
+		)
+
+		// Automatically skip out of unobtainable or expensive ingredients
+		if ingredientObtain == nil {
+			return nil, blockedIngredient
+		}
+
+		if !isEasierToObtain(cheapestMethod, ingredientObtain) {
+			return nil, nil
+		}
+
+		// Merge shopping carts together
+		recipeCost.ShoppingCart.mergeWith(ingredientObtain.ShoppingCart)
+		recipeCost.ingredients = append(recipeCost.ingredients, ingredientObtain)
+		recipeCost.BlockedRecipes = append(recipeCost.BlockedRecipes, ingredientObtain.BlockedRecipes...)
+	}
+
+	return &recipeCost, nil
 }
 
 func marketObtainMethod(
@@ -397,7 +618,7 @@ func marketObtainMethod(
 
 				// Tiebreaker logic
 				if listingAEffortCost == listingBEffortCost {
-					if listings[i].Total == listings[ii].Total {
+					if listingCost(listings[i]) == listingCost(listings[ii]) {
 						return listings[i].Id < listings[ii].Id
 					}
 
@@ -419,29 +640,32 @@ func marketObtainMethod(
 			},
 		},
 		ObtainMethod: "Market",
+		Type:         ObtainTypeMarket,
 		Quantity:     0,
 		EffortFactor: 0.99,
+		itemId:       item.Id,
+		numRequired:  numRequired,
 	}
 
+	availableListings := make([]*db.Listing, 0, len(*listings))
 	for _, listing := range *listings {
-		if numRequired <= 0 {
-			break
-		}
-
-		if alreadyBoughtListing(cheapestMethod, listing) {
-			continue
+		if !alreadyBoughtListing(cheapestMethod, listing) {
+			availableListings = append(availableListings, listing)
 		}
+	}
 
-		numRequired -= listing.Quantity
+	for _, listing := range cheapestListingCombination(availableListings, numRequired, player.HomeServer) {
 		purchasePlan.ShoppingCart.ItemsToBuy = append(
 			purchasePlan.ShoppingCart.ItemsToBuy,
 			ShoppingListing{
-				ItemId:       item.Id,
-				Quantity:     listing.Quantity,
-				RetainerName: listing.RetainerName,
-				listingId:    listing.Id,
-				worldId:      listing.WorldId,
-				CostPer:      listing.PricePer,
+				ItemId:        item.Id,
+				Quantity:      listing.Quantity,
+				RetainerName:  listing.RetainerName,
+				listingId:     listing.Id,
+				worldId:       listing.WorldId,
+				CostPer:       listing.PricePer,
+				Tax:           listing.Tax,
+				IsHighQuality: listing.IsHighQuality,
 			},
 		)
 
@@ -484,7 +708,7 @@ func calculateListingEffortCost(listing *db.Listing, playerServer int) float64 {
 		listingScore += 0.06
 	}
 
-	return math.Round(float64(listing.Total) * listingScore)
+	return math.Round(float64(listingCost(listing)) * listingScore)
 }
 
 func (p *ProfitCalculator) nonMarketObtainMethod(
@@ -535,6 +759,9 @@ func (p *ProfitCalculator) nonMarketObtainMethod(
 			Quantity:     totalQuantity,
 			EffortFactor: totalEffort,
 			ObtainMethod: obtainMethod.GetExchangeType(),
+			Type:         obtainTypeFromExchangeType(obtainMethod.GetExchangeType()),
+			itemId:       item.Id,
+			numRequired:  numRequired,
 		}
 
 		if isEasierToObtain(cheapestMethod, &currentMethod) {
@@ -573,6 +800,47 @@ func recipeEffort(recipe *RecipeInfo, item *Item) float64 {
 	return result
 }
 
+// recipeStatEffort
+// Compares a crafter's gear against a recipe. Returns false if the crafter doesn't meet the recipe's requirements or is
+// too far below its suggested stats to finish it, otherwise an effort multiplier that grows with any shortfall.
+func recipeStatEffort(recipe *RecipeInfo, stats db.CrafterStats) (float64, bool) {
+	if stats.Craftsmanship < recipe.Craftsmanship || stats.Control < recipe.Control {
+		return 0, false
+	}
+
+	requiredCp := 0
+	if recipe.IsExpert {
+		requiredCp = expertRecipeCp
+	} else if recipe.RecipeLevel >= maxLevel {
+		requiredCp = maxLevelRecipeCp
+	}
+
+	shortfalls := []float64{
+		statShortfall(stats.Craftsmanship, max(recipe.Craftsmanship, recipe.SuggestedCraftsmanship)),
+		statShortfall(stats.Control, max(recipe.Control, recipe.SuggestedControl)),
+		statShortfall(stats.CP, requiredCp),
+	}
+
+	result := 1.0
+	for _, shortfall := range shortfalls {
+		if shortfall > maxStatShortfall {
+			return 0, false
+		}
+
+		result *= 1 + shortfall
+	}
+
+	return result, true
+}
+
+func statShortfall(stat, target int) float64 {
+	if target <= 0 || stat >= target {
+		return 0
+	}
+
+	return float64(target-stat) / float64(target)
+}
+
 func combinePurchaseInfo(slice1, slice2 []*PurchaseInfo) []*PurchaseInfo {
 	combined := make([]*PurchaseInfo, 0)
 	itemMap := make(map[string]*PurchaseInfo)
@@ -596,44 +864,49 @@ type ProfitInfo struct {
 	ObtainMethod *ObtainMethod
 	SaleMethod   *SaleMethod
 	ProfitScore  float64
-}
+	// Whether the best outcome above is for a high quality item
+	IsHighQuality bool
 
-func (p *ProfitCalculator) salesPerHour(sales *[]*db.Sale, dayRange int) float64 {
-	if sales == nil || len(*sales) == 0 {
-		return 0
-	}
+	// The outcomes for each quality this item can be sold as
+	NormalQuality *QualityProfit `json:",omitempty"`
+	HighQuality   *QualityProfit `json:",omitempty"`
 
-	daysAgo := time.Now().AddDate(0, 0, -dayRange).UTC()
-	var filteredSales []*db.Sale
-	for _, sale := range *sales {
-		if sale.Timestamp.After(daysAgo) {
-			filteredSales = append(filteredSales, sale)
-		}
-	}
+	// Step by step plan for obtaining the item, including how every ingredient is obtained
+	CraftingTree *CraftingTreeNode `json:",omitempty"`
 
-	// If no sales in the specified range, return 0
-	if len(filteredSales) <= 1 {
-		return 0
-	}
+	// Gil actually spent obtaining the item, and the value of anything bought beyond what's needed
+	Spend        int
+	SurplusValue int
 
-	// Calculate the total gap in hours between consecutive sales
-	var totalGapHours float64 = 0
-	for i := 1; i < len(filteredSales); i++ {
-		gap := filteredSales[i].Timestamp.Sub(filteredSales[i-1].Timestamp).Hours()
-		totalGapHours += gap
-	}
+	// How fast the item sells on the market at the quality above
+	Velocity *SaleVelocity `json:",omitempty"`
 
-	// Calculate average gap in hours (total gap divided by number of gaps)
-	avgGapHours := totalGapHours / float64(len(filteredSales)-1)
+	// Listings and sales at the quality above that were ignored for being priced far from the rest
+	Outliers *OutlierReport `json:",omitempty"`
+}
 
-	// Convert average gap time into sales per hour
-	if avgGapHours == 0 {
-		return 0
+type QualityProfit struct {
+	ObtainMethod *ObtainMethod
+	SaleMethod   *SaleMethod
+	ProfitScore  float64
+	Velocity     *SaleVelocity
+	Outliers     *OutlierReport
+}
+
+// estimateSaleVelocity
+// Estimates how fast the item sells from its sale rollups, using the calculator's velocity settings
+func (p *ProfitCalculator) estimateSaleVelocity(rollups *[]*db.SaleRollup) *SaleVelocity {
+	if rollups == nil {
+		return EstimateSaleVelocity(nil, p.now(), p.Velocity)
 	}
-	return 1 / avgGapHours
+
+	return EstimateSaleVelocity(*rollups, p.now(), p.Velocity)
 }
 
-func (p *ProfitCalculator) CalculateProfitForItem(item *Item, info *PlayerInfo) (*ProfitInfo, error) {
+// obtainListings
+// Market listings on the player's data center for the item and everything that could go into making it, or nil if
+// none of them can be bought on the market
+func (p *ProfitCalculator) obtainListings(item *Item, info *PlayerInfo) (*[]*db.Listing, error) {
 	// Pre-calculate all items that could be involved in the obtaining of this item
 	itemIds := make([]int, 0, 10)
 	if item.CraftingRecipes != nil {
@@ -648,16 +921,39 @@ func (p *ProfitCalculator) CalculateProfitForItem(item *Item, info *PlayerInfo)
 		itemIds = append(itemIds, item.Id)
 	}
 
+	if len(itemIds) == 0 {
+		return nil, nil
+	}
+
+	return p.repository.GetListingsForItemsOnDataCenter(itemIds, info.DataCenter)
+}
+
+// BlockedRecipesForItem
+// When an item can't be obtained at all, the recipes for it (or its ingredients) the player would need a secret
+// recipe book or specialization for. Empty if the item can be obtained, or if unlocking recipes wouldn't help.
+func (p *ProfitCalculator) BlockedRecipesForItem(item *Item, info *PlayerInfo) ([]BlockedRecipe, error) {
+	listings, err := p.obtainListings(item, info)
+	if err != nil {
+		return nil, err
+	}
+
+	method, blocked := p.getCheapestObtainMethodForQuality(item, 1, listings, info, AnyQuality)
+	if method != nil {
+		return nil, nil
+	}
+
+	return blocked, nil
+}
+
+func (p *ProfitCalculator) CalculateProfitForItem(item *Item, info *PlayerInfo) (*ProfitInfo, error) {
 	// Get market listings for item if this item is sellable
-	var listings *[]*db.Listing = nil
-	var listingsOnPlayerWorld []*db.Listing
-	if len(itemIds) > 0 {
-		listingResults, err := p.repository.GetListingsForItemsOnDataCenter(itemIds, info.DataCenter)
-		listings = listingResults
-		if err != nil {
-			return nil, err
-		}
+	listings, err := p.obtainListings(item, info)
+	if err != nil {
+		return nil, err
+	}
 
+	var listingsOnPlayerWorld []*db.Listing
+	if listings != nil {
 		for _, listing := range *listings {
 			if listing.WorldId == info.HomeServer && listing.ItemId == item.Id {
 				listingsOnPlayerWorld = append(listingsOnPlayerWorld, listing)
@@ -665,31 +961,84 @@ func (p *ProfitCalculator) CalculateProfitForItem(item *Item, info *PlayerInfo)
 		}
 	}
 
-	sales, err := p.repository.GetSalesForItemOnWorld(item.Id, info.HomeServer)
+	rollups, err := p.repository.GetSaleRollupsForItemOnWorld(
+		item.Id, info.HomeServer, db.RollupDaily, p.Velocity.historyStart(p.now()),
+	)
 	if err != nil {
 		return nil, err
 	}
 
-	// Get most value created when selling the item
-	bestSale := p.GetBestSaleMethod(item, &listingsOnPlayerWorld, sales, info, false)
-	if bestSale == nil {
-		// Sometimes there's no way to sell this item, and that's okay. We will just return early
+	// High and normal quality items are sold separately on the market, so they're valued separately as well
+	result := &ProfitInfo{
+		ItemId:        item.Id,
+		NormalQuality: p.calculateProfitForQuality(item, listings, &listingsOnPlayerWorld, rollups, info, NormalQuality),
+	}
+
+	if item.CanBeHq {
+		result.HighQuality = p.calculateProfitForQuality(item, listings, &listingsOnPlayerWorld, rollups, info, HighQuality)
+	}
+
+	bestOutcome := result.NormalQuality
+	if result.HighQuality != nil && (bestOutcome == nil || result.HighQuality.ProfitScore > bestOutcome.ProfitScore) {
+		bestOutcome = result.HighQuality
+		result.IsHighQuality = true
+	}
+
+	// Sometimes there's no way to obtain or sell this item, and that's okay. We will just return early
+	if bestOutcome == nil {
 		return nil, nil
 	}
 
+	result.ObtainMethod = bestOutcome.ObtainMethod
+	result.SaleMethod = bestOutcome.SaleMethod
+	result.ProfitScore = bestOutcome.ProfitScore
+	result.CraftingTree = bestOutcome.ObtainMethod.CraftingTree()
+	result.Spend = bestOutcome.ObtainMethod.GetCost()
+	result.SurplusValue = bestOutcome.ObtainMethod.GetSurplusValue()
+	result.Velocity = bestOutcome.Velocity
+	result.Outliers = bestOutcome.Outliers
+
+	return result, nil
+}
+
+func (p *ProfitCalculator) calculateProfitForQuality(
+	item *Item,
+	listings *[]*db.Listing,
+	listingsOnPlayerWorld *[]*db.Listing,
+	rollups *[]*db.SaleRollup,
+	info *PlayerInfo,
+	quality ItemQuality,
+) *QualityProfit {
+	// Get most value created when selling the item, only comparing against listings and sales of the same quality.
+	// Listings and sales priced far from the rest (troll listings, wash trades) are left out first.
+	qualityListings, qualityRollups, outliers := filterOutliers(
+		filterListingsByQuality(listingsOnPlayerWorld, quality),
+		filterRollupsByQuality(rollups, quality),
+	)
+	bestSale := p.GetBestSaleMethod(
+		item,
+		qualityListings,
+		qualityRollups,
+		info,
+		false,
+	)
+	if bestSale == nil {
+		return nil
+	}
+
 	// Get the cheapest method to obtain the item
-	cheapestMethod := p.GetCheapestObtainMethod(item, bestSale.Quantity, listings, info)
+	cheapestMethod, _ := p.getCheapestObtainMethodForQuality(item, bestSale.Quantity, listings, info, quality)
 	if cheapestMethod == nil {
-		return nil, nil
+		return nil
 	}
 
-	// Return info
-	return &ProfitInfo{
-		ItemId:       item.Id,
+	return &QualityProfit{
 		ObtainMethod: cheapestMethod,
 		SaleMethod:   bestSale,
 		ProfitScore:  calculateProfitScore(bestSale, cheapestMethod.GetCost(), cheapestMethod.EffortFactor),
-	}, nil
+		Velocity:     p.estimateSaleVelocity(qualityRollups),
+		Outliers:     outliers,
+	}
 }
 
 func calculateProfitScore(bestSale *SaleMethod, cost int, effort float64) float64 {
@@ -742,7 +1091,9 @@ func (p *ProfitCalculator) getGilValueAndBestSaleForCurrency(currency string, in
 		return 0, nil, nil
 	}
 
-	sales, err := p.repository.GetSalesForItemsOnWorld(itemIds, info.HomeServer)
+	rollups, err := p.repository.GetSaleRollupsForItemsOnWorld(
+		itemIds, info.HomeServer, db.RollupDaily, p.Velocity.historyStart(p.now()),
+	)
 	if err != nil {
 		return 0, nil, nil
 	}
@@ -754,17 +1105,17 @@ func (p *ProfitCalculator) getGilValueAndBestSaleForCurrency(currency string, in
 	for _, item := range itemsWithObtainMethod {
 		wg.Add(1)
 
-		go func(item *Item, listings *[]*db.Listing, sales *[]*db.Sale, info *PlayerInfo) {
+		go func(item *Item, listings *[]*db.Listing, rollups *[]*db.SaleRollup, info *PlayerInfo) {
 			defer wg.Done()
 
-			filteredSales := make([]*db.Sale, 0, 100)
+			filteredRollups := make([]*db.SaleRollup, 0, 100)
 			filteredListings := make([]*db.Listing, 0, 100)
-			for _, sale := range *sales {
-				if sale.ItemId != item.Id {
+			for _, rollup := range *rollups {
+				if rollup.ItemId != item.Id {
 					continue
 				}
 
-				filteredSales = append(filteredSales, sale)
+				filteredRollups = append(filteredRollups, rollup)
 			}
 
 			for _, listing := range *listings {
@@ -775,7 +1126,8 @@ func (p *ProfitCalculator) getGilValueAndBestSaleForCurrency(currency string, in
 				filteredListings = append(filteredListings, listing)
 			}
 
-			itemSale := p.GetBestSaleMethod(item, &filteredListings, &filteredSales, info, true)
+			cleanListings, cleanRollups, _ := filterOutliers(&filteredListings, &filteredRollups)
+			itemSale := p.GetBestSaleMethod(item, cleanListings, cleanRollups, info, true)
 
 			if itemSale == nil {
 				return
@@ -803,7 +1155,7 @@ func (p *ProfitCalculator) getGilValueAndBestSaleForCurrency(currency string, in
 				item:        item,
 				sale:        itemSale,
 			}
-		}(item, listings, sales, info)
+		}(item, listings, rollups, info)
 	}
 
 	go func() {
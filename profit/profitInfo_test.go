@@ -4,18 +4,24 @@ import (
 	"github.com/level-5-pidgey/MarketMoogle/csv/readertype"
 	"github.com/level-5-pidgey/MarketMoogle/db"
 	"github.com/level-5-pidgey/MarketMoogle/profit/exchange"
+	"math"
 	"reflect"
 	"sort"
 	"testing"
+	"time"
 )
 
 func TestProfitCalculator_GetBestSaleMethod(t *testing.T) {
 	type args struct {
 		item         *Item
 		listings     *[]*db.Listing
-		sales        *[]*db.Sale
+		rollups      *[]*db.SaleRollup
 		playerServer *PlayerInfo
 	}
+
+	now := time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+	// Too few sales for the week, so velocity comes from the month window, which is 29 and a half days in
+	monthElapsedDays := 29.5
 	tests := []struct {
 		name string
 		args args
@@ -73,7 +79,7 @@ func TestProfitCalculator_GetBestSaleMethod(t *testing.T) {
 				Quantity:          1,
 				ValuePer:          500,
 				SaleVelocity:      0.0001,
-				CompetitionFactor: 0.5,
+				CompetitionFactor: 0.8909031788043871,
 			},
 		},
 		{
@@ -88,8 +94,8 @@ func TestProfitCalculator_GetBestSaleMethod(t *testing.T) {
 					},
 				},
 				listings: &[]*db.Listing{
-					{Id: 1, ItemId: 5, WorldId: 1, PricePer: 100, Quantity: 5, Total: 500},
-					{Id: 2, ItemId: 5, WorldId: 1, PricePer: 101, Quantity: 1, Total: 101},
+					{Id: 1, ItemId: 5, WorldId: 1, PricePer: 100, Quantity: 5, Total: 500, Tax: 25},
+					{Id: 2, ItemId: 5, WorldId: 1, PricePer: 101, Quantity: 1, Total: 101, Tax: 5},
 				},
 				playerServer: &PlayerInfo{
 					HomeServer: 1,
@@ -102,10 +108,66 @@ func TestProfitCalculator_GetBestSaleMethod(t *testing.T) {
 				Quantity:          5,
 				ValuePer:          99,
 				SaleVelocity:      0.0001,
-				CompetitionFactor: 0.5,
+				CompetitionFactor: 0.8909031788043871,
+			},
+		},
+		{
+			name: "Undercutting a tax free listing leaves room for the tax buyers pay on ours",
+			args: args{
+				item: &Item{
+					Id:          5,
+					CanBeTraded: true,
+				},
+				listings: &[]*db.Listing{
+					{Id: 1, ItemId: 5, WorldId: 1, PricePer: 100, Quantity: 5, Total: 500},
+				},
+				playerServer: &PlayerInfo{
+					HomeServer:   1,
+					DataCenter:   1,
+					RetainerCity: RetainerCityLimsaLominsa,
+				},
+			},
+			want: &SaleMethod{
+				ExchangeType:      readertype.Marketboard,
+				Value:             475,
+				Quantity:          5,
+				ValuePer:          95,
+				SaleVelocity:      0.0001,
+				CompetitionFactor: 0.9275735146384823,
+			},
+		},
+		{
+			name: "Item without listings is valued from its recent sales",
+			args: args{
+				item: &Item{
+					Id:          5,
+					CanBeTraded: true,
+				},
+				listings: &[]*db.Listing{},
+				rollups: &[]*db.SaleRollup{
+					{
+						ItemId: 5, WorldId: 1, BucketStart: now.AddDate(0, 0, -2), SaleCount: 2, Quantity: 4,
+						TotalPrice: 400, MinPrice: 90, MaxPrice: 110,
+					},
+					{
+						ItemId: 5, WorldId: 1, BucketStart: now.Add(-3 * time.Hour), SaleCount: 1, Quantity: 2,
+						TotalPrice: 260, MinPrice: 130, MaxPrice: 130,
+					},
+				},
+				playerServer: &PlayerInfo{
+					HomeServer: 1,
+					DataCenter: 1,
+				},
+			},
+			want: &SaleMethod{
+				ExchangeType:      readertype.Marketboard,
+				Value:             220,
+				Quantity:          2,
+				ValuePer:          110,
+				SaleVelocity:      3 / monthElapsedDays / 24,
+				CompetitionFactor: 1.0,
 			},
 		},
-		// TODO add tests for sales tracking
 	}
 	for _, tt := range tests {
 		t.Run(
@@ -117,12 +179,14 @@ func TestProfitCalculator_GetBestSaleMethod(t *testing.T) {
 					nil,
 					nil,
 					db.NewMockRepository(),
+					nil,
 				)
+				p.now = func() time.Time { return now }
 
 				if got := p.GetBestSaleMethod(
 					tt.args.item,
 					tt.args.listings,
-					tt.args.sales,
+					tt.args.rollups,
 					tt.args.playerServer,
 					false,
 				); !reflect.DeepEqual(got, tt.want) {
@@ -196,8 +260,11 @@ func TestProfitCalculator_GetCostToObtain(t *testing.T) {
 					itemsRequired: map[int]int{2: 1},
 				},
 				ObtainMethod: "Market",
+				Type:         ObtainTypeMarket,
 				Quantity:     1,
 				EffortFactor: 1.05,
+				itemId:       2,
+				numRequired:  1,
 			},
 		},
 		{
@@ -275,8 +342,74 @@ func TestProfitCalculator_GetCostToObtain(t *testing.T) {
 					itemsRequired: map[int]int{3: 6},
 				},
 				ObtainMethod: "Craft with Carpenter",
+				Type:         ObtainTypeCraft,
+				JobRequired:  readertype.JobCarpenter,
 				Quantity:     1,
 				EffortFactor: 1.0,
+				itemId:       1,
+				numRequired:  1,
+				ingredients: []*ObtainMethod{
+					{
+						ShoppingCart: ShoppingCart{
+							ItemsToBuy: []ShoppingItem{
+								LocalItem{
+									ItemId:       3,
+									Quantity:     4,
+									ObtainedFrom: "Buy from NPC",
+									CostPer:      5,
+								},
+							},
+							itemsRequired: map[int]int{3: 4},
+						},
+						ObtainMethod: "Craft with Alchemist",
+						Type:         ObtainTypeCraft,
+						JobRequired:  readertype.JobAlchemist,
+						Quantity:     1,
+						EffortFactor: 0.95,
+						itemId:       2,
+						numRequired:  1,
+						ingredients: []*ObtainMethod{
+							{
+								ShoppingCart: ShoppingCart{
+									ItemsToBuy: []ShoppingItem{
+										LocalItem{
+											ItemId:       3,
+											Quantity:     4,
+											ObtainedFrom: "Buy from NPC",
+											CostPer:      5,
+										},
+									},
+									itemsRequired: map[int]int{3: 4},
+								},
+								ObtainMethod: "Gil",
+								Type:         ObtainTypeVendor,
+								Quantity:     4,
+								EffortFactor: 0.8757558499999999,
+								itemId:       3,
+								numRequired:  4,
+							},
+						},
+					},
+					{
+						ShoppingCart: ShoppingCart{
+							ItemsToBuy: []ShoppingItem{
+								LocalItem{
+									ItemId:       3,
+									Quantity:     2,
+									ObtainedFrom: "Buy from NPC",
+									CostPer:      5,
+								},
+							},
+							itemsRequired: map[int]int{3: 2},
+						},
+						ObtainMethod: "Gil",
+						Type:         ObtainTypeVendor,
+						Quantity:     2,
+						EffortFactor: 0.8584999999999999,
+						itemId:       3,
+						numRequired:  2,
+					},
+				},
 			},
 		},
 		{
@@ -350,8 +483,53 @@ func TestProfitCalculator_GetCostToObtain(t *testing.T) {
 					},
 				},
 				ObtainMethod: "Craft with Culinarian",
+				Type:         ObtainTypeCraft,
+				JobRequired:  readertype.JobCulinarian,
 				Quantity:     1,
 				EffortFactor: 1.0,
+				itemId:       1,
+				numRequired:  1,
+				ingredients: []*ObtainMethod{
+					{
+						ShoppingCart: ShoppingCart{
+							ItemsToBuy: []ShoppingItem{
+								ShoppingListing{
+									ItemId:    2,
+									Quantity:  3,
+									listingId: 2,
+									worldId:   2,
+									CostPer:   501,
+								},
+							},
+							itemsRequired: map[int]int{2: 2},
+						},
+						ObtainMethod: "Market",
+						Type:         ObtainTypeMarket,
+						Quantity:     3,
+						EffortFactor: 1.05,
+						itemId:       2,
+						numRequired:  2,
+					},
+					{
+						ShoppingCart: ShoppingCart{
+							ItemsToBuy: []ShoppingItem{
+								LocalItem{
+									ItemId:       3,
+									Quantity:     2,
+									ObtainedFrom: "Buy from NPC",
+									CostPer:      250,
+								},
+							},
+							itemsRequired: map[int]int{3: 2},
+						},
+						ObtainMethod: "Gil",
+						Type:         ObtainTypeVendor,
+						Quantity:     2,
+						EffortFactor: 0.8584999999999999,
+						itemId:       3,
+						numRequired:  2,
+					},
+				},
 			},
 		},
 		{
@@ -447,8 +625,11 @@ func TestProfitCalculator_GetCostToObtain(t *testing.T) {
 					},
 				},
 				ObtainMethod: "Gil",
+				Type:         ObtainTypeVendor,
 				Quantity:     1,
 				EffortFactor: 0.85,
+				itemId:       1,
+				numRequired:  1,
 			},
 		},
 		{
@@ -476,7 +657,7 @@ func TestProfitCalculator_GetCostToObtain(t *testing.T) {
 							ItemId:       1,
 							Quantity:     1,
 							ObtainedFrom: "Exchange Grand Company Seals (Rank: Corporal)",
-							CostPer:      500, // This is the default gil cost for a currency grind
+							CostPer:      1500, // This is the default gil cost for a currency grind
 						},
 					},
 					itemsRequired: map[int]int{
@@ -484,8 +665,11 @@ func TestProfitCalculator_GetCostToObtain(t *testing.T) {
 					},
 				},
 				ObtainMethod: "Grand Company Seal",
+				Type:         ObtainTypeCurrency,
 				Quantity:     1,
 				EffortFactor: 0.9,
+				itemId:       1,
+				numRequired:  1,
 			},
 		},
 		{
@@ -591,8 +775,54 @@ func TestProfitCalculator_GetCostToObtain(t *testing.T) {
 					},
 				},
 				ObtainMethod: "Craft with Weaver",
+				Type:         ObtainTypeCraft,
+				JobRequired:  readertype.JobWeaver,
 				Quantity:     1,
 				EffortFactor: 0.95,
+				itemId:       1,
+				numRequired:  1,
+				ingredients: []*ObtainMethod{
+					{
+						ShoppingCart: ShoppingCart{
+							ItemsToBuy: []ShoppingItem{
+								ShoppingListing{
+									ItemId:    2,
+									Quantity:  1,
+									listingId: 3,
+									worldId:   3,
+									CostPer:   50,
+								},
+							},
+							itemsRequired: map[int]int{2: 1},
+						},
+						ObtainMethod: "Market",
+						Type:         ObtainTypeMarket,
+						Quantity:     1,
+						EffortFactor: 1.05,
+						itemId:       2,
+						numRequired:  1,
+					},
+					{
+						ShoppingCart: ShoppingCart{
+							ItemsToBuy: []ShoppingItem{
+								ShoppingListing{
+									ItemId:    3,
+									Quantity:  1,
+									listingId: 6,
+									worldId:   1,
+									CostPer:   20,
+								},
+							},
+							itemsRequired: map[int]int{3: 1},
+						},
+						ObtainMethod: "Market",
+						Type:         ObtainTypeMarket,
+						Quantity:     1,
+						EffortFactor: 1.0,
+						itemId:       3,
+						numRequired:  1,
+					},
+				},
 			},
 		},
 	}
@@ -621,6 +851,7 @@ func TestProfitCalculator_GetCostToObtain(t *testing.T) {
 					nil,
 					nil,
 					repo,
+					nil,
 				)
 
 				got := p.GetCheapestObtainMethod(
@@ -638,6 +869,7 @@ func TestProfitCalculator_GetCostToObtain(t *testing.T) {
 					)
 				}
 
+				clearRecipes(t, got)
 				if !reflect.DeepEqual(got, tt.want) {
 					t.Errorf("GetCheapestObtainMethod() = %v, want %v", got, tt.want)
 				}
@@ -646,6 +878,23 @@ func TestProfitCalculator_GetCostToObtain(t *testing.T) {
 	}
 }
 
+// clearRecipes
+// Checks every crafted method kept a recipe for its job, then clears them so methods can be compared directly
+func clearRecipes(t *testing.T, method *ObtainMethod) {
+	if method == nil {
+		return
+	}
+
+	if method.Type == ObtainTypeCraft && (method.recipe == nil || method.recipe.JobRequired != method.JobRequired) {
+		t.Errorf("crafting item %d with %s kept recipe %v", method.itemId, method.JobRequired, method.recipe)
+	}
+
+	method.recipe = nil
+	for _, ingredient := range method.ingredients {
+		clearRecipes(t, ingredient)
+	}
+}
+
 func Test_combinePurchaseInfo(t *testing.T) {
 	type args struct {
 		slice1 []*PurchaseInfo
@@ -799,7 +1048,7 @@ func Test_combinePurchaseInfo(t *testing.T) {
 	}
 }
 
-func TestProfitCalculator_getIngredientsForRecipe(t *testing.T) {
+func TestProfitCalculator_getPossibleSubItems(t *testing.T) {
 	type args struct {
 		numRequired  int
 		recipe       *RecipeInfo
@@ -1018,15 +1267,302 @@ func TestProfitCalculator_getIngredientsForRecipe(t *testing.T) {
 					nil,
 					nil,
 					repo,
+					nil,
 				)
 
+				// Sub items are only tracked by id now, so compare against the ingredient ids we expect
+				want := make(map[int]struct{}, len(*tt.want))
+				for itemId := range *tt.want {
+					want[itemId] = struct{}{}
+				}
+
+				item := &Item{CraftingRecipes: &[]RecipeInfo{*tt.args.recipe}}
 				if got := p.getPossibleSubItems(
 					nil,
-					tt.args.numRequired,
-					tt.args.recipe,
+					item,
 					tt.args.skipCrystals,
-				); !reflect.DeepEqual(got, tt.want) {
-					t.Errorf("getPossibleSubItems() = %v, want %v", got, tt.want)
+				); !reflect.DeepEqual(got, want) {
+					t.Errorf("getPossibleSubItems() = %v, want %v", got, want)
+				}
+			},
+		)
+	}
+}
+
+func TestProfitCalculator_BlockedRecipesForItem(t *testing.T) {
+	ingredient := &Item{
+		Id:            2,
+		ObtainMethods: &[]exchange.Method{exchange.NewGilExchange(5, "NPC", "")},
+	}
+
+	// The only way to get the item is a recipe from a book the player doesn't have
+	item := &Item{
+		Id:               1,
+		MarketProhibited: true,
+		CraftingRecipes: &[]RecipeInfo{
+			{
+				Yield:             1,
+				JobRequired:       readertype.JobCarpenter,
+				RecipeLevel:       90,
+				SecretRecipeBook:  "Master Carpenter I",
+				RecipeIngredients: []RecipeIngredients{{ItemId: 2, Quantity: 2}},
+			},
+		},
+	}
+
+	itemMap := map[int]*Item{ingredient.Id: ingredient, item.Id: item}
+	p := NewProfitCalculator(&itemMap, nil, nil, db.NewMockRepository(), nil)
+
+	player := &PlayerInfo{
+		HomeServer:        1,
+		DataCenter:        1,
+		JobLevels:         map[readertype.Job]int{readertype.JobCarpenter: 90},
+		SecretRecipeBooks: map[string]struct{}{},
+	}
+
+	if got := p.GetCheapestObtainMethod(item, 1, nil, player); got != nil {
+		t.Fatalf("GetCheapestObtainMethod() = %s, want nil without the book", got.ObtainMethod)
+	}
+
+	blocked, err := p.BlockedRecipesForItem(item, player)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(blocked) != 1 || blocked[0].MissingRecipeBook != "Master Carpenter I" || blocked[0].Cost != 10 {
+		t.Errorf("BlockedRecipesForItem() = %+v, want the recipe missing its book", blocked)
+	}
+
+	// A product made from the item reports the book it's missing too
+	product := &Item{
+		Id:               3,
+		MarketProhibited: true,
+		CraftingRecipes: &[]RecipeInfo{
+			{
+				Yield:             1,
+				JobRequired:       readertype.JobCarpenter,
+				RecipeLevel:       90,
+				RecipeIngredients: []RecipeIngredients{{ItemId: 1, Quantity: 1}},
+			},
+		},
+	}
+	itemMap[product.Id] = product
+
+	if blocked, _ = p.BlockedRecipesForItem(product, player); len(blocked) != 1 || blocked[0].ItemId != item.Id {
+		t.Errorf("BlockedRecipesForItem() = %+v, want the ingredient's recipe missing its book", blocked)
+	}
+
+	player.SecretRecipeBooks["Master Carpenter I"] = struct{}{}
+	if blocked, _ = p.BlockedRecipesForItem(item, player); len(blocked) != 0 {
+		t.Errorf("BlockedRecipesForItem() = %+v once the book is unlocked, want none", blocked)
+	}
+}
+
+func TestProfitCalculator_GetCheapestObtainMethod_RecipeRestrictions(t *testing.T) {
+	ingredient := &Item{
+		Id: 2,
+		ObtainMethods: &[]exchange.Method{
+			exchange.NewGilExchange(5, "NPC", ""),
+		},
+	}
+
+	newItem := func(recipe RecipeInfo) *Item {
+		recipe.Yield = 1
+		recipe.JobRequired = readertype.JobCarpenter
+		recipe.RecipeLevel = 90
+		recipe.RecipeIngredients = []RecipeIngredients{{ItemId: 2, Quantity: 2}}
+
+		return &Item{
+			Id:               1,
+			MarketProhibited: true,
+			ObtainMethods: &[]exchange.Method{
+				exchange.NewGilExchange(100, "NPC", ""),
+			},
+			CraftingRecipes: &[]RecipeInfo{recipe},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		item        *Item
+		player      *PlayerInfo
+		wantMethod  string
+		wantBlocked []BlockedRecipe
+	}{
+		{
+			name: "Crafts a secret recipe when the player owns the book",
+			item: newItem(RecipeInfo{SecretRecipeBook: "Master Carpenter I"}),
+			player: &PlayerInfo{
+				HomeServer:        1,
+				DataCenter:        1,
+				JobLevels:         map[readertype.Job]int{readertype.JobCarpenter: 90},
+				SecretRecipeBooks: map[string]struct{}{"Master Carpenter I": {}},
+			},
+			wantMethod:  "Craft with Carpenter",
+			wantBlocked: nil,
+		},
+		{
+			name: "Reports the missing book when a secret recipe would have been cheaper",
+			item: newItem(RecipeInfo{SecretRecipeBook: "Master Carpenter I"}),
+			player: &PlayerInfo{
+				HomeServer:        1,
+				DataCenter:        1,
+				JobLevels:         map[readertype.Job]int{readertype.JobCarpenter: 90},
+				SecretRecipeBooks: map[string]struct{}{},
+			},
+			wantMethod: "Gil",
+			wantBlocked: []BlockedRecipe{
+				{
+					ItemId:            1,
+					JobRequired:       readertype.JobCarpenter,
+					MissingRecipeBook: "Master Carpenter I",
+					Cost:              10,
+				},
+			},
+		},
+		{
+			name: "Reports the missing specialization when a specialist recipe would have been cheaper",
+			item: newItem(RecipeInfo{SpecializationRequired: true}),
+			player: &PlayerInfo{
+				HomeServer:  1,
+				DataCenter:  1,
+				JobLevels:   map[readertype.Job]int{readertype.JobCarpenter: 90},
+				Specialists: map[readertype.Job]struct{}{readertype.JobWeaver: {}},
+			},
+			wantMethod: "Gil",
+			wantBlocked: []BlockedRecipe{
+				{
+					ItemId:                1,
+					JobRequired:           readertype.JobCarpenter,
+					MissingSpecialization: true,
+					Cost:                  10,
+				},
+			},
+		},
+		{
+			name: "Specialists can craft specialist recipes",
+			item: newItem(RecipeInfo{SpecializationRequired: true}),
+			player: &PlayerInfo{
+				HomeServer:  1,
+				DataCenter:  1,
+				JobLevels:   map[readertype.Job]int{readertype.JobCarpenter: 90},
+				Specialists: map[readertype.Job]struct{}{readertype.JobCarpenter: {}},
+			},
+			wantMethod:  "Craft with Carpenter",
+			wantBlocked: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				itemMap := map[int]*Item{ingredient.Id: ingredient}
+
+				p := NewProfitCalculator(
+					&itemMap,
+					nil,
+					nil,
+					db.NewMockRepository(),
+					nil,
+				)
+
+				got := p.GetCheapestObtainMethod(tt.item, 1, nil, tt.player)
+				if got == nil {
+					t.Fatalf("GetCheapestObtainMethod() = nil, want %s", tt.wantMethod)
+				}
+
+				if got.ObtainMethod != tt.wantMethod {
+					t.Errorf("GetCheapestObtainMethod() method = %s, want %s", got.ObtainMethod, tt.wantMethod)
+				}
+
+				// The obtain method behind each blocked recipe is internal, so we only compare what gets reported
+				for i := range got.BlockedRecipes {
+					got.BlockedRecipes[i].method = nil
+				}
+
+				if !reflect.DeepEqual(got.BlockedRecipes, tt.wantBlocked) {
+					t.Errorf("GetCheapestObtainMethod() blocked = %v, want %v", got.BlockedRecipes, tt.wantBlocked)
+				}
+			},
+		)
+	}
+}
+
+func Test_recipeStatEffort(t *testing.T) {
+	recipe := &RecipeInfo{
+		RecipeLevel:            80,
+		Craftsmanship:          2000,
+		Control:                1800,
+		SuggestedCraftsmanship: 2400,
+		SuggestedControl:       2000,
+	}
+
+	tests := []struct {
+		name          string
+		recipe        *RecipeInfo
+		stats         db.CrafterStats
+		want          float64
+		wantCanFinish bool
+	}{
+		{
+			name:          "Crafter above every suggested stat has no extra effort",
+			recipe:        recipe,
+			stats:         db.CrafterStats{Craftsmanship: 2500, Control: 2100, CP: 500},
+			want:          1.0,
+			wantCanFinish: true,
+		},
+		{
+			name:          "Crafter below required craftsmanship can't craft",
+			recipe:        recipe,
+			stats:         db.CrafterStats{Craftsmanship: 1999, Control: 2100, CP: 500},
+			want:          0,
+			wantCanFinish: false,
+		},
+		{
+			name:          "Crafter below required control can't craft",
+			recipe:        recipe,
+			stats:         db.CrafterStats{Craftsmanship: 2500, Control: 1799, CP: 500},
+			want:          0,
+			wantCanFinish: false,
+		},
+		{
+			name:          "Near miss on suggested craftsmanship raises effort",
+			recipe:        recipe,
+			stats:         db.CrafterStats{Craftsmanship: 2160, Control: 2000, CP: 500},
+			want:          1.1,
+			wantCanFinish: true,
+		},
+		{
+			name: "Expert recipe without enough CP can't be finished",
+			recipe: &RecipeInfo{
+				RecipeLevel: 90,
+				IsExpert:    true,
+			},
+			stats:         db.CrafterStats{Craftsmanship: 4000, Control: 4000, CP: 400},
+			want:          0,
+			wantCanFinish: false,
+		},
+		{
+			name: "Expert recipe slightly under CP is harder",
+			recipe: &RecipeInfo{
+				RecipeLevel: 90,
+				IsExpert:    true,
+			},
+			stats:         db.CrafterStats{Craftsmanship: 4000, Control: 4000, CP: 540},
+			want:          1.1,
+			wantCanFinish: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, canFinish := recipeStatEffort(tt.recipe, tt.stats)
+
+				if canFinish != tt.wantCanFinish {
+					t.Errorf("recipeStatEffort() canFinish = %v, want %v", canFinish, tt.wantCanFinish)
+				}
+
+				if math.Abs(got-tt.want) > 0.0001 {
+					t.Errorf("recipeStatEffort() = %v, want %v", got, tt.want)
 				}
 			},
 		)
@@ -0,0 +1,197 @@
+package profitCalc
+
+import (
+	"github.com/level-5-pidgey/MarketMoogle/csv/readertype"
+	"slices"
+	"sort"
+	"time"
+)
+
+type ProfitSortKey string
+
+const (
+	SortByProfitScore   ProfitSortKey = "profitScore"
+	SortByMargin        ProfitSortKey = "margin"
+	SortByMarginPerHour ProfitSortKey = "marginPerHour"
+	SortByRoi           ProfitSortKey = "roi"
+)
+
+const (
+	DefaultPageSize = 25
+	MaxPageSize     = 100
+)
+
+func ProfitSortKeyFromString(s string) (ProfitSortKey, bool) {
+	switch sortKey := ProfitSortKey(s); sortKey {
+	case SortByProfitScore, SortByMargin, SortByMarginPerHour, SortByRoi:
+		return sortKey, true
+	default:
+		return "", false
+	}
+}
+
+// ProfitFilter
+// Narrows down a list of profit results. Zero values are ignored.
+type ProfitFilter struct {
+	MinProfit    int
+	MinVelocity  float64
+	MaxValuePer  int
+	Job          readertype.Job
+	UiCategory   int
+	MinItemLevel int
+	MaxItemLevel int
+	ObtainTypes  []ObtainType
+}
+
+type ProfitPage struct {
+	Results      []*ProfitInfo
+	TotalCount   int
+	Page         int
+	PageSize     int
+	TotalPages   int
+	NextPage     *int
+	PreviousPage *int
+	// When the results were calculated
+	ComputedAt time.Time `json:"computed_at"`
+	// When any of the results were last recalculated
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (p *ProfitInfo) Margin() int {
+	return p.SaleMethod.Value - p.ObtainMethod.GetCost()
+}
+
+// MarginPerHour
+// The margin weighted by how many sales of this item happen per hour
+func (p *ProfitInfo) MarginPerHour() float64 {
+	return float64(p.Margin()) * p.SaleMethod.SaleVelocity
+}
+
+// ReturnOnInvestment
+// The margin as a ratio of what it costs to obtain the item. Free items are treated as costing 1 gil.
+func (p *ProfitInfo) ReturnOnInvestment() float64 {
+	cost := p.ObtainMethod.GetCost()
+	if cost <= 0 {
+		cost = 1
+	}
+
+	return float64(p.Margin()) / float64(cost)
+}
+
+func (p *ProfitCalculator) FilterProfits(results []*ProfitInfo, filter ProfitFilter) []*ProfitInfo {
+	filtered := make([]*ProfitInfo, 0, len(results))
+
+	for _, result := range results {
+		item, ok := (*p.Items)[result.ItemId]
+		if !ok || !filter.matches(result, item) {
+			continue
+		}
+
+		filtered = append(filtered, result)
+	}
+
+	return filtered
+}
+
+func (f ProfitFilter) matches(result *ProfitInfo, item *Item) bool {
+	if f.MinProfit != 0 && result.Margin() < f.MinProfit {
+		return false
+	}
+
+	if f.MinVelocity != 0 && result.SaleMethod.SaleVelocity < f.MinVelocity {
+		return false
+	}
+
+	if f.MaxValuePer != 0 && result.SaleMethod.ValuePer > f.MaxValuePer {
+		return false
+	}
+
+	if f.UiCategory != 0 && item.UiCategory != f.UiCategory {
+		return false
+	}
+
+	if f.MinItemLevel != 0 && item.ItemLevel < f.MinItemLevel {
+		return false
+	}
+
+	if f.MaxItemLevel != 0 && item.ItemLevel > f.MaxItemLevel {
+		return false
+	}
+
+	if len(f.ObtainTypes) > 0 && !slices.Contains(f.ObtainTypes, result.ObtainMethod.Type) {
+		return false
+	}
+
+	// Jobs match either the crafter used to make the item or a job that can equip it
+	if f.Job != "" && result.ObtainMethod.JobRequired != f.Job {
+		if item.Jobs == nil || !slices.Contains(*item.Jobs, f.Job) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SortProfits
+// Sorts profit results from best to worst by the given key, falling back to the most expensive item on ties
+func SortProfits(results []*ProfitInfo, sortKey ProfitSortKey) {
+	sortValue := func(result *ProfitInfo) float64 {
+		switch sortKey {
+		case SortByMargin:
+			return float64(result.Margin())
+		case SortByMarginPerHour:
+			return result.MarginPerHour()
+		case SortByRoi:
+			return result.ReturnOnInvestment()
+		default:
+			return result.ProfitScore
+		}
+	}
+
+	sort.SliceStable(
+		results, func(i, j int) bool {
+			iValue, jValue := sortValue(results[i]), sortValue(results[j])
+
+			if iValue == jValue {
+				return results[i].ObtainMethod.GetCost() > results[j].ObtainMethod.GetCost()
+			}
+
+			return iValue > jValue
+		},
+	)
+}
+
+// PaginateProfits
+// Returns a single page (starting from 1) of results. Pages past the end are empty rather than an error.
+func PaginateProfits(results []*ProfitInfo, page, pageSize int) *ProfitPage {
+	if pageSize < 1 {
+		pageSize = DefaultPageSize
+	}
+
+	pageSize = min(pageSize, MaxPageSize)
+	page = max(page, 1)
+
+	totalPages := (len(results) + pageSize - 1) / pageSize
+	start := min((page-1)*pageSize, len(results))
+	end := min(start+pageSize, len(results))
+
+	result := &ProfitPage{
+		Results:    results[start:end],
+		TotalCount: len(results),
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: totalPages,
+	}
+
+	if page < totalPages {
+		nextPage := page + 1
+		result.NextPage = &nextPage
+	}
+
+	if page > 1 {
+		previousPage := min(page-1, max(totalPages, 1))
+		result.PreviousPage = &previousPage
+	}
+
+	return result
+}
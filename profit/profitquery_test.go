@@ -0,0 +1,269 @@
+package profitCalc
+
+import (
+	"github.com/level-5-pidgey/MarketMoogle/csv/readertype"
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	"reflect"
+	"testing"
+)
+
+func profitResultIds(results []*ProfitInfo) []int {
+	ids := make([]int, 0, len(results))
+	for _, result := range results {
+		ids = append(ids, result.ItemId)
+	}
+
+	return ids
+}
+
+func TestProfitCalculator_FilterProfits(t *testing.T) {
+	itemMap := map[int]*Item{
+		1: {Id: 1, ItemLevel: 50, UiCategory: 10, Jobs: &[]readertype.Job{readertype.JobMiner}},
+		2: {Id: 2, ItemLevel: 90, UiCategory: 20},
+		3: {Id: 3, ItemLevel: 70, UiCategory: 10},
+	}
+
+	results := []*ProfitInfo{
+		{
+			ItemId:       1,
+			ObtainMethod: &ObtainMethod{Type: ObtainTypeGather},
+			SaleMethod:   &SaleMethod{Value: 500, ValuePer: 500, SaleVelocity: 2},
+		},
+		{
+			ItemId:       2,
+			ObtainMethod: &ObtainMethod{Type: ObtainTypeCraft, JobRequired: readertype.JobCarpenter},
+			SaleMethod:   &SaleMethod{Value: 5000000, ValuePer: 5000000, SaleVelocity: 0.1},
+		},
+		{
+			ItemId:       3,
+			ObtainMethod: &ObtainMethod{Type: ObtainTypeMarket},
+			SaleMethod:   &SaleMethod{Value: 1000, ValuePer: 1000, SaleVelocity: 5},
+		},
+		{
+			// Items the calculator doesn't know about are always dropped
+			ItemId:       4,
+			ObtainMethod: &ObtainMethod{Type: ObtainTypeMarket},
+			SaleMethod:   &SaleMethod{Value: 1000, ValuePer: 1000},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		filter ProfitFilter
+		want   []int
+	}{
+		{
+			name:   "Empty filter keeps every known item, including very expensive ones",
+			filter: ProfitFilter{},
+			want:   []int{1, 2, 3},
+		},
+		{
+			name:   "Minimum profit",
+			filter: ProfitFilter{MinProfit: 1000},
+			want:   []int{2, 3},
+		},
+		{
+			name:   "Minimum velocity",
+			filter: ProfitFilter{MinVelocity: 1},
+			want:   []int{1, 3},
+		},
+		{
+			name:   "Maximum value per item",
+			filter: ProfitFilter{MaxValuePer: 1000000},
+			want:   []int{1, 3},
+		},
+		{
+			name:   "Ui category",
+			filter: ProfitFilter{UiCategory: 10},
+			want:   []int{1, 3},
+		},
+		{
+			name:   "Item level range",
+			filter: ProfitFilter{MinItemLevel: 60, MaxItemLevel: 80},
+			want:   []int{3},
+		},
+		{
+			name:   "Obtain types",
+			filter: ProfitFilter{ObtainTypes: []ObtainType{ObtainTypeCraft, ObtainTypeGather}},
+			want:   []int{1, 2},
+		},
+		{
+			name:   "Job matches the crafter used",
+			filter: ProfitFilter{Job: readertype.JobCarpenter},
+			want:   []int{2},
+		},
+		{
+			name:   "Job matches the jobs that can use the item",
+			filter: ProfitFilter{Job: readertype.JobMiner},
+			want:   []int{1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				p := NewProfitCalculator(&itemMap, nil, nil, db.NewMockRepository(), nil)
+
+				if got := profitResultIds(p.FilterProfits(results, tt.filter)); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("FilterProfits() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestSortProfits(t *testing.T) {
+	newResults := func() []*ProfitInfo {
+		return []*ProfitInfo{
+			{
+				ItemId:       1,
+				ProfitScore:  10,
+				ObtainMethod: &ObtainMethod{},
+				SaleMethod:   &SaleMethod{Value: 300, SaleVelocity: 1},
+			},
+			{
+				ItemId:       2,
+				ProfitScore:  30,
+				ObtainMethod: &ObtainMethod{},
+				SaleMethod:   &SaleMethod{Value: 100, SaleVelocity: 5},
+			},
+			{
+				ItemId:       3,
+				ProfitScore:  20,
+				ObtainMethod: &ObtainMethod{},
+				SaleMethod:   &SaleMethod{Value: 200, SaleVelocity: 0.5},
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		sortKey ProfitSortKey
+		want    []int
+	}{
+		{
+			name:    "Profit score",
+			sortKey: SortByProfitScore,
+			want:    []int{2, 3, 1},
+		},
+		{
+			name:    "Margin",
+			sortKey: SortByMargin,
+			want:    []int{1, 3, 2},
+		},
+		{
+			name:    "Margin per hour",
+			sortKey: SortByMarginPerHour,
+			want:    []int{2, 1, 3},
+		},
+		{
+			name:    "Return on investment of free items follows the margin",
+			sortKey: SortByRoi,
+			want:    []int{1, 3, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				results := newResults()
+				SortProfits(results, tt.sortKey)
+
+				if got := profitResultIds(results); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("SortProfits() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestPaginateProfits(t *testing.T) {
+	results := make([]*ProfitInfo, 0, 30)
+	for i := 1; i <= 30; i++ {
+		results = append(results, &ProfitInfo{ItemId: i})
+	}
+
+	intPtr := func(i int) *int {
+		return &i
+	}
+
+	tests := []struct {
+		name             string
+		results          []*ProfitInfo
+		page             int
+		pageSize         int
+		wantIds          []int
+		wantTotalPages   int
+		wantNextPage     *int
+		wantPreviousPage *int
+	}{
+		{
+			name:           "Fewer results than a page",
+			results:        results[:3],
+			page:           0,
+			pageSize:       0,
+			wantIds:        []int{1, 2, 3},
+			wantTotalPages: 1,
+		},
+		{
+			name:           "No results",
+			results:        []*ProfitInfo{},
+			page:           1,
+			pageSize:       10,
+			wantIds:        []int{},
+			wantTotalPages: 0,
+		},
+		{
+			name:           "First page links to the next",
+			results:        results,
+			page:           1,
+			pageSize:       10,
+			wantIds:        []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+			wantTotalPages: 3,
+			wantNextPage:   intPtr(2),
+		},
+		{
+			name:             "Last partial page",
+			results:          results,
+			page:             2,
+			pageSize:         25,
+			wantIds:          []int{26, 27, 28, 29, 30},
+			wantTotalPages:   2,
+			wantPreviousPage: intPtr(1),
+		},
+		{
+			name:             "Page past the end is empty",
+			results:          results,
+			page:             5,
+			pageSize:         25,
+			wantIds:          []int{},
+			wantTotalPages:   2,
+			wantPreviousPage: intPtr(2),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got := PaginateProfits(tt.results, tt.page, tt.pageSize)
+
+				if ids := profitResultIds(got.Results); !reflect.DeepEqual(ids, tt.wantIds) {
+					t.Errorf("PaginateProfits() results = %v, want %v", ids, tt.wantIds)
+				}
+
+				if got.TotalCount != len(tt.results) {
+					t.Errorf("PaginateProfits() total count = %d, want %d", got.TotalCount, len(tt.results))
+				}
+
+				if got.TotalPages != tt.wantTotalPages {
+					t.Errorf("PaginateProfits() total pages = %d, want %d", got.TotalPages, tt.wantTotalPages)
+				}
+
+				if !reflect.DeepEqual(got.NextPage, tt.wantNextPage) {
+					t.Errorf("PaginateProfits() next page = %v, want %v", got.NextPage, tt.wantNextPage)
+				}
+
+				if !reflect.DeepEqual(got.PreviousPage, tt.wantPreviousPage) {
+					t.Errorf("PaginateProfits() previous page = %v, want %v", got.PreviousPage, tt.wantPreviousPage)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,247 @@
+package profitCalc
+
+import (
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	"sort"
+)
+
+// DefaultWorldTravelCost is how much gil a trip to another world is treated as costing, to account for the time
+const DefaultWorldTravelCost = 2000
+
+// WorldStop
+// Everything to buy while visiting one world
+type WorldStop struct {
+	WorldId  int
+	Listings []ShoppingListing
+	Subtotal int
+}
+
+// PurchaseRoute
+// The worlds to visit, in order, to buy the market listings in a shopping cart
+type PurchaseRoute struct {
+	Stops []WorldStop
+	// Cost of every listing bought
+	ItemCost int
+	// Gil value of the time spent visiting other worlds
+	TravelCost int
+	TotalCost  int
+	// Items (keyed by id) that the visited worlds don't have enough of, and how many are missing
+	Shortfall map[int]int `json:",omitempty"`
+}
+
+// PlanPurchaseRoute
+// Works out which worlds to buy a cart's market listings from. Starting from the home world and every world the cart
+// buys from, worlds are dropped for as long as buying their items elsewhere costs less than travelling there.
+func (p *ProfitCalculator) PlanPurchaseRoute(cart ShoppingCart, player *PlayerInfo, travelCost int) (*PurchaseRoute, error) {
+	required := make(map[int]int)
+	candidateWorlds := map[int]struct{}{player.HomeServer: {}}
+
+	for _, cartItem := range cart.ItemsToBuy {
+		listing, ok := cartItem.(ShoppingListing)
+		if !ok {
+			continue
+		}
+
+		candidateWorlds[listing.worldId] = struct{}{}
+		if quantity, ok := cart.itemsRequired[listing.ItemId]; ok {
+			required[listing.ItemId] = quantity
+		} else {
+			required[listing.ItemId] += listing.Quantity
+		}
+	}
+
+	itemIds := make([]int, 0, len(required))
+	for itemId := range required {
+		itemIds = append(itemIds, itemId)
+	}
+
+	listings := &[]*db.Listing{}
+	if len(itemIds) > 0 {
+		var err error
+		listings, err = p.repository.GetListingsForItemsOnDataCenter(itemIds, player.DataCenter)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return planPurchaseRoute(required, *listings, candidateWorlds, player.HomeServer, travelCost), nil
+}
+
+func planPurchaseRoute(
+	required map[int]int, listings []*db.Listing, candidateWorlds map[int]struct{}, homeWorld, travelCost int,
+) *PurchaseRoute {
+	listingsByItem := make(map[int][]*db.Listing, len(required))
+	for _, listing := range listings {
+		if _, ok := candidateWorlds[listing.WorldId]; !ok {
+			continue
+		}
+
+		if _, ok := required[listing.ItemId]; ok {
+			listingsByItem[listing.ItemId] = append(listingsByItem[listing.ItemId], listing)
+		}
+	}
+
+	for _, itemListings := range listingsByItem {
+		sort.Slice(
+			itemListings, func(i, j int) bool {
+				if itemListings[i].PricePer == itemListings[j].PricePer {
+					return itemListings[i].Id < itemListings[j].Id
+				}
+
+				return itemListings[i].PricePer < itemListings[j].PricePer
+			},
+		)
+	}
+
+	visiting := make(map[int]struct{}, len(candidateWorlds))
+	for worldId := range candidateWorlds {
+		visiting[worldId] = struct{}{}
+	}
+
+	route := buyFromWorlds(required, listingsByItem, visiting, homeWorld, travelCost)
+
+	// Keep dropping whichever world saves the most until none are worth dropping
+	for {
+		var bestRoute *PurchaseRoute
+		bestWorld := 0
+
+		// Worlds are checked in order so ties are always broken the same way
+		worldIds := make([]int, 0, len(visiting))
+		for worldId := range visiting {
+			worldIds = append(worldIds, worldId)
+		}
+
+		sort.Ints(worldIds)
+
+		for _, worldId := range worldIds {
+			if worldId == homeWorld {
+				continue
+			}
+
+			delete(visiting, worldId)
+			candidate := buyFromWorlds(required, listingsByItem, visiting, homeWorld, travelCost)
+			visiting[worldId] = struct{}{}
+
+			if !isBetterRoute(candidate, route) || (bestRoute != nil && !isBetterRoute(candidate, bestRoute)) {
+				continue
+			}
+
+			bestRoute = candidate
+			bestWorld = worldId
+		}
+
+		if bestRoute == nil {
+			break
+		}
+
+		delete(visiting, bestWorld)
+		route = bestRoute
+	}
+
+	return route
+}
+
+// isBetterRoute
+// Routes that buy more of what's needed always win, otherwise the cheapest route does
+func isBetterRoute(route, other *PurchaseRoute) bool {
+	routeMissing, otherMissing := 0, 0
+	for _, missing := range route.Shortfall {
+		routeMissing += missing
+	}
+
+	for _, missing := range other.Shortfall {
+		otherMissing += missing
+	}
+
+	if routeMissing != otherMissing {
+		return routeMissing < otherMissing
+	}
+
+	return route.TotalCost < other.TotalCost
+}
+
+// buyFromWorlds
+// Buys the cheapest combination of listings of each item from the given worlds
+func buyFromWorlds(
+	required map[int]int,
+	listingsByItem map[int][]*db.Listing,
+	worlds map[int]struct{},
+	homeWorld, travelCost int,
+) *PurchaseRoute {
+	route := &PurchaseRoute{Stops: []WorldStop{}}
+	stopsByWorld := make(map[int]*WorldStop)
+
+	for itemId, quantity := range required {
+		worldListings := make([]*db.Listing, 0, len(listingsByItem[itemId]))
+		for _, listing := range listingsByItem[itemId] {
+			if _, ok := worlds[listing.WorldId]; ok {
+				worldListings = append(worldListings, listing)
+			}
+		}
+
+		for _, listing := range cheapestListingCombination(worldListings, quantity, homeWorld) {
+			stop, ok := stopsByWorld[listing.WorldId]
+			if !ok {
+				stop = &WorldStop{WorldId: listing.WorldId}
+				stopsByWorld[listing.WorldId] = stop
+			}
+
+			stop.Listings = append(
+				stop.Listings, ShoppingListing{
+					ItemId:        listing.ItemId,
+					Quantity:      listing.Quantity,
+					RetainerName:  listing.RetainerName,
+					listingId:     listing.Id,
+					worldId:       listing.WorldId,
+					CostPer:       listing.PricePer,
+					Tax:           listing.Tax,
+					IsHighQuality: listing.IsHighQuality,
+				},
+			)
+			stop.Subtotal += listingCost(listing)
+			quantity -= listing.Quantity
+		}
+
+		if quantity > 0 {
+			if route.Shortfall == nil {
+				route.Shortfall = make(map[int]int)
+			}
+
+			route.Shortfall[itemId] = quantity
+		}
+	}
+
+	for worldId, stop := range stopsByWorld {
+		sort.Slice(
+			stop.Listings, func(i, j int) bool {
+				return stop.Listings[i].GetHash() < stop.Listings[j].GetHash()
+			},
+		)
+
+		route.Stops = append(route.Stops, *stop)
+		route.ItemCost += stop.Subtotal
+
+		if worldId != homeWorld {
+			route.TravelCost += travelCost
+		}
+	}
+
+	// Start on the home world, then visit the worlds with the most to buy first
+	sort.Slice(
+		route.Stops, func(i, j int) bool {
+			if (route.Stops[i].WorldId == homeWorld) != (route.Stops[j].WorldId == homeWorld) {
+				return route.Stops[i].WorldId == homeWorld
+			}
+
+			if route.Stops[i].Subtotal == route.Stops[j].Subtotal {
+				return route.Stops[i].WorldId < route.Stops[j].WorldId
+			}
+
+			return route.Stops[i].Subtotal > route.Stops[j].Subtotal
+		},
+	)
+
+	route.TotalCost = route.ItemCost + route.TravelCost
+
+	return route
+}
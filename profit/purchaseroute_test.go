@@ -0,0 +1,116 @@
+package profitCalc
+
+import (
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	"reflect"
+	"testing"
+)
+
+func TestProfitCalculator_PlanPurchaseRoute(t *testing.T) {
+	listings := []db.Listing{
+		// A few gil cheaper on world 2 than at home
+		{Id: 1, ItemId: 5, WorldId: 1, PricePer: 110, Quantity: 3, Total: 330},
+		{Id: 2, ItemId: 5, WorldId: 2, PricePer: 100, Quantity: 3, Total: 300},
+		// Only listed on world 3
+		{Id: 3, ItemId: 6, WorldId: 3, PricePer: 500, Quantity: 1, Total: 500},
+		// Far cheaper on world 4 than at home
+		{Id: 4, ItemId: 7, WorldId: 1, PricePer: 5000, Quantity: 2, Total: 10000},
+		{Id: 5, ItemId: 7, WorldId: 4, PricePer: 1000, Quantity: 2, Total: 2000},
+		// Not part of the cart's worlds, so never visited
+		{Id: 6, ItemId: 7, WorldId: 5, PricePer: 1, Quantity: 2, Total: 2},
+	}
+
+	repo := db.NewMockRepository()
+	for _, listing := range listings {
+		if _, err := repo.CreateListing(listing); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	itemMap := map[int]*Item{}
+	p := NewProfitCalculator(&itemMap, nil, nil, repo, nil)
+	player := &PlayerInfo{HomeServer: 1, DataCenter: 1}
+
+	cart := ShoppingCart{
+		ItemsToBuy: []ShoppingItem{
+			ShoppingListing{ItemId: 5, Quantity: 3, listingId: 2, worldId: 2, CostPer: 100},
+			ShoppingListing{ItemId: 6, Quantity: 1, listingId: 3, worldId: 3, CostPer: 500},
+			ShoppingListing{ItemId: 7, Quantity: 2, listingId: 5, worldId: 4, CostPer: 1000},
+			LocalItem{ItemId: 8, Quantity: 1, ObtainedFrom: "Buy from NPC", CostPer: 50},
+		},
+		itemsRequired: map[int]int{5: 3, 6: 1, 7: 2, 8: 1},
+	}
+
+	tests := []struct {
+		name       string
+		travelCost int
+		want       *PurchaseRoute
+	}{
+		{
+			name:       "Small savings aren't worth the trip",
+			travelCost: DefaultWorldTravelCost,
+			want: &PurchaseRoute{
+				Stops: []WorldStop{
+					{
+						WorldId:  1,
+						Listings: []ShoppingListing{{ItemId: 5, Quantity: 3, listingId: 1, worldId: 1, CostPer: 110}},
+						Subtotal: 330,
+					},
+					{
+						WorldId:  4,
+						Listings: []ShoppingListing{{ItemId: 7, Quantity: 2, listingId: 5, worldId: 4, CostPer: 1000}},
+						Subtotal: 2000,
+					},
+					{
+						WorldId:  3,
+						Listings: []ShoppingListing{{ItemId: 6, Quantity: 1, listingId: 3, worldId: 3, CostPer: 500}},
+						Subtotal: 500,
+					},
+				},
+				ItemCost:   2830,
+				TravelCost: 4000,
+				TotalCost:  6830,
+			},
+		},
+		{
+			name:       "Free travel buys everything at the cheapest price",
+			travelCost: 0,
+			want: &PurchaseRoute{
+				Stops: []WorldStop{
+					{
+						WorldId:  4,
+						Listings: []ShoppingListing{{ItemId: 7, Quantity: 2, listingId: 5, worldId: 4, CostPer: 1000}},
+						Subtotal: 2000,
+					},
+					{
+						WorldId:  3,
+						Listings: []ShoppingListing{{ItemId: 6, Quantity: 1, listingId: 3, worldId: 3, CostPer: 500}},
+						Subtotal: 500,
+					},
+					{
+						WorldId:  2,
+						Listings: []ShoppingListing{{ItemId: 5, Quantity: 3, listingId: 2, worldId: 2, CostPer: 100}},
+						Subtotal: 300,
+					},
+				},
+				ItemCost:   2800,
+				TravelCost: 0,
+				TotalCost:  2800,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, err := p.PlanPurchaseRoute(cart, player, tt.travelCost)
+				if err != nil {
+					t.Fatalf("PlanPurchaseRoute() error = %v", err)
+				}
+
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("PlanPurchaseRoute() = %+v, want %+v", got, tt.want)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,63 @@
+package profitCalc
+
+import "github.com/level-5-pidgey/MarketMoogle/db"
+
+type ItemQuality int
+
+const (
+	AnyQuality ItemQuality = iota
+	NormalQuality
+	HighQuality
+)
+
+// hqCraftEffort is the extra effort of making sure a craft comes out high quality
+const hqCraftEffort = 1.1
+
+func (q ItemQuality) String() string {
+	return [...]string{
+		"Any",
+		"Normal",
+		"High",
+	}[q]
+}
+
+func (q ItemQuality) matches(isHighQuality bool) bool {
+	switch q {
+	case NormalQuality:
+		return !isHighQuality
+	case HighQuality:
+		return isHighQuality
+	default:
+		return true
+	}
+}
+
+func filterListingsByQuality(listings *[]*db.Listing, quality ItemQuality) *[]*db.Listing {
+	if listings == nil || quality == AnyQuality {
+		return listings
+	}
+
+	result := make([]*db.Listing, 0, len(*listings))
+	for _, listing := range *listings {
+		if quality.matches(listing.IsHighQuality) {
+			result = append(result, listing)
+		}
+	}
+
+	return &result
+}
+
+func filterRollupsByQuality(rollups *[]*db.SaleRollup, quality ItemQuality) *[]*db.SaleRollup {
+	if rollups == nil || quality == AnyQuality {
+		return rollups
+	}
+
+	result := make([]*db.SaleRollup, 0, len(*rollups))
+	for _, rollup := range *rollups {
+		if quality.matches(rollup.IsHighQuality) {
+			result = append(result, rollup)
+		}
+	}
+
+	return &result
+}
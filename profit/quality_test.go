@@ -0,0 +1,130 @@
+package profitCalc
+
+import (
+	"github.com/level-5-pidgey/MarketMoogle/csv/readertype"
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	"github.com/level-5-pidgey/MarketMoogle/profit/exchange"
+	"testing"
+)
+
+func TestProfitCalculator_getCheapestObtainMethodForQuality(t *testing.T) {
+	item := &Item{
+		Id:      1,
+		CanBeHq: true,
+		ObtainMethods: &[]exchange.Method{
+			exchange.NewGilExchange(150, "NPC", ""),
+		},
+	}
+
+	listings := &[]*db.Listing{
+		{Id: 1, ItemId: 1, WorldId: 1, PricePer: 100, Quantity: 1, Total: 100, IsHighQuality: false},
+		{Id: 2, ItemId: 1, WorldId: 1, PricePer: 400, Quantity: 1, Total: 400, IsHighQuality: true},
+	}
+
+	tests := []struct {
+		name        string
+		quality     ItemQuality
+		wantMethod  string
+		wantCostPer int
+	}{
+		{
+			name:        "Normal quality buys the cheap normal quality listing",
+			quality:     NormalQuality,
+			wantMethod:  "Market",
+			wantCostPer: 100,
+		},
+		{
+			name:        "High quality only buys high quality listings, skipping the vendor",
+			quality:     HighQuality,
+			wantMethod:  "Market",
+			wantCostPer: 400,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				itemMap := map[int]*Item{item.Id: item}
+				p := NewProfitCalculator(&itemMap, nil, nil, db.NewMockRepository(), nil)
+
+				got, _ := p.getCheapestObtainMethodForQuality(
+					item,
+					1,
+					listings,
+					&PlayerInfo{HomeServer: 1, DataCenter: 1},
+					tt.quality,
+				)
+				if got == nil {
+					t.Fatalf("getCheapestObtainMethodForQuality() = nil, want %s", tt.wantMethod)
+				}
+
+				if got.ObtainMethod != tt.wantMethod || got.GetCostPerItem() != tt.wantCostPer {
+					t.Errorf(
+						"getCheapestObtainMethodForQuality() = %s at %d, want %s at %d",
+						got.ObtainMethod,
+						got.GetCostPerItem(),
+						tt.wantMethod,
+						tt.wantCostPer,
+					)
+				}
+			},
+		)
+	}
+}
+
+func TestProfitCalculator_CalculateProfitForItem_Quality(t *testing.T) {
+	ingredient := &Item{
+		Id:               2,
+		MarketProhibited: true,
+		ObtainMethods: &[]exchange.Method{
+			exchange.NewGilExchange(50, "NPC", ""),
+		},
+	}
+
+	item := &Item{
+		Id:      1,
+		CanBeHq: true,
+		CraftingRecipes: &[]RecipeInfo{
+			{
+				Yield:             1,
+				JobRequired:       readertype.JobCarpenter,
+				RecipeLevel:       90,
+				RecipeIngredients: []RecipeIngredients{{ItemId: 2, Quantity: 1}},
+			},
+		},
+	}
+
+	repo := db.NewMockRepository()
+	for _, listing := range []db.Listing{
+		{Id: 1, ItemId: 1, WorldId: 1, PricePer: 100, Quantity: 1, Total: 100, Tax: 5, IsHighQuality: false},
+		{Id: 2, ItemId: 1, WorldId: 1, PricePer: 300, Quantity: 1, Total: 300, Tax: 15, IsHighQuality: true},
+	} {
+		_, err := repo.CreateListing(listing)
+		if err != nil {
+			t.Fatalf("Error creating mock listing: %v", err)
+		}
+	}
+
+	itemMap := map[int]*Item{item.Id: item, ingredient.Id: ingredient}
+	p := NewProfitCalculator(&itemMap, nil, nil, repo, nil)
+
+	got, err := p.CalculateProfitForItem(item, NewDefaultPlayerInfo(1, 1))
+	if err != nil {
+		t.Fatalf("CalculateProfitForItem() error = %v", err)
+	}
+
+	if got.NormalQuality == nil || got.HighQuality == nil {
+		t.Fatalf("CalculateProfitForItem() = %v, want both normal and high quality outcomes", got)
+	}
+
+	if got.NormalQuality.SaleMethod.ValuePer != 99 {
+		t.Errorf("normal quality ValuePer = %d, want 99", got.NormalQuality.SaleMethod.ValuePer)
+	}
+
+	if got.HighQuality.SaleMethod.ValuePer != 299 {
+		t.Errorf("high quality ValuePer = %d, want 299", got.HighQuality.SaleMethod.ValuePer)
+	}
+
+	if !got.IsHighQuality || got.SaleMethod != got.HighQuality.SaleMethod {
+		t.Errorf("CalculateProfitForItem() IsHighQuality = %v, want the high quality outcome", got.IsHighQuality)
+	}
+}
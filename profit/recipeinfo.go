@@ -16,6 +16,8 @@ type RecipeInfo struct {
 	SecretRecipeBook       string
 	Craftsmanship          int
 	Control                int
+	SuggestedCraftsmanship int
+	SuggestedControl       int
 	Difficulty             int
 	Durability             int
 	Quality                int
@@ -46,6 +48,8 @@ func getRecipes(item *readertype.Item, collection *datacollection.DataCollection
 		difficulty := 100
 		durability := 60
 		quality := 0
+		suggestedCraftsmanship := 0
+		suggestedControl := 0
 		craftType := ""
 		job := readertype.JobNone
 
@@ -54,6 +58,8 @@ func getRecipes(item *readertype.Item, collection *datacollection.DataCollection
 			difficulty = level.Difficulty
 			durability = level.Durability
 			quality = level.Quality
+			suggestedCraftsmanship = level.SuggestedCraftsmanship
+			suggestedControl = level.SuggestedControl
 		}
 
 		if recipeBook, ok := recipeBooks[recipe.SecretRecipeBookId]; ok {
@@ -76,6 +82,8 @@ func getRecipes(item *readertype.Item, collection *datacollection.DataCollection
 			SecretRecipeBook:       recipeBookRequired,
 			Craftsmanship:          recipe.RequiredCraftsmanship,
 			Control:                recipe.RequiredControl,
+			SuggestedCraftsmanship: suggestedCraftsmanship,
+			SuggestedControl:       suggestedControl,
 			Difficulty:             difficulty,
 			Durability:             durability,
 			Quality:                quality,
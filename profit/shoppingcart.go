@@ -14,14 +14,21 @@ type ShoppingListing struct {
 	listingId    int
 	worldId      int
 	CostPer      int
+	// Sales tax paid on top of the listing's price
+	Tax           int  `json:",omitempty"`
+	IsHighQuality bool `json:",omitempty"`
 }
 
 func (s ShoppingListing) GetTotalCost() int {
-	return s.CostPer * s.Quantity
+	return s.CostPer*s.Quantity + s.Tax
 }
 
 func (s ShoppingListing) GetCostPer() int {
-	return s.CostPer
+	if s.Quantity == 0 {
+		return s.CostPer
+	}
+
+	return s.GetTotalCost() / s.Quantity
 }
 
 func (s ShoppingListing) GetItemId() int {
@@ -0,0 +1,98 @@
+package profitCalc
+
+import (
+	"github.com/level-5-pidgey/MarketMoogle/csv/readertype"
+	"sort"
+	"time"
+)
+
+// ItemUsage
+// A product that can be crafted using an item, with how profitable the product currently is
+type ItemUsage struct {
+	ProductId   int
+	JobRequired readertype.Job
+	RecipeLevel int
+	// How many of the item the recipe needs
+	Quantity int
+	// How many products the recipe makes
+	Yield int
+	// Nil when the product can't currently be obtained or sold
+	Profit *ProfitInfo
+}
+
+type ItemUsageList struct {
+	ItemId int
+	Usages []*ItemUsage
+	// When the product profits were calculated
+	ComputedAt time.Time `json:"computed_at"`
+}
+
+// GetItemUsages
+// Lists every product crafted directly from the item, using profits already calculated for the products (keyed by
+// product id). Products are ordered from most to least profitable.
+func (p *ProfitCalculator) GetItemUsages(itemId int, profits map[int]*ProfitInfo) []*ItemUsage {
+	usages := p.Ingredients.UsedIn(itemId)
+	result := make([]*ItemUsage, 0, len(usages))
+
+	for _, usage := range usages {
+		result = append(
+			result, &ItemUsage{
+				ProductId:   usage.ProductId,
+				JobRequired: usage.Recipe.JobRequired,
+				RecipeLevel: usage.Recipe.RecipeLevel,
+				Quantity:    usage.Quantity,
+				Yield:       usage.Recipe.Yield,
+				Profit:      profits[usage.ProductId],
+			},
+		)
+	}
+
+	sort.SliceStable(
+		result, func(i, j int) bool {
+			if result[i].Profit == nil || result[j].Profit == nil {
+				return result[j].Profit == nil && result[i].Profit != nil
+			}
+
+			return result[i].Profit.ProfitScore > result[j].Profit.ProfitScore
+		},
+	)
+
+	return result
+}
+
+// GetUsageProducts
+// Returns every item that can be crafted directly from the given item, without duplicates
+func (p *ProfitCalculator) GetUsageProducts(itemId int) []*Item {
+	usages := p.Ingredients.UsedIn(itemId)
+	seen := make(map[int]struct{}, len(usages))
+	result := make([]*Item, 0, len(usages))
+
+	for _, usage := range usages {
+		if _, ok := seen[usage.ProductId]; ok {
+			continue
+		}
+
+		seen[usage.ProductId] = struct{}{}
+		if item, ok := (*p.Items)[usage.ProductId]; ok {
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
+
+// GetProfits
+// Returns the world's latest profits keyed by item id, along with the snapshot they came from
+func (l *ProfitLeaderboard) GetProfits(worldId int) (map[int]*ProfitInfo, *ProfitSnapshot, bool) {
+	snapshot, ok := l.GetSnapshot(worldId)
+	if !ok {
+		return nil, nil, false
+	}
+
+	profits := make(map[int]*ProfitInfo, len(snapshot.Results))
+	for _, result := range snapshot.Results {
+		profits[result.ItemId] = result
+	}
+
+	return profits, snapshot, true
+}
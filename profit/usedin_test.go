@@ -0,0 +1,73 @@
+package profitCalc
+
+import (
+	"github.com/level-5-pidgey/MarketMoogle/csv/readertype"
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	"reflect"
+	"testing"
+)
+
+func TestProfitCalculator_GetItemUsages(t *testing.T) {
+	itemMap := map[int]*Item{
+		1: {Id: 1},
+		2: {
+			Id: 2,
+			CraftingRecipes: &[]RecipeInfo{
+				{
+					Yield:             1,
+					JobRequired:       readertype.JobCarpenter,
+					RecipeLevel:       10,
+					RecipeIngredients: []RecipeIngredients{{ItemId: 1, Quantity: 3}},
+				},
+			},
+		},
+		3: {
+			Id: 3,
+			CraftingRecipes: &[]RecipeInfo{
+				{
+					Yield:             3,
+					JobRequired:       readertype.JobAlchemist,
+					RecipeLevel:       50,
+					RecipeIngredients: []RecipeIngredients{{ItemId: 1, Quantity: 1}},
+				},
+			},
+		},
+		4: {
+			Id: 4,
+			CraftingRecipes: &[]RecipeInfo{
+				{
+					Yield:             1,
+					JobRequired:       readertype.JobWeaver,
+					RecipeLevel:       90,
+					RecipeIngredients: []RecipeIngredients{{ItemId: 1, Quantity: 2}},
+				},
+			},
+		},
+	}
+
+	p := NewProfitCalculator(&itemMap, nil, nil, db.NewMockRepository(), nil)
+	profits := map[int]*ProfitInfo{
+		2: {ItemId: 2, ProfitScore: 10},
+		3: {ItemId: 3, ProfitScore: 50},
+	}
+
+	got := p.GetItemUsages(1, profits)
+	want := []*ItemUsage{
+		{ProductId: 3, JobRequired: readertype.JobAlchemist, RecipeLevel: 50, Quantity: 1, Yield: 3, Profit: profits[3]},
+		{ProductId: 2, JobRequired: readertype.JobCarpenter, RecipeLevel: 10, Quantity: 3, Yield: 1, Profit: profits[2]},
+		// Products without a profit go last
+		{ProductId: 4, JobRequired: readertype.JobWeaver, RecipeLevel: 90, Quantity: 2, Yield: 1},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetItemUsages() = %v, want %v", got, want)
+	}
+
+	if products := p.GetUsageProducts(1); len(products) != 3 {
+		t.Errorf("GetUsageProducts() returned %d products, want 3", len(products))
+	}
+
+	if usages := p.GetItemUsages(4, profits); len(usages) != 0 {
+		t.Errorf("GetItemUsages() = %v for an item that isn't used in anything", usages)
+	}
+}
@@ -0,0 +1,180 @@
+package profitCalc
+
+import (
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	"math"
+	"slices"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+// VelocityConfig
+// How sale velocity is estimated from an item's sale history
+type VelocityConfig struct {
+	// Lengths of the windows (in days, counting today) velocity is measured over. The shortest window with enough
+	// sales is used, as it's the most up to date.
+	WindowDays []int
+	// How many sales a window needs before it's trusted over longer windows
+	MinSales int
+	// Days selling more than this many times a typical day are capped, so a single burst of sales doesn't make an
+	// item look like it moves fast
+	BurstFactor float64
+}
+
+// DefaultVelocityConfig measures velocity over the last week, falling back to the last month for slow sellers
+var DefaultVelocityConfig = VelocityConfig{
+	WindowDays:  []int{7, 30},
+	MinSales:    10,
+	BurstFactor: 3,
+}
+
+// maxWindowDays
+// The longest window, which is how much sale history the estimate needs
+func (c VelocityConfig) maxWindowDays() int {
+	longest := 1
+	for _, days := range c.WindowDays {
+		longest = max(longest, days)
+	}
+
+	return longest
+}
+
+// historyStart
+// The start of the oldest day any window covers
+func (c VelocityConfig) historyStart(now time.Time) time.Time {
+	return now.UTC().Truncate(day).AddDate(0, 0, 1-c.maxWindowDays())
+}
+
+// WindowVelocity
+// How fast an item sold within one window
+type WindowVelocity struct {
+	Days        int
+	UnitsPerDay float64
+	SalesPerDay float64
+	// Sales made within the window, before any bursts were capped
+	SaleCount int
+}
+
+// SaleVelocity
+// How fast an item sells, taken from the shortest window with enough sales to go on
+type SaleVelocity struct {
+	UnitsPerDay float64
+	SalesPerDay float64
+	// How much the estimate can be trusted, from 0 to 1, based on how many sales it's from
+	Confidence float64
+	// The window the estimate is from
+	WindowDays int
+	Windows    []WindowVelocity
+}
+
+// SalesPerHour
+// The estimated number of sales made each hour
+func (v *SaleVelocity) SalesPerHour() float64 {
+	if v == nil {
+		return 0
+	}
+
+	return v.SalesPerDay / 24
+}
+
+// EstimateSaleVelocity
+// Estimates how fast an item sells from its sale rollups. Each window is the average of its days, with any day far
+// busier than a typical day capped first.
+func EstimateSaleVelocity(rollups []*db.SaleRollup, now time.Time, config VelocityConfig) *SaleVelocity {
+	today := now.UTC().Truncate(day)
+
+	// Units and sales made on each day, keyed by how many days ago it was
+	unitsByDay := make(map[int]int)
+	salesByDay := make(map[int]int)
+	for _, rollup := range rollups {
+		daysAgo := int(today.Sub(rollup.BucketStart.UTC().Truncate(day)) / day)
+		if daysAgo < 0 {
+			continue
+		}
+
+		unitsByDay[daysAgo] += rollup.Quantity
+		salesByDay[daysAgo] += rollup.SaleCount
+	}
+
+	windowDays := slices.Clone(config.WindowDays)
+	slices.Sort(windowDays)
+
+	velocity := &SaleVelocity{Windows: make([]WindowVelocity, 0, len(windowDays))}
+	for _, days := range windowDays {
+		if days < 1 {
+			continue
+		}
+
+		units := make([]int, days)
+		sales := make([]int, days)
+		saleCount := 0
+		for daysAgo := 0; daysAgo < days; daysAgo++ {
+			units[daysAgo] = unitsByDay[daysAgo]
+			sales[daysAgo] = salesByDay[daysAgo]
+			saleCount += sales[daysAgo]
+		}
+
+		// Today is only partly over, so the window is a little shorter than its number of days
+		elapsedDays := math.Max(float64(days-1)+now.UTC().Sub(today).Hours()/24, 1.0/24)
+
+		velocity.Windows = append(
+			velocity.Windows, WindowVelocity{
+				Days:        days,
+				UnitsPerDay: cappedSum(units, config.BurstFactor) / elapsedDays,
+				SalesPerDay: cappedSum(sales, config.BurstFactor) / elapsedDays,
+				SaleCount:   saleCount,
+			},
+		)
+	}
+
+	if len(velocity.Windows) == 0 {
+		return velocity
+	}
+
+	chosen := velocity.Windows[len(velocity.Windows)-1]
+	for _, window := range velocity.Windows {
+		if window.SaleCount >= config.MinSales {
+			chosen = window
+			break
+		}
+	}
+
+	velocity.UnitsPerDay = chosen.UnitsPerDay
+	velocity.SalesPerDay = chosen.SalesPerDay
+	velocity.WindowDays = chosen.Days
+	velocity.Confidence = 1 - math.Exp(-float64(chosen.SaleCount)/float64(max(config.MinSales, 1)))
+
+	return velocity
+}
+
+// cappedSum
+// Adds up daily values, capping each day at burstFactor times the median of the days with any sales. At least 3 days
+// with sales are needed to tell a burst apart from normal trading, so fewer aren't capped.
+func cappedSum(values []int, burstFactor float64) float64 {
+	active := make([]int, 0, len(values))
+	for _, value := range values {
+		if value > 0 {
+			active = append(active, value)
+		}
+	}
+
+	limit := math.Inf(1)
+	if len(active) >= 3 && burstFactor > 0 {
+		slices.Sort(active)
+
+		median := float64(active[len(active)/2])
+		if len(active)%2 == 0 {
+			median = float64(active[len(active)/2-1]+active[len(active)/2]) / 2
+		}
+
+		limit = median * burstFactor
+	}
+
+	total := 0.0
+	for _, value := range values {
+		total += math.Min(float64(value), limit)
+	}
+
+	return total
+}
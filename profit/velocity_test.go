@@ -0,0 +1,102 @@
+package profitCalc
+
+import (
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEstimateSaleVelocity(t *testing.T) {
+	// Midnight, so the week window is exactly the 6 days before today
+	now := time.Date(2024, time.March, 10, 0, 0, 0, 0, time.UTC)
+
+	dailyRollups := func(sales, units []int) []*db.SaleRollup {
+		rollups := make([]*db.SaleRollup, 0, len(sales))
+		for index := range sales {
+			rollups = append(
+				rollups, &db.SaleRollup{
+					BucketStart: now.AddDate(0, 0, -(index + 1)),
+					SaleCount:   sales[index],
+					Quantity:    units[index],
+				},
+			)
+		}
+
+		return rollups
+	}
+
+	tests := []struct {
+		name            string
+		rollups         []*db.SaleRollup
+		wantUnitsPerDay float64
+		wantSalesPerDay float64
+		wantWindowDays  int
+		wantConfidence  float64
+	}{
+		{
+			name:            "Steady seller uses the week window",
+			rollups:         dailyRollups([]int{2, 2, 2, 2, 2, 2}, []int{6, 6, 6, 6, 6, 6}),
+			wantUnitsPerDay: 6,
+			wantSalesPerDay: 2,
+			wantWindowDays:  7,
+			wantConfidence:  1 - math.Exp(-1.2),
+		},
+		{
+			name:            "A single burst is capped at a few times a typical day",
+			rollups:         dailyRollups([]int{1, 1, 1, 1, 1, 40}, []int{1, 1, 1, 1, 1, 40}),
+			wantUnitsPerDay: 8.0 / 6,
+			wantSalesPerDay: 8.0 / 6,
+			wantWindowDays:  7,
+			wantConfidence:  1 - math.Exp(-4.5),
+		},
+		{
+			name: "Slow seller falls back to the month window",
+			rollups: []*db.SaleRollup{
+				{BucketStart: now.AddDate(0, 0, -20), SaleCount: 1, Quantity: 5},
+			},
+			wantUnitsPerDay: 5.0 / 29,
+			wantSalesPerDay: 1.0 / 29,
+			wantWindowDays:  30,
+			wantConfidence:  1 - math.Exp(-0.1),
+		},
+		{
+			name:           "No sales has no velocity or confidence",
+			rollups:        nil,
+			wantWindowDays: 30,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got := EstimateSaleVelocity(tt.rollups, now, DefaultVelocityConfig)
+
+				if !closeTo(got.UnitsPerDay, tt.wantUnitsPerDay) || !closeTo(got.SalesPerDay, tt.wantSalesPerDay) {
+					t.Errorf(
+						"EstimateSaleVelocity() = %v units and %v sales per day, want %v and %v",
+						got.UnitsPerDay,
+						got.SalesPerDay,
+						tt.wantUnitsPerDay,
+						tt.wantSalesPerDay,
+					)
+				}
+
+				if got.WindowDays != tt.wantWindowDays {
+					t.Errorf("EstimateSaleVelocity() window = %d days, want %d", got.WindowDays, tt.wantWindowDays)
+				}
+
+				if !closeTo(got.Confidence, tt.wantConfidence) {
+					t.Errorf("EstimateSaleVelocity() confidence = %v, want %v", got.Confidence, tt.wantConfidence)
+				}
+
+				if len(got.Windows) != len(DefaultVelocityConfig.WindowDays) {
+					t.Errorf("EstimateSaleVelocity() has %d windows, want %d", len(got.Windows), len(DefaultVelocityConfig.WindowDays))
+				}
+			},
+		)
+	}
+}
+
+func closeTo(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
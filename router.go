@@ -4,9 +4,12 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
+	"github.com/level-5-pidgey/MarketMoogle/api/universalis"
 	dc "github.com/level-5-pidgey/MarketMoogle/csv/datacollection"
 	"github.com/level-5-pidgey/MarketMoogle/csv/readertype"
+	"github.com/level-5-pidgey/MarketMoogle/db"
 	profitCalc "github.com/level-5-pidgey/MarketMoogle/profit"
+	"github.com/level-5-pidgey/MarketMoogle/stream"
 	"net/http"
 )
 
@@ -14,18 +17,24 @@ func Routes(
 	collection *dc.DataCollection,
 	worlds *map[int]*readertype.World,
 	profitCalc *profitCalc.ProfitCalculator,
+	repository db.Repository,
+	leaderboard *profitCalc.ProfitLeaderboard,
+	alerts *profitCalc.AlertMonitor,
+	marketStream *stream.Hub,
+	marketFeeds *universalis.WebsocketPool,
 ) http.Handler {
 	router := chi.NewRouter()
 	router.Use(middleware.Recoverer)
+	// Credentials aren't allowed, as nothing's authenticated with cookies and other sites mustn't be able to write on a
+	// visitor's behalf
 	router.Use(
 		cors.Handler(
 			cors.Options{
-				AllowedOrigins:   []string{"https://*", "http://*"},
-				AllowedMethods:   []string{"GET"},
-				AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-				ExposedHeaders:   []string{"Link"},
-				AllowCredentials: true,
-				MaxAge:           300, // Maximum value not ignored by any of major browsers
+				AllowedOrigins: []string{"https://*", "http://*"},
+				AllowedMethods: []string{"GET", "POST", "PUT", "DELETE"},
+				AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+				ExposedHeaders: []string{"Link"},
+				MaxAge:         300, // Maximum value not ignored by any of major browsers
 			},
 		),
 	)
@@ -35,15 +44,45 @@ func Routes(
 		dataCollection: collection,
 		worlds:         worlds,
 		profitCalc:     profitCalc,
+		repository:     repository,
+		leaderboard:    leaderboard,
+		alerts:         alerts,
+		marketStream:   marketStream,
+		marketFeeds:    marketFeeds,
+		onDemandSlots:  make(chan struct{}, maxOnDemandCalculations),
 	}
 
 	// Item Routes
 	router.Get("/api/v1/server/{worldId}/items/{itemId}/profit", controller.GetItemProfit)
+	router.Get("/api/v1/server/{worldId}/items/{itemId}/used-in", controller.GetItemUsedIn)
+	router.Get("/api/v1/server/{worldId}/items/{itemId}/history", controller.GetItemHistory)
 	router.Get("/api/v1/server/{worldId}/items/profit", controller.GetAllItemProfit)
+	router.Post("/api/v1/server/{worldId}/crafting-plan", controller.PlanCrafts)
+	router.Post("/api/v1/server/{worldId}/purchase-route", controller.PlanPurchaseRoute)
 
 	// Currency
 	router.Get("/api/v1/server/{worldId}/currency/{currency}/value", controller.GetGilValueOfCurrency)
 	router.Get("/api/v1/server/{worldId}/currency/{currency}/best-sell", controller.GetBestItemToSellForCurrency)
 
+	// Player Profiles
+	router.Get("/api/v1/profiles", controller.GetPlayerProfiles)
+	router.Post("/api/v1/profiles", controller.CreatePlayerProfile)
+	router.Get("/api/v1/profiles/{profileId}", controller.GetPlayerProfile)
+	router.Put("/api/v1/profiles/{profileId}", controller.UpdatePlayerProfile)
+	router.Delete("/api/v1/profiles/{profileId}", controller.DeletePlayerProfile)
+
+	// Price Alerts
+	router.Get("/api/v1/alerts", controller.GetPriceAlerts)
+	router.Post("/api/v1/alerts", controller.CreatePriceAlert)
+	router.Get("/api/v1/alerts/{alertId}", controller.GetPriceAlert)
+	router.Put("/api/v1/alerts/{alertId}", controller.UpdatePriceAlert)
+	router.Delete("/api/v1/alerts/{alertId}", controller.DeletePriceAlert)
+	router.Get("/api/v1/alerts/{alertId}/deliveries", controller.GetAlertDeliveries)
+
+	// Live Market Changes
+	router.Get("/api/v1/stream", controller.StreamMarketEvents)
+	router.Get("/api/v1/stream/ws", controller.StreamMarketEventsWebsocket)
+	router.Get("/api/v1/status/market-feed", controller.GetMarketFeedStatus)
+
 	return router
 }
@@ -0,0 +1,202 @@
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/level-5-pidgey/MarketMoogle/util"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	writeWait = 8 * time.Second
+
+	pongWait = 60 * time.Second
+
+	pingPeriod = (pongWait * 6) / 10
+
+	// How often SSE clients are sent a comment, so proxies don't close quiet streams
+	heartbeatPeriod = 15 * time.Second
+
+	// How long SSE clients should wait before reconnecting, in milliseconds
+	sseRetry = 5000
+
+	// Clients only send pongs and close messages, so anything bigger is a mistake
+	maxClientMessageSize = 512
+)
+
+// DroppedNotice
+// Sent before the next event when a subscriber's buffer overflowed, so it knows it missed some
+type DroppedNotice struct {
+	Type    string `json:"type"`
+	Dropped int    `json:"dropped"`
+}
+
+func newDroppedNotice(dropped int) DroppedNotice {
+	return DroppedNotice{Type: "dropped", Dropped: dropped}
+}
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// Anyone can already read the rest of the API cross-origin
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// ServeSSE
+// Streams events matching the filter as Server-Sent Events until the client leaves, or is disconnected for being too
+// slow. Each event is named after its type, with the JSON event as its data.
+func (h *Hub) ServeSSE(w http.ResponseWriter, r *http.Request, filter Filter) {
+	controller := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Stop nginx from holding events back
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	// Send the headers straight away, which also checks the response can be streamed at all
+	if err := controller.Flush(); err != nil {
+		util.ErrorJSON(w, errors.New("streaming is not supported"), http.StatusInternalServerError)
+		return
+	}
+
+	subscription := h.Subscribe(filter)
+	defer h.Unsubscribe(subscription)
+
+	if err := writeSSE(w, controller, fmt.Sprintf("retry: %d\n\n", sseRetry)); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(heartbeatPeriod)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-subscription.Done():
+			_ = writeSSE(w, controller, "event: error\ndata: {\"error\":\"client is too slow\"}\n\n")
+			return
+		case <-heartbeat.C:
+			if err := writeSSE(w, controller, ": ping\n\n"); err != nil {
+				return
+			}
+		case event := <-subscription.Events():
+			if dropped := subscription.TakeDropped(); dropped > 0 {
+				if err := writeSSEEvent(w, controller, "dropped", newDroppedNotice(dropped)); err != nil {
+					return
+				}
+			}
+
+			if err := writeSSEEvent(w, controller, string(event.Type), event); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func writeSSEEvent(w http.ResponseWriter, controller *http.ResponseController, name string, data any) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	return writeSSE(w, controller, fmt.Sprintf("event: %s\ndata: %s\n\n", name, body))
+}
+
+// writeSSE
+// Writes and flushes part of the stream. A client that can't take it within writeWait is treated as gone.
+func writeSSE(w http.ResponseWriter, controller *http.ResponseController, message string) error {
+	err := controller.SetWriteDeadline(time.Now().Add(writeWait))
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+
+	if _, err = w.Write([]byte(message)); err != nil {
+		return err
+	}
+
+	return controller.Flush()
+}
+
+// ServeWebsocket
+// Upgrades the request to a websocket and sends events matching the filter as JSON text messages until the client
+// leaves, or is disconnected for being too slow
+func (h *Hub) ServeWebsocket(w http.ResponseWriter, r *http.Request, filter Filter) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already responded with the error
+		log.Printf("failed to upgrade market stream: %s\n", err)
+		return
+	}
+
+	defer conn.Close()
+
+	subscription := h.Subscribe(filter)
+	defer h.Unsubscribe(subscription)
+
+	// Read until the client goes away, so pongs and close messages are handled
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+
+		conn.SetReadLimit(maxClientMessageSize)
+		_ = conn.SetReadDeadline(time.Now().Add(pongWait))
+		conn.SetPongHandler(
+			func(string) error {
+				return conn.SetReadDeadline(time.Now().Add(pongWait))
+			},
+		)
+
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-subscription.Done():
+			_ = conn.WriteControl(
+				websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "client is too slow"),
+				time.Now().Add(writeWait),
+			)
+			return
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				return
+			}
+		case event := <-subscription.Events():
+			if dropped := subscription.TakeDropped(); dropped > 0 {
+				if err := writeWebsocketJSON(conn, newDroppedNotice(dropped)); err != nil {
+					return
+				}
+			}
+
+			if err := writeWebsocketJSON(conn, event); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func writeWebsocketJSON(conn *websocket.Conn, data any) error {
+	if err := conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
+		return err
+	}
+
+	return conn.WriteJSON(data)
+}
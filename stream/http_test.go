@@ -0,0 +1,127 @@
+package stream
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitForSubscribers
+// Blocks until the handler has subscribed, so nothing published by the test is missed
+func waitForSubscribers(t *testing.T, hub *Hub, count int) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for hub.SubscriberCount() < count {
+		if time.Now().After(deadline) {
+			t.Fatalf("handler never subscribed")
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHub_ServeSSE(t *testing.T) {
+	hub := NewHub(map[int]int{1: 1, 2: 1})
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				hub.ServeSSE(w, r, Filter{WorldIds: idSet(2)})
+			},
+		),
+	)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("ServeSSE() Content-Type = %q, want text/event-stream", contentType)
+	}
+
+	waitForSubscribers(t, hub, 1)
+	hub.Publish(MarketEvent{Type: SalesAdded, ItemId: 1, WorldId: 1})
+	hub.Publish(
+		MarketEvent{Type: SalesAdded, ItemId: 2, WorldId: 2, Sales: []db.Sale{{ItemId: 2, PricePer: 100, Quantity: 1}}},
+	)
+
+	reader := bufio.NewReader(resp.Body)
+	lines := make([]string, 0)
+	for len(lines) < 2 || !strings.HasPrefix(lines[len(lines)-1], "data:") {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "retry:") {
+			lines = append(lines, line)
+		}
+	}
+
+	if lines[0] != "event: sales/add" {
+		t.Errorf("ServeSSE() sent %q, want the event named after its type", lines[0])
+	}
+
+	var event MarketEvent
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &event); err != nil {
+		t.Fatal(err)
+	}
+
+	if event.WorldId != 2 || event.ItemId != 2 || len(event.Sales) != 1 {
+		t.Errorf("ServeSSE() sent %+v, want only the sale on world 2", event)
+	}
+}
+
+func TestHub_ServeWebsocket(t *testing.T) {
+	hub := NewHub(map[int]int{1: 1})
+	server := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				hub.ServeWebsocket(w, r, Filter{ItemIds: idSet(5057)})
+			},
+		),
+	)
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	waitForSubscribers(t, hub, 1)
+	hub.Publish(MarketEvent{Type: ListingsAdded, ItemId: 1, WorldId: 1})
+	hub.Publish(MarketEvent{Type: ListingsRemoved, ItemId: 5057, WorldId: 1})
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	var event MarketEvent
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatal(err)
+	}
+
+	if event.Type != ListingsRemoved || event.ItemId != 5057 || event.DataCenterId != 1 {
+		t.Errorf("ServeWebsocket() sent %+v, want only the removed listings of item 5057", event)
+	}
+
+	// Leaving should end the subscription
+	_ = conn.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for hub.SubscriberCount() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("subscription was left open after the client left")
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+}
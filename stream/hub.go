@@ -0,0 +1,205 @@
+package stream
+
+import (
+	"github.com/level-5-pidgey/MarketMoogle/db"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultBufferSize is how many events a subscriber can fall behind by before new ones are dropped
+	DefaultBufferSize = 256
+	// DefaultMaxDropped is how many events a subscriber can miss in a row before it's disconnected for being too slow
+	DefaultMaxDropped = 1024
+)
+
+// EventType is what happened on the market
+type EventType string
+
+const (
+	ListingsAdded   EventType = "listings/add"
+	ListingsRemoved EventType = "listings/remove"
+	SalesAdded      EventType = "sales/add"
+)
+
+// MarketEvent
+// A change to an item's listings or sales on a world
+type MarketEvent struct {
+	Type         EventType    `json:"type"`
+	ItemId       int          `json:"item_id"`
+	WorldId      int          `json:"world_id"`
+	DataCenterId int          `json:"data_center_id"`
+	Listings     []db.Listing `json:"listings,omitempty"`
+	Sales        []db.Sale    `json:"sales,omitempty"`
+	Timestamp    time.Time    `json:"timestamp"`
+}
+
+// Filter
+// Which events a subscriber wants. Empty sets allow everything, so the zero filter gets every event.
+type Filter struct {
+	WorldIds      map[int]struct{}
+	DataCenterIds map[int]struct{}
+	ItemIds       map[int]struct{}
+}
+
+// Matches
+// Checks if an event is wanted. An event has to match every set that isn't empty.
+func (f Filter) Matches(event *MarketEvent) bool {
+	return matchesSet(f.WorldIds, event.WorldId) &&
+		matchesSet(f.DataCenterIds, event.DataCenterId) &&
+		matchesSet(f.ItemIds, event.ItemId)
+}
+
+func matchesSet(set map[int]struct{}, id int) bool {
+	if len(set) == 0 {
+		return true
+	}
+
+	_, ok := set[id]
+	return ok
+}
+
+// Subscription
+// A subscriber's stream of events. Events are buffered so a slow subscriber never holds up the market feed; once the
+// buffer is full new events are dropped and counted instead.
+type Subscription struct {
+	filter Filter
+	events chan *MarketEvent
+	done   chan struct{}
+	once   sync.Once
+
+	mutex sync.Mutex
+	// Events dropped since the subscriber last asked
+	dropped int
+	// Events dropped in a row, reset whenever one is delivered
+	droppedInARow int
+}
+
+// Events
+// The subscription's events, in the order they were published
+func (s *Subscription) Events() <-chan *MarketEvent {
+	return s.events
+}
+
+// Done
+// Closed once the subscription ends, either by unsubscribing or for falling too far behind
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// TakeDropped
+// How many events were dropped since this was last called
+func (s *Subscription) TakeDropped() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	dropped := s.dropped
+	s.dropped = 0
+
+	return dropped
+}
+
+func (s *Subscription) close() {
+	s.once.Do(
+		func() {
+			close(s.done)
+		},
+	)
+}
+
+// Hub
+// Fans market events out to every subscriber that wants them
+type Hub struct {
+	// The data center of each world, keyed by world id
+	worlds map[int]int
+	// How many events each subscriber can fall behind by
+	BufferSize int
+	// How many events a subscriber can miss in a row before it's disconnected
+	MaxDropped int
+
+	mutex       sync.RWMutex
+	subscribers map[*Subscription]struct{}
+}
+
+func NewHub(worlds map[int]int) *Hub {
+	return &Hub{
+		worlds:      worlds,
+		BufferSize:  DefaultBufferSize,
+		MaxDropped:  DefaultMaxDropped,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe
+// Starts a subscription to every event matching the filter. Unsubscribe must be called once it's no longer needed.
+func (h *Hub) Subscribe(filter Filter) *Subscription {
+	subscription := &Subscription{
+		filter: filter,
+		events: make(chan *MarketEvent, max(h.BufferSize, 1)),
+		done:   make(chan struct{}),
+	}
+
+	h.mutex.Lock()
+	h.subscribers[subscription] = struct{}{}
+	h.mutex.Unlock()
+
+	return subscription
+}
+
+// Unsubscribe
+// Stops sending events to a subscription and ends it
+func (h *Hub) Unsubscribe(subscription *Subscription) {
+	h.mutex.Lock()
+	delete(h.subscribers, subscription)
+	h.mutex.Unlock()
+
+	subscription.close()
+}
+
+// SubscriberCount
+// How many subscriptions are currently open
+func (h *Hub) SubscriberCount() int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	return len(h.subscribers)
+}
+
+// Publish
+// Sends an event to every subscriber that wants it, filling in its data center and timestamp. Publishing never blocks:
+// subscribers with a full buffer miss the event, and ones that have missed too many in a row are disconnected.
+func (h *Hub) Publish(event MarketEvent) {
+	event.DataCenterId = h.worlds[event.WorldId]
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+
+	tooSlow := make([]*Subscription, 0)
+
+	h.mutex.RLock()
+	for subscription := range h.subscribers {
+		if !subscription.filter.Matches(&event) {
+			continue
+		}
+
+		select {
+		case subscription.events <- &event:
+			subscription.mutex.Lock()
+			subscription.droppedInARow = 0
+			subscription.mutex.Unlock()
+		default:
+			subscription.mutex.Lock()
+			subscription.dropped++
+			subscription.droppedInARow++
+			if subscription.droppedInARow >= h.MaxDropped {
+				tooSlow = append(tooSlow, subscription)
+			}
+			subscription.mutex.Unlock()
+		}
+	}
+	h.mutex.RUnlock()
+
+	for _, subscription := range tooSlow {
+		h.Unsubscribe(subscription)
+	}
+}
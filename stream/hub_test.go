@@ -0,0 +1,129 @@
+package stream
+
+import (
+	"testing"
+)
+
+func idSet(ids ...int) map[int]struct{} {
+	set := make(map[int]struct{}, len(ids))
+	for _, id := range ids {
+		set[id] = struct{}{}
+	}
+
+	return set
+}
+
+func TestFilter_Matches(t *testing.T) {
+	event := &MarketEvent{Type: ListingsAdded, ItemId: 5057, WorldId: 63, DataCenterId: 8}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{
+			name:   "Empty filter matches everything",
+			filter: Filter{},
+			want:   true,
+		},
+		{
+			name:   "Matching world",
+			filter: Filter{WorldIds: idSet(63, 64)},
+			want:   true,
+		},
+		{
+			name:   "Other world",
+			filter: Filter{WorldIds: idSet(64)},
+			want:   false,
+		},
+		{
+			name:   "Matching data center and item",
+			filter: Filter{DataCenterIds: idSet(8), ItemIds: idSet(5057)},
+			want:   true,
+		},
+		{
+			name:   "Matching data center but other item",
+			filter: Filter{DataCenterIds: idSet(8), ItemIds: idSet(5058)},
+			want:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if got := tt.filter.Matches(event); got != tt.want {
+					t.Errorf("Matches() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestHub_Publish(t *testing.T) {
+	hub := NewHub(map[int]int{63: 8, 79: 4})
+
+	everything := hub.Subscribe(Filter{})
+	lightDc := hub.Subscribe(Filter{DataCenterIds: idSet(8)})
+	defer hub.Unsubscribe(everything)
+	defer hub.Unsubscribe(lightDc)
+
+	hub.Publish(MarketEvent{Type: SalesAdded, ItemId: 1, WorldId: 63})
+	hub.Publish(MarketEvent{Type: SalesAdded, ItemId: 2, WorldId: 79})
+
+	if got := len(everything.Events()); got != 2 {
+		t.Errorf("unfiltered subscription got %d events, want 2", got)
+	}
+
+	if got := len(lightDc.Events()); got != 1 {
+		t.Fatalf("data center subscription got %d events, want 1", got)
+	}
+
+	event := <-lightDc.Events()
+	if event.ItemId != 1 || event.DataCenterId != 8 || event.Timestamp.IsZero() {
+		t.Errorf("Publish() sent %+v, want item 1 with its data center and timestamp filled in", event)
+	}
+}
+
+func TestHub_PublishToSlowSubscriber(t *testing.T) {
+	hub := NewHub(map[int]int{1: 1})
+	hub.BufferSize = 2
+	hub.MaxDropped = 3
+
+	subscription := hub.Subscribe(Filter{})
+
+	// Fills the buffer, then drops two
+	for itemId := 1; itemId <= 4; itemId++ {
+		hub.Publish(MarketEvent{Type: ListingsAdded, ItemId: itemId, WorldId: 1})
+	}
+
+	if got := subscription.TakeDropped(); got != 2 {
+		t.Errorf("TakeDropped() = %d, want 2", got)
+	}
+
+	if got := subscription.TakeDropped(); got != 0 {
+		t.Errorf("TakeDropped() = %d after taking them, want 0", got)
+	}
+
+	// Catching up resets the count of events missed in a row
+	<-subscription.Events()
+	hub.Publish(MarketEvent{Type: ListingsAdded, ItemId: 5, WorldId: 1})
+	hub.Publish(MarketEvent{Type: ListingsAdded, ItemId: 6, WorldId: 1})
+	hub.Publish(MarketEvent{Type: ListingsAdded, ItemId: 7, WorldId: 1})
+
+	select {
+	case <-subscription.Done():
+		t.Fatalf("subscription was closed before missing %d events in a row", hub.MaxDropped)
+	default:
+	}
+
+	hub.Publish(MarketEvent{Type: ListingsAdded, ItemId: 8, WorldId: 1})
+
+	select {
+	case <-subscription.Done():
+	default:
+		t.Fatalf("subscription was left open after missing %d events in a row", hub.MaxDropped)
+	}
+
+	if got := hub.SubscriberCount(); got != 0 {
+		t.Errorf("SubscriberCount() = %d, want the slow subscriber removed", got)
+	}
+}
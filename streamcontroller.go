@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"github.com/level-5-pidgey/MarketMoogle/api/universalis"
+	"github.com/level-5-pidgey/MarketMoogle/stream"
+	"github.com/level-5-pidgey/MarketMoogle/util"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// readStreamFilter
+// Builds the market stream filter from the worlds, dataCenters and items query params. Each is a comma separated list,
+// and worlds and data centers can be given by name or id, e.g. ?worlds=gilgamesh,ravana&items=5057
+func (c Controller) readStreamFilter(r *http.Request) (stream.Filter, error) {
+	query := r.URL.Query()
+	filter := stream.Filter{
+		WorldIds:      make(map[int]struct{}),
+		DataCenterIds: make(map[int]struct{}),
+		ItemIds:       make(map[int]struct{}),
+	}
+
+	for _, param := range splitQueryList(query.Get("worlds")) {
+		worldId, ok := c.findWorldId(param)
+		if !ok {
+			return filter, fmt.Errorf("invalid world %q", param)
+		}
+
+		filter.WorldIds[worldId] = struct{}{}
+	}
+
+	for _, param := range splitQueryList(query.Get("dataCenters")) {
+		dcId, ok := c.findDataCenterId(param)
+		if !ok {
+			return filter, fmt.Errorf("invalid data center %q", param)
+		}
+
+		filter.DataCenterIds[dcId] = struct{}{}
+	}
+
+	for _, param := range splitQueryList(query.Get("items")) {
+		itemId, err := strconv.Atoi(param)
+		if err != nil {
+			return filter, fmt.Errorf("invalid item id %q", param)
+		}
+
+		filter.ItemIds[itemId] = struct{}{}
+	}
+
+	return filter, nil
+}
+
+func splitQueryList(param string) []string {
+	values := make([]string, 0)
+	for _, value := range strings.Split(param, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+func (c Controller) findWorldId(param string) (int, bool) {
+	for _, world := range *c.worlds {
+		if strconv.Itoa(world.Id) == param || strings.EqualFold(world.Name, param) {
+			return world.Id, true
+		}
+	}
+
+	return 0, false
+}
+
+func (c Controller) findDataCenterId(param string) (int, bool) {
+	for _, world := range *c.worlds {
+		if strconv.Itoa(world.DataCenterId) == param || strings.EqualFold(world.DataCenterName, param) {
+			return world.DataCenterId, true
+		}
+	}
+
+	return 0, false
+}
+
+// StreamMarketEvents
+// Streams listing and sale changes as they come in from Universalis over Server-Sent Events
+func (c Controller) StreamMarketEvents(w http.ResponseWriter, r *http.Request) {
+	filter, err := c.readStreamFilter(r)
+	if err != nil {
+		util.ErrorJSON(w, err)
+		return
+	}
+
+	c.marketStream.ServeSSE(w, r, filter)
+}
+
+// StreamMarketEventsWebsocket
+// Streams listing and sale changes as they come in from Universalis over a websocket
+func (c Controller) StreamMarketEventsWebsocket(w http.ResponseWriter, r *http.Request) {
+	filter, err := c.readStreamFilter(r)
+	if err != nil {
+		util.ErrorJSON(w, err)
+		return
+	}
+
+	c.marketStream.ServeWebsocket(w, r, filter)
+}
+
+// MarketFeedStatus
+// The health of every websocket connection to Universalis
+type MarketFeedStatus struct {
+	Connected int                            `json:"connected"`
+	Total     int                            `json:"total"`
+	Feeds     []universalis.ConnectionStatus `json:"feeds"`
+}
+
+// GetMarketFeedStatus
+// Reports how each Universalis connection is doing. Responds with 503 if none are connected, so it can be used as a
+// health check.
+func (c Controller) GetMarketFeedStatus(w http.ResponseWriter, r *http.Request) {
+	feeds := c.marketFeeds.Status()
+	status := MarketFeedStatus{
+		Total: len(feeds),
+		Feeds: feeds,
+	}
+
+	for _, feed := range feeds {
+		if feed.State == universalis.StateConnected {
+			status.Connected++
+		}
+	}
+
+	statusCode := http.StatusOK
+	if status.Connected == 0 {
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	_ = util.WriteJSON(w, statusCode, status)
+}